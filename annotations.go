@@ -0,0 +1,46 @@
+package lxcri
+
+// Annotations (specs.Spec.Annotations) evaluated by the runtime.
+const (
+	// AnnotationProcOptions are additional mount options (comma separated)
+	// for the container /proc mount e.g `hidepid=2,subset=pid`.
+	// See ContainerConfig.ProcMountOptions.
+	AnnotationProcOptions = "lxcri.proc-options"
+
+	// AnnotationBestEffortHooks are the paths (comma separated) of the OCI hooks
+	// whose failure does not abort the container creation or start.
+	// Failed best-effort hooks are logged and reported as warning.
+	// See Runtime.BestEffortHooks.
+	AnnotationBestEffortHooks = "lxcri.best-effort-hooks"
+
+	// AnnotationCPUSet is the list of CPUs (e.g `2-5`) that are allocated exclusively
+	// by the container. The CPUs must be in the Runtime.CPUPool, if it is set.
+	// The allocated CPUs are not used by the other containers in the runtime root.
+	AnnotationCPUSet = "lxcri.cpuset"
+
+	// AnnotationCPUSetCount is the number of CPUs to allocate exclusively
+	// from the Runtime.CPUPool for the container.
+	AnnotationCPUSetCount = "lxcri.cpuset-count"
+
+	// AnnotationHugepages are hugetlbfs mounts (comma separated) in the format
+	// `<pagesize>:<path>[:<size>]` e.g `2MB:/dev/hugepages:1GB`.
+	// See ContainerConfig.HugepageMounts.
+	AnnotationHugepages = "lxcri.hugepages"
+
+	// AnnotationCPUBurst is the CPU bandwidth burst in microseconds (cgroup2 `cpu.max.burst`)
+	// that allows the container to exceed its CPU quota briefly.
+	// The burst can also be set through the unified cgroup2 property `cpu.max.burst`.
+	AnnotationCPUBurst = "lxcri.cpu-burst"
+
+	// AnnotationCoreScheduling enables core scheduling for the container if set to `true`.
+	// See ContainerConfig.CoreScheduling.
+	AnnotationCoreScheduling = "lxcri.core-scheduling"
+
+	// AnnotationMemoryLock enables memory locking for the container if set to `true`.
+	// See ContainerConfig.MemoryLock.
+	AnnotationMemoryLock = "lxcri.memory-lock"
+
+	// AnnotationNoSwap excludes the container memory from swap if set to `true`.
+	// See ContainerConfig.NoSwap.
+	AnnotationNoSwap = "lxcri.no-swap"
+)
@@ -0,0 +1,144 @@
+package lxcri
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// archInfo maps a seccomp architecture to the kernel architecture name
+// (`uname -m`) and the ELF machine type of executables for the architecture.
+type archInfo struct {
+	seccomp specs.Arch
+	name    string
+	machine elf.Machine
+}
+
+var archInfos = []archInfo{
+	{specs.ArchX86_64, "x86_64", elf.EM_X86_64},
+	{specs.ArchX86, "i686", elf.EM_386},
+	{specs.ArchAARCH64, "aarch64", elf.EM_AARCH64},
+	{specs.ArchARM, "armv7l", elf.EM_ARM},
+	{specs.ArchPPC64LE, "ppc64le", elf.EM_PPC64},
+	{specs.ArchPPC64, "ppc64", elf.EM_PPC64},
+	{specs.ArchS390X, "s390x", elf.EM_S390},
+	{specs.ArchMIPS64, "mips64", elf.EM_MIPS},
+	{specs.ArchMIPSEL64, "mips64el", elf.EM_MIPS},
+	{specs.Arch("SCMP_ARCH_RISCV64"), "riscv64", elf.EM_RISCV},
+}
+
+func lookupArch(name string) *archInfo {
+	switch name {
+	case "i386", "i486", "i586":
+		name = "i686"
+	case "armv6l", "armv8l":
+		name = "armv7l"
+	}
+	for i := range archInfos {
+		if archInfos[i].name == name {
+			return &archInfos[i]
+		}
+	}
+	return nil
+}
+
+func lookupSeccompArch(a specs.Arch) *archInfo {
+	for i := range archInfos {
+		if archInfos[i].seccomp == a {
+			return &archInfos[i]
+		}
+	}
+	return nil
+}
+
+func hostArch() (string, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return "", err
+	}
+	return nullTerminatedString(uts.Machine[:]), nil
+}
+
+// containerArch returns the architecture of the container process.
+// The OCI runtime spec has no explicit container architecture,
+// so it is derived from the seccomp architectures.
+// The host architecture is returned if the seccomp architectures
+// are undefined or contain the host architecture.
+// Otherwise the first seccomp architecture is the container architecture.
+func containerArch(spec *specs.Spec, host string) string {
+	if spec.Linux == nil || spec.Linux.Seccomp == nil || len(spec.Linux.Seccomp.Architectures) == 0 {
+		return host
+	}
+	hostInfo := lookupArch(host)
+	var first *archInfo
+	for _, a := range spec.Linux.Seccomp.Architectures {
+		info := lookupSeccompArch(a)
+		if info == nil {
+			continue
+		}
+		if info == hostInfo {
+			return host
+		}
+		if first == nil {
+			first = info
+		}
+	}
+	if first == nil {
+		return host
+	}
+	return first.name
+}
+
+// libexecArch returns the path to the runtime executable for the given architecture.
+// An executable with the architecture as suffix (e.g lxcri-init.aarch64)
+// takes precedence over the executable without suffix.
+func (rt *Runtime) libexecArch(name string, arch string) string {
+	p := rt.libexec(name + "." + arch)
+	if _, err := os.Stat(p); err == nil {
+		return p
+	}
+	return rt.libexec(name)
+}
+
+// checkELFMachine checks that the given ELF executable is built for arch.
+func checkELFMachine(filename string, arch string) error {
+	info := lookupArch(arch)
+	if info == nil {
+		return fmt.Errorf("unsupported architecture %q", arch)
+	}
+	f, err := elf.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if f.Machine != info.machine {
+		return fmt.Errorf("%s is built for %s but architecture %s requires %s", filename,
+			strings.TrimPrefix(f.Machine.String(), "EM_"), arch, strings.TrimPrefix(info.machine.String(), "EM_"))
+	}
+	return nil
+}
+
+// resolveInit returns the lxcri-init executable for the container architecture.
+// The host kernel executes a static lxcri-init for the host architecture
+// in a container for a foreign architecture (e.g with binfmt_misc emulation),
+// so an architecture specific lxcri-init is optional.
+func (rt *Runtime) resolveInit(c *Container) (string, error) {
+	host, err := hostArch()
+	if err != nil {
+		return "", err
+	}
+	arch := containerArch(c.Spec, host)
+	p := rt.libexecArch(ExecInit, arch)
+	if p == rt.libexec(ExecInit) && arch != host {
+		c.warnf("InitArchMismatch", "no %s for container architecture %s - using %s for host architecture %s", ExecInit, arch, p, host)
+		arch = host
+	}
+	if err := checkELFMachine(p, arch); err != nil {
+		return "", err
+	}
+	return p, nil
+}
@@ -0,0 +1,42 @@
+package lxcri
+
+import (
+	"os"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerArch(t *testing.T) {
+	spec := &specs.Spec{Linux: &specs.Linux{}}
+	require.Equal(t, "x86_64", containerArch(spec, "x86_64"))
+
+	spec.Linux.Seccomp = &specs.LinuxSeccomp{
+		Architectures: []specs.Arch{specs.ArchX86_64, specs.ArchX86, specs.ArchX32},
+	}
+	require.Equal(t, "x86_64", containerArch(spec, "x86_64"))
+
+	spec.Linux.Seccomp.Architectures = []specs.Arch{specs.ArchAARCH64, specs.ArchARM}
+	require.Equal(t, "aarch64", containerArch(spec, "x86_64"))
+	require.Equal(t, "armv7l", containerArch(spec, "armv7l"))
+	require.Equal(t, "armv6l", containerArch(spec, "armv6l"))
+
+	spec.Linux.Seccomp.Architectures = []specs.Arch{specs.ArchPARISC}
+	require.Equal(t, "x86_64", containerArch(spec, "x86_64"))
+}
+
+func TestCheckELFMachine(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	arch, err := hostArch()
+	require.NoError(t, err)
+	require.NoError(t, checkELFMachine(exe, arch))
+
+	other := "aarch64"
+	if arch == other {
+		other = "x86_64"
+	}
+	require.Error(t, checkELFMachine(exe, other))
+	require.Error(t, checkELFMachine(exe, "unknown"))
+}
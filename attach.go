@@ -0,0 +1,198 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// AttachOptions are the streams of Container.Attach.
+type AttachOptions struct {
+	// Stdin is copied to the terminal. It is optional.
+	Stdin io.Reader
+	// Stdout receives the terminal output. It is optional.
+	Stdout io.Writer
+	// Console is the pseudo terminal master of the container process,
+	// received over the console socket (see ConsoleSocket).
+	// It must be in non-blocking mode, otherwise Attach can not be interrupted.
+	// If Console is nil, the liblxc console of the container is used,
+	// which requires a process terminal (specs.Process.Terminal)
+	// and no ContainerConfig.ConsoleSocket.
+	Console *os.File
+	// TTY is the liblxc tty number to attach to, if Console is nil.
+	// Zero is the container console.
+	TTY int
+	// Resize receives the terminal size changes, e.g of the client window.
+	// It is optional.
+	Resize <-chan TerminalSize
+}
+
+// Attach copies the terminal output of the container to opts.Stdout,
+// and opts.Stdin to the terminal. It returns when the terminal is closed,
+// e.g because the container process exited, or when ctx is done.
+// A read from opts.Stdin that blocks is not interrupted when Attach returns.
+func (c *Container) Attach(ctx context.Context, opts AttachOptions) error {
+	console := opts.Console
+	if console == nil {
+		fd, err := c.linuxContainer.ConsoleFd(opts.TTY)
+		if err != nil {
+			return fmt.Errorf("failed to get console of tty %d: %w", opts.TTY, err)
+		}
+		// A non-blocking file is registered with the runtime poller,
+		// so that blocking reads can be interrupted with a deadline.
+		if err := unix.SetNonblock(fd, true); err != nil {
+			unix.Close(fd)
+			return err
+		}
+		console = os.NewFile(uintptr(fd), "console")
+		defer console.Close()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				// Unblock the output copy.
+				if err := console.SetReadDeadline(time.Now()); err != nil {
+					c.Log.Debug().Msgf("failed to set console deadline: %s", err)
+				}
+				return
+			case size, ok := <-opts.Resize:
+				if !ok {
+					opts.Resize = nil
+					continue
+				}
+				if err := resizeFile(console, size); err != nil {
+					c.Log.Warn().Msgf("failed to resize console: %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if opts.Stdin != nil {
+		go func() {
+			_, err := io.Copy(console, opts.Stdin)
+			if err != nil && !isTerminalClosed(err) {
+				c.Log.Debug().Msgf("failed to copy stdin to console: %s", err)
+			}
+		}()
+	}
+
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	_, err := io.Copy(stdout, console)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil && !isTerminalClosed(err) {
+		return fmt.Errorf("failed to copy console output: %w", err)
+	}
+	return nil
+}
+
+// isTerminalClosed returns true if the error indicates that the terminal is closed.
+// Reading the pseudo terminal master returns EIO if all slave file descriptors are closed.
+func isTerminalClosed(err error) bool {
+	return errors.Is(err, unix.EIO) || errors.Is(err, os.ErrClosed)
+}
+
+// ConsoleSocket is a unix socket that receives the pseudo terminal master
+// of a container process created with a ContainerConfig.ConsoleSocket.
+// It is the receiving end of the console socket protocol used by conmon.
+type ConsoleSocket struct {
+	// Path is the socket path to set as ContainerConfig.ConsoleSocket.
+	Path string
+	l    *net.UnixListener
+}
+
+// NewConsoleSocket listens on a new unix socket at path.
+func NewConsoleSocket(path string) (*ConsoleSocket, error) {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on console socket: %w", err)
+	}
+	return &ConsoleSocket{Path: path, l: l}, nil
+}
+
+// Receive accepts a single connection and returns the received pseudo terminal master.
+// It blocks until the runtime sends the terminal or ctx is done.
+func (s *ConsoleSocket) Receive(ctx context.Context) (*os.File, error) {
+	deadline, _ := ctx.Deadline()
+	if err := s.l.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// Unblock the accept if ctx has no deadline.
+			_ = s.l.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	conn, err := s.l.AcceptUnix()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to accept console connection: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive console: %w", err)
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse console message: %w", err)
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("expected a single console message but got %d", len(msgs))
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse console file descriptor: %w", err)
+	}
+	if len(fds) != 1 {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+		return nil, fmt.Errorf("expected a single console file descriptor but got %d", len(fds))
+	}
+	if err := unix.SetNonblock(fds[0], true); err != nil {
+		unix.Close(fds[0])
+		return nil, err
+	}
+	return os.NewFile(uintptr(fds[0]), "console"), nil
+}
+
+// Close closes the socket and removes the socket file.
+func (s *ConsoleSocket) Close() error {
+	return s.l.Close()
+}
@@ -0,0 +1,93 @@
+package lxcri
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestConsoleSocket(t *testing.T) {
+	s, err := NewConsoleSocket(filepath.Join(t.TempDir(), "console.sock"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	ptmx, tty, err := pty.Open()
+	require.NoError(t, err)
+	defer ptmx.Close()
+	defer tty.Close()
+
+	go func() {
+		conn, err := net.Dial("unix", s.Path)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		f, err := conn.(*net.UnixConn).File()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		_ = unix.Sendmsg(int(f.Fd()), []byte("terminal"), unix.UnixRights(int(ptmx.Fd())), nil, 0)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	console, err := s.Receive(ctx)
+	require.NoError(t, err)
+	defer console.Close()
+
+	var out bytes.Buffer
+	attached := make(chan error, 1)
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	go func() {
+		attached <- c.Attach(ctx, AttachOptions{Console: console, Stdout: &out})
+	}()
+	_, err = tty.Write([]byte("hello"))
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 50)
+	// Closing the terminal ends the attach.
+	require.NoError(t, tty.Close())
+	require.NoError(t, <-attached)
+	require.Equal(t, "hello", out.String())
+}
+
+func TestConsoleSocketCanceled(t *testing.T) {
+	s, err := NewConsoleSocket(filepath.Join(t.TempDir(), "console.sock"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// A canceled context without a deadline unblocks the accept.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+	_, err = s.Receive(ctx)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestAttachCanceled(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	require.NoError(t, err)
+	defer ptmx.Close()
+	defer tty.Close()
+	// The console must be non-blocking to interrupt the attach.
+	fd, err := unix.Dup(int(ptmx.Fd()))
+	require.NoError(t, err)
+	require.NoError(t, unix.SetNonblock(fd, true))
+	console := os.NewFile(uintptr(fd), "console")
+	defer console.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	require.Equal(t, context.DeadlineExceeded, c.Attach(ctx, AttachOptions{Console: console}))
+}
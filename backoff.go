@@ -0,0 +1,70 @@
+package lxcri
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Backoff configures the intervals between polls while the runtime waits
+// for a state change, e.g for the container init process to be created.
+// The interval starts at InitialInterval and is multiplied by Factor after each poll,
+// until MaxInterval is reached. Each interval is randomized by +/- Jitter * interval,
+// so that concurrent runtime invocations do not poll in lockstep.
+type Backoff struct {
+	// InitialInterval is the first poll interval in milliseconds.
+	InitialInterval uint `json:",omitempty"`
+	// MaxInterval is the maximum poll interval in milliseconds.
+	MaxInterval uint `json:",omitempty"`
+	// Factor is the multiplier for the poll interval after each poll.
+	// A Factor <= 1 disables the backoff.
+	Factor float64 `json:",omitempty"`
+	// Jitter is the randomization factor in the range [0,1].
+	Jitter float64 `json:",omitempty"`
+}
+
+// backoffTimer implements the waits for a single poll loop.
+type backoffTimer struct {
+	Backoff
+	interval time.Duration
+}
+
+func (b Backoff) timer() *backoffTimer {
+	t := &backoffTimer{Backoff: b}
+	t.interval = time.Duration(b.InitialInterval) * time.Millisecond
+	if t.interval <= 0 {
+		t.interval = time.Millisecond
+	}
+	return t
+}
+
+// next returns the next (randomized) poll interval and increases the interval.
+func (t *backoffTimer) next() time.Duration {
+	d := t.interval
+	if t.Jitter > 0 {
+		delta := t.Jitter * float64(d)
+		// #nosec
+		d = time.Duration(float64(d) - delta + rand.Float64()*2*delta)
+	}
+
+	max := time.Duration(t.MaxInterval) * time.Millisecond
+	if t.Factor > 1 {
+		t.interval = time.Duration(float64(t.interval) * t.Factor)
+	}
+	if max > 0 && t.interval > max {
+		t.interval = max
+	}
+	return d
+}
+
+// wait blocks for the next poll interval or until the context is done.
+func (t *backoffTimer) wait(ctx context.Context) error {
+	timer := time.NewTimer(t.next())
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
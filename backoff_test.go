@@ -0,0 +1,41 @@
+package lxcri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{InitialInterval: 10, MaxInterval: 100, Factor: 2}
+	timer := b.timer()
+	var intervals []time.Duration
+	for i := 0; i < 6; i++ {
+		intervals = append(intervals, timer.next())
+	}
+	ms := time.Millisecond
+	require.Equal(t, []time.Duration{10 * ms, 20 * ms, 40 * ms, 80 * ms, 100 * ms, 100 * ms}, intervals)
+
+	// constant interval
+	b = Backoff{InitialInterval: 10}
+	timer = b.timer()
+	require.Equal(t, 10*ms, timer.next())
+	require.Equal(t, 10*ms, timer.next())
+
+	// jitter
+	b = Backoff{InitialInterval: 100, Jitter: 0.5}
+	timer = b.timer()
+	for i := 0; i < 100; i++ {
+		d := timer.next()
+		require.True(t, d >= 50*ms && d <= 150*ms, "interval %s out of range", d)
+	}
+}
+
+func TestBackoffWaitCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := Backoff{InitialInterval: 10000}
+	require.Equal(t, context.Canceled, b.timer().wait(ctx))
+}
@@ -0,0 +1,46 @@
+package lxcri
+
+import (
+	"runtime"
+
+	"github.com/lxc/go-lxc"
+)
+
+// Build metadata injected by the linker, e.g
+// `-ldflags '-X github.com/lxc/lxcri.version=v0.12.1'` (see Makefile).
+var (
+	version   = "undefined"
+	gitCommit = ""
+	buildDate = ""
+)
+
+// VersionInfo identifies the runtime build.
+type VersionInfo struct {
+	// Version is the release version e.g output of `git describe`.
+	Version string
+	// GitCommit is the git commit hash the runtime was built from.
+	GitCommit string `json:",omitempty"`
+	// BuildDate is the build date in RFC3339 format.
+	BuildDate string `json:",omitempty"`
+	// GoVersion is the go version used to build the runtime.
+	GoVersion string
+	// LXCVersion is the version of the loaded liblxc library.
+	LXCVersion string
+	// Features are the optional features enabled at build time.
+	Features []string `json:",omitempty"`
+}
+
+// BuildInfo returns the build metadata of the runtime.
+func BuildInfo() VersionInfo {
+	info := VersionInfo{
+		Version:    version,
+		GitCommit:  gitCommit,
+		BuildDate:  buildDate,
+		GoVersion:  runtime.Version(),
+		LXCVersion: lxc.Version(),
+	}
+	if HasEmbeddedLibexec() {
+		info.Features = append(info.Features, "embed")
+	}
+	return info
+}
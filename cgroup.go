@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -17,13 +16,16 @@ import (
 var cgroupRoot = "/sys/fs/cgroup"
 
 // liblxc itself does cgroup root detection in cgfsng
+// The detection is skipped if Runtime.CgroupRoot is set.
 func detectCgroupRoot(rt *Runtime) (string, error) {
-	var cgroupRoot string
-	if err := isFilesystem("/sys/fs/cgroup", "cgroup2"); err == nil {
-		cgroupRoot = "/sys/fs/cgroup"
-	}
-	if err := isFilesystem("/sys/fs/cgroup/unified", "cgroup2"); err == nil {
-		cgroupRoot = "/sys/fs/cgroup/unified"
+	cgroupRoot := rt.CgroupRoot
+	if cgroupRoot == "" {
+		if err := isFilesystem("/sys/fs/cgroup", "cgroup2"); err == nil {
+			cgroupRoot = "/sys/fs/cgroup"
+		}
+		if err := isFilesystem("/sys/fs/cgroup/unified", "cgroup2"); err == nil {
+			cgroupRoot = "/sys/fs/cgroup/unified"
+		}
 	}
 
 	if rt.isPrivileged() {
@@ -69,7 +71,6 @@ func checkCgroup(c *Container) error {
 }
 
 // https://github.com/opencontainers/runtime-spec/blob/v1.0.2/config-linux.md
-// TODO New spec will contain a property Unified for cgroupv2 properties
 // https://github.com/opencontainers/runtime-spec/blob/master/config-linux.md#unified
 func configureCgroup(rt *Runtime, c *Container) error {
 	if err := configureCgroupPath(rt, c); err != nil {
@@ -80,44 +81,104 @@ func configureCgroup(rt *Runtime, c *Container) error {
 		return err
 	}
 
+	// The controllers are unknown if cgroup.controllers does not exist.
+	controllers, err := cgroupControllers(filepath.Join(cgroupRoot, c.CgroupDir))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to detect cgroup controllers: %w", err)
+	}
+	c.cgroupControllers = controllers
+
 	if devices := c.Spec.Linux.Resources.Devices; devices != nil {
 		if rt.Features.CgroupDevices {
 			if err := configureDeviceController(c); err != nil {
 				return err
 			}
 		} else {
-			c.Log.Warn().Msg("cgroup device controller feature is disabled - access to all devices is granted")
+			c.warnf("CgroupDevicesDisabled", "cgroup device controller feature is disabled - access to all devices is granted")
 		}
 
 	}
 
 	if mem := c.Spec.Linux.Resources.Memory; mem != nil {
-		c.Log.Debug().Msg("TODO cgroup memory controller not implemented")
+		if err := configureMemoryController(c, mem); err != nil {
+			return err
+		}
 	}
 
 	if cpu := c.Spec.Linux.Resources.CPU; cpu != nil {
-		if err := configureCPUController(rt, cpu); err != nil {
+		if err := configureCPUController(c, cpu); err != nil {
+			return err
+		}
+		if err := configureCPURealtime(rt, c, cpu); err != nil {
 			return err
 		}
 	}
+	if err := configureCPUBurst(c); err != nil {
+		return err
+	}
 
 	if pids := c.Spec.Linux.Resources.Pids; pids != nil {
-		if err := c.setConfigItem("lxc.cgroup2.pids.max", fmt.Sprintf("%d", pids.Limit)); err != nil {
+		if err := c.setCgroupItem("pids.max", pidsLimit(pids.Limit)); err != nil {
 			return err
 		}
 	}
 	if blockio := c.Spec.Linux.Resources.BlockIO; blockio != nil {
-		c.Log.Debug().Msg("TODO cgroup blockio controller not implemented")
+		if err := configureIOController(c, blockio); err != nil {
+			return err
+		}
 	}
 
-	if hugetlb := c.Spec.Linux.Resources.HugepageLimits; hugetlb != nil {
-		// set Hugetlb limit (in bytes)
-		c.Log.Debug().Msg("TODO cgroup hugetlb controller not implemented")
+	if hugetlb := c.Spec.Linux.Resources.HugepageLimits; len(hugetlb) > 0 {
+		if err := configureHugetlbController(c, hugetlb); err != nil {
+			return err
+		}
 	}
 	if net := c.Spec.Linux.Resources.Network; net != nil {
-		c.Log.Debug().Msg("TODO cgroup network controller not implemented")
+		c.warnf("ResourceIgnored", "network resource limits are not supported and ignored")
 	}
-	return nil
+	return configureUnified(c)
+}
+
+// cgroupControllers returns the controllers available for the given cgroup directory.
+// They are read from cgroup.controllers of the directory, or of the nearest ancestor
+// if the directory does not exist yet. On hosts with partial delegation
+// (e.g to an unprivileged user) only some controllers are available.
+func cgroupControllers(dir string) (map[string]bool, error) {
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+		if err == nil {
+			controllers := make(map[string]bool)
+			for _, name := range strings.Fields(string(data)) {
+				controllers[name] = true
+			}
+			return controllers, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || !strings.HasPrefix(parent, cgroupRoot) {
+			return nil, err
+		}
+		dir = parent
+	}
+}
+
+// setCgroupItem sets the cgroup2 interface file (e.g `pids.max`) for the container cgroup.
+// The setting is ignored with a warning if the controller is not available,
+// instead of failing the container start.
+func (c *Container) setCgroupItem(key string, value string) error {
+	if controller := strings.SplitN(key, ".", 2)[0]; !c.hasCgroupController(controller) {
+		c.warnf("CgroupControllerUnavailable", "cgroup controller %q is not available - %s=%s is ignored", controller, key, value)
+		return nil
+	}
+	return c.setConfigItem("lxc.cgroup2."+key, value)
+}
+
+// hasCgroupController returns true if the controller is available,
+// or if the available controllers are unknown.
+func (c *Container) hasCgroupController(controller string) bool {
+	return controller == "cgroup" || c.cgroupControllers == nil || c.cgroupControllers[controller]
 }
 
 func configureCgroupPath(rt *Runtime, c *Container) error {
@@ -169,6 +230,17 @@ func configureCgroupPath(rt *Runtime, c *Container) error {
 }
 
 func configureDeviceController(c *Container) error {
+	// The device filter program is attached to the container cgroup
+	// when the container is created (see Runtime.configureDeviceFilter).
+	// Generate it here to reject invalid rules early.
+	rules := deviceFilterRules(c.Spec.Linux.Resources.Devices)
+	if _, err := deviceFilter(rules); err != nil {
+		return err
+	}
+
+	// The liblxc device rules are applied before the container process runs,
+	// also when the container is restored from a checkpoint,
+	// and restrict device access until the device filter is attached.
 	devicesAllow := "lxc.cgroup2.devices.allow"
 	devicesDeny := "lxc.cgroup2.devices.deny"
 
@@ -182,7 +254,7 @@ func configureDeviceController(c *Container) error {
 	blockDevice := "b"
 	charDevice := "c"
 
-	for _, dev := range c.Spec.Linux.Resources.Devices {
+	for _, dev := range rules {
 		key := devicesDeny
 		if dev.Allow {
 			key = devicesAllow
@@ -225,46 +297,128 @@ func configureDeviceController(c *Container) error {
 	return nil
 }
 
-func configureCPUController(clxc *Runtime, slinux *specs.LinuxCPU) error {
-	// CPU resource restriction configuration
-	// use strconv.FormatUint(n, 10) instead of fmt.Sprintf ?
-	clxc.Log.Debug().Msg("TODO configure cgroup cpu controller")
-	/*
-		if cpu.Shares != nil && *cpu.Shares > 0 {
-				if err := clxc.setConfigItem("lxc.cgroup2.cpu.shares", fmt.Sprintf("%d", *cpu.Shares)); err != nil {
-					return err
-				}
-		}
-		if cpu.Quota != nil && *cpu.Quota > 0 {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpu.cfs_quota_us", fmt.Sprintf("%d", *cpu.Quota)); err != nil {
-				return err
-			}
+// configureIOController sets the block IO weights and throttle limits.
+// The container cgroup does not exist yet, so the BFQ weight (io.bfq.weight)
+// is used if it is available in the parent cgroup.
+func configureIOController(c *Container, blkio *specs.LinuxBlockIO) error {
+	leafWeight := blkio.LeafWeight != nil
+	for _, dev := range blkio.WeightDevice {
+		leafWeight = leafWeight || dev.LeafWeight != nil
+	}
+	if leafWeight {
+		c.warnf("ResourceIgnored", "blockio leaf weights are not supported by cgroup2 and ignored")
+	}
+	_, err := os.Stat(filepath.Join(cgroupRoot, filepath.Dir(c.CgroupDir), "io.bfq.weight"))
+	items, err := ioCgroupItems(blkio, err == nil)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := c.setCgroupItem(item.key, item.value); err != nil {
+			return err
 		}
-			if cpu.Period != nil && *cpu.Period != 0 {
-				if err := clxc.setConfigItem("lxc.cgroup2.cpu.cfs_period_us", fmt.Sprintf("%d", *cpu.Period)); err != nil {
-					return err
-				}
-			}
-		if cpu.Cpus != "" {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpuset.cpus", cpu.Cpus); err != nil {
-				return err
-			}
+	}
+	return nil
+}
+
+// configureMemoryController sets the memory limits (see memoryCgroupItems).
+// The cgroup1 only settings are ignored with a warning.
+func configureMemoryController(c *Container, mem *specs.LinuxMemory) error {
+	if mem.Kernel != nil || mem.KernelTCP != nil || mem.Swappiness != nil || mem.DisableOOMKiller != nil {
+		c.warnf("ResourceIgnored", "memory kernel limits, swappiness and disableOOMKiller are not supported by cgroup2 and ignored")
+	}
+	items, err := memoryCgroupItems(mem)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := c.setCgroupItem(item.key, item.value); err != nil {
+			return err
 		}
-		if cpu.RealtimePeriod != nil && *cpu.RealtimePeriod > 0 {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpu.rt_period_us", fmt.Sprintf("%d", *cpu.RealtimePeriod)); err != nil {
-				return err
-			}
+	}
+	return nil
+}
+
+// configureHugetlbController sets the hugetlb cgroup limits.
+// Unlike other resource limits they are not ignored if the controller
+// is not available, because the limits are required to account
+// huge page usage (e.g for hugetlbfs mounts, see HugepageMount).
+func configureHugetlbController(c *Container, limits []specs.LinuxHugepageLimit) error {
+	if !c.hasCgroupController("hugetlb") {
+		return fmt.Errorf("hugepage limits require the cgroup hugetlb controller, which is not available for %s", c.CgroupDir)
+	}
+	items, err := hugetlbCgroupItems(limits)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := c.setCgroupItem(item.key, item.value); err != nil {
+			return err
 		}
-		if cpu.RealtimeRuntime != nil && *cpu.RealtimeRuntime > 0 {
-			if err := clxc.setConfigItem("lxc.cgroup2.cpu.rt_runtime_us", fmt.Sprintf("%d", *cpu.RealtimeRuntime)); err != nil {
-				return err
-			}
+	}
+	return nil
+}
+
+// configureCPUController sets the cpu bandwidth and cpuset limits (see cpuCgroupItems).
+// The cpuset.cpus limit is ignored if the container requests exclusive CPUs
+// (see configureCPUSet).
+func configureCPUController(c *Container, cpu *specs.LinuxCPU) error {
+	for _, item := range cpuCgroupItems(cpu) {
+		if item.key == "cpuset.cpus" && hasExclusiveCPUsAnnotation(c) {
+			c.warnf("ResourceIgnored", "cpuset cpus %q are ignored because exclusive cpus are requested", item.value)
+			continue
+		}
+		if err := c.setCgroupItem(item.key, item.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureCPURealtime sets the realtime CPU bandwidth limits if RuntimeFeatures.CPURealtime is enabled.
+// Realtime group scheduling (CONFIG_RT_GROUP_SCHED) is only available for cgroup1 in mainline kernels.
+// If the cgroup2 interface files (cpu.rt_period_us, cpu.rt_runtime_us) are not available,
+// the limits are ignored with a warning and realtime processes of the container are only
+// limited by the global bandwidth (sysctl kernel.sched_rt_runtime_us and kernel.sched_rt_period_us).
+func configureCPURealtime(rt *Runtime, c *Container, cpu *specs.LinuxCPU) error {
+	items, err := cpuRealtimeItems(cpu)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	if !rt.Features.CPURealtime {
+		c.warnf("CPURealtimeDisabled", "cpu realtime feature is disabled - realtime limits are ignored")
+		return nil
+	}
+	// The container cgroup does not exist yet.
+	if _, err := os.Stat(filepath.Join(cgroupRoot, filepath.Dir(c.CgroupDir), "cpu.rt_runtime_us")); err != nil {
+		c.warnf("CPURealtimeUnlimited", "realtime group scheduling is not available - realtime limits are ignored")
+		return nil
+	}
+	for _, item := range items {
+		if err := c.setCgroupItem(item.key, item.value); err != nil {
+			return err
 		}
-	*/
-	// Mems string `json:"mems,omitempty"`
+	}
 	return nil
 }
 
+// cpuRealtimeItems returns the realtime CPU bandwidth limits.
+// The period is set before the runtime, because the runtime must not exceed the period.
+func cpuRealtimeItems(cpu *specs.LinuxCPU) ([]cgroupItem, error) {
+	var items []cgroupItem
+	if cpu.RealtimePeriod != nil && *cpu.RealtimePeriod > 0 {
+		items = append(items, cgroupItem{"cpu.rt_period_us", strconv.FormatUint(*cpu.RealtimePeriod, 10)})
+	}
+	if cpu.RealtimeRuntime != nil {
+		if cpu.RealtimePeriod != nil && *cpu.RealtimeRuntime > int64(*cpu.RealtimePeriod) {
+			return nil, fmt.Errorf("cpu realtime runtime %d exceeds the realtime period %d", *cpu.RealtimeRuntime, *cpu.RealtimePeriod)
+		}
+		// A runtime of -1 disables the limit.
+		items = append(items, cgroupItem{"cpu.rt_runtime_us", strconv.FormatInt(*cpu.RealtimeRuntime, 10)})
+	}
+	return items, nil
+}
+
 // FIXME Register containers using the systemd DBUS API see https://systemd.io/CGROUP_DELEGATION/
 // Using the systemd DBUS API is the only way for proper support of unprivileged containers.
 // `systemd-run --user --scope cat /proc/self/cgroup`
@@ -310,6 +464,10 @@ func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
 		return nil
 	}
 
+	// A paused container (see Runtime.Pause) remains frozen,
+	// unless it is killed with SIGKILL.
+	paused := ev.frozen
+
 	freezer := filepath.Join(rootDir, "cgroup.freeze")
 
 	err = cgroupFreeze(freezer, true)
@@ -317,7 +475,7 @@ func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
 		return err
 	}
 
-	err = pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
+	err = pollCgroupEvents(ctx, c.backoff, eventsFile, func(ev cgroupEvents) bool {
 		return ev.frozen
 	})
 	if err != nil {
@@ -357,7 +515,7 @@ func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
 			}
 
 			c.Log.Debug().Msgf("killing process: %d", pid)
-			err = unix.Kill(pid, sig)
+			err = killProcess(pid, sig)
 			if err != nil && err != unix.ESRCH {
 				c.Log.Error().Msgf("failed to kill %d: %s", pid, err)
 				continue
@@ -370,6 +528,9 @@ func killCgroup(ctx context.Context, c *Container, sig unix.Signal) error {
 		return err
 	}
 
+	if paused && sig != unix.SIGKILL {
+		return nil
+	}
 	err = cgroupFreeze(freezer, false)
 	if err != nil {
 		return err
@@ -419,20 +580,21 @@ func cgroupFreeze(filename string, freeze bool) error {
 	return err
 }
 
-func pollCgroupEvents(ctx context.Context, eventsFile string, fn func(ev cgroupEvents) bool) error {
+func pollCgroupEvents(ctx context.Context, b Backoff, eventsFile string, fn func(ev cgroupEvents) bool) error {
+	timer := b.timer()
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			ev, err := parseCgroupEvents(eventsFile)
-			if err != nil {
-				return err
-			}
-			if fn(ev) {
-				return nil
-			}
-			time.Sleep(time.Millisecond * 5)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ev, err := parseCgroupEvents(eventsFile)
+		if err != nil {
+			return err
+		}
+		if fn(ev) {
+			return nil
+		}
+		if err := timer.wait(ctx); err != nil {
+			return err
 		}
 	}
 }
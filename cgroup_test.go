@@ -1,8 +1,11 @@
 package lxcri
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -11,3 +14,46 @@ func TestParseSystemCgroupPath(t *testing.T) {
 	cg := parseSystemdCgroupPath(s)
 	require.Equal(t, "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-123.slice/crio-ABC.scope", cg)
 }
+
+func TestCgroupControllers(t *testing.T) {
+	defer func(root string) { cgroupRoot = root }(cgroupRoot)
+	cgroupRoot = t.TempDir()
+
+	parent := filepath.Join(cgroupRoot, "user.slice")
+	require.NoError(t, os.MkdirAll(parent, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "cgroup.controllers"), []byte("memory pids\n"), 0644))
+
+	controllers, err := cgroupControllers(filepath.Join(parent, "c1.scope"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"memory": true, "pids": true}, controllers)
+
+	c := &Container{ContainerConfig: &ContainerConfig{}, cgroupControllers: controllers}
+	require.True(t, c.hasCgroupController("pids"))
+	require.True(t, c.hasCgroupController("cgroup"))
+	require.False(t, c.hasCgroupController("cpuset"))
+
+	_, err = cgroupControllers(filepath.Join(cgroupRoot, "system.slice", "c2.scope"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCPURealtimeItems(t *testing.T) {
+	cpu := &specs.LinuxCPU{}
+	items, err := cpuRealtimeItems(cpu)
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	period := uint64(1000000)
+	runtime := int64(950000)
+	cpu.RealtimePeriod = &period
+	cpu.RealtimeRuntime = &runtime
+	items, err = cpuRealtimeItems(cpu)
+	require.NoError(t, err)
+	require.Equal(t, []cgroupItem{
+		{"cpu.rt_period_us", "1000000"},
+		{"cpu.rt_runtime_us", "950000"},
+	}, items)
+
+	runtime = int64(period) + 1
+	_, err = cpuRealtimeItems(cpu)
+	require.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package lxcri
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/go-lxc"
+	"golang.org/x/sys/unix"
+)
+
+// Names of the checks added to the HostReport by CheckHost.
+const (
+	CheckSubUID           = "subuid"
+	CheckSubGID           = "subgid"
+	CheckCgroupDelegation = "cgroup-delegation"
+	CheckKernelVersion    = "kernel-version"
+	CheckUserNamespaces   = "user-namespaces"
+	CheckCgroupNamespaces = "cgroup-namespaces"
+	CheckLXCVersion       = "liblxc-version"
+	CheckLXCConfigItems   = "liblxc-config-items"
+	CheckInitStatic       = "lxcri-init-static"
+)
+
+// minSubIDs is the minimum number of subordinate IDs required
+// to map a full container user namespace.
+const minSubIDs = 65536
+
+// lxcConfigItems are the liblxc config items the runtime relies on.
+var lxcConfigItems = []string{
+	"lxc.cgroup.dir.container",
+	"lxc.cgroup.dir.monitor",
+	"lxc.init.groups",
+	"lxc.namespace.share.user",
+}
+
+// CheckHost runs the full host readiness probe and returns the report.
+// The report contains the checks from Runtime.Init and additional checks,
+// which are too expensive to run for every runtime command.
+// Init must be called before CheckHost, but the error returned by Init
+// can be ignored, the failed checks are contained in the report.
+// Every call returns a new report, the report of Init is not modified.
+func (rt *Runtime) CheckHost() *HostReport {
+	r := &HostReport{LXCVersion: lxc.Version()}
+	if rt.report != nil {
+		*r = *rt.report
+		r.Checks = append([]HostCheck(nil), rt.report.Checks...)
+	}
+
+	if !rt.isPrivileged() {
+		hint := "add a subordinate ID range for the runtime user: `echo \"$(whoami):20000:65536\" >> %s`"
+		r.require(CheckSubUID, checkSubIDs("/etc/subuid"), fmt.Sprintf(hint, "/etc/subuid"))
+		r.require(CheckSubGID, checkSubIDs("/etc/subgid"), fmt.Sprintf(hint, "/etc/subgid"))
+
+		cg, err := getProcessCgroup()
+		if err == nil {
+			err = checkCgroupWritable(cg)
+		}
+		r.require(CheckCgroupDelegation, err,
+			"run the runtime in a delegated cgroup e.g `systemd-run --user --scope` or `chown -R $(whoami) /sys/fs/cgroup$(grep '^0:' /proc/self/cgroup | cut -d: -f3)`")
+	}
+
+	r.recommend(CheckKernelVersion, checkKernelVersion(5, 2),
+		"upgrade to a kernel >= 5.2 (required for the cgroup2 freezer)")
+	r.require(CheckUserNamespaces, checkUserNamespaces(),
+		"enable user namespaces: `sysctl -w user.max_user_namespaces=15000`")
+	r.recommend(CheckCgroupNamespaces, checkNamespaceSupported("cgroup"),
+		"enable CONFIG_CGROUPS and CONFIG_CGROUP_NS in the kernel configuration")
+
+	var err error
+	if !lxc.VersionAtLeast(4, 0, 9) {
+		err = fmt.Errorf("liblxc version %s < 4.0.9", lxc.Version())
+	}
+	r.recommend(CheckLXCVersion, err, "upgrade liblxc to version >= 4.0.9")
+	r.recommend(CheckLXCConfigItems, checkConfigItems(lxcConfigItems...),
+		"upgrade liblxc or rebuild it with all options enabled")
+
+	r.require(CheckInitStatic, checkStaticBinary(rt.libexec(ExecInit)),
+		"rebuild lxcri-init with CGO_ENABLED=0")
+	return r
+}
+
+// checkSubIDs checks whether the given subordinate ID file (see `man subuid`)
+// contains at least minSubIDs entries for the current user.
+func checkSubIDs(filename string) error {
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var count uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		vals := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(vals) != 3 || (vals[0] != u.Username && vals[0] != u.Uid) {
+			continue
+		}
+		n, err := strconv.ParseUint(vals[2], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid entry %q in %s: %w", scanner.Text(), filename, err)
+		}
+		count += n
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if count < minSubIDs {
+		return fmt.Errorf("%s contains %d IDs for user %s but %d are required", filename, count, u.Username, minSubIDs)
+	}
+	return nil
+}
+
+// parseKernelVersion parses major and minor version from a kernel release string.
+// e.g 5.10.0-8-amd64
+func parseKernelVersion(release string) (major int, minor int, err error) {
+	vals := strings.SplitN(release, ".", 3)
+	if len(vals) < 2 {
+		return 0, 0, fmt.Errorf("invalid kernel release %q", release)
+	}
+	major, err = strconv.Atoi(vals[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid kernel release %q: %w", release, err)
+	}
+	minor, err = strconv.Atoi(strings.TrimRightFunc(vals[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid kernel release %q: %w", release, err)
+	}
+	return major, minor, nil
+}
+
+func checkKernelVersion(major, minor int) error {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return err
+	}
+	release := nullTerminatedString(uts.Release[:])
+	kmajor, kminor, err := parseKernelVersion(release)
+	if err != nil {
+		return err
+	}
+	if kmajor < major || (kmajor == major && kminor < minor) {
+		return fmt.Errorf("kernel version %s < %d.%d", release, major, minor)
+	}
+	return nil
+}
+
+func checkUserNamespaces() error {
+	if err := checkNamespaceSupported("user"); err != nil {
+		return err
+	}
+	max, err := readSysctlUint("user.max_user_namespaces")
+	if err != nil {
+		return err
+	}
+	if max == 0 {
+		return fmt.Errorf("user namespaces are disabled (user.max_user_namespaces = 0)")
+	}
+	return nil
+}
+
+// readSysctlUint reads the unsigned integer value of the given kernel parameter
+// from /proc/sys, e.g user.max_user_namespaces.
+func readSysctlUint(key string) (uint64, error) {
+	filename := filepath.Join("/proc/sys", strings.ReplaceAll(key, ".", "/"))
+	// #nosec
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse sysctl %s: %w", key, err)
+	}
+	return val, nil
+}
+
+func checkNamespaceSupported(name string) error {
+	_, err := os.Stat(filepath.Join("/proc/self/ns", name))
+	return err
+}
+
+func checkConfigItems(keys ...string) error {
+	var unsupported []string
+	for _, key := range keys {
+		if !lxc.IsSupportedConfigItem(key) {
+			unsupported = append(unsupported, key)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("unsupported config items %s", strings.Join(unsupported, ","))
+	}
+	return nil
+}
+
+// checkStaticBinary checks that the given ELF executable does not
+// require a dynamic loader.
+func checkStaticBinary(filename string) error {
+	f, err := elf.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return fmt.Errorf("%s is dynamically linked", filename)
+		}
+	}
+	return nil
+}
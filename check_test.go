@@ -0,0 +1,51 @@
+package lxcri
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKernelVersion(t *testing.T) {
+	major, minor, err := parseKernelVersion("5.10.0-8-amd64")
+	require.NoError(t, err)
+	require.Equal(t, 5, major)
+	require.Equal(t, 10, minor)
+
+	major, minor, err = parseKernelVersion("4.19+")
+	require.NoError(t, err)
+	require.Equal(t, 4, major)
+	require.Equal(t, 19, minor)
+
+	_, _, err = parseKernelVersion("linux")
+	require.Error(t, err)
+}
+
+func TestCheckFailed(t *testing.T) {
+	rt := Runtime{Log: zerolog.Nop(), IgnoreChecks: []string{CheckCgroup2}}
+	err := fmt.Errorf("not mounted")
+	require.Error(t, rt.checkFailed(CheckProcfs, err))
+	require.NoError(t, rt.checkFailed(CheckCgroup2, err))
+	require.NoError(t, rt.checkFailed(CheckProcfs, nil))
+}
+
+func TestReadSysctlUint(t *testing.T) {
+	val, err := readSysctlUint("kernel.pid_max")
+	require.NoError(t, err)
+	require.Greater(t, val, uint64(0))
+
+	_, err = readSysctlUint("kernel.ostype")
+	require.Error(t, err)
+}
+
+func TestCheckHostNoDuplicates(t *testing.T) {
+	rt := Runtime{Log: zerolog.Nop()}
+	rt.report = &HostReport{}
+	rt.report.add(CheckProcfs, nil)
+
+	n := len(rt.CheckHost().Checks)
+	require.Equal(t, n, len(rt.CheckHost().Checks))
+	require.Len(t, rt.report.Checks, 1)
+}
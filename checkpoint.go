@@ -0,0 +1,341 @@
+package lxcri
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lxc/go-lxc"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// checkpointFile is the checkpoint metadata file. It is written to the
+// container runtime directory and to the checkpoint image directory.
+const checkpointFile = "checkpoint.json"
+
+// CheckpointOptions are the options for Container.Checkpoint.
+type CheckpointOptions struct {
+	// ImageDir is the directory the CRIU images are written to.
+	// It is created if it does not exist.
+	ImageDir string
+	// Verbose enables verbose CRIU logging to the container log.
+	Verbose bool
+	// LeaveRunning resumes the container after the dump, instead of stopping it.
+	LeaveRunning bool
+	// PreDumps is the number of memory pre-dumps before the final dump.
+	// Each pre-dump (CRIU --track-mem) writes the memory pages changed since
+	// the previous pre-dump to ImageDir/predump-<n>, while the container is running.
+	// The final dump only contains the memory pages changed since the last pre-dump,
+	// which minimizes the time the container is frozen for large-memory containers.
+	PreDumps int
+	// OnPreDump is called after each pre-dump with the iteration number (starting at 1)
+	// and the pre-dump image directory, e.g to transfer the images to another host.
+	// The checkpoint is aborted if OnPreDump returns an error.
+	OnPreDump func(n int, dir string) error
+	// PageServer enables lazy (post-copy) migration. It is the address (host:port)
+	// the CRIU page server listens on. The memory pages are not written to ImageDir,
+	// but are transferred from the frozen container to the destination on demand
+	// (see ContainerConfig.RestorePageServer). Checkpoint returns when all memory pages
+	// are transferred. PageServer can not be combined with LeaveRunning.
+	PageServer string
+	// OnDumped is called when the images are written to ImageDir, while the container
+	// is still frozen. With LeaveRunning it can be used to copy the root filesystem
+	// consistent with the images. For a lazy migration it is called before the page server
+	// is started, e.g to transfer the images to the destination and restore the container there.
+	// The checkpoint is aborted and the container continues to run if OnDumped returns an error.
+	OnDumped func() error
+}
+
+// CheckpointInfo is the metadata of the last checkpoint of a container.
+type CheckpointInfo struct {
+	ContainerID string
+	// ImageDir is the directory that contains the CRIU images.
+	ImageDir string
+	// CgroupDir is the cgroup of the checkpointed container.
+	CgroupDir string
+	// Time is the time the final dump completed.
+	Time time.Time
+	// Duration is the duration of the checkpoint, including all pre-dumps.
+	Duration time.Duration
+	// LeaveRunning is true if the container was left running after the dump.
+	LeaveRunning bool `json:",omitempty"`
+	PreDumps     int  `json:",omitempty"`
+	// PageServer is the page server address of a lazy migration.
+	PageServer string `json:",omitempty"`
+	// RuntimeVersion is the version of the runtime that created the checkpoint.
+	RuntimeVersion string
+}
+
+// LastCheckpoint returns the metadata of the last checkpoint of the container.
+// ErrNotExist is returned if the container was never checkpointed.
+func (c *Container) LastCheckpoint() (*CheckpointInfo, error) {
+	return readCheckpointInfo(c.RuntimePath(checkpointFile))
+}
+
+// ReadCheckpointInfo returns the metadata of the checkpoint in the given image directory.
+// ErrNotExist is returned if the directory contains no checkpoint metadata,
+// e.g because the images were not created by Container.Checkpoint.
+func ReadCheckpointInfo(imageDir string) (*CheckpointInfo, error) {
+	return readCheckpointInfo(filepath.Join(imageDir, checkpointFile))
+}
+
+func readCheckpointInfo(filename string) (*CheckpointInfo, error) {
+	// #nosec
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := new(CheckpointInfo)
+	return info, json.Unmarshal(data, info)
+}
+
+// recordCheckpoint writes the checkpoint metadata to the runtime directory
+// and to the image directory.
+func (c *Container) recordCheckpoint(opts CheckpointOptions, start time.Time) error {
+	now := time.Now()
+	info := CheckpointInfo{
+		ContainerID:    c.ContainerID,
+		ImageDir:       opts.ImageDir,
+		CgroupDir:      c.CgroupDir,
+		Time:           now,
+		Duration:       now.Sub(start),
+		LeaveRunning:   opts.LeaveRunning,
+		PreDumps:       opts.PreDumps,
+		PageServer:     opts.PageServer,
+		RuntimeVersion: BuildInfo().Version,
+	}
+	for _, filename := range []string{c.RuntimePath(checkpointFile), filepath.Join(opts.ImageDir, checkpointFile)} {
+		if err := specki.EncodeJSONFile(filename, info, os.O_CREATE|os.O_TRUNC, 0640); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func preDumpDir(n int) string {
+	return fmt.Sprintf("predump-%d", n)
+}
+
+// migrateOptions returns the options for the given pre-dump iteration n,
+// or for the final dump if n is zero.
+// The previous images directory is relative to the images directory (see CRIU --prev-images-dir).
+func (opts CheckpointOptions) migrateOptions(n int) lxc.MigrateOptions {
+	if n == 0 {
+		mo := lxc.MigrateOptions{Directory: opts.ImageDir, Verbose: opts.Verbose, Stop: !opts.LeaveRunning}
+		if opts.PreDumps > 0 {
+			mo.PredumpDir = preDumpDir(opts.PreDumps)
+		}
+		return mo
+	}
+	mo := lxc.MigrateOptions{Directory: filepath.Join(opts.ImageDir, preDumpDir(n)), Verbose: opts.Verbose}
+	if n > 1 {
+		mo.PredumpDir = filepath.Join("..", preDumpDir(n-1))
+	}
+	return mo
+}
+
+// Checkpoint dumps the process tree of the running container
+// to CRIU images (see `man lxc-checkpoint`) and stops the container,
+// unless CheckpointOptions.LeaveRunning is set.
+// The container can be restored from the images (see ContainerConfig.RestoreImageDir),
+// on this or another host with the same root filesystem at the same path.
+// The checkpoint metadata is recorded (see Container.LastCheckpoint and ReadCheckpointInfo).
+func (c *Container) Checkpoint(ctx context.Context, opts CheckpointOptions) error {
+	start := time.Now()
+	if !filepath.IsAbs(opts.ImageDir) {
+		return fmt.Errorf("image dir %q is not an absolute path", opts.ImageDir)
+	}
+	if opts.PageServer != "" && opts.LeaveRunning {
+		return fmt.Errorf("lazy migration can not leave the container running")
+	}
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != specs.StateRunning {
+		return fmt.Errorf("invalid container state. expected %q, but was %q", specs.StateRunning, state)
+	}
+	if err := os.MkdirAll(opts.ImageDir, 0700); err != nil {
+		return errorf("failed to create image dir: %w", err)
+	}
+
+	for n := 1; n <= opts.PreDumps; n++ {
+		mo := opts.migrateOptions(n)
+		if err := os.Mkdir(mo.Directory, 0700); err != nil {
+			return errorf("failed to create pre-dump dir: %w", err)
+		}
+		c.Log.Info().Str("dir", mo.Directory).Int("n", n).Msg("pre-dump container")
+		if err := c.linuxContainer.Migrate(lxc.MIGRATE_PRE_DUMP, mo); err != nil {
+			return errorf("pre-dump %d failed: %w", n, err)
+		}
+		if opts.OnPreDump != nil {
+			if err := opts.OnPreDump(n, mo.Directory); err != nil {
+				return errorf("pre-dump %d callback failed: %w", n, err)
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	c.Log.Info().Str("dir", opts.ImageDir).Msg("checkpoint container")
+	if opts.PageServer != "" || opts.OnDumped != nil {
+		err = c.dumpFrozen(ctx, opts)
+	} else {
+		err = c.linuxContainer.Migrate(lxc.MIGRATE_DUMP, opts.migrateOptions(0))
+	}
+	if err != nil {
+		return errorf("failed to dump container: %w", err)
+	}
+	if err := c.recordCheckpoint(opts, start); err != nil {
+		return errorf("failed to record checkpoint: %w", err)
+	}
+	if opts.LeaveRunning {
+		return nil
+	}
+	// The container processes are killed by CRIU after the dump.
+	if err := c.waitMonitorExited(ctx); err != nil {
+		return errorf("monitor process did not stop: %w", err)
+	}
+	return nil
+}
+
+// waitRestored waits until the container init process is restored.
+// Unlike a created container, a restored container is running,
+// because the init process `lxcri-init` has already executed the container process.
+func (c *Container) waitRestored(ctx context.Context) error {
+	return c.waitInit(ctx, func(initState specs.ContainerState) (bool, error) {
+		return initState == specs.StateRunning, nil
+	})
+}
+
+// Files in the container runtime directory used by dumpFrozen.
+const (
+	criuActionScript = "criu-action.sh"
+	criuDumpedFifo   = "criu-dumped"
+	criuResumeFifo   = "criu-resume"
+)
+
+// The action script blocks criu in the post-dump stage, after the images are written
+// and before the container is resumed or killed (or the page server is started),
+// until the runtime writes the exit status of the script to the resume FIFO.
+// criu continues the container if the exit status is not zero.
+const criuActionScriptTemplate = `#!/bin/sh
+[ "$CRTOOLS_SCRIPT_ACTION" = "post-dump" ] || exit 0
+echo dumped > %q
+read -r status < %q
+exit "$status"
+`
+
+// dumpFrozen dumps the container and calls CheckpointOptions.OnDumped
+// while the container is frozen. For a lazy migration the memory pages
+// are served until they are transferred to the destination.
+func (c *Container) dumpFrozen(ctx context.Context, opts CheckpointOptions) error {
+	var conf string
+	if opts.PageServer != "" {
+		var err error
+		if conf, err = c.writeLazyDumpConfig(opts.PageServer); err != nil {
+			return err
+		}
+	}
+
+	dumped, resume, err := c.createDumpFifos()
+	if err != nil {
+		return err
+	}
+	defer dumped.Close()
+	defer resume.Close()
+
+	script := c.RuntimePath(criuActionScript)
+	data := fmt.Sprintf(criuActionScriptTemplate, dumped.Name(), resume.Name())
+	// #nosec
+	if err := os.WriteFile(script, []byte(data), 0700); err != nil {
+		return err
+	}
+
+	mo := opts.migrateOptions(0)
+	mo.ActionScript = script
+
+	migrated := make(chan error, 1)
+	go func() {
+		if conf == "" {
+			migrated <- c.linuxContainer.Migrate(lxc.MIGRATE_DUMP, mo)
+			return
+		}
+		migrated <- c.lazyDump(mo, conf)
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := bufio.NewReader(dumped).ReadString('\n')
+		ready <- err
+	}()
+
+	select {
+	case err := <-migrated:
+		if err == nil {
+			err = fmt.Errorf("dump completed without post-dump stage")
+		}
+		return err
+	case err := <-ready:
+		if err != nil {
+			return fmt.Errorf("failed to read dump status: %w", err)
+		}
+	}
+
+	status := "0"
+	err = ctx.Err()
+	if err == nil && opts.OnDumped != nil {
+		err = opts.OnDumped()
+	}
+	if err != nil {
+		// The container continues to run.
+		status = "1"
+	}
+	if _, werr := io.WriteString(resume, status+"\n"); werr != nil {
+		return fmt.Errorf("failed to resume dump: %w", werr)
+	}
+	c.Log.Info().Str("page-server", opts.PageServer).Bool("aborted", err != nil).Msg("images dumped")
+
+	// For a lazy migration the page server runs until the memory pages are transferred.
+	merr := <-migrated
+	if err != nil {
+		return fmt.Errorf("checkpoint aborted: %w", err)
+	}
+	return merr
+}
+
+// createDumpFifos creates the FIFOs used by the action script
+// and opens them for reading and writing, so that opening
+// them does not block.
+func (c *Container) createDumpFifos() (dumped *os.File, resume *os.File, err error) {
+	for _, name := range []string{criuDumpedFifo, criuResumeFifo} {
+		p := c.RuntimePath(name)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		if err := unix.Mkfifo(p, 0600); err != nil {
+			return nil, nil, fmt.Errorf("failed to create fifo %s: %w", p, err)
+		}
+	}
+	dumped, err = os.OpenFile(c.RuntimePath(criuDumpedFifo), os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	resume, err = os.OpenFile(c.RuntimePath(criuResumeFifo), os.O_RDWR, 0)
+	if err != nil {
+		dumped.Close()
+		return nil, nil, err
+	}
+	return dumped, resume, nil
+}
@@ -0,0 +1,87 @@
+package lxcri
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/lxc/go-lxc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointMigrateOptions(t *testing.T) {
+	opts := CheckpointOptions{ImageDir: "/tmp/images", PreDumps: 2}
+
+	require.Equal(t, lxc.MigrateOptions{Directory: "/tmp/images/predump-1"}, opts.migrateOptions(1))
+	require.Equal(t, lxc.MigrateOptions{Directory: "/tmp/images/predump-2", PredumpDir: "../predump-1"}, opts.migrateOptions(2))
+	require.Equal(t, lxc.MigrateOptions{Directory: "/tmp/images", PredumpDir: "predump-2", Stop: true}, opts.migrateOptions(0))
+
+	opts.PreDumps = 0
+	require.Equal(t, lxc.MigrateOptions{Directory: "/tmp/images", Stop: true}, opts.migrateOptions(0))
+}
+
+func TestRecordCheckpoint(t *testing.T) {
+	runtimeDir := t.TempDir()
+	imageDir := t.TempDir()
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1", CgroupDir: "lxcri/c1.scope"}}
+	c.runtimeDir = runtimeDir
+
+	_, err := c.LastCheckpoint()
+	require.Equal(t, ErrNotExist, err)
+	_, err = ReadCheckpointInfo(imageDir)
+	require.Equal(t, ErrNotExist, err)
+
+	start := time.Now()
+	opts := CheckpointOptions{ImageDir: imageDir, LeaveRunning: true, PreDumps: 1}
+	require.NoError(t, c.recordCheckpoint(opts, start))
+
+	info, err := c.LastCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, "c1", info.ContainerID)
+	require.Equal(t, imageDir, info.ImageDir)
+	require.Equal(t, "lxcri/c1.scope", info.CgroupDir)
+	require.True(t, info.LeaveRunning)
+	require.Equal(t, 1, info.PreDumps)
+	require.True(t, info.Duration >= 0)
+
+	info2, err := ReadCheckpointInfo(imageDir)
+	require.NoError(t, err)
+	require.Equal(t, info.Time.Unix(), info2.Time.Unix())
+}
+
+func TestCriuActionScript(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1"}}
+	c.runtimeDir = t.TempDir()
+
+	dumped, resume, err := c.createDumpFifos()
+	require.NoError(t, err)
+	defer dumped.Close()
+	defer resume.Close()
+
+	script := c.RuntimePath(criuActionScript)
+	data := fmt.Sprintf(criuActionScriptTemplate, dumped.Name(), resume.Name())
+	require.NoError(t, os.WriteFile(script, []byte(data), 0700))
+
+	run := func(action string) *exec.Cmd {
+		cmd := exec.Command(script)
+		cmd.Env = []string{"CRTOOLS_SCRIPT_ACTION=" + action}
+		return cmd
+	}
+
+	// Other actions are not blocked.
+	require.NoError(t, run("pre-dump").Run())
+
+	cmd := run("post-dump")
+	require.NoError(t, cmd.Start())
+	_, err = bufio.NewReader(dumped).ReadString('\n')
+	require.NoError(t, err)
+	_, err = io.WriteString(resume, "1\n")
+	require.NoError(t, err)
+	err = cmd.Wait()
+	require.Error(t, err)
+	require.Equal(t, 1, cmd.ProcessState.ExitCode())
+}
@@ -0,0 +1,164 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// CloneOptions are the options for Runtime.Clone.
+type CloneOptions struct {
+	// BundlePath is the bundle directory of the clone. It must not exist.
+	// The source root filesystem is copied to BundlePath/rootfs,
+	// and the spec of the source container (as passed to Runtime.Create)
+	// to BundlePath/config.json.
+	BundlePath string
+	// Live restores the clone from a checkpoint of the running source container
+	// (see CheckpointOptions.LeaveRunning), instead of creating it from scratch.
+	// The source container keeps running. The root filesystem is copied
+	// while the source container is frozen for the checkpoint,
+	// so that it is consistent with the checkpoint.
+	Live bool
+}
+
+// cloneRootfs is the name of the cloned root filesystem in the clone bundle.
+const cloneRootfs = "rootfs"
+
+// cloneImageDir is the name of the checkpoint image directory in the clone bundle.
+const cloneImageDir = "checkpoint"
+
+// Clone creates a new container with the given ID from the source container.
+// The root filesystem of the source is copied using reflinks (copy-on-write)
+// if the filesystem supports them e.g btrfs or xfs, and a full copy otherwise.
+// The cgroups path of the source spec is not used, and the hostname is set
+// to the new ID if the source container has its own UTS namespace and hostname.
+// Without CloneOptions.Live the clone is in state created like a container
+// returned by Create, with CloneOptions.Live it is running.
+// The clone is created from the config of the source as passed to Create
+// (see Container.CreateConfig), so secrets without a source can not be cloned.
+// Like with Create you should call Runtime.Delete to cleanup the clone,
+// even if Clone returned with an error.
+func (rt *Runtime) Clone(ctx context.Context, src *Container, newID string, opts CloneOptions) (*Container, error) {
+	if !filepath.IsAbs(opts.BundlePath) {
+		return nil, fmt.Errorf("clone bundle path %q is not an absolute path", opts.BundlePath)
+	}
+	// The runtime modifications of the source (e.g the runtime mounts)
+	// are applied again when the clone is created.
+	cfg, err := src.CreateConfig()
+	if err != nil {
+		return nil, errorf("failed to load source container config: %w", err)
+	}
+	if err := checkCloneSecrets(cfg); err != nil {
+		return nil, err
+	}
+	spec := cfg.Spec
+	srcRootfs := spec.Root.Path
+	if !filepath.IsAbs(srcRootfs) {
+		srcRootfs = filepath.Join(src.BundlePath, srcRootfs)
+	}
+
+	if err := os.Mkdir(opts.BundlePath, 0700); err != nil {
+		return nil, errorf("failed to create clone bundle: %w", err)
+	}
+
+	cfg.ContainerID = newID
+	cfg.BundlePath = opts.BundlePath
+	cfg.ConsoleSocket = ""
+	cfg.CRILogFile = ""
+	cfg.Log = rt.Log.With().Str("cid", newID).Logger()
+
+	copyRootfs := func() error {
+		rt.Log.Info().Str("src", src.ContainerID).Str("cid", newID).Msg("copy root filesystem")
+		if err := copyTree(ctx, srcRootfs, filepath.Join(opts.BundlePath, cloneRootfs)); err != nil {
+			return errorf("failed to copy root filesystem: %w", err)
+		}
+		return nil
+	}
+	if opts.Live {
+		cfg.RestoreImageDir = filepath.Join(opts.BundlePath, cloneImageDir)
+		err := src.Checkpoint(ctx, CheckpointOptions{ImageDir: cfg.RestoreImageDir, LeaveRunning: true, OnDumped: copyRootfs})
+		if err != nil {
+			return nil, errorf("failed to checkpoint source container: %w", err)
+		}
+	} else if err := copyRootfs(); err != nil {
+		return nil, err
+	}
+
+	cloneSpec(spec, newID, opts.BundlePath)
+	err = specki.EncodeJSONFile(filepath.Join(opts.BundlePath, BundleConfigFile), spec, os.O_EXCL|os.O_CREATE, 0440)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Spec = spec
+
+	c, err := rt.Create(ctx, cfg)
+	if err != nil || !opts.Live || spec.Hostname != newID {
+		return c, err
+	}
+	// The hostname of the restored clone is restored from the checkpoint.
+	if err := c.setHostname(spec.Hostname); err != nil {
+		return c, errorf("failed to set clone hostname: %w", err)
+	}
+	return c, nil
+}
+
+// checkCloneSecrets checks that the secrets of the source container
+// can be recreated for the clone. The secret data is never persisted,
+// so only secrets with a source can be cloned.
+func checkCloneSecrets(cfg *ContainerConfig) error {
+	for _, s := range cfg.Secrets {
+		if s.Source == "" {
+			return fmt.Errorf("secret %s without source can not be cloned", s.Target)
+		}
+	}
+	return nil
+}
+
+// cloneSpec modifies the spec of the source container for the clone with the given ID
+// and the bundle path. The rootfs path is absolute, because the runtime uses
+// the rootfs path of the spec as is (and not relative to the bundle).
+func cloneSpec(spec *specs.Spec, newID string, bundlePath string) {
+	spec.Root.Path = filepath.Join(bundlePath, cloneRootfs)
+	if spec.Linux == nil {
+		return
+	}
+	// The clone is created in its own cgroup (see Runtime.PayloadCgroup).
+	spec.Linux.CgroupsPath = ""
+	// The hostname of a joined UTS namespace (e.g of a pod) is kept.
+	if ns := getNamespace(spec, specs.UTSNamespace); ns != nil && ns.Path == "" && spec.Hostname != "" {
+		spec.Hostname = newID
+	}
+}
+
+// setHostname sets the hostname in the UTS namespace of the running container.
+func (c *Container) setHostname(hostname string) error {
+	pid := c.InitPid()
+	if pid <= 0 {
+		return fmt.Errorf("container init process is not running")
+	}
+	ns := map[specs.LinuxNamespaceType]string{
+		specs.UTSNamespace: fmt.Sprintf("/proc/%d/ns/uts", pid),
+	}
+	return runInNamespaces(ns, func() error {
+		return unix.Sethostname([]byte(hostname))
+	})
+}
+
+// copyTree copies the directory src to dst (which must not exist)
+// and preserves ownership, permissions, timestamps and xattrs.
+func copyTree(ctx context.Context, src string, dst string) error {
+	// #nosec
+	cmd := exec.CommandContext(ctx, "cp", "-a", "--reflink=auto", src, dst)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
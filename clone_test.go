@@ -0,0 +1,95 @@
+package lxcri
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyTree(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "etc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "etc", "hostname"), []byte("c1\n"), 0640))
+	require.NoError(t, os.Symlink("etc/hostname", filepath.Join(src, "hostname")))
+
+	dst := filepath.Join(tmp, "dst")
+	require.NoError(t, copyTree(context.Background(), src, dst))
+
+	data, err := os.ReadFile(filepath.Join(dst, "etc", "hostname"))
+	require.NoError(t, err)
+	require.Equal(t, "c1\n", string(data))
+
+	info, err := os.Stat(filepath.Join(dst, "etc", "hostname"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	target, err := os.Readlink(filepath.Join(dst, "hostname"))
+	require.NoError(t, err)
+	require.Equal(t, "etc/hostname", target)
+
+	// The destination must not exist.
+	require.Error(t, copyTree(context.Background(), filepath.Join(tmp, "missing"), dst+"2"))
+}
+
+func TestCloneRelativeBundle(t *testing.T) {
+	rt := &Runtime{}
+	_, err := rt.Clone(context.Background(), &Container{}, "c2", CloneOptions{BundlePath: "clone"})
+	require.Error(t, err)
+}
+
+func TestCloneSpec(t *testing.T) {
+	spec := specki.NewSpec("/var/lib/c1/rootfs", "/bin/sh")
+	spec.Hostname = "c1"
+	spec.Linux.CgroupsPath = "lxcri/c1.scope"
+	spec.Linux.Namespaces = []specs.LinuxNamespace{{Type: specs.UTSNamespace}}
+	cloneSpec(spec, "c2", "/var/lib/c2")
+	require.Equal(t, "/var/lib/c2/rootfs", spec.Root.Path)
+	require.Equal(t, "", spec.Linux.CgroupsPath)
+	require.Equal(t, "c2", spec.Hostname)
+
+	spec.Hostname = "pod"
+	spec.Linux.Namespaces = []specs.LinuxNamespace{{Type: specs.UTSNamespace, Path: "/proc/1/ns/uts"}}
+	cloneSpec(spec, "c3", "/var/lib/c3")
+	require.Equal(t, "pod", spec.Hostname)
+}
+
+func TestCreateConfig(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{ContainerID: "c1"}}
+	c.runtimeDir = t.TempDir()
+
+	cfg := &ContainerConfig{
+		ContainerID:     "c1",
+		Spec:            specki.NewSpec("rootfs", "/bin/sh"),
+		RestoreImageDir: "/tmp/checkpoint",
+		Secrets: []Secret{
+			{Target: "/run/secrets/a", Data: []byte("secret")},
+			{Target: "/run/secrets/b", Source: "/etc/secret"},
+		},
+	}
+	data, err := encodeCreateConfig(cfg)
+	require.NoError(t, err)
+	require.NoError(t, specki.EncodeJSONFile(c.RuntimePath(createConfigFile), data, os.O_EXCL|os.O_CREATE, 0640))
+
+	// Modifications applied by the runtime are not recorded.
+	mounts := len(cfg.Spec.Mounts)
+	cfg.Spec.Mounts = append(cfg.Spec.Mounts, specs.Mount{Destination: "/.lxcri", Source: "/run/lxcri/c1", Type: "bind"})
+
+	createCfg, err := c.CreateConfig()
+	require.NoError(t, err)
+	require.Equal(t, "c1", createCfg.ContainerID)
+	require.Equal(t, "", createCfg.RestoreImageDir)
+	require.Len(t, createCfg.Spec.Mounts, mounts)
+	require.Nil(t, createCfg.Secrets[0].Data)
+	require.Equal(t, "/tmp/checkpoint", cfg.RestoreImageDir)
+
+	// The data of the first secret is lost.
+	require.Error(t, checkCloneSecrets(createCfg))
+	createCfg.Secrets = createCfg.Secrets[1:]
+	require.NoError(t, checkCloneSecrets(createCfg))
+}
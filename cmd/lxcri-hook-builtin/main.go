@@ -23,6 +23,11 @@ func main() {
 		}
 	}
 
+	if err := setupPtmx(rootfs, spec); err != nil {
+		err := fmt.Errorf("failed to setup /dev/ptmx: %w", err)
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+
 	for _, p := range spec.Linux.MaskedPaths {
 		if err := maskPath(filepath.Join(rootfs, p)); err != nil {
 			err := fmt.Errorf("failed to mask path %s: %w", p, err)
@@ -90,3 +95,51 @@ func maskPath(p string) error {
 	}
 	return err
 }
+
+// setupPtmx creates /dev/ptmx for the /dev/pts mount of the container,
+// unless it was created from the spec (device or mount).
+// For a private devpts instance /dev/ptmx is a symlink to pts/ptmx
+// (see Documentation/filesystems/devpts.rst in the kernel source tree).
+// If /dev/pts is bind mounted from the host, the host /dev/ptmx is bind mounted,
+// because the pts/ptmx node of the host instance is usually inaccessible (ptmxmode=000).
+func setupPtmx(rootfs string, spec *specs.Spec) error {
+	var devpts *specs.Mount
+	for i, m := range spec.Mounts {
+		if filepath.Clean(m.Destination) == "/dev/pts" {
+			devpts = &spec.Mounts[i]
+		}
+	}
+	if devpts == nil {
+		return nil
+	}
+
+	ptmx := filepath.Join(rootfs, "dev/ptmx")
+	if _, err := os.Lstat(ptmx); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	if !isBindMount(devpts) {
+		return os.Symlink("pts/ptmx", ptmx)
+	}
+	// #nosec
+	f, err := os.OpenFile(ptmx, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return unix.Mount("/dev/ptmx", ptmx, "", unix.MS_BIND, "")
+}
+
+func isBindMount(m *specs.Mount) bool {
+	if m.Type == "bind" {
+		return true
+	}
+	for _, opt := range m.Options {
+		if opt == "bind" || opt == "rbind" {
+			return true
+		}
+	}
+	return false
+}
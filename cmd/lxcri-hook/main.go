@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/lxc/lxcri/pkg/specki"
@@ -69,7 +71,32 @@ func run(ctx context.Context, env *Env) error {
 	state.Status = status
 
 	fmt.Printf("running OCI hooks for lxc hook %q", env.Type)
-	return specki.RunHooks(ctx, &state, hooksToRun, false)
+	// NOTE keep in sync with lxcri.AnnotationBestEffortHooks
+	bestEffort := specki.HookPathMatcher(strings.Split(state.Annotations["lxcri.best-effort-hooks"], ","))
+	results, err := specki.RunHooksBestEffort(ctx, &state, hooksToRun, bestEffort)
+	// The runtime reads the results to report hook failures.
+	if err := writeResults(filepath.Join(runtimeDir, "hooks-result.json"), results); err != nil {
+		fmt.Printf("failed to write hook results: %s\n", err)
+	}
+	return err
+}
+
+// writeResults appends the given results as JSON lines to the given file.
+// The file is not created if the hook is not allowed to write to the runtime directory
+// (e.g the container root user is mapped to a user other than the runtime user).
+func writeResults(filename string, results []specki.HookResult) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
 }
 
 // https://github.com/opencontainers/runtime-spec/blob/master/specs-go/state.go
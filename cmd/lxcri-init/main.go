@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lxc/lxcri/pkg/specki"
@@ -14,7 +17,22 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// pauseArg is the argument lxcri-init is executed with to hold a pause container.
+const pauseArg = "pause"
+
+// execArg is the argument lxcri-init is executed with to start an exec process
+// in an exec sub-cgroup: `exec <cgroup.procs fd> <lxcri-init fd> <args...>`
+// NOTE keep in sync with lxcri.Container.runInExecCgroup
+const execArg = "exec"
+
 func main() {
+	if len(os.Args) == 2 && os.Args[1] == pauseArg {
+		holdPause()
+	}
+	if len(os.Args) > 4 && os.Args[1] == execArg {
+		execInCgroup(os.Args[2], os.Args[3], os.Args[4:])
+	}
+
 	// TODO use environment variable for runtime dir
 	runtimeDir, err := os.Getwd()
 	if err != nil {
@@ -68,20 +86,17 @@ func doInit(runtimeDir string, spec *specs.Spec) error {
 		return fmt.Errorf("failed to read spec %q: %s", statePath, err)
 	}
 
-	cmdPath := spec.Process.Args[0]
-	val, exist := specki.Getenv(spec.Process.Env, "PATH")
-	if exist {
-		err := os.Setenv("PATH", val)
-		if err != nil {
-			return fmt.Errorf("failed to set PATH environment variable: %s", err)
-		}
-		cmdPath, err = exec.LookPath(spec.Process.Args[0])
-		if err != nil {
-			return fmt.Errorf("lookup path for %s failed: %w", spec.Process.Args[0], err)
-		}
+	// NOTE keep in sync with lxcri.AnnotationPause
+	if spec.Annotations["lxcri.pause"] == "true" {
+		return execPause(runtimeDir, spec)
 	}
 
-	_, exist = specki.Getenv(spec.Process.Env, "HOME")
+	cmdPath, err := lookPath(spec)
+	if err != nil {
+		return err
+	}
+
+	_, exist := specki.Getenv(spec.Process.Env, "HOME")
 	if !exist {
 		addEnvHome(spec)
 	}
@@ -96,14 +111,44 @@ func doInit(runtimeDir string, spec *specs.Spec) error {
 		return err
 	}
 
+	// The process may be overridden after the container was created,
+	// e.g when it is claimed from a pool.
+	// NOTE keep in sync with lxcri.ProcessOverrideFile
+	proc, err := specki.LoadSpecProcessJSON(filepath.Join(runtimeDir, "process.json"))
+	if err == nil {
+		spec.Process.Args = proc.Args
+		spec.Process.Env = proc.Env
+		spec.Process.Cwd = proc.Cwd
+		if cmdPath, err = lookPath(spec); err != nil {
+			return err
+		}
+		if _, exist := specki.Getenv(spec.Process.Env, "HOME"); !exist {
+			addEnvHome(spec)
+		}
+		if err := unix.Chdir(spec.Process.Cwd); err != nil {
+			return fmt.Errorf("failed to change cwd to %s: %w", spec.Process.Cwd, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to load process override: %w", err)
+	}
+
 	// TODO use environment variable to control timeout
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
-	err = specki.RunHooks(ctx, state, spec.Hooks.StartContainer, false)
+	// NOTE keep in sync with lxcri.AnnotationBestEffortHooks
+	bestEffort := specki.HookPathMatcher(strings.Split(spec.Annotations["lxcri.best-effort-hooks"], ","))
+	_, err = specki.RunHooksBestEffort(ctx, state, spec.Hooks.StartContainer, bestEffort)
 	if err != nil {
 		return err
 	}
 
+	// NOTE keep in sync with lxcri.AnnotationCoreScheduling
+	if spec.Annotations["lxcri.core-scheduling"] == "true" {
+		if err := createSchedCoreCookie(); err != nil {
+			return err
+		}
+	}
+
 	unix.Unmount("/.lxcri/lxcri-init", unix.MNT_DETACH)
 	unix.Unmount("/.lxcri", unix.MNT_DETACH)
 
@@ -114,6 +159,109 @@ func doInit(runtimeDir string, spec *specs.Spec) error {
 	return nil
 }
 
+// execPause executes lxcri-init as holder process of a pause container.
+// The pause binary is not required. The changed command line of the init process
+// indicates that the container is running.
+func execPause(runtimeDir string, spec *specs.Spec) error {
+	if err := unix.Chdir(spec.Process.Cwd); err != nil {
+		return fmt.Errorf("failed to change cwd to %s: %w", spec.Process.Cwd, err)
+	}
+	if err := readSyncfifo(filepath.Join(runtimeDir, "syncfifo")); err != nil {
+		return err
+	}
+	self := "/.lxcri/lxcri-init"
+	err := unix.Exec(self, []string{self, pauseArg}, spec.Process.Env)
+	return fmt.Errorf("exec failed: %w", err)
+}
+
+// holdPause behaves like the pause binary: It reaps orphaned child processes
+// and exits on SIGINT and SIGTERM.
+func holdPause() {
+	unix.Unmount("/.lxcri/lxcri-init", unix.MNT_DETACH)
+	unix.Unmount("/.lxcri", unix.MNT_DETACH)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, unix.SIGINT, unix.SIGTERM, unix.SIGCHLD)
+	for sig := range sigs {
+		if sig != unix.SIGCHLD {
+			os.Exit(0)
+		}
+		for {
+			pid, err := unix.Wait4(-1, nil, unix.WNOHANG, nil)
+			if pid <= 0 || err != nil {
+				break
+			}
+		}
+	}
+}
+
+// execInCgroup joins the cgroup of the inherited cgroup.procs file descriptor
+// and executes the given command. The command is not executed
+// if joining the cgroup failed.
+func execInCgroup(procsFd string, initFd string, args []string) {
+	if err := joinCgroup(procsFd); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(126)
+	}
+	if fd, err := strconv.Atoi(initFd); err == nil {
+		unix.Close(fd)
+	}
+	cmdPath, err := exec.LookPath(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lookup path for %s failed: %s\n", args[0], err)
+		os.Exit(127)
+	}
+	err = unix.Exec(cmdPath, args, os.Environ())
+	fmt.Fprintf(os.Stderr, "exec failed: %s\n", err)
+	os.Exit(126)
+}
+
+func joinCgroup(procsFd string) error {
+	fd, err := strconv.Atoi(procsFd)
+	if err != nil {
+		return fmt.Errorf("invalid cgroup.procs file descriptor %q", procsFd)
+	}
+	defer unix.Close(fd)
+	// Writing 0 moves the writing process (all threads) into the cgroup.
+	if _, err := unix.Write(fd, []byte("0")); err != nil {
+		return fmt.Errorf("failed to join exec cgroup: %w", err)
+	}
+	return nil
+}
+
+// lookPath returns the path of the container process executable.
+func lookPath(spec *specs.Spec) (string, error) {
+	val, exist := specki.Getenv(spec.Process.Env, "PATH")
+	if !exist {
+		return spec.Process.Args[0], nil
+	}
+	if err := os.Setenv("PATH", val); err != nil {
+		return "", fmt.Errorf("failed to set PATH environment variable: %s", err)
+	}
+	cmdPath, err := exec.LookPath(spec.Process.Args[0])
+	if err != nil {
+		return "", fmt.Errorf("lookup path for %s failed: %w", spec.Process.Args[0], err)
+	}
+	return cmdPath, nil
+}
+
+// prctl(2) core scheduling commands (linux/prctl.h, kernel >= 5.14).
+// NOTE keep in sync with lxcri/schedcore.go
+const (
+	prSchedCore       = 62
+	prSchedCoreCreate = 1
+	pidtypeTGID       = 1
+)
+
+// createSchedCoreCookie creates a new core scheduling cookie for all threads
+// of the init process. The cookie is inherited by all child processes.
+func createSchedCoreCookie() error {
+	if err := unix.Prctl(prSchedCore, prSchedCoreCreate, 0, pidtypeTGID, 0); err != nil {
+		return fmt.Errorf("failed to create core scheduling cookie: %w", err)
+	}
+	return nil
+}
+
 func readSyncfifo(filename string) error {
 	f, err := os.OpenFile(filename, os.O_RDONLY, 0)
 	if err != nil {
@@ -2,10 +2,21 @@
 #include <dirent.h>
 #include <errno.h>
 #include <fcntl.h>
+#include <limits.h>
+#include <poll.h>
+#include <pthread.h>
 #include <signal.h>
+#include <stdarg.h>
+#include <stdbool.h>
 #include <stdio.h>
+#include <stdlib.h>
 #include <string.h>
+#include <sys/ioctl.h>
+#include <sys/prctl.h>
+#include <sys/syscall.h>
 #include <sys/types.h>
+#include <sys/wait.h>
+#include <time.h>
 #include <unistd.h>
 
 #include <lxc/lxccontainer.h>
@@ -16,13 +27,552 @@
 */
 #define ENABLE_LXCINIT 0
 
-#define ERROR(format, ...)                                                     \
+#ifndef __NR_close_range
+#define __NR_close_range 436
+#endif
+
+/*
+/ The runtime passes the file descriptor number of the error pipe
+/ in the environment variable LXCRI_ERROR_FD.
+/ Failures are reported as single line '<reason> <message>\n'
+/ where reason is a CamelCase identifier.
+*/
+static int errfd = -1;
+static pthread_mutex_t errfd_mutex = PTHREAD_MUTEX_INITIALIZER;
+
+static void report_error(const char *reason, const char *format, ...)
+{
+	va_list args;
+
+	pthread_mutex_lock(&errfd_mutex);
+	if (errfd < 0) {
+		pthread_mutex_unlock(&errfd_mutex);
+		return;
+	}
+
+	dprintf(errfd, "%s ", reason);
+	va_start(args, format);
+	vdprintf(errfd, format, args);
+	va_end(args);
+	dprintf(errfd, "\n");
+	pthread_mutex_unlock(&errfd_mutex);
+}
+
+/*
+/ The runtime closes the read end of the error pipe when the container
+/ is created. The error pipe is closed once the container is running,
+/ because a write to the pipe without reader kills the monitor with SIGPIPE.
+*/
+static void close_errfd(void)
+{
+	pthread_mutex_lock(&errfd_mutex);
+	if (errfd >= 0) {
+		close(errfd);
+		errfd = -1;
+	}
+	pthread_mutex_unlock(&errfd_mutex);
+}
+
+static void *close_errfd_when_running(void *arg)
+{
+	struct lxc_container *c = arg;
+
+	if (c->wait(c, "RUNNING", -1))
+		close_errfd();
+	return NULL;
+}
+
+/*
+/ Start a detached thread with all signals blocked, so that the signals
+/ liblxc reads from a signalfd (e.g SIGCHLD) are not delivered to the thread.
+*/
+static int start_thread(void *(*fn)(void *), void *arg)
+{
+	sigset_t all, old;
+	pthread_t t;
+	int err;
+
+	sigfillset(&all);
+	pthread_sigmask(SIG_SETMASK, &all, &old);
+	err = pthread_create(&t, NULL, fn, arg);
+	pthread_sigmask(SIG_SETMASK, &old, NULL);
+	if (err != 0) {
+		errno = err;
+		return -1;
+	}
+	pthread_detach(t);
+	return 0;
+}
+
+#define ERROR(reason, format, ...)                                             \
 	{                                                                      \
-		fprintf(stderr, "[lxcri-start] " format, ##__VA_ARGS__);       \
+		fprintf(stderr, "[lxcri-start] " format "\n", ##__VA_ARGS__);  \
+		report_error(reason, format, ##__VA_ARGS__);                   \
 		ret = EXIT_FAILURE;                                            \
 		goto out;                                                      \
 	}
 
+/* Close all file descriptors from first to last (inclusive). */
+static int close_fd_range(unsigned int first, unsigned int last)
+{
+	DIR *dirp = NULL;
+	struct dirent *entry = NULL;
+	int procfd;
+
+	if (syscall(__NR_close_range, first, last, 0) == 0)
+		return 0;
+	/* close_range requires kernel >= 5.9 */
+	if (errno != ENOSYS)
+		return -1;
+
+	procfd = open("/proc/self/fd", O_RDONLY | O_CLOEXEC);
+	if (procfd == -1)
+		return -1;
+
+	dirp = fdopendir(procfd);
+	if (dirp == NULL) {
+		close(procfd);
+		return -1;
+	}
+
+	while ((entry = readdir(dirp)) != NULL) {
+		char *end = NULL;
+		errno = 0;
+		long xfd = strtol(entry->d_name, &end, 10);
+		if (errno || *end != '\0')
+			continue;
+
+		if (xfd >= first && xfd <= last && xfd != procfd)
+			close(xfd);
+	}
+	closedir(dirp);
+	return 0;
+}
+
+/*
+/ Close all file descriptors >= first except keepfd.
+*/
+static int close_fds(int first, int keepfd)
+{
+	if (keepfd >= first) {
+		if (keepfd > first && close_fd_range(first, keepfd - 1) == -1)
+			return -1;
+		first = keepfd + 1;
+	}
+	return close_fd_range(first, ~0U);
+}
+
+/*
+/ Write the wait status of the container init process to the file
+/ 'exit-status' in the container runtime directory <lxcpath>/<name>.
+/ The file is written atomically, so the runtime never reads a partial status.
+*/
+static int write_exit_status(const char *lxcpath, const char *name, int status)
+{
+	char path[PATH_MAX];
+	char tmp_path[PATH_MAX];
+	int fd;
+	int n;
+
+	n = snprintf(path, sizeof(path), "%s/%s/exit-status", lxcpath, name);
+	if (n < 0 || (size_t)n >= sizeof(path))
+		return -1;
+	n = snprintf(tmp_path, sizeof(tmp_path), "%s.tmp", path);
+	if (n < 0 || (size_t)n >= sizeof(tmp_path))
+		return -1;
+
+	fd = open(tmp_path, O_WRONLY | O_CREAT | O_TRUNC | O_CLOEXEC, 0440);
+	if (fd == -1)
+		return -1;
+	if (dprintf(fd, "%d\n", status) < 0 || fsync(fd) == -1) {
+		close(fd);
+		return -1;
+	}
+	if (close(fd) == -1)
+		return -1;
+	return rename(tmp_path, path);
+}
+
+/*
+/ Sleep for the given number of seconds, also if interrupted by a signal.
+*/
+static void sleep_seconds(long seconds)
+{
+	struct timespec ts;
+
+	if (clock_gettime(CLOCK_MONOTONIC, &ts) == -1)
+		return;
+	ts.tv_sec += seconds;
+	while (clock_nanosleep(CLOCK_MONOTONIC, TIMER_ABSTIME, &ts, NULL) == EINTR)
+		;
+}
+
+/*
+/ The container is stopped when the maximum runtime LXCRI_MAX_RUNTIME (seconds)
+/ is exceeded. The init process receives SIGTERM, and SIGKILL if it did not exit
+/ within LXCRI_MAX_RUNTIME_GRACE seconds. The file 'deadline-exceeded' is created
+/ in the container runtime directory to record the reason.
+/ The watchdog is a child process, because liblxc runs the container
+/ mainloop in the monitor process. It is killed when the container exits,
+/ and it dies with the monitor process.
+*/
+static pid_t start_deadline_watchdog(struct lxc_container *c,
+				     const char *lxcpath, const char *name,
+				     long max_runtime, long grace)
+{
+	char path[PATH_MAX];
+	pid_t pid;
+	pid_t ppid = getpid();
+	int fd;
+	int n;
+
+	n = snprintf(path, sizeof(path), "%s/%s/deadline-exceeded", lxcpath,
+		     name);
+	if (n < 0 || (size_t)n >= sizeof(path)) {
+		errno = ENAMETOOLONG;
+		return -1;
+	}
+
+	pid = fork();
+	if (pid != 0)
+		return pid;
+
+	if (prctl(PR_SET_PDEATHSIG, SIGKILL) == -1 || getppid() != ppid)
+		_exit(EXIT_FAILURE);
+
+	sleep_seconds(max_runtime);
+
+	fd = open(path, O_WRONLY | O_CREAT | O_TRUNC | O_CLOEXEC, 0440);
+	if (fd != -1)
+		close(fd);
+	fprintf(stderr, "[lxcri-start] maximum runtime of %lds exceeded\n",
+		max_runtime);
+
+	pid = c->init_pid(c);
+	if (pid > 0 && kill(pid, SIGTERM) == 0) {
+		sleep_seconds(grace);
+		/* The init process exited if the container is not running. */
+		pid = c->init_pid(c);
+		if (pid > 0)
+			kill(pid, SIGKILL);
+	}
+	_exit(EXIT_SUCCESS);
+}
+
+/*
+/ Container stdout and stderr are written to the CRI log file
+/ in the format `<RFC3339Nano timestamp> <stream> <P|F> <line>`
+/ (as written by conmon), if the runtime sets LXCRI_CRI_LOG.
+/ Lines longer than CRI_LOG_LINE_MAX are split into partial (P) lines.
+*/
+#define CRI_LOG_LINE_MAX 16384
+
+struct cri_stream {
+	const char *name;
+	int fd;	/* read end of the container stdio pipe */
+	int out;   /* the inherited stdio file descriptor */
+	size_t len;
+	char buf[CRI_LOG_LINE_MAX];
+};
+
+static int write_all(int fd, const char *buf, size_t len)
+{
+	while (len > 0) {
+		ssize_t n = write(fd, buf, len);
+		if (n == -1) {
+			if (errno == EINTR)
+				continue;
+			return -1;
+		}
+		buf += n;
+		len -= (size_t)n;
+	}
+	return 0;
+}
+
+static int cri_log_line(int logfd, const char *stream, const char *tag,
+			const char *line, size_t len)
+{
+	char ts[64];
+	struct timespec now;
+	struct tm tm;
+	int n;
+
+	/* The log file is not written anymore (see cri_log_copy). */
+	if (logfd == -1)
+		return 0;
+
+	clock_gettime(CLOCK_REALTIME, &now);
+	gmtime_r(&now.tv_sec, &tm);
+	n = (int)strftime(ts, sizeof(ts), "%Y-%m-%dT%H:%M:%S", &tm);
+	n += snprintf(ts + n, sizeof(ts) - n, ".%09ldZ", now.tv_nsec);
+
+	if (dprintf(logfd, "%s %s %s ", ts, stream, tag) < 0)
+		return -1;
+	if (write_all(logfd, line, len) == -1)
+		return -1;
+	return write_all(logfd, "\n", 1);
+}
+
+/*
+/ Write all complete lines in the stream buffer to the log file.
+/ The lines are consumed even if they can not be written.
+/ Returns -1 with errno set if writing a line failed.
+*/
+static int cri_log_flush(int logfd, struct cri_stream *s, bool eof)
+{
+	size_t start = 0;
+	int ret = 0;
+
+	for (size_t i = 0; i < s->len; i++) {
+		if (s->buf[i] != '\n')
+			continue;
+		if (cri_log_line(logfd, s->name, "F", s->buf + start, i - start) == -1)
+			ret = -1;
+		start = i + 1;
+	}
+	if (start == 0 && s->len == sizeof(s->buf)) {
+		if (cri_log_line(logfd, s->name, "P", s->buf, s->len) == -1)
+			ret = -1;
+		start = s->len;
+	} else if (eof && start < s->len) {
+		if (cri_log_line(logfd, s->name, "F", s->buf + start, s->len - start) == -1)
+			ret = -1;
+		start = s->len;
+	}
+	memmove(s->buf, s->buf + start, s->len - start);
+	s->len -= start;
+	return ret;
+}
+
+/*
+/ Copy the container output from the stdio pipes to the log file
+/ and the inherited stdio until all writers have closed the pipes.
+/ A destination whose reader has gone away (EPIPE) is not written anymore,
+/ but the pipes are still drained, so that the container does not block.
+/ SIGPIPE must be ignored by the caller.
+*/
+static void cri_log_copy(int logfd, struct cri_stream *streams, int nstreams)
+{
+	struct pollfd fds[2];
+	int open = nstreams;
+
+	for (int i = 0; i < nstreams; i++) {
+		fds[i].fd = streams[i].fd;
+		fds[i].events = POLLIN;
+	}
+
+	while (open > 0) {
+		if (poll(fds, nstreams, -1) == -1) {
+			if (errno == EINTR)
+				continue;
+			return;
+		}
+		for (int i = 0; i < nstreams; i++) {
+			struct cri_stream *s = &streams[i];
+			ssize_t n;
+
+			if (fds[i].fd == -1 || fds[i].revents == 0)
+				continue;
+
+			n = read(s->fd, s->buf + s->len, sizeof(s->buf) - s->len);
+			if (n == -1 && errno == EINTR)
+				continue;
+			if (n <= 0) {
+				if (cri_log_flush(logfd, s, true) == -1 && errno == EPIPE)
+					logfd = -1;
+				fds[i].fd = -1;
+				open--;
+				continue;
+			}
+			/* The inherited stdio may be closed. */
+			if (s->out != -1 &&
+			    write_all(s->out, s->buf + s->len, (size_t)n) == -1 &&
+			    errno == EPIPE)
+				s->out = -1;
+			s->len += (size_t)n;
+			if (cri_log_flush(logfd, s, false) == -1 && errno == EPIPE)
+				logfd = -1;
+		}
+	}
+}
+
+/*
+/ Replace stdout and stderr with pipes whose output is copied
+/ by a forked logger process to the CRI log file and the original stdio.
+/ The logger process exits when the container and the monitor have exited.
+*/
+static int setup_cri_log(const char *path, int keepfds)
+{
+	static struct cri_stream streams[2] = {
+		{.name = "stdout", .out = STDOUT_FILENO},
+		{.name = "stderr", .out = STDERR_FILENO},
+	};
+	int pipes[2][2];
+	int logfd;
+	pid_t pid;
+
+	logfd = open(path, O_WRONLY | O_APPEND | O_CREAT | O_CLOEXEC, 0640);
+	if (logfd == -1)
+		return -1;
+
+	for (int i = 0; i < 2; i++) {
+		if (pipe2(pipes[i], O_CLOEXEC) == -1)
+			return -1;
+	}
+
+	pid = fork();
+	if (pid == -1)
+		return -1;
+
+	if (pid == 0) {
+		/*
+		/ Do not hold the error pipe and the socket activation file descriptors
+		/ open and leave the process group, so that the logger is not killed
+		/ before the container output is drained (see kill below).
+		*/
+		if (errfd >= 0)
+			close(errfd);
+		for (int fd = 3; fd < 3 + keepfds; fd++)
+			close(fd);
+		setpgid(0, 0);
+		/*
+		/ The reader of the inherited stdio (or of a log FIFO) may exit
+		/ before the container, the writes fail with EPIPE instead.
+		*/
+		signal(SIGPIPE, SIG_IGN);
+		for (int i = 0; i < 2; i++) {
+			close(pipes[i][1]);
+			streams[i].fd = pipes[i][0];
+		}
+		cri_log_copy(logfd, streams, 2);
+		_exit(EXIT_SUCCESS);
+	}
+
+	close(logfd);
+	for (int i = 0; i < 2; i++) {
+		close(pipes[i][0]);
+		/* dup2 clears the close-on-exec flag. */
+		if (dup2(pipes[i][1], streams[i].out) == -1)
+			return -1;
+		close(pipes[i][1]);
+	}
+	return 0;
+}
+
+/*
+/ Terminal control messages are read from the FIFOs 'ctl' and 'winsz'
+/ in the container runtime directory, if the runtime sets LXCRI_CTL.
+/ The messages have the format '<type> <height> <width>\n' used by conmon.
+/ A resize message (CTL_RESIZE) sets the size of the terminal passed
+/ to the console socket, which is the stdin of the monitor.
+/ liblxc receives SIGWINCH and forwards the size to the container console.
+/ Other message types (e.g conmon's request to reopen the log) are ignored.
+*/
+#define CTL_RESIZE 1
+#define CTL_MSG_MAX 64
+
+struct ctl_fifo {
+	const char *name;
+	int fd;
+	size_t len;
+	char buf[CTL_MSG_MAX];
+};
+
+static void ctl_message(const char *fifo, const char *msg)
+{
+	struct winsize ws = {0};
+	int type;
+
+	if (sscanf(msg, "%d %hu %hu", &type, &ws.ws_row, &ws.ws_col) != 3) {
+		fprintf(stderr, "[lxcri-start] invalid %s message '%s'\n", fifo,
+			msg);
+		return;
+	}
+	if (type != CTL_RESIZE) {
+		fprintf(stderr, "[lxcri-start] ignored %s message type %d\n",
+			fifo, type);
+		return;
+	}
+	if (ioctl(STDIN_FILENO, TIOCSWINSZ, &ws) == -1)
+		fprintf(stderr, "[lxcri-start] failed to resize terminal: %s\n",
+			strerror(errno));
+}
+
+/* Process the complete messages in the FIFO buffer. */
+static void ctl_read(struct ctl_fifo *f)
+{
+	size_t start = 0;
+	ssize_t n;
+
+	n = read(f->fd, f->buf + f->len, sizeof(f->buf) - 1 - f->len);
+	if (n <= 0)
+		return;
+	f->len += (size_t)n;
+
+	for (size_t i = 0; i < f->len; i++) {
+		if (f->buf[i] != '\n')
+			continue;
+		f->buf[i] = '\0';
+		ctl_message(f->name, f->buf + start);
+		start = i + 1;
+	}
+	/* A message that exceeds the buffer is discarded. */
+	if (start == 0 && f->len == sizeof(f->buf) - 1)
+		start = f->len;
+	memmove(f->buf, f->buf + start, f->len - start);
+	f->len -= start;
+}
+
+static void *ctl_loop(void *arg)
+{
+	struct ctl_fifo *fifos = arg;
+	struct pollfd fds[2];
+
+	for (int i = 0; i < 2; i++) {
+		fds[i].fd = fifos[i].fd;
+		fds[i].events = POLLIN;
+	}
+	for (;;) {
+		if (poll(fds, 2, -1) == -1) {
+			if (errno == EINTR)
+				continue;
+			return NULL;
+		}
+		for (int i = 0; i < 2; i++) {
+			if (fds[i].revents != 0)
+				ctl_read(&fifos[i]);
+		}
+	}
+}
+
+/*
+/ The FIFOs are opened for reading and writing, so that the monitor
+/ does not see EOF when a writer closes the FIFO.
+*/
+static int start_ctl(const char *lxcpath, const char *name)
+{
+	static struct ctl_fifo fifos[2] = {
+		{.name = "ctl", .fd = -1},
+		{.name = "winsz", .fd = -1},
+	};
+	char path[PATH_MAX];
+	int n;
+
+	for (int i = 0; i < 2; i++) {
+		n = snprintf(path, sizeof(path), "%s/%s/%s", lxcpath, name,
+			     fifos[i].name);
+		if (n < 0 || (size_t)n >= sizeof(path)) {
+			errno = ENAMETOOLONG;
+			return -1;
+		}
+		fifos[i].fd = open(path, O_RDWR | O_NONBLOCK | O_CLOEXEC);
+		if (fifos[i].fd == -1)
+			return -1;
+	}
+	return start_thread(ctl_loop, fifos);
+}
+
 /* NOTE lxc_execute.c was taken as guidline and some lines where copied. */
 int main(int argc, char **argv)
 {
@@ -31,15 +581,24 @@ int main(int argc, char **argv)
 	const char *name;
 	const char *lxcpath;
 	const char *rcfile;
+	pid_t watchdog = -1;
 
 	/* Ensure stdout and stderr are line bufferd. */
 	setvbuf(stdout, NULL, _IOLBF, -1);
 	setvbuf(stderr, NULL, _IOLBF, -1);
 	errno = 0;
 
+	char *env_errfd = getenv("LXCRI_ERROR_FD");
+	if (env_errfd != NULL) {
+		errfd = atoi(env_errfd);
+		/* Do not leak the error pipe into the container. */
+		if (errfd > 2 && fcntl(errfd, F_SETFD, FD_CLOEXEC) == -1)
+			errfd = -1;
+	}
+
 	if (argc != 4)
-		ERROR("invalid argument count, usage: "
-		      "$0 <container_name> <lxcpath> <config_path>\n");
+		ERROR("InvalidArguments", "invalid argument count, usage: "
+					  "$0 <container_name> <lxcpath> <config_path>");
 
 	/*
 	/ If this is non interactive, get rid of our controlling terminal,
@@ -53,63 +612,145 @@ int main(int argc, char **argv)
 	lxcpath = argv[2];
 	rcfile = argv[3];
 
-	/* Close all file descriptors but stdio (0,1,2).
-	 * To pass additional file descriptors to the runtime
-	 * in order to enable [socket activation][systemd-listen-fds]
-	 * the environment variable LISTEN_FDS can be used.
-	 * If LISTEN_FDS is set to a value n > 0, than all
-	 * filedescriptors > 2+n are kept open.
+	/* Close all file descriptors that are not in the allowlist:
+	 * - stdio (0,1,2)
+	 * - the file descriptors passed for [socket activation][systemd-listen-fds]
+	 *   If LISTEN_FDS is set to a value n > 0, then the file descriptors
+	 *   3 to 2+n are kept open.
+	 * - the error pipe (LXCRI_ERROR_FD)
+	 * This prevents the container from holding file descriptors (e.g host
+	 * sockets) open, that were leaked by the caller of the runtime.
 	 */
-
-	int procfd;
-	DIR *dirp = NULL;
-	struct dirent *entry = NULL;
 	int keepfds = 0;
 	char *env_listen = getenv("LISTEN_FDS");
 
 	if (env_listen != NULL)
 		keepfds = atoi(env_listen);
+	if (keepfds < 0)
+		keepfds = 0;
 
-	procfd = open("/proc/self/fd", O_RDONLY | O_CLOEXEC);
-	if (procfd == -1)
-		ERROR("open /proc/self/fd failed");
-
-	dirp = fdopendir(procfd);
-	if (dirp == NULL)
-		ERROR("fdopendir for /proc/self/fd failed");
-
-	while ((entry = readdir(dirp)) != NULL) {
-		errno = 0; // reset errno from previous strtol or close
-		int xfd = strtol(entry->d_name, NULL, 10);
-		if (errno)
-			continue;
-
-		if ((xfd > 2 + keepfds) && (xfd != procfd))
-			close(xfd);
-	}
+	if (close_fds(3 + keepfds, errfd) == -1)
+		ERROR("CloseFds", "failed to close inherited file descriptors: %s",
+		      strerror(errno));
 
-	closedir(dirp);
+	char *env_cri_log = getenv("LXCRI_CRI_LOG");
+	if (env_cri_log != NULL && setup_cri_log(env_cri_log, keepfds) == -1)
+		ERROR("CRILog", "failed to setup CRI log %s: %s", env_cri_log,
+		      strerror(errno));
 
 	c = lxc_container_new(name, lxcpath);
 	if (c == NULL)
-		ERROR("failed to create new container");
+		ERROR("NewContainer", "failed to create new container %s in %s",
+		      name, lxcpath);
 
 	c->clear_config(c);
 
 	if (!c->load_config(c, rcfile))
-		ERROR("failed to load container config %s\n", rcfile);
+		ERROR("LoadConfig", "failed to load container config %s",
+		      rcfile);
 
 	/* Do not daemonize - this would null the inherited stdio. */
 	c->daemonize = false;
-	c->start(c, ENABLE_LXCINIT, NULL);
+
+	/* The runtime dumps the container in a child process, if the CRIU
+	 * configuration file must be passed to criu in the environment
+	 * (see lazyDump in lazypages.go). */
+	char *env_dump = getenv("LXCRI_DUMP_DIR");
+	if (env_dump != NULL) {
+		struct migrate_opts opts = {
+			.directory = env_dump,
+			.predump_dir = getenv("LXCRI_DUMP_PREDUMP_DIR"),
+			.action_script = getenv("LXCRI_DUMP_ACTION_SCRIPT"),
+			.verbose = getenv("LXCRI_DUMP_VERBOSE") != NULL,
+			.stop = getenv("LXCRI_DUMP_STOP") != NULL,
+		};
+
+		if (c->migrate(c, MIGRATE_DUMP, &opts, sizeof(opts)) != 0)
+			ERROR("DumpFailed", "failed to dump container to %s",
+			      env_dump);
+		goto out;
+	}
+
+	char *env_restore = getenv("LXCRI_RESTORE_DIR");
+	if (env_restore != NULL) {
+		/* The restored process tree is monitored by a child process
+		 * forked by liblxc. The exit status of the init process is not
+		 * reported to us, so no exit status is written. */
+		if (!c->restore(c, env_restore, false))
+			ERROR("RestoreFailed",
+			      "failed to restore container from %s",
+			      env_restore);
+		close_errfd();
+		while (waitpid(-1, NULL, 0) > 0 || errno == EINTR)
+			;
+		goto out;
+	}
+
+	char *env_max_runtime = getenv("LXCRI_MAX_RUNTIME");
+	if (env_max_runtime != NULL) {
+		long max_runtime = atol(env_max_runtime);
+		long grace = 0;
+		char *env_grace = getenv("LXCRI_MAX_RUNTIME_GRACE");
+
+		if (env_grace != NULL)
+			grace = atol(env_grace);
+		if (max_runtime <= 0 || grace < 0)
+			ERROR("InvalidMaxRuntime",
+			      "invalid maximum runtime %s (grace period %s)",
+			      env_max_runtime, env_grace ? env_grace : "0");
+		watchdog = start_deadline_watchdog(c, lxcpath, name,
+						   max_runtime, grace);
+		if (watchdog == -1)
+			ERROR("MaxRuntime",
+			      "failed to start deadline watchdog: %s",
+			      strerror(errno));
+	}
+
+	int status;
+	bool started;
+
+	if (getenv("LXCRI_CTL") != NULL && start_ctl(lxcpath, name) == -1)
+		ERROR("TerminalControl",
+		      "failed to start terminal control: %s", strerror(errno));
+
+	if (start_thread(close_errfd_when_running, c) == -1)
+		ERROR("ErrorPipe", "failed to start error pipe closer: %s",
+		      strerror(errno));
+
+	started = c->start(c, ENABLE_LXCINIT, NULL);
+	if (!started) {
+		/* The details are written to the container log.
+		 * The failure is only reported if the container was not
+		 * running yet, the error pipe is closed otherwise. */
+		report_error("StartFailed",
+			     "failed to start container (error %d): %s",
+			     c->error_num,
+			     c->error_string ? c->error_string
+					     : "see container log for details");
+	}
+	close_errfd();
+
+	if (watchdog > 0) {
+		kill(watchdog, SIGKILL);
+		waitpid(watchdog, NULL, 0);
+	}
+
+	/* Init never ran if start failed without an exit status of init,
+	 * the container is stopped with a failure status anyways. */
+	status = c->error_num;
+	if (!started && status == 0)
+		status = W_EXITCODE(EXIT_FAILURE, 0);
+	if (write_exit_status(lxcpath, name, status) == -1)
+		fprintf(stderr, "[lxcri-start] failed to write exit status: %s\n",
+			strerror(errno));
 
 	/* Try to die with the same signal the task did. */
 	/* FIXME error_num is zero if init was killed with SIGHUP */
 	if (WIFSIGNALED(c->error_num))
 		kill(0, WTERMSIG(c->error_num));
 
-	if (WIFEXITED(c->error_num))
-		ret = WEXITSTATUS(c->error_num);
+	if (WIFEXITED(status))
+		ret = WEXITSTATUS(status);
 out:
 	if (c != NULL)
 		lxc_container_put(c);
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/urfave/cli/v2"
+)
+
+func checkpointCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "checkpoint",
+		Usage:  "checkpoint a running container with CRIU",
+		Action: doCheckpoint,
+		ArgsUsage: `<containerID>
+
+<containerID> is the ID of the running container to checkpoint
+
+The process tree of the container is dumped to CRIU images in --image-dir
+and the container is stopped, unless --leave-running is set.
+The container can be restored with 'lxcri create --restore <image-dir>'.
+`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "image-dir",
+				Usage:    "directory for the checkpoint images",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "leave-running",
+				Usage: "leave the container running after the checkpoint",
+			},
+			&cli.IntFlag{
+				Name:  "pre-dumps",
+				Usage: "number of memory pre-dumps before the final dump",
+			},
+			&cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "enable verbose CRIU logging to the container log",
+			},
+			&cli.UintFlag{
+				Name:  "timeout",
+				Usage: "maximum duration in seconds for the checkpoint",
+				Value: 300,
+			},
+		},
+	}
+}
+
+func doCheckpoint(ctxcli *cli.Context) error {
+	imageDir, err := filepath.Abs(ctxcli.String("image-dir"))
+	if err != nil {
+		return err
+	}
+	if ctxcli.Int("pre-dumps") < 0 {
+		return fmt.Errorf("invalid number of pre-dumps %d", ctxcli.Int("pre-dumps"))
+	}
+
+	timeout := time.Duration(ctxcli.Uint("timeout")) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := clxc.lockContainer(ctx, true); err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+	return c.Checkpoint(ctx, lxcri.CheckpointOptions{
+		ImageDir:     imageDir,
+		LeaveRunning: ctxcli.Bool("leave-running"),
+		PreDumps:     ctxcli.Int("pre-dumps"),
+		Verbose:      ctxcli.Bool("verbose"),
+	})
+}
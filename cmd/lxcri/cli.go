@@ -5,27 +5,30 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"os/user"
 	"path/filepath"
-	"text/template"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lxc/lxcri"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/unix"
 	"sigs.k8s.io/yaml"
 )
 
-var (
-	version = "undefined"
-)
-
 type app struct {
 	*lxcri.Runtime
 
 	command     string
 	containerID string
+	lock        *lxcri.Lock
 }
 
 var clxc app
@@ -40,6 +43,35 @@ func (app *app) loadContainer(containerID string) (*lxcri.Container, error) {
 	return c, err
 }
 
+// lockContainer locks the runtime directory of the container,
+// to serialize the command with concurrent runtime invocations.
+// The lock is held until the command returns.
+func (app *app) lockContainer(ctx context.Context, exclusive bool) error {
+	l, err := app.Lock(ctx, app.containerID, exclusive)
+	if err != nil {
+		return err
+	}
+	app.lock = l
+	return nil
+}
+
+func (app *app) unlockContainer() {
+	if err := app.lock.Unlock(); err != nil {
+		app.Runtime.Log.Error().Msgf("failed to unlock container: %s", err)
+	}
+}
+
+// loadContainerShared loads the container with the shared container lock held,
+// and releases the lock after loading. It is used by commands that run
+// until the container process exits, which must not block kill or delete.
+func (app *app) loadContainerShared(ctx context.Context) (*lxcri.Container, error) {
+	if err := app.lockContainer(ctx, false); err != nil {
+		return nil, err
+	}
+	defer app.unlockContainer()
+	return app.loadContainer(app.containerID)
+}
+
 func (app *app) releaseContainer(c *lxcri.Container) {
 	if c == nil {
 		return
@@ -57,7 +89,8 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "lxcri"
 	app.Usage = "lxcri is a OCI compliant runtime wrapper for lxc"
-	app.Version = version
+	app.Version = lxcri.BuildInfo().Version
+	cli.VersionPrinter = printVersion
 
 	// Disable the default ExitErrHandler.
 	// It will call os.Exit if a command returns an error that implements
@@ -68,11 +101,25 @@ func main() {
 		createCmd(),
 		startCmd(),
 		killCmd(),
+		pauseCmd(),
+		resumeCmd(),
+		updateCmd(),
+		waitCmd(),
 		deleteCmd(),
 		execCmd(),
 		inspectCmd(),
 		listCmd(),
 		configCmd(),
+		checkCmd(),
+		featuresCmd(),
+		gcCmd(),
+		addTenantCmd(),
+		serveEventsCmd(),
+		eventsCmd(),
+		statsCmd(),
+		psCmd(),
+		checkpointCmd(),
+		migrateCmd(),
 	}
 
 	app.Flags = []cli.Flag{
@@ -117,6 +164,13 @@ func main() {
 			Destination: &clxc.LogConfig.LogConsole,
 			Value:       isTerminal(0),
 		},
+		&cli.StringFlag{
+			Name:        "log-console-level",
+			Usage:       "additionally write log output to stdout with the given log level (if --log-console is not set)",
+			EnvVars:     []string{"LXCRI_LOG_CONSOLE_LEVEL"},
+			Value:       clxc.LogConfig.ConsoleLogLevel,
+			Destination: &clxc.LogConfig.ConsoleLogLevel,
+		},
 		&cli.StringFlag{
 			Name:    "root",
 			Usage:   "root directory for storage of container runtime state (tmpfs is recommended)",
@@ -125,6 +179,20 @@ func main() {
 			Value:       clxc.Root,
 			Destination: &clxc.Root,
 		},
+		&cli.BoolFlag{
+			Name:        "multi-tenant",
+			Usage:       "isolate the containers of each user in a private subdirectory of the runtime root",
+			EnvVars:     []string{"LXCRI_MULTI_TENANT"},
+			Value:       clxc.MultiTenant,
+			Destination: &clxc.MultiTenant,
+		},
+		&cli.StringFlag{
+			Name:        "runtime-dir-permissions",
+			Usage:       "permissions policy for container runtime directories [minimal|world]",
+			EnvVars:     []string{"LXCRI_RUNTIME_DIR_PERMISSIONS"},
+			Value:       clxc.RuntimeDirPermissions,
+			Destination: &clxc.RuntimeDirPermissions,
+		},
 		&cli.BoolFlag{
 			Name:  "systemd-cgroup",
 			Usage: "cgroup path in container spec is systemd encoded and must be expanded",
@@ -138,7 +206,7 @@ func main() {
 		},
 		&cli.StringFlag{
 			Name:        "libexec",
-			Usage:       "path to directory that contains the runtime executables",
+			Usage:       "path to directory that contains the runtime executables (empty to use the embedded executables)",
 			EnvVars:     []string{"LXCRI_LIBEXEC"},
 			Value:       clxc.LibexecDir,
 			Destination: &clxc.LibexecDir,
@@ -164,6 +232,13 @@ func main() {
 			Value:       clxc.Features.CgroupDevices,
 			Destination: &clxc.Features.CgroupDevices,
 		},
+		&cli.BoolFlag{
+			Name:        "cpu-realtime",
+			Usage:       "apply realtime CPU bandwidth limits defined in container spec",
+			EnvVars:     []string{"LXCRI_CPU_REALTIME"},
+			Value:       clxc.Features.CPURealtime,
+			Destination: &clxc.Features.CPURealtime,
+		},
 		&cli.BoolFlag{
 			Name:        "seccomp",
 			Usage:       "Generate and apply seccomp profile for lxc from container spec",
@@ -171,6 +246,87 @@ func main() {
 			Value:       clxc.Features.Seccomp,
 			Destination: &clxc.Features.Seccomp,
 		},
+		&cli.BoolFlag{
+			Name:        "allow-config-drift",
+			Usage:       "load containers even if the generated configuration was modified after create",
+			EnvVars:     []string{"LXCRI_ALLOW_CONFIG_DRIFT"},
+			Value:       clxc.AllowConfigDrift,
+			Destination: &clxc.AllowConfigDrift,
+		},
+		&cli.StringFlag{
+			Name:        "cgroup-root",
+			Usage:       "cgroup2 mountpoint (detected if empty)",
+			EnvVars:     []string{"LXCRI_CGROUP_ROOT"},
+			Value:       clxc.CgroupRoot,
+			Destination: &clxc.CgroupRoot,
+		},
+		&cli.StringSliceFlag{
+			Name:    "ignore-check",
+			Usage:   "do not abort if the given host check fails [procfs|cgroup2] (can be repeated)",
+			EnvVars: []string{"LXCRI_IGNORE_CHECKS"},
+			Value:   cli.NewStringSlice(clxc.IgnoreChecks...),
+		},
+		&cli.StringSliceFlag{
+			Name:    "default-sysctl",
+			Usage:   "namespaced sysctl (key=value) set in all containers, unless the spec sets it (can be repeated)",
+			EnvVars: []string{"LXCRI_DEFAULT_SYSCTLS"},
+		},
+		&cli.StringFlag{
+			Name:        "cpu-pool",
+			Usage:       "list of CPUs that are allocated exclusively for containers, or 'isolated' for the isolcpus",
+			EnvVars:     []string{"LXCRI_CPU_POOL"},
+			Value:       clxc.CPUPool,
+			Destination: &clxc.CPUPool,
+		},
+		&cli.BoolFlag{
+			Name:        "host-localtime",
+			Usage:       "bind mount the host timezone files into all containers that lack them",
+			EnvVars:     []string{"LXCRI_HOST_LOCALTIME"},
+			Value:       clxc.HostLocaltime,
+			Destination: &clxc.HostLocaltime,
+		},
+		&cli.BoolFlag{
+			Name:        "host-dns",
+			Usage:       "propagate the host DNS config to all containers without DNS config and resolv.conf mount",
+			EnvVars:     []string{"LXCRI_HOST_DNS"},
+			Value:       clxc.HostDNS,
+			Destination: &clxc.HostDNS,
+		},
+		&cli.BoolFlag{
+			Name:        "manage-hosts",
+			Usage:       "generate /etc/hosts for all containers without /etc/hosts mount",
+			EnvVars:     []string{"LXCRI_MANAGE_HOSTS"},
+			Value:       clxc.ManageHosts,
+			Destination: &clxc.ManageHosts,
+		},
+		&cli.StringFlag{
+			Name:        "lxcfs",
+			Usage:       "LXCFS mountpoint or 'auto' to detect it - bind mount the LXCFS proc and sys files into all containers",
+			EnvVars:     []string{"LXCRI_LXCFS"},
+			Value:       clxc.LXCFS,
+			Destination: &clxc.LXCFS,
+		},
+		&cli.BoolFlag{
+			Name:        "pause-fast-path",
+			Usage:       "create pause (infra) containers without seccomp profile, device files and hooks",
+			EnvVars:     []string{"LXCRI_PAUSE_FAST_PATH"},
+			Value:       clxc.PauseFastPath,
+			Destination: &clxc.PauseFastPath,
+		},
+		&cli.BoolFlag{
+			Name:        "seccomp-default",
+			Usage:       "apply the default seccomp profile to containers without seccomp profile",
+			EnvVars:     []string{"LXCRI_SECCOMP_DEFAULT"},
+			Value:       clxc.SeccompDefault,
+			Destination: &clxc.SeccompDefault,
+		},
+		&cli.StringFlag{
+			Name:        "seccomp-default-profile",
+			Usage:       "path to the default seccomp profile (OCI format) - the builtin profile is used if empty",
+			EnvVars:     []string{"LXCRI_SECCOMP_DEFAULT_PROFILE"},
+			Value:       clxc.SeccompDefaultProfile,
+			Destination: &clxc.SeccompDefaultProfile,
+		},
 		&cli.UintFlag{
 			Name:        "create-timeout",
 			Usage:       "maximum duration in seconds for create to complete",
@@ -199,6 +355,20 @@ func main() {
 			Value:       clxc.Timeouts.DeleteTimeout,
 			Destination: &clxc.Timeouts.DeleteTimeout,
 		},
+		&cli.UintFlag{
+			Name:        "poll-interval",
+			Usage:       "initial interval in milliseconds for polling container state changes",
+			EnvVars:     []string{"LXCRI_POLL_INTERVAL"},
+			Value:       clxc.Backoff.InitialInterval,
+			Destination: &clxc.Backoff.InitialInterval,
+		},
+		&cli.UintFlag{
+			Name:        "poll-max-interval",
+			Usage:       "maximum interval in milliseconds for polling container state changes",
+			EnvVars:     []string{"LXCRI_POLL_MAX_INTERVAL"},
+			Value:       clxc.Backoff.MaxInterval,
+			Destination: &clxc.Backoff.MaxInterval,
+		},
 	}
 
 	startTime := time.Now()
@@ -217,12 +387,26 @@ func main() {
 
 	app.Before = func(ctx *cli.Context) error {
 		clxc.command = ctx.Args().Get(0)
+		clxc.IgnoreChecks = ctx.StringSlice("ignore-check")
+		if ctx.IsSet("default-sysctl") {
+			sysctls, err := parseSysctls(ctx.StringSlice("default-sysctl"))
+			if err != nil {
+				return err
+			}
+			// The flags take precedence over the config file.
+			if clxc.DefaultSysctls == nil {
+				clxc.DefaultSysctls = make(map[string]string, len(sysctls))
+			}
+			for key, val := range sysctls {
+				clxc.DefaultSysctls[key] = val
+			}
+		}
 		return nil
 	}
 
 	setupCmd := func(ctx *cli.Context) error {
 		switch clxc.command {
-		case "list":
+		case "list", "events", "features", "add-tenant":
 			if err := clxc.ConfigureLogger(); err != nil {
 				return err
 			}
@@ -235,6 +419,16 @@ func main() {
 				return err
 			}
 			clxc.Runtime.LogConfig = logCfg
+		case "serve-events", "gc":
+			clxc.LogConfig.LogContext = map[string]string{"cmd": clxc.command}
+			if err := clxc.Init(); err != nil {
+				return err
+			}
+		case "check":
+			// The failed checks are reported by the check command.
+			if err := clxc.Init(); err != nil {
+				clxc.Log.Debug().Msgf("runtime init failed: %s", err)
+			}
 		default:
 			containerID := ctx.Args().Get(0)
 			if len(containerID) == 0 {
@@ -267,6 +461,7 @@ func main() {
 	}
 
 	err := app.Run(os.Args)
+	clxc.unlockContainer()
 
 	cmdDuration := time.Since(startTime)
 
@@ -303,6 +498,11 @@ func createCmd() *cli.Command {
 				Usage: "set bundle directory",
 				Value: ".",
 			},
+			&cli.StringFlag{
+				Name:    "bundle-config",
+				Aliases: []string{"config"},
+				Usage:   "path to the container spec, or '-' to read it from stdin (defaults to config.json in the bundle directory)",
+			},
 			&cli.StringFlag{
 				Name:  "console-socket",
 				Usage: "send container pty master fd to this socket path",
@@ -315,6 +515,114 @@ func createCmd() *cli.Command {
 				Name:  "no-new-keyring",
 				Usage: "unused -required by buildah",
 			},
+			&cli.BoolFlag{
+				Name:  "no-pivot",
+				Usage: "use chroot instead of pivot_root to enter the container rootfs",
+			},
+			&cli.StringSliceFlag{
+				Name:  "label",
+				Usage: "attach a label (key=value) to the container (can be repeated)",
+			},
+			&cli.BoolFlag{
+				Name:  "host-localtime",
+				Usage: "bind mount the host timezone files into the container if it lacks them",
+			},
+			&cli.BoolFlag{
+				Name:  "memory-lock",
+				Usage: "allow the container process to lock its memory (unlimited RLIMIT_MEMLOCK) and disable swap",
+			},
+			&cli.BoolFlag{
+				Name:  "no-swap",
+				Usage: "exclude the container memory from swap",
+			},
+			&cli.StringFlag{
+				Name:  "cri-log",
+				Usage: "copy the container stdout and stderr to this file in the kubernetes CRI log format",
+			},
+			&cli.StringFlag{
+				Name:  "create-config",
+				Usage: "create the container from this container config, as recorded by a previous create (other container options are ignored)",
+			},
+			&cli.StringFlag{
+				Name:  "restore",
+				Usage: "restore the container from the checkpoint images in this directory",
+			},
+			&cli.StringFlag{
+				Name:  "restore-page-server",
+				Usage: "transfer the memory pages of a lazy checkpoint on demand from the page server at this address (host:port)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dns",
+				Usage: "DNS server written to the container resolv.conf (can be repeated)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dns-search",
+				Usage: "DNS search domain written to the container resolv.conf (can be repeated)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dns-option",
+				Usage: "DNS resolver option written to the container resolv.conf (can be repeated)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "add-host",
+				Usage: "add a custom host-to-IP mapping (host:ip) to the container /etc/hosts (can be repeated)",
+			},
+			&cli.StringFlag{
+				Name:  "sandbox",
+				Usage: "join the network, ipc and uts namespaces of this pod sandbox container",
+			},
+			&cli.StringFlag{
+				Name:  "restart",
+				Usage: "restart policy applied by lxcrid when the container exits [no|on-failure[:max-retries]|always|unless-stopped]",
+			},
+			&cli.DurationFlag{
+				Name:  "max-runtime",
+				Usage: "stop the container when it exceeds this runtime (disabled if 0)",
+			},
+			&cli.StringFlag{
+				Name:  "wait-interface",
+				Usage: "start waits until this network interface exists in the container network namespace",
+			},
+			&cli.BoolFlag{
+				Name:  "wait-address",
+				Usage: "start waits until an IP address is assigned in the container network namespace",
+			},
+			&cli.StringFlag{
+				Name:  "wait-file",
+				Usage: "start waits until this file exists (e.g created by a hook)",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-timeout",
+				Usage: "maximum time start waits for the network readiness conditions",
+				Value: lxcri.DefaultNetworkReadyTimeout,
+			},
+			&cli.StringFlag{
+				Name:  "health-cmd",
+				Usage: "health check command executed with /bin/sh -c within the container",
+			},
+			&cli.DurationFlag{
+				Name:  "health-interval",
+				Usage: "time between two health checks",
+				Value: lxcri.DefaultHealthInterval,
+			},
+			&cli.DurationFlag{
+				Name:  "health-timeout",
+				Usage: "maximum duration of a health check",
+				Value: lxcri.DefaultHealthTimeout,
+			},
+			&cli.DurationFlag{
+				Name:  "health-start-period",
+				Usage: "initialization time of the container, failed health checks within are not counted",
+			},
+			&cli.IntFlag{
+				Name:  "health-retries",
+				Usage: "number of consecutive failed health checks until the container is unhealthy",
+				Value: lxcri.DefaultHealthRetries,
+			},
+			&cli.BoolFlag{
+				Name:  "kill-unhealthy",
+				Usage: "kill the container when it becomes unhealthy",
+			},
 			&cli.UintFlag{
 				Name:        "timeout",
 				Usage:       "maximum duration in seconds for create to complete",
@@ -327,31 +635,30 @@ func createCmd() *cli.Command {
 }
 
 func doCreate(ctxcli *cli.Context) error {
-	cfg := lxcri.ContainerConfig{
-		ContainerID:   clxc.containerID,
-		BundlePath:    ctxcli.String("bundle"),
-		ConsoleSocket: ctxcli.String("console-socket"),
-		SystemdCgroup: ctxcli.Bool("systemd-cgroup"),
-		Log:           clxc.Runtime.Log,
-		LogFile:       clxc.LogConfig.ContainerLogFile,
-		LogLevel:      clxc.LogConfig.ContainerLogLevel,
+	var cfg *lxcri.ContainerConfig
+	var err error
+	if p := ctxcli.String("create-config"); p != "" {
+		cfg, err = loadCreateConfig(p)
+	} else {
+		cfg, err = newContainerConfig(ctxcli)
 	}
-
-	specPath := filepath.Join(cfg.BundlePath, lxcri.BundleConfigFile)
-	spec, err := specki.LoadSpecJSON(specPath)
 	if err != nil {
-		return fmt.Errorf("failed to load container spec from bundle: %w", err)
+		return err
 	}
-	cfg.Spec = spec
+	cfg.RestorePageServer = ctxcli.String("restore-page-server")
 	pidFile := ctxcli.String("pid-file")
 
 	timeout := time.Duration(clxc.Timeouts.CreateTimeout) * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	err = doCreateInternal(ctx, &cfg, pidFile)
+	created, err := doCreateInternal(ctx, cfg, pidFile, ctxcli.String("restore"))
 	if err != nil {
 		clxc.Log.Error().Msgf("failed to create container: %s", err)
+		// The runtime dir of an existing container must not be deleted.
+		if !created {
+			return err
+		}
 		// Create a new context because create may fail with a timeout.
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.DeleteTimeout)*time.Second)
 		defer cancel()
@@ -363,20 +670,117 @@ func doCreate(ctxcli *cli.Context) error {
 	return nil
 }
 
-func doCreateInternal(ctx context.Context, cfg *lxcri.ContainerConfig, pidFile string) error {
-	c, err := clxc.Create(ctx, cfg)
+// loadCreateConfig loads the container config from a file
+// written from Container.CreateConfig (e.g by migrate).
+func loadCreateConfig(p string) (*lxcri.ContainerConfig, error) {
+	cfg := new(lxcri.ContainerConfig)
+	if err := specki.DecodeJSONFile(p, cfg); err != nil {
+		return nil, fmt.Errorf("failed to load container config: %w", err)
+	}
+	cfg.ContainerID = clxc.containerID
+	cfg.Log = clxc.Runtime.Log
+	return cfg, nil
+}
+
+// newContainerConfig creates the container config from the create flags.
+func newContainerConfig(ctxcli *cli.Context) (*lxcri.ContainerConfig, error) {
+	cfg := &lxcri.ContainerConfig{
+		ContainerID:   clxc.containerID,
+		BundlePath:    ctxcli.String("bundle"),
+		ConsoleSocket: ctxcli.String("console-socket"),
+		SystemdCgroup: ctxcli.Bool("systemd-cgroup"),
+		NoPivot:       ctxcli.Bool("no-pivot"),
+		RestartPolicy: ctxcli.String("restart"),
+		HostLocaltime: ctxcli.Bool("host-localtime"),
+		CRILogFile:    ctxcli.String("cri-log"),
+		SandboxID:     ctxcli.String("sandbox"),
+		MemoryLock:    ctxcli.Bool("memory-lock"),
+		NoSwap:        ctxcli.Bool("no-swap"),
+		MaxRuntime:    ctxcli.Duration("max-runtime"),
+		Log:           clxc.Runtime.Log,
+		LogFile:       clxc.LogConfig.ContainerLogFile,
+		LogLevel:      clxc.LogConfig.ContainerLogLevel,
+	}
+
+	labels, err := parseLabels(ctxcli.StringSlice("label"))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	cfg.Labels = labels
+
+	if ctxcli.IsSet("dns") || ctxcli.IsSet("dns-search") || ctxcli.IsSet("dns-option") {
+		cfg.DNS = &lxcri.DNSConfig{
+			Servers:  ctxcli.StringSlice("dns"),
+			Searches: ctxcli.StringSlice("dns-search"),
+			Options:  ctxcli.StringSlice("dns-option"),
+		}
+	}
+
+	if ctxcli.IsSet("wait-interface") || ctxcli.IsSet("wait-address") || ctxcli.IsSet("wait-file") {
+		cfg.NetworkReady = &lxcri.NetworkReadiness{
+			Interface: ctxcli.String("wait-interface"),
+			Address:   ctxcli.Bool("wait-address"),
+			File:      ctxcli.String("wait-file"),
+			Timeout:   ctxcli.Duration("wait-timeout"),
+		}
+	}
+
+	if cmd := ctxcli.String("health-cmd"); cmd != "" {
+		cfg.HealthCheck = &lxcri.HealthCheck{
+			Cmd:           []string{"/bin/sh", "-c", cmd},
+			Interval:      ctxcli.Duration("health-interval"),
+			Timeout:       ctxcli.Duration("health-timeout"),
+			StartPeriod:   ctxcli.Duration("health-start-period"),
+			Retries:       ctxcli.Int("health-retries"),
+			KillUnhealthy: ctxcli.Bool("kill-unhealthy"),
+		}
+	}
+
+	for _, val := range ctxcli.StringSlice("add-host") {
+		h, err := lxcri.ParseHostEntry(val)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExtraHosts = append(cfg.ExtraHosts, h)
+	}
+
+	specPath := ctxcli.String("bundle-config")
+	if specPath == "" {
+		specPath = filepath.Join(cfg.BundlePath, lxcri.BundleConfigFile)
+	}
+	spec, err := loadSpec(specPath, os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container spec: %w", err)
+	}
+	cfg.Spec = spec
+	return cfg, nil
+}
+
+// doCreateInternal creates the container.
+// created is true if the container runtime dir was created.
+func doCreateInternal(ctx context.Context, cfg *lxcri.ContainerConfig, pidFile string, restoreDir string) (created bool, err error) {
+	var c *lxcri.Container
+	if restoreDir != "" {
+		c, err = clxc.Restore(ctx, cfg, restoreDir)
+	} else {
+		c, err = clxc.Create(ctx, cfg)
+	}
+	if err != nil {
+		return c != nil, err
 	}
 	defer clxc.releaseContainer(c)
 
+	for _, w := range c.Warnings {
+		fmt.Fprintf(os.Stderr, "lxcri://%s warning: %s\n", c.ContainerID, w)
+	}
+
 	if pidFile != "" {
 		err := createPidFile(pidFile, c.Pid)
 		if err != nil {
-			return err
+			return true, err
 		}
 	}
-	return nil
+	return true, nil
 }
 
 func startCmd() *cli.Command {
@@ -406,6 +810,9 @@ func doStart(ctxcli *cli.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	if err := clxc.lockContainer(ctx, true); err != nil {
+		return err
+	}
 	c, err := clxc.loadContainer(clxc.containerID)
 	if err != nil {
 		return err
@@ -423,11 +830,23 @@ func stateCmd() *cli.Command {
 
 <containerID> is the ID of the container you want to know about.
 `,
-		Flags: []cli.Flag{},
+		Flags: []cli.Flag{
+			formatFlag(),
+		},
 	}
 }
 
-func doState(unused *cli.Context) error {
+func doState(ctxcli *cli.Context) error {
+	f, err := newFormatter(ctxcli.String("format"))
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := clxc.lockContainer(ctx, false); err != nil {
+		return err
+	}
 	c, err := clxc.loadContainer(clxc.containerID)
 	if err != nil {
 		return err
@@ -442,102 +861,530 @@ func doState(unused *cli.Context) error {
 		return fmt.Errorf("failed to marshal json: %w", err)
 	}
 	clxc.Log.Trace().RawJSON("state", j).Msg("container state")
+	if f != nil {
+		return f.write(os.Stdout, state.SpecState)
+	}
 	_, err = fmt.Fprint(os.Stdout, string(j))
 	return err
 }
 
-func killCmd() *cli.Command {
+func psCmd() *cli.Command {
 	return &cli.Command{
-		Name:   "kill",
-		Usage:  "sends a signal to a container",
-		Action: doKill,
-		ArgsUsage: `[containerID] [signal]
+		Name:   "ps",
+		Usage:  "lists the processes running in a container",
+		Action: doPs,
+		ArgsUsage: `[containerID]
 
-<containerID> is the ID of the container to send a signal to
-[signal] signal name or numerical value (e.g [9|kill|KILL|sigkill|SIGKILL])
+<containerID> is the ID of the container.
 `,
+		Description: `Prints the PIDs of the processes in the container cgroup, one per line.
+With --format the process details (command, user, cpu time, rss) are printed.`,
 		Flags: []cli.Flag{
-			&cli.UintFlag{
-				Name:        "timeout",
-				Usage:       "timeout for killing all processes in container cgroup",
-				EnvVars:     []string{"LXCRI_KILL_TIMEOUT"},
-				Value:       clxc.Timeouts.KillTimeout,
-				Destination: &clxc.Timeouts.KillTimeout,
-			},
+			formatFlag(),
 		},
 	}
 }
 
-func doKill(ctxcli *cli.Context) error {
-	sig := ctxcli.Args().Get(1)
-	signum := parseSignal(sig)
-	if signum == 0 {
-		return fmt.Errorf("invalid signal param %q", sig)
-	}
-
-	c, err := clxc.loadContainer(clxc.containerID)
+func doPs(ctxcli *cli.Context) error {
+	f, err := newFormatter(ctxcli.String("format"))
 	if err != nil {
 		return err
 	}
-	defer clxc.releaseContainer(c)
-
 	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	if err := clxc.lockContainer(ctx, false); err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
 
-	return clxc.Kill(ctx, c, signum)
+	if f == nil {
+		pids, err := c.Pids()
+		if err != nil {
+			return err
+		}
+		for _, pid := range pids {
+			fmt.Println(pid)
+		}
+		return nil
+	}
+	procs, err := c.Processes()
+	if err != nil {
+		return err
+	}
+	for _, p := range procs {
+		if err := f.write(os.Stdout, p); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func deleteCmd() *cli.Command {
+func statsCmd() *cli.Command {
 	return &cli.Command{
-		Name:   "delete",
-		Usage:  "deletes a container",
-		Action: doDelete,
+		Name:   "stats",
+		Usage:  "print the resource usage statistics of a container as JSON",
+		Action: doStats,
 		ArgsUsage: `[containerID]
 
-<containerID> is the ID of the container to delete
+<containerID> is the ID of the container.
 `,
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
-				Name:  "force",
-				Usage: "force deletion",
+				Name:  "watch",
+				Usage: "print a statistics snapshot (JSON line) every interval until interrupted",
 			},
-			&cli.UintFlag{
-				Name:        "timeout",
-				Usage:       "maximum duration in seconds for delete to complete",
-				EnvVars:     []string{"LXCRI_DELETE_TIMEOUT"},
-				Value:       clxc.Timeouts.DeleteTimeout,
-				Destination: &clxc.Timeouts.DeleteTimeout,
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "interval between statistics snapshots in watch mode",
+				Value: time.Second,
+			},
+			&cli.BoolFlag{
+				Name:  "rootfs",
+				Usage: "include the root filesystem usage (walks the writable layer of an overlay rootfs)",
 			},
+			formatFlag(),
 		},
 	}
 }
 
-func doDelete(ctxcli *cli.Context) error {
-	timeout := time.Duration(clxc.Timeouts.DeleteTimeout) * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+func doStats(ctxcli *cli.Context) error {
+	f, err := newFormatter(ctxcli.String("format"))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		f = &formatter{}
+	}
+	interval := ctxcli.Duration("interval")
+	if ctxcli.Bool("watch") && interval <= 0 {
+		return fmt.Errorf("invalid interval %s", interval)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
 	defer cancel()
 
-	err := clxc.Delete(ctx, clxc.containerID, ctxcli.Bool("force"))
-	// Deleting a non-existing container is a noop,
-	// otherwise cri-o / kubelet log warnings about that.
-	if err == lxcri.ErrNotExist {
-		return nil
+	var c *lxcri.Container
+	if ctxcli.Bool("watch") {
+		c, err = clxc.loadContainerShared(ctx)
+	} else {
+		if err := clxc.lockContainer(ctx, false); err != nil {
+			return err
+		}
+		c, err = clxc.loadContainer(clxc.containerID)
 	}
-	return err
-}
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
 
-func execCmd() *cli.Command {
-	return &cli.Command{
-		Name:      "exec",
-		Usage:     "execute a new process in a running container",
-		ArgsUsage: "<containerID> [COMMAND] [args...]",
-		Action:    doExec,
+	collect := func() (*lxcri.Stats, error) {
+		stats, err := c.Stats()
+		if err != nil || !ctxcli.Bool("rootfs") {
+			return stats, err
+		}
+		stats.Rootfs, err = c.RootfsStats()
+		return stats, err
+	}
+
+	if !ctxcli.Bool("watch") {
+		stats, err := collect()
+		if err != nil {
+			return err
+		}
+		return f.write(os.Stdout, stats)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		stats, err := collect()
+		if err != nil {
+			return err
+		}
+		if err := f.write(os.Stdout, stats); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func killCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "kill",
+		Usage:  "sends a signal to a container",
+		Action: doKill,
+		ArgsUsage: `[containerID] [signal]
+
+<containerID> is the ID of the container to send a signal to
+[signal] signal name or numerical value (e.g [9|kill|KILL|sigkill|SIGKILL])
+`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "pod",
+				Usage: "send the signal to all containers of the pod sandbox <containerID>",
+			},
+			&cli.UintFlag{
+				Name:        "timeout",
+				Usage:       "timeout for killing all processes in container cgroup",
+				EnvVars:     []string{"LXCRI_KILL_TIMEOUT"},
+				Value:       clxc.Timeouts.KillTimeout,
+				Destination: &clxc.Timeouts.KillTimeout,
+			},
+		},
+	}
+}
+
+func doKill(ctxcli *cli.Context) error {
+	sig := ctxcli.Args().Get(1)
+	signum := parseSignal(sig)
+	if signum == 0 {
+		return fmt.Errorf("invalid signal param %q", sig)
+	}
+
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if ctxcli.Bool("pod") {
+		return clxc.KillSandbox(ctx, clxc.containerID, signum)
+	}
+
+	if err := clxc.lockContainer(ctx, true); err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	return clxc.Kill(ctx, c, signum)
+}
+
+func pauseCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "pause",
+		Usage:  "freezes all processes of a running container",
+		Action: doPause,
+		ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to pause
+`,
+		Flags: []cli.Flag{
+			&cli.UintFlag{
+				Name:        "timeout",
+				Usage:       "maximum duration in seconds to wait for the container to be frozen",
+				EnvVars:     []string{"LXCRI_KILL_TIMEOUT"},
+				Value:       clxc.Timeouts.KillTimeout,
+				Destination: &clxc.Timeouts.KillTimeout,
+			},
+		},
+	}
+}
+
+func doPause(ctxcli *cli.Context) error {
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := clxc.lockContainer(ctx, true); err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+	return clxc.Pause(ctx, c)
+}
+
+func resumeCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "resume",
+		Usage:  "thaws all processes of a paused container",
+		Action: doResume,
+		ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to resume
+`,
+		Flags: []cli.Flag{
+			&cli.UintFlag{
+				Name:        "timeout",
+				Usage:       "maximum duration in seconds to wait for the container to be thawed",
+				EnvVars:     []string{"LXCRI_KILL_TIMEOUT"},
+				Value:       clxc.Timeouts.KillTimeout,
+				Destination: &clxc.Timeouts.KillTimeout,
+			},
+		},
+	}
+}
+
+func doResume(ctxcli *cli.Context) error {
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := clxc.lockContainer(ctx, true); err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+	return clxc.Resume(ctx, c)
+}
+
+func updateCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "update",
+		Usage:  "updates the resource limits of a container",
+		Action: doUpdate,
+		ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to update
+`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "resources",
+				Aliases: []string{"r"},
+				Usage:   "path to a JSON file with the linux resources (runtime spec `linux.resources`), '-' reads from stdin",
+			},
+			&cli.Int64Flag{
+				Name:  "memory",
+				Usage: "memory limit in bytes (-1 is unlimited)",
+			},
+			&cli.Int64Flag{
+				Name:  "memory-swap",
+				Usage: "memory plus swap limit in bytes (-1 is unlimited)",
+			},
+			&cli.Int64Flag{
+				Name:  "cpu-quota",
+				Usage: "CPU quota in microseconds per CPU period (-1 is unlimited)",
+			},
+			&cli.Uint64Flag{
+				Name:  "cpu-period",
+				Usage: "CPU period in microseconds",
+			},
+			&cli.Uint64Flag{
+				Name:  "cpu-shares",
+				Usage: "CPU shares (relative weight)",
+			},
+			&cli.StringFlag{
+				Name:  "cpuset-cpus",
+				Usage: "CPUs the container may use (e.g '0-3,7')",
+			},
+			&cli.StringFlag{
+				Name:  "cpuset-mems",
+				Usage: "memory nodes the container may use",
+			},
+			&cli.Int64Flag{
+				Name:  "pids-limit",
+				Usage: "maximum number of processes (0 is unlimited)",
+			},
+		},
+	}
+}
+
+func doUpdate(ctxcli *cli.Context) error {
+	res, err := updateResources(ctxcli, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := clxc.lockContainer(ctx, true); err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+	return clxc.Update(ctx, c, res)
+}
+
+// updateResources returns the resources from the --resources file,
+// overridden by the resource flags that are set.
+func updateResources(ctxcli *cli.Context, stdin io.Reader) (*specs.LinuxResources, error) {
+	res := &specs.LinuxResources{}
+	if path := ctxcli.String("resources"); path != "" {
+		r := stdin
+		if path != stdinPath {
+			// #nosec
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		if err := json.NewDecoder(r).Decode(res); err != nil {
+			return nil, fmt.Errorf("failed to decode resources: %w", err)
+		}
+	}
+	if ctxcli.IsSet("memory") || ctxcli.IsSet("memory-swap") {
+		if res.Memory == nil {
+			res.Memory = &specs.LinuxMemory{}
+		}
+		if ctxcli.IsSet("memory") {
+			v := ctxcli.Int64("memory")
+			res.Memory.Limit = &v
+		}
+		if ctxcli.IsSet("memory-swap") {
+			v := ctxcli.Int64("memory-swap")
+			res.Memory.Swap = &v
+		}
+	}
+	for _, name := range []string{"cpu-quota", "cpu-period", "cpu-shares", "cpuset-cpus", "cpuset-mems"} {
+		if ctxcli.IsSet(name) && res.CPU == nil {
+			res.CPU = &specs.LinuxCPU{}
+		}
+	}
+	if ctxcli.IsSet("cpu-quota") {
+		v := ctxcli.Int64("cpu-quota")
+		res.CPU.Quota = &v
+	}
+	if ctxcli.IsSet("cpu-period") {
+		v := ctxcli.Uint64("cpu-period")
+		res.CPU.Period = &v
+	}
+	if ctxcli.IsSet("cpu-shares") {
+		v := ctxcli.Uint64("cpu-shares")
+		res.CPU.Shares = &v
+	}
+	if ctxcli.IsSet("cpuset-cpus") {
+		res.CPU.Cpus = ctxcli.String("cpuset-cpus")
+	}
+	if ctxcli.IsSet("cpuset-mems") {
+		res.CPU.Mems = ctxcli.String("cpuset-mems")
+	}
+	if ctxcli.IsSet("pids-limit") {
+		res.Pids = &specs.LinuxPids{Limit: ctxcli.Int64("pids-limit")}
+	}
+	return res, nil
+}
+
+func waitCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "wait",
+		Usage:  "waits until the container process exits and prints the exit status",
+		Action: doWait,
+		ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to wait for
+`,
+		Flags: []cli.Flag{
+			formatFlag(),
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "maximum duration to wait (0 waits forever)",
+			},
+		},
+	}
+}
+
+func doWait(ctxcli *cli.Context) error {
+	f, err := newFormatter(ctxcli.String("format"))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		f = &formatter{}
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer cancel()
+	if timeout := ctxcli.Duration("timeout"); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	c, err := clxc.loadContainerShared(ctx)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	status, err := clxc.Wait(ctx, c)
+	if err != nil {
+		return err
+	}
+	return f.write(os.Stdout, status)
+}
+
+func deleteCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "delete",
+		Usage:  "deletes a container",
+		Action: doDelete,
+		ArgsUsage: `[containerID]
+
+<containerID> is the ID of the container to delete
+`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "force deletion",
+			},
+			&cli.BoolFlag{
+				Name:  "pod",
+				Usage: "delete all containers of the pod sandbox <containerID>",
+			},
+			&cli.UintFlag{
+				Name:        "timeout",
+				Usage:       "maximum duration in seconds for delete to complete",
+				EnvVars:     []string{"LXCRI_DELETE_TIMEOUT"},
+				Value:       clxc.Timeouts.DeleteTimeout,
+				Destination: &clxc.Timeouts.DeleteTimeout,
+			},
+		},
+	}
+}
+
+func doDelete(ctxcli *cli.Context) error {
+	timeout := time.Duration(clxc.Timeouts.DeleteTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	if ctxcli.Bool("pod") {
+		err = clxc.DeleteSandbox(ctx, clxc.containerID, ctxcli.Bool("force"))
+	} else {
+		err = clxc.lockContainer(ctx, true)
+		if err == nil {
+			err = clxc.Delete(ctx, clxc.containerID, ctxcli.Bool("force"))
+		}
+	}
+	// Deleting a non-existing container is a noop,
+	// otherwise cri-o / kubelet log warnings about that.
+	if err == lxcri.ErrNotExist {
+		return nil
+	}
+	return err
+}
+
+func execCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "exec",
+		Usage:     "execute a new process in a running container",
+		ArgsUsage: "<containerID> [COMMAND] [args...]",
+		Action:    doExec,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "process",
 				Aliases: []string{"p"},
-				Usage:   "path to process json - cmd and args are ignored if set",
+				Usage:   "path to process json, or '-' to read it from stdin - cmd and args are ignored if set",
 				Value:   "",
 			},
 			&cli.StringFlag{
@@ -550,6 +1397,14 @@ func execCmd() *cli.Command {
 				Aliases: []string{"d"},
 				Usage:   "detach from the executed process",
 			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "kill the process and its descendants if it does not exit within the timeout (0 disables the timeout)",
+			},
+			&cli.StringFlag{
+				Name:  "sub-cgroup",
+				Usage: "run the process in the sub-cgroup 'exec-<name>' of the container cgroup",
+			},
 			&cli.BoolFlag{
 				Name:  "cgroup",
 				Usage: "run in container cgroup namespace",
@@ -583,6 +1438,10 @@ func execCmd() *cli.Command {
 				Name:  "uts",
 				Usage: "run in container UTS namespace",
 			},
+			&cli.StringSliceFlag{
+				Name:  "ns-path",
+				Usage: "join the namespace file instead of the container namespace <type>=<path> e.g network=/proc/1/ns/net (can be repeated)",
+			},
 		},
 	}
 }
@@ -613,6 +1472,9 @@ func (e execError) Error() string {
 // otherwise it creates a new specs.Process from the given args.
 // It's an error if both values are empty.
 func loadSpecProcess(specProcessPath string, args []string) (*specs.Process, error) {
+	if specProcessPath == stdinPath {
+		return specki.ReadSpecProcessJSON(os.Stdin)
+	}
 	if specProcessPath != "" {
 		return specki.LoadSpecProcessJSON(specProcessPath)
 	}
@@ -640,13 +1502,20 @@ func doExec(ctxcli *cli.Context) error {
 		return err
 	}
 
-	c, err := clxc.loadContainer(clxc.containerID)
+	timeout := time.Duration(clxc.Timeouts.KillTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	c, err := clxc.loadContainerShared(ctx)
 	if err != nil {
 		return err
 	}
 	defer clxc.releaseContainer(c)
 
-	opts := lxcri.ExecOptions{}
+	opts := lxcri.ExecOptions{Cgroup: ctxcli.String("sub-cgroup")}
+	opts.NamespacePaths, err = parseNamespacePaths(ctxcli.StringSlice("ns-path"))
+	if err != nil {
+		return err
+	}
 
 	if ctxcli.Bool("cgroup") {
 		opts.Namespaces = append(opts.Namespaces, specs.CgroupNamespace)
@@ -676,7 +1545,8 @@ func doExec(ctxcli *cli.Context) error {
 	c.Log.Info().Str("cmd", procSpec.Args[0]).
 		Uint32("uid", procSpec.User.UID).Uint32("gid", procSpec.User.GID).
 		Uints32("groups", procSpec.User.AdditionalGids).
-		Str("namespaces", fmt.Sprintf("%s", opts.Namespaces)).Msg("execute cmd")
+		Str("namespaces", fmt.Sprintf("%s", opts.Namespaces)).
+		Interface("namespace-paths", opts.NamespacePaths).Msg("execute cmd")
 
 	if detach {
 		pid, err := c.ExecDetached(procSpec, &opts)
@@ -687,7 +1557,14 @@ func doExec(ctxcli *cli.Context) error {
 			return createPidFile(pidFile, pid)
 		}
 	} else {
-		status, err := c.Exec(procSpec, &opts)
+		var status int
+		if timeout := ctxcli.Duration("timeout"); timeout > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			status, err = c.ExecContext(ctx, procSpec, &opts)
+		} else {
+			status, err = c.Exec(procSpec, &opts)
+		}
 		if err != nil {
 			return err
 		}
@@ -708,67 +1585,167 @@ func inspectCmd() *cli.Command {
 <containerID> [containerID...] list of IDs for container to inspect
 `,
 		Flags: []cli.Flag{
+			formatFlag(),
 			&cli.StringFlag{
-				Name:  "template",
-				Usage: "Use this go template to format the output.",
+				Name:   "template",
+				Usage:  "deprecated alias for --format",
+				Hidden: true,
 			},
 		},
 	}
 }
 
-func doInspect(ctxcli *cli.Context) (err error) {
-	var t *template.Template
-	tmpl := ctxcli.String("template")
-	if tmpl != "" {
-		t, err = template.New("inspect").Parse(tmpl)
-		if err != nil {
-			return err
-		}
+func doInspect(ctxcli *cli.Context) error {
+	f, err := newFormatter(formatOrTemplate(ctxcli))
+	if err != nil {
+		return err
 	}
 
 	for _, id := range ctxcli.Args().Slice() {
-		if err := inspectContainer(id, t); err != nil {
+		if err := inspectContainer(id, f); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func serveEventsCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "serve-events",
+		Usage:  "stream container events as JSON lines to clients of a unix socket",
+		Action: doServeEvents,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "socket",
+				Usage: "path to the unix socket (defaults to .events.sock in the runtime root)",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "interval for polling the container states",
+				Value: time.Second,
+			},
+		},
+	}
+}
+
+func doServeEvents(ctxcli *cli.Context) error {
+	socket := ctxcli.String("socket")
+	if socket == "" {
+		socket = clxc.EventSocketPath()
+	}
+	l, err := lxcri.ListenUnix(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer cancel()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, unix.SIGHUP)
+	defer signal.Stop(reload)
+
+	clxc.Log.Info().Str("socket", socket).Msg("serving events")
+	s := lxcri.EventServer{Runtime: lxcri.NewReloadableRuntime(clxc.Runtime), Interval: ctxcli.Duration("interval"), Reload: reload}
+	return s.Serve(ctx, l)
+}
+
+func eventsCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "events",
+		Usage:  "print the container events served by serve-events or lxcrid",
+		Action: doEvents,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "socket",
+				Usage: "path to the events unix socket (defaults to .events.sock in the runtime root)",
+			},
+			formatFlag(),
+		},
+	}
+}
+
+func doEvents(ctxcli *cli.Context) error {
+	f, err := newFormatter(ctxcli.String("format"))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		f = &formatter{}
+	}
+	socket := ctxcli.String("socket")
+	if socket == "" {
+		socket = clxc.EventSocketPath()
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	dec := json.NewDecoder(conn)
+	for {
+		var ev lxcri.Event
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil || err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := f.write(os.Stdout, ev); err != nil {
+			return err
+		}
+	}
+}
+
 func listCmd() *cli.Command {
 	return &cli.Command{
 		Name:   "list",
 		Usage:  "list available containers",
 		Action: doList,
 		Flags: []cli.Flag{
+			formatFlag(),
 			&cli.StringFlag{
-				Name:  "template",
-				Usage: "Use this go template to format the output.",
-				// e.g `{{ printf "%s %s\n" .Container.ContainerID .State.ContainerState }}`,
+				Name:   "template",
+				Usage:  "deprecated alias for --format",
+				Hidden: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "filter",
+				Usage: "only list containers matching the filter (label=<key>[=<value>]), can be repeated",
 			},
 		},
 	}
 }
 
-func doList(ctxcli *cli.Context) (err error) {
-	tmpl := ctxcli.String("template")
-	var t *template.Template
-	if tmpl != "" {
-		t, err = template.New("list").Parse(tmpl)
-		if err != nil {
-			return err
-		}
+func doList(ctxcli *cli.Context) error {
+	f, err := newFormatter(formatOrTemplate(ctxcli))
+	if err != nil {
+		return err
 	}
 
-	all, err := clxc.List()
+	filters, err := parseListFilters(ctxcli.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
+
+	all, err := clxc.List(filters...)
 	if err != nil {
 		return err
 	}
 
 	for _, id := range all {
-		if t == nil {
+		if f == nil {
 			fmt.Println(id)
 		} else {
-			err := inspectContainer(id, t)
+			err := inspectContainer(id, f)
 			if err != nil && !errors.Is(err, lxcri.ErrNotExist) {
 				return err
 			}
@@ -777,7 +1754,23 @@ func doList(ctxcli *cli.Context) (err error) {
 	return nil
 }
 
-func inspectContainer(id string, t *template.Template) error {
+// formatOrTemplate returns the value of the --format flag,
+// or the value of the deprecated --template flag.
+func formatOrTemplate(ctxcli *cli.Context) string {
+	if format := ctxcli.String("format"); format != "" {
+		return format
+	}
+	return ctxcli.String("template")
+}
+
+// containerInfo is the output of inspect and list.
+type containerInfo struct {
+	Spec      *specs.Spec
+	Container *lxcri.Container
+	State     *lxcri.State
+}
+
+func inspectContainer(id string, f *formatter) error {
 	c, err := clxc.loadContainer(id)
 	if err != nil {
 		return err
@@ -788,24 +1781,24 @@ func inspectContainer(id string, t *template.Template) error {
 		return fmt.Errorf("failed ot get container state: %w", err)
 	}
 
-	info := struct {
-		Spec      *specs.Spec
-		Container *lxcri.Container
-		State     *lxcri.State
-	}{
+	info := containerInfo{
 		Spec:      c.Spec,
 		Container: c,
 		State:     state,
 	}
 
-	if t != nil {
-		return t.Execute(os.Stdout, info)
+	if f != nil && f.tmpl != nil {
+		return f.write(os.Stdout, info)
 	}
 
 	// avoid duplicate output
 	c.Spec = nil
 	state.SpecState.Annotations = nil
 
+	if f != nil {
+		return f.write(os.Stdout, info)
+	}
+
 	j, err := json.MarshalIndent(info, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal json: %w", err)
@@ -874,3 +1867,150 @@ func doConfig(ctxcli *cli.Context) error {
 	}
 	return os.WriteFile(out, data, 0644)
 }
+
+func printVersion(ctx *cli.Context) {
+	info := lxcri.BuildInfo()
+	fmt.Printf("%s version %s\n", ctx.App.Name, info.Version)
+	if info.GitCommit != "" {
+		fmt.Printf("commit: %s\n", info.GitCommit)
+	}
+	if info.BuildDate != "" {
+		fmt.Printf("build date: %s\n", info.BuildDate)
+	}
+	fmt.Printf("go version: %s\n", info.GoVersion)
+	fmt.Printf("liblxc version: %s\n", info.LXCVersion)
+	if len(info.Features) > 0 {
+		fmt.Printf("features: %s\n", strings.Join(info.Features, ","))
+	}
+}
+
+func checkCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "check",
+		Usage:  "check whether the host is setup properly for the runtime",
+		Action: doCheck,
+	}
+}
+
+func gcCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "gc",
+		Usage:  "removes stale containers",
+		Action: doGC,
+		Description: `Removes containers whose monitor process is gone and that are stopped
+for at least --min-age seconds, e.g because the container manager crashed.
+Processes left over in the container cgroup are killed.
+The IDs of the removed containers are printed.`,
+		Flags: []cli.Flag{
+			&cli.UintFlag{
+				Name:        "min-age",
+				Usage:       "minimum time in seconds since the container has stopped",
+				EnvVars:     []string{"LXCRI_GC_MIN_AGE"},
+				Value:       clxc.GCMinAge,
+				Destination: &clxc.GCMinAge,
+			},
+			&cli.UintFlag{
+				Name:  "timeout",
+				Usage: "maximum duration in seconds for the garbage collection",
+				Value: 300,
+			},
+		},
+	}
+}
+
+func doGC(ctxcli *cli.Context) error {
+	timeout := time.Duration(ctxcli.Uint("timeout")) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	removed, err := clxc.GC(ctx)
+	for _, id := range removed {
+		fmt.Println(id)
+	}
+	return err
+}
+
+func addTenantCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "add-tenant",
+		Usage:     "creates the tenant directory of a user in the multi-tenant runtime root",
+		ArgsUsage: "<uid>",
+		Action:    doAddTenant,
+		Description: `Creates the runtime directory of the user with the given UID
+(or user name) within the runtime root for --multi-tenant.
+The tenant directories can only be created by root, because the
+tenants directory must not be writable by other users.`,
+	}
+}
+
+func doAddTenant(ctxcli *cli.Context) error {
+	name := ctxcli.Args().Get(0)
+	if name == "" {
+		return fmt.Errorf("missing UID")
+	}
+	uid, err := strconv.Atoi(name)
+	if err != nil {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return err
+		}
+	}
+	return clxc.AddTenant(uid)
+}
+
+func featuresCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "features",
+		Usage:  "prints the supported OCI runtime spec features",
+		Action: doFeatures,
+		Description: `Prints the runtime features in the 'runc features' JSON format,
+so that container engines can detect the features supported by the runtime.`,
+		Flags: []cli.Flag{
+			formatFlag(),
+		},
+	}
+}
+
+func doFeatures(ctxcli *cli.Context) error {
+	f, err := newFormatter(ctxcli.String("format"))
+	if err != nil {
+		return err
+	}
+	features := clxc.SupportedFeatures()
+	if f != nil {
+		return f.write(os.Stdout, features)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(features)
+}
+
+func doCheck(ctxcli *cli.Context) error {
+	report := clxc.CheckHost()
+	fmt.Printf("liblxc version: %s\n", report.LXCVersion)
+	fmt.Printf("cgroup mode: %s (root %s)\n", report.CgroupMode, report.CgroupRoot)
+	for _, c := range report.Checks {
+		status := "pass"
+		if !c.OK {
+			status = "warn"
+			if c.Required {
+				status = "fail"
+			}
+		}
+		fmt.Printf("[%s] %s", status, c.Name)
+		if c.Message != "" {
+			fmt.Printf(": %s", c.Message)
+		}
+		fmt.Println()
+		if c.Hint != "" {
+			fmt.Printf("       hint: %s\n", c.Hint)
+		}
+	}
+	if report.Failed() {
+		return fmt.Errorf("host check failed")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli/v2"
+)
+
+// formatJSON is the --format value for JSON output.
+// Every value is printed as a single JSON line.
+const formatJSON = "json"
+
+// formatFlag returns the --format flag shared by all commands with structured output.
+// The default output of the command is used if the flag is not set.
+func formatFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "format",
+		Usage: "output format: 'json' (JSON lines) or a Go template e.g '{{ .ID }}'",
+	}
+}
+
+// formatter prints values as JSON lines or with a Go template.
+// The field names are the same for both formats.
+type formatter struct {
+	tmpl *template.Template
+}
+
+// templateFuncs are available in --format templates.
+var templateFuncs = template.FuncMap{
+	// json formats a value as JSON e.g `{{ json .Spec.Process }}`
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// newFormatter parses the format. It returns nil if the format is empty,
+// so that the command uses its default output.
+func newFormatter(format string) (*formatter, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case formatJSON:
+		return &formatter{}, nil
+	}
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %w", err)
+	}
+	return &formatter{tmpl: tmpl}, nil
+}
+
+// write prints the value followed by a newline.
+func (f *formatter) write(w io.Writer, v interface{}) error {
+	if f.tmpl == nil {
+		return json.NewEncoder(w).Encode(v)
+	}
+	var b strings.Builder
+	if err := f.tmpl.Execute(&b, v); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lxc/lxcri"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatter(t *testing.T) {
+	f, err := newFormatter("")
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	ev := lxcri.Event{Type: lxcri.EventStarted, ContainerID: "c1", Status: "running"}
+
+	var b bytes.Buffer
+	f, err = newFormatter(formatJSON)
+	require.NoError(t, err)
+	require.NoError(t, f.write(&b, ev))
+	require.Equal(t, `{"Type":"started","ContainerID":"c1","Status":"running","Time":"0001-01-01T00:00:00Z"}`+"\n", b.String())
+
+	b.Reset()
+	f, err = newFormatter(`{{ .ContainerID }} {{ upper .Type }}`)
+	require.NoError(t, err)
+	require.NoError(t, f.write(&b, ev))
+	require.NoError(t, f.write(&b, ev))
+	require.Equal(t, "c1 STARTED\nc1 STARTED\n", b.String())
+
+	b.Reset()
+	f, err = newFormatter(`{{ json .Status }}`)
+	require.NoError(t, err)
+	require.NoError(t, f.write(&b, ev))
+	require.Equal(t, "\"running\"\n", b.String())
+
+	_, err = newFormatter(`{{ .ContainerID `)
+	require.Error(t, err)
+}
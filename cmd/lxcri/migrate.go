@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/urfave/cli/v2"
+)
+
+func migrateCmd() *cli.Command {
+	return &cli.Command{
+		Name:   "migrate",
+		Usage:  "migrate a running container to another host",
+		Action: doMigrate,
+		ArgsUsage: `<containerID> <destination>
+
+<containerID> is the ID of the running container to migrate
+<destination> is the ssh destination ([user@]host) of a host running lxcri
+
+The container is checkpointed and the bundle, the root filesystem and the
+checkpoint images are copied with rsync (over ssh) to the same paths on the
+destination, where the container is restored with 'lxcri create --restore'
+from the config it was created with on this host.
+The root filesystem is synchronized before the checkpoint, so that only
+the changes must be copied while the container is stopped.
+With --pre-dumps the container memory is pre-copied the same way.
+With --lazy-pages the memory is not copied with the images, but transferred
+on demand from the page server on this host, after the container is restored.
+The container is restored on this host if the migration fails.
+`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "image-dir",
+				Usage: "directory for the checkpoint images (defaults to a temporary directory)",
+			},
+			&cli.StringFlag{
+				Name:  "ssh",
+				Usage: "remote shell command used to connect to the destination",
+				Value: "ssh",
+			},
+			&cli.StringFlag{
+				Name:  "remote-lxcri",
+				Usage: "path to lxcri on the destination",
+				Value: "lxcri",
+			},
+			&cli.IntFlag{
+				Name:  "pre-dumps",
+				Usage: "number of memory pre-dumps copied to the destination while the container is running",
+			},
+			&cli.StringFlag{
+				Name:  "lazy-pages",
+				Usage: "address (host:port) of the page server on this host for a lazy (post-copy) migration",
+			},
+			&cli.UintFlag{
+				Name:  "timeout",
+				Usage: "maximum duration in seconds for the checkpoint and the restore",
+				Value: 300,
+			},
+		},
+	}
+}
+
+// migration copies a container to a destination host using rsync and ssh.
+type migration struct {
+	c *lxcri.Container
+	// cfg is the container config as passed to create,
+	// used to restore the container on this host if the migration fails.
+	cfg      *lxcri.ContainerConfig
+	dest     string
+	ssh      []string
+	lxcri    string
+	imageDir string
+	preDumps int
+	// pageServer is the page server address for a lazy migration.
+	pageServer string
+	// paths are the directories copied to the destination.
+	paths []string
+}
+
+func doMigrate(ctxcli *cli.Context) error {
+	dest := ctxcli.Args().Get(1)
+	if dest == "" {
+		return fmt.Errorf("missing destination")
+	}
+	timeout := time.Duration(ctxcli.Uint("timeout")) * time.Second
+
+	// The container is locked until it is deleted on this host or restored locally.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := clxc.lockContainer(ctx, true); err != nil {
+		return err
+	}
+	c, err := clxc.loadContainer(clxc.containerID)
+	if err != nil {
+		return err
+	}
+	defer clxc.releaseContainer(c)
+
+	m := migration{
+		c:        c,
+		dest:     dest,
+		ssh:      strings.Fields(ctxcli.String("ssh")),
+		lxcri:    ctxcli.String("remote-lxcri"),
+		preDumps: ctxcli.Int("pre-dumps"),
+
+		pageServer: ctxcli.String("lazy-pages"),
+	}
+	if len(m.ssh) == 0 {
+		return fmt.Errorf("invalid ssh command")
+	}
+	// The runtime directory is removed before the local restore.
+	if m.cfg, err = c.CreateConfig(); err != nil {
+		return fmt.Errorf("failed to load container config: %w", err)
+	}
+	for _, s := range m.cfg.Secrets {
+		// The secret data is never persisted.
+		if s.Source == "" {
+			return fmt.Errorf("secret %s without source can not be restored", s.Target)
+		}
+	}
+	if err := m.setPaths(); err != nil {
+		return err
+	}
+
+	m.imageDir = ctxcli.String("image-dir")
+	if m.imageDir == "" {
+		m.imageDir, err = os.MkdirTemp("", "lxcri-checkpoint-"+c.ContainerID+"-")
+		if err != nil {
+			return err
+		}
+	}
+	if m.imageDir, err = filepath.Abs(m.imageDir); err != nil {
+		return err
+	}
+	if err := m.writeCreateConfig(); err != nil {
+		return err
+	}
+	return m.run(timeout)
+}
+
+// migrateConfigFile is the file in the image directory the container config is
+// copied to, to recreate the container on the destination (see create --create-config).
+const migrateConfigFile = "create.json"
+
+// writeCreateConfig writes the container config to the migrateConfigFile.
+func (m *migration) writeCreateConfig() error {
+	if err := os.MkdirAll(m.imageDir, 0700); err != nil {
+		return err
+	}
+	cfg := *m.cfg
+	// The console socket of this host is not available on the destination.
+	cfg.ConsoleSocket = ""
+	err := specki.EncodeJSONFile(filepath.Join(m.imageDir, migrateConfigFile), &cfg, os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write container config: %w", err)
+	}
+	return nil
+}
+
+// setPaths sets the directories that must be copied to the destination.
+// The paths must be absolute, because they are the same on the destination.
+func (m *migration) setPaths() error {
+	bundle := m.c.BundlePath
+	if !filepath.IsAbs(bundle) {
+		return fmt.Errorf("bundle path %q is not an absolute path", bundle)
+	}
+	rootfs := m.c.Spec.Root.Path
+	if !filepath.IsAbs(rootfs) {
+		rootfs = filepath.Join(bundle, rootfs)
+	}
+	m.paths = []string{bundle}
+	if !strings.HasPrefix(rootfs, filepath.Clean(bundle)+"/") {
+		m.paths = append(m.paths, rootfs)
+	}
+	return nil
+}
+
+func (m *migration) run(timeout time.Duration) error {
+	log := clxc.Log.With().Str("dest", m.dest).Logger()
+
+	log.Info().Strs("paths", m.paths).Msg("pre-copy container files")
+	if err := m.sync(m.paths...); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	opts := lxcri.CheckpointOptions{
+		ImageDir: m.imageDir,
+		PreDumps: m.preDumps,
+		OnPreDump: func(n int, dir string) error {
+			log.Info().Int("n", n).Msg("copy pre-dump images")
+			return m.sync(m.imageDir)
+		},
+	}
+	if m.pageServer != "" {
+		if err := m.runLazy(ctx, opts); err != nil {
+			return err
+		}
+		return m.cleanup()
+	}
+	err := m.c.Checkpoint(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("images", m.imageDir).Msg("copy container files and checkpoint images")
+	err = m.sync(append(m.paths, m.imageDir)...)
+	if err == nil {
+		log.Info().Msg("restore container on destination")
+		err = m.restoreRemote()
+	}
+	if err != nil {
+		log.Error().Msgf("migration failed: %s", err)
+		if rerr := m.restoreLocal(timeout); rerr != nil {
+			return fmt.Errorf("%w (local restore failed: %s, images are kept in %s)", err, rerr, m.imageDir)
+		}
+		return err
+	}
+	return m.cleanup()
+}
+
+// runLazy checkpoints the container for a lazy migration. The container is restored
+// on the destination, when the images without the memory pages are copied.
+// Then the memory pages are transferred on demand by the page server.
+// If the migration fails before the memory pages are transferred,
+// the container continues to run on this host.
+func (m *migration) runLazy(ctx context.Context, opts lxcri.CheckpointOptions) error {
+	log := clxc.Log.With().Str("dest", m.dest).Str("page-server", m.pageServer).Logger()
+
+	var restored chan error
+	opts.PageServer = m.pageServer
+	opts.OnDumped = func() error {
+		log.Info().Str("images", m.imageDir).Msg("copy container files and checkpoint images")
+		if err := m.sync(append(m.paths, m.imageDir)...); err != nil {
+			return err
+		}
+		log.Info().Msg("restore container on destination")
+		restored = make(chan error, 1)
+		go func() {
+			err := m.restoreRemote()
+			if err != nil {
+				// The page server stops and the container continues to run on this host,
+				// if the connection is closed before all memory pages are transferred.
+				if conn, derr := net.DialTimeout("tcp", m.pageServer, 10*time.Second); derr == nil {
+					conn.Close()
+				}
+			}
+			restored <- err
+		}()
+		return nil
+	}
+	err := m.c.Checkpoint(ctx, opts)
+	if restored == nil {
+		if err != nil {
+			log.Error().Msgf("migration failed, the container continues to run: %s", err)
+		}
+		return err
+	}
+	rerr := <-restored
+	switch {
+	case rerr != nil && err != nil:
+		log.Error().Msgf("migration failed, the container continues to run: %s", rerr)
+		return rerr
+	case rerr != nil:
+		return fmt.Errorf("memory pages were transferred, but the restore failed (images are kept in %s): %w", m.imageDir, rerr)
+	case err != nil:
+		return fmt.Errorf("container was restored on %s, but the memory transfer failed: %w", m.dest, err)
+	}
+	return nil
+}
+
+// cleanup deletes the migrated container and the checkpoint images.
+func (m *migration) cleanup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clxc.Timeouts.DeleteTimeout)*time.Second)
+	defer cancel()
+	if err := clxc.Delete(ctx, m.c.ContainerID, true); err != nil {
+		return fmt.Errorf("container was migrated, but failed to delete the local container: %w", err)
+	}
+	if err := os.RemoveAll(m.imageDir); err != nil {
+		clxc.Log.Warn().Msgf("failed to remove checkpoint images: %s", err)
+	}
+	clxc.Log.Info().Str("dest", m.dest).Msg("container migrated")
+	return nil
+}
+
+// sync copies the given directories to the same paths on the destination.
+func (m *migration) sync(paths ...string) error {
+	for _, p := range paths {
+		// #nosec
+		cmd := exec.Command("rsync", "-aHAX", "--numeric-ids", "--delete",
+			"-e", strings.Join(m.ssh, " "), p+"/", m.dest+":"+p+"/")
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// restoreRemote restores the container on the destination,
+// from the container config in the migrateConfigFile.
+// The stdio of the restored container is closed, because the ssh session would
+// otherwise not terminate. Errors are logged to the destination runtime log.
+func (m *migration) restoreRemote() error {
+	args := []string{m.lxcri, "create",
+		"--create-config", filepath.Join(m.imageDir, migrateConfigFile),
+		"--restore", m.imageDir}
+	if m.pageServer != "" {
+		args = append(args, "--restore-page-server", m.pageServer)
+	}
+	args = append(args, m.c.ContainerID)
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	remoteCmd := strings.Join(quoted, " ") + " </dev/null >/dev/null 2>&1"
+
+	// #nosec
+	cmd := exec.Command(m.ssh[0], append(m.ssh[1:], m.dest, remoteCmd)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to restore container on %s: %w", m.dest, err)
+	}
+	return nil
+}
+
+// restoreLocal restores the checkpointed container on this host.
+func (m *migration) restoreLocal(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cfg := *m.cfg
+	cfg.Log = m.c.Log
+
+	if err := clxc.Delete(ctx, cfg.ContainerID, true); err != nil {
+		return err
+	}
+	c, err := clxc.Restore(ctx, &cfg, m.imageDir)
+	if err != nil {
+		// The container is nil if the runtime dir was not created.
+		if c != nil {
+			if err := clxc.Delete(ctx, cfg.ContainerID, true); err != nil {
+				clxc.Log.Error().Err(err).Msg("failed to destroy container")
+			}
+		}
+		return err
+	}
+	clxc.releaseContainer(c)
+	clxc.Log.Info().Msg("restored container on this host")
+	return nil
+}
@@ -2,14 +2,34 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 )
 
+// stdinPath is the path value for reading a file from stdin.
+const stdinPath = "-"
+
+// loadSpec loads the container spec from the given path,
+// or from stdin if the path is stdinPath.
+func loadSpec(path string, stdin io.Reader) (*specs.Spec, error) {
+	if path == stdinPath {
+		spec, err := specki.ReadSpecJSON(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode JSON from stdin: %w", err)
+		}
+		return spec, nil
+	}
+	return specki.LoadSpecJSON(path)
+}
+
 func parseSignal(sig string) unix.Signal {
 	if sig == "" {
 		return unix.SIGTERM
@@ -57,3 +77,71 @@ func isTerminal(fd int) bool {
 	_, err := unix.IoctlGetTermios(fd, unix.TCGETS)
 	return err == nil
 }
+
+// parseLabels parses the given list of `key=value` pairs into a map.
+func parseLabels(vals []string) (map[string]string, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(vals))
+	for _, kv := range vals {
+		a := strings.SplitN(kv, "=", 2)
+		if len(a) != 2 || a[0] == "" {
+			return nil, fmt.Errorf("invalid label %q (expected key=value)", kv)
+		}
+		labels[a[0]] = a[1]
+	}
+	return labels, nil
+}
+
+// parseSysctls parses the given sysctls in the format `key=value`.
+func parseSysctls(vals []string) (map[string]string, error) {
+	sysctls := make(map[string]string, len(vals))
+	for _, kv := range vals {
+		a := strings.SplitN(kv, "=", 2)
+		if len(a) != 2 || a[0] == "" {
+			return nil, fmt.Errorf("invalid sysctl %q (expected key=value)", kv)
+		}
+		sysctls[a[0]] = a[1]
+	}
+	return sysctls, nil
+}
+
+// parseListFilters converts the given list filter expressions
+// into lxcri.ListFilter functions.
+func parseListFilters(vals []string) ([]lxcri.ListFilter, error) {
+	filters := make([]lxcri.ListFilter, 0, len(vals))
+	for _, val := range vals {
+		a := strings.SplitN(val, "=", 2)
+		if len(a) != 2 || a[1] == "" {
+			return nil, fmt.Errorf("invalid filter %q", val)
+		}
+		switch a[0] {
+		case "label":
+			filters = append(filters, lxcri.WithLabel(a[1]))
+		default:
+			return nil, fmt.Errorf("unsupported filter %q", a[0])
+		}
+	}
+	return filters, nil
+}
+
+func parseNamespacePaths(values []string) (map[specs.LinuxNamespaceType]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	paths := make(map[specs.LinuxNamespaceType]string, len(values))
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i < 1 || i == len(v)-1 {
+			return nil, fmt.Errorf("invalid namespace path %q: expected <type>=<path>", v)
+		}
+		paths[specs.LinuxNamespaceType(v[:i])] = v[i+1:]
+	}
+	return paths, nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
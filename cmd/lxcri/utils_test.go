@@ -1,8 +1,13 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 
 	"github.com/stretchr/testify/require"
@@ -30,3 +35,72 @@ func TestParseSignal(t *testing.T) {
 	sig = parseSignal("66")
 	require.Equal(t, unix.Signal(66), sig)
 }
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels([]string{"pod=x", "empty=", "k=v=w"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"pod": "x", "empty": "", "k": "v=w"}, labels)
+
+	_, err = parseLabels([]string{"novalue"})
+	require.Error(t, err)
+
+	_, err = parseLabels([]string{"=value"})
+	require.Error(t, err)
+}
+
+func TestParseSysctls(t *testing.T) {
+	sysctls, err := parseSysctls([]string{"net.core.somaxconn=1024", "net/ipv4/ip_unprivileged_port_start=0"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"net.core.somaxconn": "1024", "net/ipv4/ip_unprivileged_port_start": "0"}, sysctls)
+
+	_, err = parseSysctls([]string{"net.core.somaxconn"})
+	require.Error(t, err)
+}
+
+func TestParseListFilters(t *testing.T) {
+	filters, err := parseListFilters([]string{"label=pod=x", "label=tier"})
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+
+	_, err = parseListFilters([]string{"name=foo"})
+	require.Error(t, err)
+
+	_, err = parseListFilters([]string{"label="})
+	require.Error(t, err)
+}
+
+func TestParseNamespacePaths(t *testing.T) {
+	paths, err := parseNamespacePaths([]string{"network=/proc/1/ns/net", "uts=/run/netns/x"})
+	require.NoError(t, err)
+	require.Equal(t, map[specs.LinuxNamespaceType]string{
+		specs.NetworkNamespace: "/proc/1/ns/net",
+		specs.UTSNamespace:     "/run/netns/x",
+	}, paths)
+
+	_, err = parseNamespacePaths([]string{"network"})
+	require.Error(t, err)
+	_, err = parseNamespacePaths([]string{"network="})
+	require.Error(t, err)
+}
+
+func TestShellQuote(t *testing.T) {
+	require.Equal(t, `'/var/lib/my bundle'`, shellQuote("/var/lib/my bundle"))
+	require.Equal(t, `'it'\''s'`, shellQuote("it's"))
+	require.Equal(t, `''`, shellQuote(""))
+}
+
+func TestLoadSpec(t *testing.T) {
+	spec, err := loadSpec(stdinPath, strings.NewReader(`{"ociVersion": "1.0.2", "process": {"args": ["/bin/sh"]}}`))
+	require.NoError(t, err)
+	require.Equal(t, "1.0.2", spec.Version)
+	require.Equal(t, []string{"/bin/sh"}, spec.Process.Args)
+
+	_, err = loadSpec(stdinPath, strings.NewReader(`{"ociVersion": `))
+	require.Error(t, err)
+
+	p := filepath.Join(t.TempDir(), "spec.json")
+	require.NoError(t, specki.EncodeJSONFile(p, spec, os.O_CREATE|os.O_EXCL, 0600))
+	loaded, err := loadSpec(p, nil)
+	require.NoError(t, err)
+	require.Equal(t, spec, loaded)
+}
@@ -0,0 +1,181 @@
+// lxcrid is a long running daemon that owns the runtime root
+// and serves the runtime API (see package daemon) on a unix socket.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/daemon"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/unix"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "lxcrid"
+	app.Usage = "lxcrid serves the lxcri runtime API on a unix socket"
+	app.Version = lxcri.BuildInfo().Version
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "path to the runtime config file",
+			EnvVars: []string{"LXCRI_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:  "socket",
+			Usage: "path to the API unix socket (defaults to .lxcrid.sock in the runtime root)",
+		},
+		&cli.StringFlag{
+			Name:  "events-socket",
+			Usage: "path to the events unix socket (defaults to .events.sock in the runtime root)",
+		},
+		&cli.StringFlag{
+			Name:  "http-socket",
+			Usage: "path to the unix socket for the read-only HTTP API (disabled if empty)",
+		},
+		&cli.IntSliceFlag{
+			Name:  "http-allow-uid",
+			Usage: "allow the given user ID to use the HTTP API in addition to root and the daemon user, can be repeated",
+		},
+		&cli.DurationFlag{
+			Name:  "events-interval",
+			Usage: "interval for polling the container states",
+			Value: time.Second,
+		},
+		&cli.DurationFlag{
+			Name:  "health-interval",
+			Usage: "interval for scanning the containers for due health checks (disabled if 0)",
+			Value: time.Second,
+		},
+		&cli.DurationFlag{
+			Name:  "restart-interval",
+			Usage: "interval for scanning the containers for due restarts (disabled if 0)",
+			Value: time.Second,
+		},
+	}
+	app.Action = serve
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func serve(ctxcli *cli.Context) error {
+	rt := lxcri.NewRuntime(os.Getuid() != 0)
+	if err := rt.LoadConfig(ctxcli.String("config")); err != nil {
+		return err
+	}
+	rt.LogConfig.LogContext = map[string]string{"cmd": "lxcrid"}
+	if err := rt.Init(); err != nil {
+		return err
+	}
+
+	socket := ctxcli.String("socket")
+	if socket == "" {
+		socket = daemon.SocketPath(rt)
+	}
+	l, err := lxcri.ListenUnix(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	eventSocket := ctxcli.String("events-socket")
+	if eventSocket == "" {
+		eventSocket = rt.EventSocketPath()
+	}
+	el, err := lxcri.ListenUnix(eventSocket)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	defer os.Remove(eventSocket)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), unix.SIGINT, unix.SIGTERM)
+	defer cancel()
+
+	rr := lxcri.NewReloadableRuntime(rt)
+	svc := &daemon.Service{Runtime: rr}
+
+	// SIGHUP reloads the runtime configuration once all servers are started.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, unix.SIGHUP)
+	defer signal.Stop(reload)
+
+	if httpSocket := ctxcli.String("http-socket"); httpSocket != "" {
+		hl, err := lxcri.ListenUnix(httpSocket)
+		if err != nil {
+			l.Close()
+			el.Close()
+			return err
+		}
+		defer os.Remove(httpSocket)
+		// The socket permissions are relaxed, because clients are authenticated
+		// by their peer credentials (see daemon.HTTPHandler).
+		if err := os.Chmod(httpSocket, 0666); err != nil {
+			hl.Close()
+			l.Close()
+			el.Close()
+			return err
+		}
+		h := &daemon.HTTPHandler{Service: svc}
+		for _, uid := range ctxcli.IntSlice("http-allow-uid") {
+			h.AllowedUIDs = append(h.AllowedUIDs, uint32(uid))
+		}
+		go func() {
+			if err := daemon.ServeHTTP(ctx, hl, h); err != nil {
+				logError(rr, "HTTP API failed: %s", err)
+			}
+		}()
+		rt.Log.Info().Str("socket", httpSocket).Msg("serving HTTP API")
+	}
+
+	if interval := ctxcli.Duration("health-interval"); interval > 0 {
+		go rr.MonitorHealth(ctx, interval)
+	}
+	if interval := ctxcli.Duration("restart-interval"); interval > 0 {
+		go rr.MonitorRestarts(ctx, interval)
+	}
+
+	events := lxcri.EventServer{Runtime: rr, Interval: ctxcli.Duration("events-interval")}
+	eventsDone := make(chan error, 1)
+	go func() {
+		eventsDone <- events.Serve(ctx, el)
+	}()
+
+	rt.Log.Info().Str("socket", socket).Str("events-socket", eventSocket).Msg("serving runtime API")
+	// Operations in progress keep using the previous configuration,
+	// the old log file is closed when they are done.
+	// rt must not be used after this point.
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reload:
+				if err := svc.Reload(); err != nil {
+					logError(rr, "failed to reload runtime configuration: %s", err)
+				}
+			}
+		}
+	}()
+	err = daemon.Serve(ctx, l, svc)
+	cancel()
+	if eventsErr := <-eventsDone; err == nil {
+		err = eventsErr
+	}
+	return err
+}
+
+// logError logs the error with the logger of the current runtime snapshot.
+func logError(rr *lxcri.ReloadableRuntime, format string, args ...interface{}) {
+	rt, done := rr.Acquire()
+	defer done()
+	rt.Log.Error().Msgf(format, args...)
+}
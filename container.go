@@ -6,11 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/lxc/go-lxc"
-	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/rs/zerolog"
 	"golang.org/x/sys/unix"
@@ -54,6 +54,111 @@ type ContainerConfig struct {
 	// LogLevel is the liblxc log level
 	LogLevel string
 
+	// NoPivot requests to enter the container rootfs using chroot instead
+	// of pivot_root. This is required if the host root filesystem
+	// is the initramfs (rootfs) which can not be pivoted.
+	// liblxc uses chroot only on an initramfs, so Runtime.Create fails
+	// if NoPivot is set on a host with another root filesystem.
+	NoPivot bool `json:",omitempty"`
+
+	// Labels are arbitrary key value pairs attached to the container.
+	// Labels are persisted with the container state and can be used
+	// to select containers with Runtime.List (see WithLabel).
+	Labels map[string]string `json:",omitempty"`
+
+	// HostLocaltime bind mounts the host timezone files /etc/localtime
+	// and /etc/timezone (read-only) into the container,
+	// if they do not exist in the container rootfs.
+	HostLocaltime bool `json:",omitempty"`
+
+	// DNS is the resolver configuration written to a runtime managed
+	// /etc/resolv.conf. It is ignored if the spec mounts /etc/resolv.conf.
+	// See Runtime.HostDNS for the default if DNS is nil.
+	DNS *DNSConfig `json:",omitempty"`
+
+	// ExtraHosts are additional entries for the runtime managed /etc/hosts.
+	// They are merged with AnnotationExtraHosts. See Runtime.ManageHosts.
+	ExtraHosts []HostEntry `json:",omitempty"`
+
+	// ProcMountOptions are additional mount options for the container /proc mount.
+	// Only the options `hidepid=<value>` and `subset=pid` are supported
+	// (see `man 5 proc`). The options are merged with AnnotationProcOptions.
+	ProcMountOptions []string `json:",omitempty"`
+
+	// HugepageMounts are hugetlbfs mounts within the container.
+	// They are merged with AnnotationHugepages.
+	HugepageMounts []HugepageMount `json:",omitempty"`
+
+	// CoreScheduling creates a core scheduling cookie (PR_SCHED_CORE)
+	// for the container init process that is shared with all exec'd processes.
+	// Tasks with different cookies never run simultaneously on SMT siblings
+	// of the same CPU core. It requires kernel >= 5.14.
+	// See AnnotationCoreScheduling.
+	CoreScheduling bool `json:",omitempty"`
+
+	// MemoryLock allows the container process to lock all of its memory
+	// (see `man 2 mlockall`) e.g for realtime workloads. An unlimited RLIMIT_MEMLOCK
+	// is added to the spec (raising the hard limit requires CAP_SYS_RESOURCE),
+	// and the container memory is excluded from swap (see NoSwap).
+	// The runtime can not lock the memory on behalf of the container process,
+	// because memory locks are removed by execve. See AnnotationMemoryLock.
+	MemoryLock bool `json:",omitempty"`
+
+	// NoSwap excludes the container memory from swap (cgroup2 `memory.swap.max=0`).
+	// It requires the cgroup memory controller. See AnnotationNoSwap.
+	NoSwap bool `json:",omitempty"`
+
+	// CRILogFile is the path of a log file in the kubernetes CRI log format
+	// that receives a copy of the container stdout and stderr.
+	// This is an alternative to conmon, for containers with inherited stdio.
+	// The file is written by the monitor process until the container exits.
+	CRILogFile string `json:",omitempty"`
+
+	// Secrets are the files that are made available to the container process
+	// on a tmpfs (see Secret).
+	Secrets []Secret `json:",omitempty"`
+
+	// SandboxID is the ID of a pod sandbox container, whose SandboxNamespaces
+	// are joined by the container. The container is labeled with SandboxLabel.
+	// Pod containers can be signaled and deleted as a group,
+	// see Runtime.KillSandbox and Runtime.DeleteSandbox.
+	SandboxID string `json:",omitempty"`
+
+	// RestoreImageDir is the directory of the CRIU images written by
+	// Container.Checkpoint. If set the container process is restored from the images
+	// instead of being created, and the container is running after Runtime.Create.
+	RestoreImageDir string `json:",omitempty"`
+
+	// RestorePageServer is the address (host:port) of the page server of a lazy
+	// checkpoint (see CheckpointOptions.PageServer). The `criu lazy-pages` daemon
+	// is started before the container is restored from RestoreImageDir, and transfers
+	// the memory pages on demand while the container is running.
+	// The daemon exits when all memory pages are transferred.
+	RestorePageServer string `json:",omitempty"`
+
+	// RestartPolicy is the restart policy of the container (see ParseRestartPolicy).
+	// It is persisted for the process that supervises the container.
+	// The policy is applied only by Runtime.MonitorRestarts (lxcrid),
+	// a container created with the standalone `lxcri` is never restarted.
+	RestartPolicy string `json:",omitempty"`
+
+	// HealthCheck is the health check probe of the container.
+	// It is merged with the health check annotations (see AnnotationHealthCmd).
+	// The probes are executed by ReloadableRuntime.MonitorHealth.
+	HealthCheck *HealthCheck `json:",omitempty"`
+
+	// MaxRuntime is the maximum runtime of the container, starting when it is created.
+	// The monitor process stops the container when the runtime is exceeded:
+	// The container init process receives SIGTERM, and SIGKILL after Timeouts.KillTimeout.
+	// The ExitStatus.Reason is ExitReasonDeadlineExceeded. The deadline is enforced
+	// independent of the runtime caller. It is merged with AnnotationMaxRuntime.
+	MaxRuntime time.Duration `json:",omitempty"`
+
+	// NetworkReady are the conditions Runtime.Start waits for before
+	// the container process is started. It is merged with the network readiness
+	// annotations (see AnnotationNetworkReadyInterface).
+	NetworkReady *NetworkReadiness `json:",omitempty"`
+
 	// Log is the container Logger
 	Log zerolog.Logger `json:"-"`
 }
@@ -75,76 +180,211 @@ func (c Container) RuntimePath(subPath ...string) string {
 
 // Container is the runtime state of a container instance.
 type Container struct {
-	LinuxContainer *lxc.Container `json:"-"`
+	// linuxContainer is the liblxc container instance.
+	// It must not be exposed, use (or add) wrapper methods instead.
+	linuxContainer *lxc.Container
 	*ContainerConfig
 
+	// SchemaVersion is the version of the persisted container state.
+	// See the SchemaVersion constant for details.
+	SchemaVersion int
+
 	CreatedAt time.Time
 	// Pid is the process ID of the liblxc monitor process ( see ExecStart )
 	Pid int
+	// MonitorStartTime is the start time of the monitor process
+	// in clock ticks after system boot. Together with Pid it identifies
+	// the monitor process, even if Pid was reused by another process.
+	MonitorStartTime uint64 `json:",omitempty"`
+
+	// Warnings are the configuration decisions made by Runtime.Create,
+	// that deviate from the container spec.
+	Warnings []Warning `json:",omitempty"`
+
+	// ConfigDigest is the digest of the liblxc config file
+	// generated by Runtime.Create.
+	ConfigDigest string `json:",omitempty"`
+	// SpecDigest is the digest of the container spec file
+	// generated by Runtime.Create.
+	SpecDigest string `json:",omitempty"`
+
+	// InitPath is the host path of the lxcri-init executable
+	// that is bind mounted into the container (see ExecOptions.Cgroup).
+	InitPath string `json:",omitempty"`
+	// StartPath is the host path of the lxcri-start executable
+	// that started the monitor process. It is also used for
+	// the lazy dump (see CheckpointOptions.PageServer).
+	StartPath string `json:",omitempty"`
 
 	runtimeDir string
+
+	// backoff are the poll intervals used while waiting for state changes.
+	backoff Backoff
+	// events receives the EventExecStarted events.
+	events *eventBus
+	// hooks are the Runtime.LifecycleHooks.
+	hooks *LifecycleHooks
+
+	// cpuAllocationsFile records the CPU allocations of the containers.
+	cpuAllocationsFile string
+
+	// configItems is the number of liblxc config items set by setConfigItem.
+	configItems int
+
+	// cgroupControllers are the cgroup2 controllers available for the container cgroup.
+	// It is nil if the controllers are unknown (see setCgroupItem).
+	cgroupControllers map[string]bool
+
+	// timings are the lifecycle operation durations (see Container.Timings).
+	timings Timings
+}
+
+// Warning describes a configuration decision made by the runtime,
+// which degrades the container compared to the container spec.
+// e.g a disabled security feature or an ignored resource limit.
+type Warning struct {
+	// Reason is a short machine readable identifier in CamelCase.
+	Reason string
+	// Message is the human readable warning message.
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Reason + ": " + w.Message
 }
 
-func (c *Container) create() error {
-	if err := os.MkdirAll(c.runtimeDir, 0777); err != nil {
-		return fmt.Errorf("failed to create container dir: %w", err)
+// warnf logs the warning and adds it to the list of container warnings.
+func (c *Container) warnf(reason string, format string, args ...interface{}) {
+	w := Warning{Reason: reason, Message: fmt.Sprintf(format, args...)}
+	c.Log.Warn().Str("reason", w.Reason).Msg(w.Message)
+	c.Warnings = append(c.Warnings, w)
+}
+
+// create creates the runtime directory of the container and returns its lock.
+// The directory is created and locked as hidden temporary directory,
+// which is renamed into place, so that concurrent invocations for the container
+// never find the runtime directory unlocked before the container is created.
+// ErrExist is returned if the runtime directory already exists.
+// The runtime directory is only in place if no error is returned.
+// The lock must be released by the caller.
+func (c *Container) create(ctx context.Context, perm dirPermissions) (*Lock, error) {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(c.runtimeDir), "."+c.ContainerID+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container dir: %w", err)
+	}
+	lock, err := c.createLocked(ctx, tmpDir, perm)
+	if err != nil {
+		_ = lock.Unlock()
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
 	}
+	return lock, nil
+}
 
-	if err := os.Chmod(c.runtimeDir, 0777); err != nil {
-		return errorf("failed to chmod %s: %w", err)
+// createLocked locks the temporary directory and renames it to the runtime directory.
+// The returned lock is valid even if an error is returned.
+func (c *Container) createLocked(ctx context.Context, tmpDir string, perm dirPermissions) (*Lock, error) {
+	if err := perm.apply(tmpDir); err != nil {
+		return nil, err
 	}
 
-	f, err := os.OpenFile(c.RuntimePath("config"), os.O_EXCL|os.O_CREATE|os.O_RDWR, 0640)
+	lock, err := lockDir(ctx, tmpDir, true, c.backoff)
 	if err != nil {
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("failed to close empty config tmpfile: %w", err)
+		return nil, err
 	}
 
-	c.LinuxContainer, err = lxc.NewContainer(c.ContainerID, filepath.Dir(c.runtimeDir))
+	// The directory is not empty, so it can not be replaced by the rename
+	// of a concurrent create for the same container.
+	f, err := os.OpenFile(filepath.Join(tmpDir, "config"), os.O_EXCL|os.O_CREATE|os.O_RDWR, 0640)
 	if err != nil {
-		return err
+		return lock, err
+	}
+	if err := f.Close(); err != nil {
+		return lock, fmt.Errorf("failed to close empty config tmpfile: %w", err)
 	}
-	c.Log.Debug().Msgf("create new container Container:%p LinuxContainer:%p", c, c.LinuxContainer)
 
-	return nil
+	if err := os.Rename(tmpDir, c.runtimeDir); err != nil {
+		if errors.Is(err, unix.ENOTEMPTY) || errors.Is(err, unix.EEXIST) {
+			return lock, ErrExist
+		}
+		return lock, fmt.Errorf("failed to create container dir: %w", err)
+	}
+	return lock, nil
 }
 
 func (c *Container) load() error {
 	c.Log.Debug().Str("config", c.RuntimePath("lxcri.json")).Msgf("loading container")
-	err := specki.DecodeJSONFile(c.RuntimePath("lxcri.json"), c)
+	// #nosec
+	data, err := os.ReadFile(c.RuntimePath("lxcri.json"))
 	if err != nil {
 		return fmt.Errorf("failed to load container config: %w", err)
 	}
+	if err := decodeContainerState(data, c); err != nil {
+		return fmt.Errorf("failed to load container config: %w", err)
+	}
 
 	// FIXME use access (read/write) check instead ?
 	_, err = os.Stat(c.ConfigFilePath())
 	if err != nil {
 		return fmt.Errorf("failed to stat lxc config file: %w", err)
 	}
-	c.LinuxContainer, err = lxc.NewContainer(c.ContainerID, filepath.Dir(c.runtimeDir))
+	c.linuxContainer, err = lxc.NewContainer(c.ContainerID, filepath.Dir(c.runtimeDir))
 	if err != nil {
 		return fmt.Errorf("failed to create lxc container: %w", err)
 	}
 
-	err = c.LinuxContainer.LoadConfigFile(c.ConfigFilePath())
+	err = c.linuxContainer.LoadConfigFile(c.ConfigFilePath())
 	if err != nil {
 		return fmt.Errorf("failed to load config file: %w", err)
 	}
 	return nil
 }
 
+// updateDigests updates the digests of the generated
+// liblxc config file and container spec file.
+func (c *Container) updateDigests() (err error) {
+	c.ConfigDigest, err = fileDigest(c.ConfigFilePath())
+	if err != nil {
+		return err
+	}
+	c.SpecDigest, err = fileDigest(c.RuntimePath(BundleConfigFile))
+	return err
+}
+
+// verifyDigests verifies that the liblxc config file and the container spec file
+// have not been modified since the container was created.
+// Containers created by a runtime without digest support are not verified.
+func (c *Container) verifyDigests() error {
+	files := []struct {
+		name   string
+		digest string
+	}{
+		{c.ConfigFilePath(), c.ConfigDigest},
+		{c.RuntimePath(BundleConfigFile), c.SpecDigest},
+	}
+	for _, f := range files {
+		if f.digest == "" {
+			continue
+		}
+		digest, err := fileDigest(f.name)
+		if err != nil {
+			return err
+		}
+		if digest != f.digest {
+			return fmt.Errorf("%w: %s digest is %s but was %s at create", ErrConfigDrift, f.name, digest, f.digest)
+		}
+	}
+	return nil
+}
+
 func (c *Container) waitMonitorStopped(ctx context.Context) error {
+	timer := c.backoff.timer()
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if !c.isMonitorRunning() {
-				return nil
-			}
-			time.Sleep(time.Millisecond * 100)
+		if !c.isMonitorRunning() {
+			return nil
+		}
+		if err := timer.wait(ctx); err != nil {
+			return err
 		}
 	}
 }
@@ -171,59 +411,62 @@ func (c *Container) isMonitorRunning() bool {
 	// This runtime process may not be the parent of the monitor process
 	if err == unix.ECHILD {
 		// check if the process is still runnning
-		err := unix.Kill(c.Pid, 0)
-		if err == nil {
-			return true
+		pidfd, err := c.openMonitor()
+		if err == unix.ENOSYS {
+			// pidfd_open requires kernel >= 5.3
+			return unix.Kill(c.Pid, 0) == nil
 		}
-		// it's not running
-		if err == unix.ESRCH {
+		if err != nil {
 			return false
 		}
+		defer unix.Close(pidfd)
+		exited, err := pidfdExited(pidfd)
+		return err == nil && !exited
 	}
 	return false
 }
 
 func (c *Container) waitCreated(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if !c.isMonitorRunning() {
-				return fmt.Errorf("monitor already died")
-			}
-			state := c.LinuxContainer.State()
-			if !(state == lxc.RUNNING) {
-				c.Log.Debug().Stringer("state", state).Msg("wait for state lxc.RUNNING")
-				time.Sleep(time.Millisecond * 100)
-				continue
-			}
-			initState, err := c.getContainerInitState()
-			if err != nil {
-				return err
-			}
-			if initState == specs.StateCreated {
-				return nil
-			}
-			return fmt.Errorf("unexpected init state %q", initState)
+	return c.waitInit(ctx, func(initState specs.ContainerState) (bool, error) {
+		if initState == specs.StateCreated {
+			return true, nil
 		}
-	}
+		return false, fmt.Errorf("unexpected init state %q", initState)
+	})
 }
 
+// waitStarted waits until lxcri-init has executed the container process.
+// The exec is not observable through an event, so the init process is polled,
+// but the wait ends immediately if the init process exits.
 func (c *Container) waitStarted(ctx context.Context) error {
+	initPid := c.linuxContainer.InitPid()
+	if initPid < 1 {
+		return nil
+	}
+	var exited <-chan error
+	if pidfd, err := pidfdOpen(initPid); err == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		exited = watchPidfd(ctx, pidfd)
+	}
+	timer := c.backoff.timer()
 	for {
+		if exited == nil && !c.isMonitorRunning() {
+			return nil
+		}
+		initState, _ := c.getContainerInitState()
+		if initState != specs.StateCreated {
+			return nil
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		default:
-			if !c.isMonitorRunning() {
+		case err := <-exited:
+			if err == nil {
 				return nil
 			}
-			initState, _ := c.getContainerInitState()
-			if initState != specs.StateCreated {
-				return nil
-			}
-			time.Sleep(time.Millisecond * 10)
+			exited = nil
+		case <-time.After(timer.next()):
 		}
 	}
 }
@@ -233,6 +476,88 @@ type State struct {
 	ContainerState string
 	RuntimePath    string
 	SpecState      specs.State
+	// ExitStatus is the exit status of the container init process.
+	// It is only set if the container is stopped.
+	ExitStatus *ExitStatus `json:",omitempty"`
+	// Health is the health status of the container.
+	// It is only set if the container has a HealthCheck.
+	Health *Health `json:",omitempty"`
+	// Timings are the lifecycle operation durations.
+	Timings *Timings `json:",omitempty"`
+	// Checkpoint is the metadata of the last checkpoint.
+	Checkpoint *CheckpointInfo `json:",omitempty"`
+}
+
+// ExitStatus is the exit status of the container init process.
+type ExitStatus struct {
+	// Code is the exit code of the init process.
+	// If the process was killed by a signal the code is 128 + signal number.
+	Code int
+	// Signal is the signal that killed the process.
+	Signal string `json:",omitempty"`
+	// Reason is the reason why the runtime stopped the container,
+	// e.g ExitReasonDeadlineExceeded.
+	Reason string `json:",omitempty"`
+	// ExitedAt is the time when the exit status was recorded.
+	ExitedAt time.Time
+}
+
+// exitStatusFile is written by the monitor process (lxcri-start)
+// when the container init process exits.
+const exitStatusFile = "exit-status"
+
+// ExitStatus returns the exit status of the container init process.
+// ErrNotExist is returned if the init process has not yet exited.
+func (c *Container) ExitStatus() (*ExitStatus, error) {
+	filename := c.RuntimePath(exitStatusFile)
+	// #nosec
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	status, err := parseExitStatus(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exit status file %s: %w", filename, err)
+	}
+	status.ExitedAt = info.ModTime()
+	if c.deadlineExceeded() {
+		status.Reason = ExitReasonDeadlineExceeded
+	}
+	return status, nil
+}
+
+// ShouldRestart evaluates the container RestartPolicy for the stopped container.
+// See RestartPolicy.ShouldRestart for the arguments.
+func (c *Container) ShouldRestart(restarts int, stopped bool) (bool, error) {
+	p, err := ParseRestartPolicy(c.RestartPolicy)
+	if err != nil {
+		return false, err
+	}
+	status, err := c.ExitStatus()
+	if err != nil && err != ErrNotExist {
+		return false, err
+	}
+	return p.ShouldRestart(status, restarts, stopped), nil
+}
+
+// parseExitStatus parses the wait status written by the monitor process.
+func parseExitStatus(data []byte) (*ExitStatus, error) {
+	val, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	ws := unix.WaitStatus(val)
+	if ws.Signaled() {
+		return &ExitStatus{Code: 128 + int(ws.Signal()), Signal: unix.SignalName(ws.Signal())}, nil
+	}
+	return &ExitStatus{Code: ws.ExitStatus()}, nil
 }
 
 // State returns the runtime state of the containers process.
@@ -245,7 +570,7 @@ func (c *Container) State() (*State, error) {
 	}
 
 	state := &State{
-		ContainerState: c.LinuxContainer.State().String(),
+		ContainerState: c.linuxContainer.State().String(),
 		RuntimePath:    c.RuntimePath(),
 		SpecState: specs.State{
 			Version:     c.Spec.Version,
@@ -257,13 +582,41 @@ func (c *Container) State() (*State, error) {
 		},
 	}
 
+	if status == specs.StateStopped {
+		exitStatus, err := c.ExitStatus()
+		if err != nil && err != ErrNotExist {
+			c.Log.Warn().Msgf("failed to read exit status: %s", err)
+		}
+		state.ExitStatus = exitStatus
+	}
+
+	if c.HealthCheck != nil {
+		health, err := c.Health()
+		if err != nil {
+			c.Log.Warn().Msgf("failed to read health status: %s", err)
+		}
+		state.Health = health
+	}
+
+	timings, err := c.Timings()
+	if err != nil && err != ErrNotExist {
+		c.Log.Warn().Msgf("failed to read timings: %s", err)
+	}
+	state.Timings = timings
+
+	checkpoint, err := c.LastCheckpoint()
+	if err != nil && err != ErrNotExist {
+		c.Log.Warn().Msgf("failed to read checkpoint metadata: %s", err)
+	}
+	state.Checkpoint = checkpoint
+
 	return state, nil
 }
 
 // ContainerState returns the current state of the container process,
 // as defined by the OCI runtime spec.
 func (c *Container) ContainerState() (specs.ContainerState, error) {
-	return c.state(c.LinuxContainer.State())
+	return c.state(c.linuxContainer.State())
 }
 
 func (c *Container) state(s lxc.State) (specs.ContainerState, error) {
@@ -273,7 +626,11 @@ func (c *Container) state(s lxc.State) (specs.ContainerState, error) {
 	case lxc.STARTING:
 		return specs.StateCreating, nil
 	case lxc.RUNNING, lxc.STOPPING, lxc.ABORTING, lxc.FREEZING, lxc.FROZEN, lxc.THAWED:
-		return c.getContainerInitState()
+		initState, err := c.getContainerInitState()
+		if err == nil && initState == specs.StateRunning && c.isFrozen(s) {
+			return StatePaused, nil
+		}
+		return initState, err
 	default:
 		return specs.StateStopped, fmt.Errorf("unsupported lxc container state %q", s)
 	}
@@ -283,7 +640,7 @@ func (c *Container) state(s lxc.State) (specs.ContainerState, error) {
 // This should be called if the container is in state lxc.RUNNING.
 // On error the caller should call getContainerState() again
 func (c *Container) getContainerInitState() (specs.ContainerState, error) {
-	initPid := c.LinuxContainer.InitPid()
+	initPid := c.linuxContainer.InitPid()
 	if initPid < 1 {
 		return specs.StateStopped, nil
 	}
@@ -329,10 +686,32 @@ func (c *Container) kill(ctx context.Context, signum unix.Signal) error {
 	return nil
 }
 
+// InitPid returns the PID of the container init process
+// or -1 if the init process is not running.
+func (c *Container) InitPid() int {
+	return c.linuxContainer.InitPid()
+}
+
+// ConfigItem returns the values of the given liblxc config key
+// from the container configuration. e.g `lxc.mount.entry`
+func (c *Container) ConfigItem(key string) []string {
+	return c.linuxContainer.ConfigItem(key)
+}
+
+// Freeze freezes all processes of the container.
+func (c *Container) Freeze() error {
+	return c.linuxContainer.Freeze()
+}
+
+// Unfreeze thaws all processes of a frozen container.
+func (c *Container) Unfreeze() error {
+	return c.linuxContainer.Unfreeze()
+}
+
 // getConfigItem is a wrapper function and returns the
 // first value returned by lxc.Container.ConfigItem
 func (c *Container) getConfigItem(key string) string {
-	vals := c.LinuxContainer.ConfigItem(key)
+	vals := c.linuxContainer.ConfigItem(key)
 	if len(vals) > 0 {
 		first := vals[0]
 		// some lxc config values are set to '(null)' if unset eg. lxc.cgroup.dir
@@ -347,11 +726,12 @@ func (c *Container) getConfigItem(key string) string {
 // setConfigItem is a wrapper for lxc.Container.setConfigItem.
 // and only adds additional logging.
 func (c *Container) setConfigItem(key, value string) error {
-	err := c.LinuxContainer.SetConfigItem(key, value)
+	err := c.linuxContainer.SetConfigItem(key, value)
 	if err != nil {
 		return fmt.Errorf("failed to set config item '%s=%s': %w", key, value, err)
 	}
-	c.Log.Debug().Str(key, value).Msg("set config item")
+	c.Log.Trace().Str(key, value).Msg("set config item")
+	c.configItems++
 	return nil
 }
 
@@ -374,26 +754,141 @@ func (c *Container) supportsConfigItem(keys ...string) bool {
 // Release releases resources allocated by the container.
 func (c *Container) Release() error {
 	c.Log.Debug().Msg("releasing container")
-	return c.LinuxContainer.Release()
+	return c.linuxContainer.Release()
 }
 
 func (c *Container) start(ctx context.Context) error {
-	// #nosec
-	fifo, err := os.OpenFile(c.syncFifoPath(), os.O_WRONLY, 0)
-	if err != nil {
-		return err
+	initPid := c.linuxContainer.InitPid()
+	if initPid < 1 {
+		return fmt.Errorf("%w: init process is not running", ErrInitExited)
 	}
-	if err := fifo.Close(); err != nil {
+	// Open the init process before notifying it,
+	// so the watchdog can not watch a reused PID.
+	pidfd, err := pidfdOpen(initPid)
+	if err == unix.ESRCH {
+		return fmt.Errorf("%w: init process %d is not running", ErrInitExited, initPid)
+	}
+	if err != nil && err != unix.ENOSYS {
+		return fmt.Errorf("failed to open init process %d: %w", initPid, err)
+	}
+
+	// Opening the fifo blocks until lxcri-init opens the fifo for reading.
+	notified := make(chan error, 1)
+	go func() {
+		// #nosec
+		fifo, err := os.OpenFile(c.syncFifoPath(), os.O_WRONLY, 0)
+		if err == nil {
+			err = fifo.Close()
+		}
+		notified <- err
+	}()
+
+	if err := c.watchInit(ctx, initPid, pidfd, notified); err != nil {
+		// Unblock the goroutine that opens the fifo for writing.
+		// #nosec
+		if f, err := os.OpenFile(c.syncFifoPath(), os.O_RDONLY|unix.O_NONBLOCK, 0); err == nil {
+			select {
+			case <-notified:
+			case <-time.After(time.Second):
+			}
+			f.Close()
+		}
 		return err
 	}
 	return c.waitStarted(ctx)
 }
 
+// watchInit waits until lxcri-init is notified.
+// It returns immediately with ErrInitExited if lxcri-init exits before.
+// The process file descriptor of lxcri-init is closed. If it is not available (-1)
+// the init process is polled.
+func (c *Container) watchInit(ctx context.Context, initPid int, pidfd int, notified chan error) error {
+	var exited <-chan error
+	if pidfd >= 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		exited = watchPidfd(ctx, pidfd)
+	}
+	timer := c.backoff.timer()
+	for {
+		var poll <-chan time.Time
+		if exited == nil {
+			if unix.Kill(initPid, 0) == unix.ESRCH {
+				return initExited(initPid, notified)
+			}
+			poll = time.After(timer.next())
+		}
+		select {
+		case err := <-notified:
+			return err
+		case err := <-exited:
+			if err == nil {
+				return initExited(initPid, notified)
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.Log.Debug().Msgf("polling init process: %s", err)
+			exited = nil
+		case <-poll:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func initExited(initPid int, notified chan error) error {
+	// lxcri-init may have been notified right before it exited.
+	select {
+	case err := <-notified:
+		return err
+	default:
+	}
+	return fmt.Errorf("%w: %s", ErrInitExited, describeExit(initPid))
+}
+
+// describeExit describes the exit of the process with the given pid.
+// The exit status is only available until the process is reaped by its parent.
+func describeExit(pid int) string {
+	status, err := processExitStatus(pid)
+	if err != nil {
+		return fmt.Sprintf("init process %d exited", pid)
+	}
+	if status.Signaled() {
+		return fmt.Sprintf("init process %d exited with signal %s", pid, status.Signal())
+	}
+	return fmt.Sprintf("init process %d exited with status %d", pid, status.ExitStatus())
+}
+
 // ExecOptions contains options for Container.Exec and Container.ExecDetached
 type ExecOptions struct {
 	// Namespaces is the list of container namespaces that the process is attached to.
 	// The process will is attached to all container namespaces if Namespaces is empty.
 	Namespaces []specs.LinuxNamespaceType
+
+	// NamespacePaths are namespace files (e.g /proc/<pid>/ns/net or a bind mounted
+	// namespace file) that the process joins instead of the container namespace of the same type.
+	// Namespaces of types that are neither in Namespaces nor in NamespacePaths
+	// are inherited from the runtime.
+	// Mount and user namespaces can not be joined by path.
+	NamespacePaths map[specs.LinuxNamespaceType]string
+
+	// Stdin, Stdout and Stderr are the standard streams of the process,
+	// e.g pipes, log files or sockets. The stdio of the runtime process is used
+	// for each stream that is nil.
+	Stdin  *os.File
+	Stdout *os.File
+	Stderr *os.File
+
+	// Cgroup is the name of a sub-cgroup `exec-<Cgroup>` of the container cgroup,
+	// that the process is started in. The process is executed by lxcri-init,
+	// which joins the sub-cgroup before it executes the process, and exits
+	// with status 126 if joining the sub-cgroup failed.
+	// The process is resource-accounted to the container,
+	// and can be killed reliably with its descendants. The sub-cgroup is removed
+	// by Container.Exec and Container.ExecContext when the process exits,
+	// and otherwise with the container cgroup when the container is deleted.
+	Cgroup string
 }
 
 // ExecDetached executes the given process spec within the container.
@@ -407,10 +902,21 @@ func (c *Container) ExecDetached(proc *specs.Process, execOpts *ExecOptions) (pi
 		return 0, errorf("failed to create attach options: %w", err)
 	}
 
-	pid, err = c.LinuxContainer.RunCommandNoWait(proc.Args, opts)
+	run := func(args []string) error {
+		return c.runAttach(execOpts, func() (err error) {
+			pid, err = c.linuxContainer.RunCommandNoWait(args, opts)
+			return err
+		})
+	}
+	if execOpts != nil && execOpts.Cgroup != "" {
+		err = c.runInExecCgroup(execOpts.Cgroup, proc.Args, run)
+	} else {
+		err = run(proc.Args)
+	}
 	if err != nil {
 		return pid, errorf("failed to run exec cmd detached: %w", err)
 	}
+	c.events.publish(c.execStartedEvent(pid))
 	return pid, nil
 }
 
@@ -419,17 +925,29 @@ func (c *Container) ExecDetached(proc *specs.Process, execOpts *ExecOptions) (pi
 // The container state must either be specs.StateCreated or specs.StateRunning
 // The given ExecOptions execOpts control the execution environment of the the process.
 func (c *Container) Exec(proc *specs.Process, execOpts *ExecOptions) (exitStatus int, err error) {
+	// The PID of the process is required to remove the sub-cgroup when it exits.
+	if execOpts != nil && execOpts.Cgroup != "" {
+		return c.ExecContext(context.Background(), proc, execOpts)
+	}
 	opts, err := c.attachOptions(proc, execOpts)
 	if err != nil {
 		return 0, errorf("failed to create attach options: %w", err)
 	}
-	exitStatus, err = c.LinuxContainer.RunCommandStatus(proc.Args, opts)
+	err = c.runAttach(execOpts, func() (err error) {
+		c.events.publish(c.execStartedEvent(0))
+		exitStatus, err = c.linuxContainer.RunCommandStatus(proc.Args, opts)
+		return err
+	})
 	if err != nil {
 		return exitStatus, errorf("failed to run exec cmd: %w", err)
 	}
 	return exitStatus, nil
 }
 
+func (c *Container) execStartedEvent(pid int) Event {
+	return Event{Type: EventExecStarted, ContainerID: c.ContainerID, Pid: pid, Time: time.Now()}
+}
+
 func (c *Container) attachOptions(procSpec *specs.Process, execOpts *ExecOptions) (lxc.AttachOptions, error) {
 	opts := lxc.AttachOptions{
 		StdinFd:  0,
@@ -457,14 +975,47 @@ func (c *Container) attachOptions(procSpec *specs.Process, execOpts *ExecOptions
 	if execOpts == nil {
 		execOpts = new(ExecOptions)
 	}
+	if execOpts.Stdin != nil {
+		opts.StdinFd = execOpts.Stdin.Fd()
+	}
+	if execOpts.Stdout != nil {
+		opts.StdoutFd = execOpts.Stdout.Fd()
+	}
+	if execOpts.Stderr != nil {
+		opts.StderrFd = execOpts.Stderr.Fd()
+	}
+
+	for t := range execOpts.NamespacePaths {
+		if _, ok := namespaceMap[t]; !ok {
+			return opts, fmt.Errorf("unsupported namespace %s", t)
+		}
+		if t == specs.MountNamespace || t == specs.UserNamespace {
+			return opts, fmt.Errorf("%s namespace can not be joined by path", t)
+		}
+		for _, t2 := range execOpts.Namespaces {
+			if t == t2 {
+				return opts, fmt.Errorf("%s namespace is both a container namespace and a namespace path", t)
+			}
+		}
+	}
 
 	if len(execOpts.Namespaces) == 0 {
 		for t := range namespaceMap {
-			execOpts.Namespaces = append(execOpts.Namespaces, t)
+			if _, ok := execOpts.NamespacePaths[t]; !ok {
+				execOpts.Namespaces = append(execOpts.Namespaces, t)
+			}
 		}
 	}
 	c.Log.Debug().Msgf("attaching to namespaces %#v\n", execOpts.Namespaces)
 
+	// The process terminal is inherited from the caller (e.g conmon).
+	if procSpec.Terminal && procSpec.ConsoleSize != nil {
+		size := TerminalSize{Width: uint16(procSpec.ConsoleSize.Width), Height: uint16(procSpec.ConsoleSize.Height)}
+		if err := resizeTerminal(int(opts.StdinFd), size); err != nil {
+			c.Log.Warn().Msgf("failed to set console size: %s", err)
+		}
+	}
+
 	for _, n := range c.Spec.Linux.Namespaces {
 		for _, t := range execOpts.Namespaces {
 			if n.Type == t {
@@ -498,15 +1049,15 @@ func (c *Container) SetLog(filename string, level string) error {
 	}
 
 	if verbose {
-		c.LinuxContainer.SetVerbosity(lxc.Verbose)
+		c.linuxContainer.SetVerbosity(lxc.Verbose)
 	} else {
-		c.LinuxContainer.SetVerbosity(lxc.Verbose)
+		c.linuxContainer.SetVerbosity(lxc.Verbose)
 	}
-	err := c.LinuxContainer.SetLogLevel(lxcLevel)
+	err := c.linuxContainer.SetLogLevel(lxcLevel)
 	if err != nil {
 		return fmt.Errorf("failed to set container loglevel: %w", err)
 	}
-	if err := c.LinuxContainer.SetLogFile(filename); err != nil {
+	if err := c.linuxContainer.SetLogFile(filename); err != nil {
 		return fmt.Errorf("failed to set container log file: %w", err)
 	}
 	return nil
@@ -0,0 +1,49 @@
+package lxcri
+
+import (
+	"os"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExitStatus(t *testing.T) {
+	status, err := parseExitStatus([]byte("0\n"))
+	require.NoError(t, err)
+	require.Equal(t, &ExitStatus{Code: 0}, status)
+
+	// exit status 3
+	status, err = parseExitStatus([]byte("768\n"))
+	require.NoError(t, err)
+	require.Equal(t, &ExitStatus{Code: 3}, status)
+
+	// killed by SIGKILL
+	status, err = parseExitStatus([]byte("9\n"))
+	require.NoError(t, err)
+	require.Equal(t, &ExitStatus{Code: 137, Signal: "SIGKILL"}, status)
+
+	_, err = parseExitStatus([]byte("invalid"))
+	require.Error(t, err)
+}
+
+func TestAttachOptionsStdio(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: &specs.Spec{Linux: &specs.Linux{}}}}
+	proc := &specs.Process{Args: []string{"true"}, Cwd: "/"}
+
+	opts, err := c.attachOptions(proc, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, opts.StdinFd)
+	require.EqualValues(t, 1, opts.StdoutFd)
+	require.EqualValues(t, 2, opts.StderrFd)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+	opts, err = c.attachOptions(proc, &ExecOptions{Stdin: r, Stderr: w})
+	require.NoError(t, err)
+	require.Equal(t, r.Fd(), opts.StdinFd)
+	require.EqualValues(t, 1, opts.StdoutFd)
+	require.Equal(t, w.Fd(), opts.StderrFd)
+}
@@ -0,0 +1,63 @@
+package lxcri
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// cpuMaxBurst is the cgroup2 interface file for the CPU bandwidth burst.
+// The burst allows a cgroup to accumulate unused quota and exceed
+// the quota (cpu.max) briefly. It requires kernel >= 5.14.
+const cpuMaxBurst = "cpu.max.burst"
+
+// cpuBurst returns the CPU burst in microseconds from either
+// AnnotationCPUBurst or the unified cgroup2 property `cpu.max.burst`.
+// The boolean return value is false if no burst is configured.
+func cpuBurst(spec *specs.Spec) (uint64, bool, error) {
+	var vals []string
+	if val, ok := spec.Annotations[AnnotationCPUBurst]; ok {
+		vals = append(vals, val)
+	}
+	if spec.Linux != nil && spec.Linux.Resources != nil {
+		if val, ok := spec.Linux.Resources.Unified[cpuMaxBurst]; ok {
+			vals = append(vals, val)
+		}
+	}
+	if len(vals) == 0 {
+		return 0, false, nil
+	}
+
+	var burst uint64
+	for i, val := range vals {
+		v, err := strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid cpu burst %q: %w", val, err)
+		}
+		if i > 0 && v != burst {
+			return 0, false, fmt.Errorf("cpu burst %s=%d conflicts with unified %s=%d", AnnotationCPUBurst, burst, cpuMaxBurst, v)
+		}
+		burst = v
+	}
+	return burst, true, nil
+}
+
+func configureCPUBurst(c *Container) error {
+	burst, ok, err := cpuBurst(c.Spec)
+	if err != nil || !ok {
+		return err
+	}
+	if err := checkKernelVersion(5, 14); err != nil {
+		c.warnf("CPUBurstUnsupported", "cpu burst is ignored: %s", err)
+		return nil
+	}
+	return c.setCgroupItem(cpuMaxBurst, strconv.FormatUint(burst, 10))
+}
+
+// SetCPUBurst sets the CPU burst (in microseconds) of the running container.
+// The burst must not exceed the CPU quota of the container cgroup.
+func (c *Container) SetCPUBurst(burst uint64) error {
+	return c.writeCgroupFile(cpuMaxBurst, strconv.FormatUint(burst, 10))
+}
@@ -0,0 +1,44 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUBurst(t *testing.T) {
+	spec := &specs.Spec{
+		Annotations: map[string]string{},
+		Linux:       &specs.Linux{Resources: &specs.LinuxResources{}},
+	}
+	_, ok, err := cpuBurst(spec)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	spec.Annotations[AnnotationCPUBurst] = "20000"
+	burst, ok, err := cpuBurst(spec)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(20000), burst)
+
+	spec.Linux.Resources.Unified = map[string]string{"cpu.max.burst": "20000"}
+	burst, ok, err = cpuBurst(spec)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(20000), burst)
+
+	spec.Linux.Resources.Unified["cpu.max.burst"] = "10000"
+	_, _, err = cpuBurst(spec)
+	require.Error(t, err)
+
+	delete(spec.Annotations, AnnotationCPUBurst)
+	burst, ok, err = cpuBurst(spec)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(10000), burst)
+
+	spec.Linux.Resources.Unified["cpu.max.burst"] = "-1"
+	_, _, err = cpuBurst(spec)
+	require.Error(t, err)
+}
@@ -0,0 +1,493 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+// CPUPoolIsolated is the value for Runtime.CPUPool that uses
+// the CPUs isolated from the scheduler by the `isolcpus` kernel parameter.
+const CPUPoolIsolated = "isolated"
+
+// cpuAllocationsFile records the CPU allocations
+// of all containers in the runtime root.
+const cpuAllocationsFile = ".cpu-allocations.json"
+
+// cpuAllocation is the CPU allocation of a container.
+type cpuAllocation struct {
+	// CPUs are the CPUs allocated exclusively by the container.
+	// Containers without exclusive CPUs are restricted
+	// to the shared CPUs (see sharedCPUs).
+	CPUs []int `json:",omitempty"`
+	// CgroupDir is the cgroup of a container without exclusive CPUs,
+	// whose cpuset is updated when CPUs are allocated or released.
+	CgroupDir string `json:",omitempty"`
+	// Requested are the CPUs requested by a container without exclusive CPUs
+	// (the spec cpuset or the cpuset set with Runtime.Update).
+	// The container may use all shared CPUs if Requested is empty.
+	Requested []int `json:",omitempty"`
+}
+
+// sharedCPUs returns the cpuset of a container without exclusive CPUs,
+// which is the intersection of the requested CPUs with the shared CPUs.
+func (a cpuAllocation) sharedCPUs(shared []int) []int {
+	if len(a.Requested) == 0 {
+		return shared
+	}
+	var cpus []int
+	for _, cpu := range a.Requested {
+		if containsInt(shared, cpu) {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+// restrict writes the cpuset of a container without exclusive CPUs
+// (see cpuAllocation.sharedCPUs). If none of the requested CPUs is shared,
+// the cpuset is not changed, because a cpuset can not be empty.
+func (a cpuAllocation) restrict(shared []int) error {
+	cpus := a.sharedCPUs(shared)
+	if len(cpus) == 0 {
+		return fmt.Errorf("none of the requested cpus %s is shared", formatCPUList(a.Requested))
+	}
+	return writeCgroupItem(a.CgroupDir, "cpuset.cpus", formatCPUList(cpus))
+}
+
+// cpuAllocations maps the container runtime directory to
+// the CPU allocation of the container.
+type cpuAllocations map[string]cpuAllocation
+
+// maxCPUs is the upper bound for CPU numbers (the maximum of the NR_CPUS kernel config).
+const maxCPUs = 8192
+
+// parseCPUList parses a cpu list as used by cpuset.cpus (e.g `0-3,8,10-11`).
+// The returned CPUs are sorted and unique.
+func parseCPUList(s string) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	seen := make(map[int]bool)
+	for _, r := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(r), "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 0 || first >= maxCPUs {
+			return nil, fmt.Errorf("invalid cpu list %q", s)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first || last >= maxCPUs {
+				return nil, fmt.Errorf("invalid cpu list %q", s)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			seen[cpu] = true
+		}
+	}
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// formatCPUList formats the sorted CPUs as cpu list (see parseCPUList).
+func formatCPUList(cpus []int) string {
+	var ranges []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(cpus[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// cpuAllocationsFile returns the path of the CPU allocations file.
+// The file is shared by all users of a multi-tenant runtime root.
+func (rt *Runtime) cpuAllocationsFile() string {
+	return filepath.Join(rt.Root, cpuAllocationsFile)
+}
+
+// cpuAllocationsPerm returns the permissions of the CPU allocations file.
+// The file has the permissions of the runtime root (without the execute bits),
+// so that it is accessible by the users that can access the runtime root.
+func (rt *Runtime) cpuAllocationsPerm() os.FileMode {
+	info, err := os.Stat(rt.Root)
+	if err != nil {
+		return 0600
+	}
+	return info.Mode().Perm() &^ 0111
+}
+
+// onlineCPUs returns the CPUs that are online.
+func onlineCPUs() ([]int, error) {
+	data, err := os.ReadFile("/sys/devices/system/cpu/online")
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUList(string(data))
+}
+
+// cpuPool returns the CPUs of Runtime.CPUPool.
+func (rt *Runtime) cpuPool() ([]int, error) {
+	if rt.CPUPool != CPUPoolIsolated {
+		return parseCPUList(rt.CPUPool)
+	}
+	data, err := os.ReadFile("/sys/devices/system/cpu/isolated")
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUList(string(data))
+}
+
+// allocateCPUs allocates the CPUs requested by the cpu list
+// or the number of CPUs exclusively for the container with the given runtime directory.
+// Either cpuList or count must be set.
+func allocateCPUs(allocs cpuAllocations, pool []int, runtimeDir string, cpuList string, count int) ([]int, error) {
+	used := make(map[int]string)
+	for dir, a := range allocs {
+		for _, cpu := range a.CPUs {
+			used[cpu] = dir
+		}
+	}
+
+	if cpuList != "" {
+		cpus, err := parseCPUList(cpuList)
+		if err != nil {
+			return nil, err
+		}
+		for _, cpu := range cpus {
+			if pool != nil && !containsInt(pool, cpu) {
+				return nil, fmt.Errorf("cpu %d is not in the cpu pool %s", cpu, formatCPUList(pool))
+			}
+			if dir, ok := used[cpu]; ok {
+				return nil, fmt.Errorf("cpu %d is already allocated by container %s", cpu, filepath.Base(dir))
+			}
+		}
+		allocs[runtimeDir] = cpuAllocation{CPUs: cpus}
+		return cpus, nil
+	}
+
+	if pool == nil {
+		return nil, fmt.Errorf("cpu pool is not configured")
+	}
+	var cpus []int
+	for _, cpu := range pool {
+		if _, ok := used[cpu]; !ok {
+			cpus = append(cpus, cpu)
+		}
+		if len(cpus) == count {
+			allocs[runtimeDir] = cpuAllocation{CPUs: cpus}
+			return cpus, nil
+		}
+	}
+	return nil, fmt.Errorf("only %d of %d requested cpus are available in the cpu pool", len(cpus), count)
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedCPUs returns the online CPUs that are not allocated exclusively.
+func sharedCPUs(allocs cpuAllocations, online []int) []int {
+	used := make(map[int]bool)
+	for _, a := range allocs {
+		for _, cpu := range a.CPUs {
+			used[cpu] = true
+		}
+	}
+	var cpus []int
+	for _, cpu := range online {
+		if !used[cpu] {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+// hasExclusiveCPUs returns true if any container has allocated CPUs exclusively.
+func hasExclusiveCPUs(allocs cpuAllocations) bool {
+	for _, a := range allocs {
+		if len(a.CPUs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictSharedCPUs restricts the cpuset of the containers without exclusive CPUs
+// to the given shared CPUs (see cpuAllocation.restrict).
+// Containers whose cgroup does not exist are skipped.
+// A container that is created concurrently is restricted when its cgroup
+// is created (see Runtime.configureSharedCPUs).
+func restrictSharedCPUs(allocs cpuAllocations, shared []int, log zerolog.Logger) {
+	for _, a := range allocs {
+		if len(a.CPUs) > 0 || a.CgroupDir == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(cgroupRoot, a.CgroupDir)); os.IsNotExist(err) {
+			continue
+		}
+		if err := a.restrict(shared); err != nil {
+			log.Warn().Str("cgroup", a.CgroupDir).Msgf("failed to restrict shared cpus: %s", err)
+		}
+	}
+}
+
+// updateCPUAllocations calls fn with the CPU allocations read from filename,
+// and writes back the allocations if fn returns without error.
+// The file is created with the given permissions if it does not exist.
+// The file is locked exclusively while fn runs. Allocations of containers,
+// whose runtime directory no longer exists, are removed.
+func updateCPUAllocations(filename string, perm os.FileMode, fn func(cpuAllocations) error) error {
+	f, err := openCPUAllocationsFile(filename, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", filename, err)
+	}
+
+	allocs := make(cpuAllocations)
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		if err := json.NewDecoder(f).Decode(&allocs); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", filename, err)
+		}
+	}
+	for dir := range allocs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			delete(allocs, dir)
+		}
+	}
+
+	if err := fn(allocs); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(allocs)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func openCPUAllocationsFile(filename string, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+	if os.IsExist(err) {
+		return os.OpenFile(filename, os.O_RDWR, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// chmod is required because umask is applied to the permissions.
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// configureCPUSet allocates the CPUs requested with AnnotationCPUSet
+// or AnnotationCPUSetCount exclusively for the container.
+// The allocated CPUs are removed from the cpuset of the containers
+// without exclusive CPUs (see Runtime.configureSharedCPUs).
+func configureCPUSet(rt *Runtime, c *Container) error {
+	if !hasExclusiveCPUsAnnotation(c) {
+		return nil
+	}
+	cpuList := c.Spec.Annotations[AnnotationCPUSet]
+	countVal := c.Spec.Annotations[AnnotationCPUSetCount]
+	if cpuList != "" && countVal != "" {
+		return fmt.Errorf("annotations %s and %s are mutually exclusive", AnnotationCPUSet, AnnotationCPUSetCount)
+	}
+	// Do not allocate CPUs that can not be assigned to the container.
+	if !c.hasCgroupController("cpuset") {
+		c.warnf("CgroupControllerUnavailable", "cgroup controller \"cpuset\" is not available - exclusive cpus are not allocated")
+		return nil
+	}
+	var count int
+	if countVal != "" {
+		n, err := strconv.Atoi(countVal)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid %s value %q", AnnotationCPUSetCount, countVal)
+		}
+		count = n
+	}
+
+	var pool []int
+	if rt.CPUPool != "" {
+		var err error
+		pool, err = rt.cpuPool()
+		if err != nil {
+			return fmt.Errorf("failed to load cpu pool: %w", err)
+		}
+	}
+
+	online, err := onlineCPUs()
+	if err != nil {
+		return fmt.Errorf("failed to load online cpus: %w", err)
+	}
+
+	var cpus []int
+	err = updateCPUAllocations(c.cpuAllocationsFile, rt.cpuAllocationsPerm(), func(allocs cpuAllocations) (err error) {
+		cpus, err = allocateCPUs(allocs, pool, c.runtimeDir, cpuList, count)
+		if err != nil {
+			return err
+		}
+		shared := sharedCPUs(allocs, online)
+		if len(shared) == 0 {
+			return fmt.Errorf("no cpus are left for containers without exclusive cpus")
+		}
+		restrictSharedCPUs(allocs, shared, c.Log)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to allocate cpus: %w", err)
+	}
+	c.Log.Info().Str("cpus", formatCPUList(cpus)).Msg("allocated cpus exclusively")
+	return c.setCgroupItem("cpuset.cpus", formatCPUList(cpus))
+}
+
+func hasExclusiveCPUsAnnotation(c *Container) bool {
+	return c.Spec.Annotations[AnnotationCPUSet] != "" || c.Spec.Annotations[AnnotationCPUSetCount] != ""
+}
+
+// configureSharedCPUs restricts a container without exclusive CPUs
+// to the requested CPUs (spec cpuset) that are not allocated exclusively by other containers.
+// The container is recorded in the CPU allocations file, so that its cpuset
+// is updated when CPUs are allocated or released by other containers.
+// Containers are only recorded if Runtime.CPUPool is set or the CPU allocations
+// file exists, so that containers are not serialized by the file lock
+// on hosts that never allocate CPUs exclusively.
+// It must be called after the container cgroup is created.
+func (rt *Runtime) configureSharedCPUs(c *Container) error {
+	if hasExclusiveCPUsAnnotation(c) || !c.hasCgroupController("cpuset") {
+		return nil
+	}
+	if _, err := os.Stat(c.cpuAllocationsFile); os.IsNotExist(err) && rt.CPUPool == "" {
+		return nil
+	}
+	var requested []int
+	if c.Spec.Linux != nil && c.Spec.Linux.Resources != nil && c.Spec.Linux.Resources.CPU != nil {
+		var err error
+		if requested, err = parseCPUList(c.Spec.Linux.Resources.CPU.Cpus); err != nil {
+			return err
+		}
+	}
+	online, err := onlineCPUs()
+	if err != nil {
+		return fmt.Errorf("failed to load online cpus: %w", err)
+	}
+	err = updateCPUAllocations(c.cpuAllocationsFile, rt.cpuAllocationsPerm(), func(allocs cpuAllocations) error {
+		a := cpuAllocation{CgroupDir: c.CgroupDir, Requested: requested}
+		allocs[c.runtimeDir] = a
+		if !hasExclusiveCPUs(allocs) {
+			return nil
+		}
+		if err := a.restrict(sharedCPUs(allocs, online)); err != nil {
+			c.warnf("CPUsNotRestricted", "cpuset is not restricted to the shared cpus: %s", err)
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrPermission) {
+		// Only the users with access to the runtime root can allocate CPUs.
+		c.Log.Debug().Msgf("cpus are not restricted: %s", err)
+		return nil
+	}
+	return err
+}
+
+// updateSharedCPUs sets the cpuset of the container to the given cpu list.
+// The cpuset of a container without exclusive CPUs is restricted
+// to the shared CPUs, and the cpu list is recorded as requested CPUs,
+// so that it is retained when CPUs are allocated or released by other containers.
+func updateSharedCPUs(c *Container, cpuList string) error {
+	requested, err := parseCPUList(cpuList)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(c.cpuAllocationsFile); os.IsNotExist(err) {
+		return c.writeCgroupFile("cpuset.cpus", cpuList)
+	}
+	online, err := onlineCPUs()
+	if err != nil {
+		return fmt.Errorf("failed to load online cpus: %w", err)
+	}
+	// The file exists, so the permissions are not used.
+	err = updateCPUAllocations(c.cpuAllocationsFile, 0600, func(allocs cpuAllocations) error {
+		a, ok := allocs[c.runtimeDir]
+		if !ok || len(a.CPUs) > 0 {
+			return c.writeCgroupFile("cpuset.cpus", cpuList)
+		}
+		a.Requested = requested
+		allocs[c.runtimeDir] = a
+		if !hasExclusiveCPUs(allocs) {
+			return c.writeCgroupFile("cpuset.cpus", cpuList)
+		}
+		return a.restrict(sharedCPUs(allocs, online))
+	})
+	if errors.Is(err, os.ErrPermission) {
+		return c.writeCgroupFile("cpuset.cpus", cpuList)
+	}
+	return err
+}
+
+// releaseCPUs releases the CPUs allocated by the container
+// with the given runtime directory. The released CPUs are added
+// to the cpuset of the containers without exclusive CPUs.
+func releaseCPUs(filename string, runtimeDir string, log zerolog.Logger) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	// The file exists, so the permissions are not used.
+	err := updateCPUAllocations(filename, 0600, func(allocs cpuAllocations) error {
+		a, ok := allocs[runtimeDir]
+		delete(allocs, runtimeDir)
+		if !ok || len(a.CPUs) == 0 {
+			return nil
+		}
+		online, err := onlineCPUs()
+		if err != nil {
+			log.Warn().Msgf("released cpus are not shared: failed to load online cpus: %s", err)
+			return nil
+		}
+		restrictSharedCPUs(allocs, sharedCPUs(allocs, online), log)
+		return nil
+	})
+	// The container can not have allocated CPUs without access to the file.
+	if errors.Is(err, os.ErrPermission) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := parseCPUList("0-3,8,10-11,2\n")
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2, 3, 8, 10, 11}, cpus)
+	require.Equal(t, "0-3,8,10-11", formatCPUList(cpus))
+
+	cpus, err = parseCPUList("")
+	require.NoError(t, err)
+	require.Empty(t, cpus)
+
+	for _, s := range []string{"a", "3-1", "-1", "1-", "0-100000000"} {
+		_, err = parseCPUList(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestAllocateCPUs(t *testing.T) {
+	pool := []int{2, 3, 4, 5}
+	allocs := cpuAllocations{}
+
+	cpus, err := allocateCPUs(allocs, pool, "/run/lxcri/a", "2-3", 0)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 3}, cpus)
+
+	// already allocated
+	_, err = allocateCPUs(allocs, pool, "/run/lxcri/b", "3", 0)
+	require.Error(t, err)
+	// not in pool
+	_, err = allocateCPUs(allocs, pool, "/run/lxcri/b", "6", 0)
+	require.Error(t, err)
+	// not enough cpus available
+	_, err = allocateCPUs(allocs, pool, "/run/lxcri/b", "", 3)
+	require.Error(t, err)
+
+	cpus, err = allocateCPUs(allocs, pool, "/run/lxcri/b", "", 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 5}, cpus)
+
+	// no pool
+	_, err = allocateCPUs(allocs, nil, "/run/lxcri/c", "", 1)
+	require.Error(t, err)
+}
+
+func TestUpdateCPUAllocations(t *testing.T) {
+	dir, err := os.MkdirTemp("", "lxcri-test-cpuset")
+	require.NoError(t, err)
+	defer removeAll(t, dir)
+
+	filename := filepath.Join(dir, cpuAllocationsFile)
+	err = updateCPUAllocations(filename, 0666, func(allocs cpuAllocations) error {
+		allocs[dir] = cpuAllocation{CPUs: []int{1, 2}}
+		allocs[filepath.Join(dir, "deleted")] = cpuAllocation{CPUs: []int{3}}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the permissions are not restricted by the umask
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0666), info.Mode().Perm())
+
+	err = updateCPUAllocations(filename, 0600, func(allocs cpuAllocations) error {
+		// allocations of containers without runtime directory are removed
+		require.Equal(t, cpuAllocations{dir: {CPUs: []int{1, 2}}}, allocs)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, releaseCPUs(filename, dir, zerolog.Nop()))
+	err = updateCPUAllocations(filename, 0600, func(allocs cpuAllocations) error {
+		require.Empty(t, allocs)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestSharedCPUs(t *testing.T) {
+	allocs := cpuAllocations{
+		"/run/lxcri/a": {CPUs: []int{2, 3}},
+		"/run/lxcri/b": {CgroupDir: "lxcri/b"},
+		"/run/lxcri/c": {CgroupDir: "lxcri/c"},
+		"/run/lxcri/d": {CgroupDir: "lxcri/d", Requested: []int{1, 2}},
+		"/run/lxcri/e": {CgroupDir: "lxcri/e", Requested: []int{3}},
+	}
+	shared := sharedCPUs(allocs, []int{0, 1, 2, 3, 4})
+	require.Equal(t, []int{0, 1, 4}, shared)
+	require.True(t, hasExclusiveCPUs(allocs))
+
+	prevRoot := cgroupRoot
+	cgroupRoot = t.TempDir()
+	defer func() { cgroupRoot = prevRoot }()
+
+	// The cgroup of container c does not exist.
+	cpuset := func(name string) string {
+		return filepath.Join(cgroupRoot, "lxcri", name, "cpuset.cpus")
+	}
+	for _, name := range []string{"b", "d", "e"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(cpuset(name)), 0755))
+		require.NoError(t, os.WriteFile(cpuset(name), []byte("3"), 0644))
+	}
+
+	restrictSharedCPUs(allocs, shared, zerolog.Nop())
+	data, err := os.ReadFile(cpuset("b"))
+	require.NoError(t, err)
+	require.Equal(t, "0-1,4", string(data))
+
+	// The requested cpuset is intersected with the shared cpus.
+	data, err = os.ReadFile(cpuset("d"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(data))
+
+	// None of the requested cpus is shared.
+	data, err = os.ReadFile(cpuset("e"))
+	require.NoError(t, err)
+	require.Equal(t, "3", string(data))
+}
@@ -2,11 +2,14 @@ package lxcri
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/lxc/go-lxc"
 	"github.com/lxc/lxcri/pkg/specki"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -16,34 +19,89 @@ import (
 // Create is the first runtime method to call within the lifecycle of a container.
 // A created Container must be released with Container.Release after use.
 // You should call Runtime.Delete to cleanup container runtime state, even
-// if the Create returned with an error.
+// if the Create returned with an error. Create returns a nil Container
+// if the runtime directory was not created, e.g if the container already
+// exists (ErrExist). The runtime directory must not be deleted then.
+// Configuration decisions that deviate from the container spec are
+// returned in Container.Warnings.
 func (rt *Runtime) Create(ctx context.Context, cfg *ContainerConfig) (*Container, error) {
+	created := time.Now()
 	if err := rt.checkConfig(cfg); err != nil {
 		return nil, err
 	}
+	// Must be recorded before the config is modified.
+	createCfg, err := encodeCreateConfig(cfg)
+	if err != nil {
+		return nil, errorf("failed to encode container config: %w", err)
+	}
+	restart, err := newRestartState(cfg)
+	if err != nil {
+		return nil, errorf("failed to encode restart config: %w", err)
+	}
+	if cfg.SandboxID != "" {
+		if err := rt.joinSandbox(cfg); err != nil {
+			return nil, errorf("failed to join sandbox: %w", err)
+		}
+	}
 
-	c := &Container{ContainerConfig: cfg}
-	c.runtimeDir = filepath.Join(rt.Root, c.ContainerID)
+	c := &Container{ContainerConfig: cfg, SchemaVersion: SchemaVersion}
+	c.runtimeDir = filepath.Join(rt.containersDir(), c.ContainerID)
+	c.backoff = rt.Backoff
+	c.cpuAllocationsFile = rt.cpuAllocationsFile()
+	c.events = rt.events
+	c.hooks = &rt.LifecycleHooks
 
 	if cfg.Spec.Annotations == nil {
 		cfg.Spec.Annotations = make(map[string]string)
 	}
 	cfg.Spec.Annotations["org.linuxcontainers.lxc.ConfigFile"] = c.RuntimePath("config")
 
-	if err := c.create(); err != nil {
+	perm, err := runtimeDirPermissions(rt.RuntimeDirPermissions, cfg.Spec, os.Getuid())
+	if err != nil {
+		return nil, errorf("failed to create container: %w", err)
+	}
+	c.Log.Debug().Msgf("runtime dir permissions %s owner %d:%d", perm.Mode, perm.UID, perm.GID)
+
+	// Concurrent invocations for the container wait until it is created.
+	lock, err := c.create(ctx, perm)
+	if err != nil {
+		return nil, errorf("failed to create container: %w", err)
+	}
+	defer lock.Unlock()
+
+	c.linuxContainer, err = lxc.NewContainer(c.ContainerID, filepath.Dir(c.runtimeDir))
+	if err != nil {
+		return c, errorf("failed to create container: %w", err)
+	}
+	c.Log.Debug().Msgf("create new container Container:%p linuxContainer:%p", c, c.linuxContainer)
+
+	if err := specki.EncodeJSONFile(c.RuntimePath(createConfigFile), createCfg, os.O_EXCL|os.O_CREATE, 0640); err != nil {
 		return c, errorf("failed to create container: %w", err)
 	}
+	if restart != nil {
+		if err := specki.EncodeJSONFile(c.RuntimePath(restartFile), restart, os.O_EXCL|os.O_CREATE, 0640); err != nil {
+			return c, errorf("failed to create container: %w", err)
+		}
+	}
+
+	rt.applyDefaults(c)
+
+	if err := c.hooks.run(ctx, HookCreate, c); err != nil {
+		return c, errorf("%w", err)
+	}
 
+	configured := time.Now()
 	if err := configureContainer(rt, c); err != nil {
 		return c, errorf("failed to configure container: %w", err)
 	}
+	c.Log.Debug().Int("items", c.configItems).Int("warnings", len(c.Warnings)).Msg("configured container")
 
 	cleanenv(c, true)
 
 	// Seralize the modified spec.Spec separately, to make it available for
 	// runtime hooks.
 	specPath := c.RuntimePath(BundleConfigFile)
-	err := specki.EncodeJSONFile(specPath, cfg.Spec, os.O_EXCL|os.O_CREATE, 0444)
+	err = specki.EncodeJSONFile(specPath, cfg.Spec, os.O_EXCL|os.O_CREATE, 0444)
 	if err != nil {
 		return c, err
 	}
@@ -61,17 +119,61 @@ func (rt *Runtime) Create(ctx context.Context, cfg *ContainerConfig) (*Container
 		return c, err
 	}
 
+	c.timings.ConfigGeneration = time.Since(configured)
+
 	if err := rt.runStartCmd(ctx, c); err != nil {
+		if herr := c.hookError(); herr != nil {
+			return c, errorf("failed to run container process: %w: %s", err, herr)
+		}
 		return c, errorf("failed to run container process: %w", err)
 	}
+	if n := c.failedBestEffortHooks(); n > 0 {
+		c.warnf("HookFailed", "%d best-effort hooks failed", n)
+	}
+	c.timings.Create = time.Since(created)
+	c.recordTimings()
 	return c, nil
 }
 
+// createConfigFile is the file in the container runtime directory that records
+// the ContainerConfig as passed to Runtime.Create, before it is modified by the runtime.
+const createConfigFile = "create.json"
+
+// encodeCreateConfig encodes the container config for the createConfigFile.
+// A container created from the encoded config is created from scratch.
+func encodeCreateConfig(cfg *ContainerConfig) (json.RawMessage, error) {
+	createCfg := *cfg
+	createCfg.RestoreImageDir = ""
+	createCfg.RestorePageServer = ""
+	return json.Marshal(&createCfg)
+}
+
+// CreateConfig returns the container config as passed to Runtime.Create,
+// without the modifications applied by the runtime (e.g the runtime mounts).
+// A new container can be created from the returned config.
+// The data of secrets is never persisted, so only secrets with a Source
+// are usable in the returned config.
+func (c *Container) CreateConfig() (*ContainerConfig, error) {
+	cfg := new(ContainerConfig)
+	if err := specki.DecodeJSONFile(c.RuntimePath(createConfigFile), cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 func configureContainer(rt *Runtime, c *Container) error {
 	if err := c.SetLog(c.LogFile, c.LogLevel); err != nil {
 		return errorf("failed to configure container log (file:%s level:%s): %w", c.LogFile, c.LogLevel, err)
 	}
 
+	// Must be evaluated before the runtime adds mounts to the spec.
+	pause := rt.PauseFastPath && rt.isPauseContainer(c.Spec)
+	if pause {
+		c.Log.Info().Msg("using pause container fast path")
+		c.Spec.Annotations[AnnotationPause] = "true"
+		c.Spec.Linux.Devices = nil
+	}
+
 	if err := configureHostname(rt, c); err != nil {
 		return err
 	}
@@ -95,13 +197,13 @@ func configureContainer(rt *Runtime, c *Container) error {
 		namesp := c.Spec.Linux.Namespaces
 		for i, n := range namesp {
 			if n.Type == specs.UserNamespace {
-				rt.Log.Warn().Msg("Preconfigured user namespace is removed from the namespace list.")
+				c.warnf("UserNamespaceRemoved", "preconfigured user namespace is removed from the namespace list")
 				c.Spec.Linux.Namespaces = append(namesp[0:i], namesp[i+1:]...)
 			}
 		}
 	} else if os.Getuid() != 0 {
 		if !isNamespaceEnabled(c.Spec, specs.UserNamespace) {
-			rt.Log.Warn().Msg("unprivileged runtime - enabling user namespace")
+			c.warnf("UserNamespaceAdded", "unprivileged runtime - enabling user namespace")
 			c.Spec.Linux.Namespaces = append(c.Spec.Linux.Namespaces,
 				specs.LinuxNamespace{Type: specs.UserNamespace},
 			)
@@ -129,11 +231,17 @@ func configureContainer(rt *Runtime, c *Container) error {
 			return fmt.Errorf("failed to configure apparmor: %w", err)
 		}
 	} else {
-		rt.Log.Warn().Msg("apparmor feature is disabled - profile is set to unconfined")
+		c.warnf("ApparmorDisabled", "apparmor feature is disabled - profile is set to unconfined")
 	}
 
-	if rt.Features.Seccomp {
+	if rt.Features.Seccomp && !pause {
+		if err := configureDefaultSeccomp(rt, c); err != nil {
+			return fmt.Errorf("failed to configure default seccomp profile: %w", err)
+		}
 		if c.Spec.Linux.Seccomp != nil && len(c.Spec.Linux.Seccomp.Syscalls) > 0 {
+			if hasSeccompAction(c.Spec.Linux.Seccomp, actKillProcess) {
+				c.warnf("SeccompKillProcess", "liblxc does not support %s - the calling thread is killed instead of the process", actKillProcess)
+			}
 			profilePath := c.RuntimePath("seccomp.conf")
 			if err := writeSeccompProfile(profilePath, c.Spec.Linux.Seccomp); err != nil {
 				return err
@@ -141,9 +249,12 @@ func configureContainer(rt *Runtime, c *Container) error {
 			if err := c.setConfigItem("lxc.seccomp.profile", profilePath); err != nil {
 				return err
 			}
+			if err := configureSeccompNotify(c); err != nil {
+				return fmt.Errorf("failed to configure seccomp notify: %w", err)
+			}
 		}
-	} else {
-		rt.Log.Warn().Msg("seccomp feature is disabled - all system calls are allowed")
+	} else if !pause {
+		c.warnf("SeccompDisabled", "seccomp feature is disabled - all system calls are allowed")
 	}
 
 	if rt.Features.Capabilities {
@@ -151,7 +262,7 @@ func configureContainer(rt *Runtime, c *Container) error {
 			return fmt.Errorf("failed to configure capabilities: %w", err)
 		}
 	} else {
-		rt.Log.Warn().Msg("capabilities feature is disabled - container inherits privileges of the runtime process")
+		c.warnf("CapabilitiesDisabled", "capabilities feature is disabled - container inherits privileges of the runtime process")
 	}
 
 	// make sure autodev is disabled
@@ -180,7 +291,9 @@ func configureContainer(rt *Runtime, c *Container) error {
 						Options: m.Options,
 					},
 				)
-				rt.Log.Info().Msg("device files are bind mounted")
+				if len(c.Spec.Linux.Devices) > 0 {
+					c.warnf("DevicesBindMounted", "runtime can not create device files - %d devices are bind mounted from the host", len(c.Spec.Linux.Devices))
+				}
 				for _, device := range c.Spec.Linux.Devices {
 					newMounts = append(newMounts,
 						specs.Mount{
@@ -198,18 +311,31 @@ func configureContainer(rt *Runtime, c *Container) error {
 		c.Spec.Linux.Devices = nil
 	}
 
-	if err := configureHooks(rt, c); err != nil {
-		return err
+	// A pause container has no hooks (see isPauseContainer).
+	if !pause {
+		if err := configureHooks(rt, c); err != nil {
+			return err
+		}
 	}
 
 	if err := configureCgroup(rt, c); err != nil {
 		return fmt.Errorf("failed to configure cgroups: %w", err)
 	}
 
-	for key, val := range c.Spec.Linux.Sysctl {
-		if err := c.setConfigItem("lxc.sysctl."+key, val); err != nil {
-			return err
-		}
+	if err := configureCPUSet(rt, c); err != nil {
+		return err
+	}
+
+	if err := configureCoreScheduling(c); err != nil {
+		return err
+	}
+
+	if err := configureSysctls(c); err != nil {
+		return fmt.Errorf("failed to configure sysctls: %w", err)
+	}
+
+	if err := configureMemoryLock(c); err != nil {
+		return fmt.Errorf("failed to configure memory locking: %w", err)
 	}
 
 	// `man lxc.container.conf`: "A resource with no explicitly configured limitation will be inherited
@@ -229,6 +355,50 @@ func configureContainer(rt *Runtime, c *Container) error {
 		}
 	}
 
+	if err := configureProcMount(c); err != nil {
+		return fmt.Errorf("failed to configure proc mount: %w", err)
+	}
+
+	if err := configureHugepageMounts(c); err != nil {
+		return fmt.Errorf("failed to configure hugepage mounts: %w", err)
+	}
+
+	if err := configureLocaltime(rt, c); err != nil {
+		return fmt.Errorf("failed to configure localtime: %w", err)
+	}
+
+	if err := configureDNS(rt, c); err != nil {
+		return fmt.Errorf("failed to configure DNS: %w", err)
+	}
+
+	if err := configureHosts(rt, c); err != nil {
+		return fmt.Errorf("failed to configure hosts: %w", err)
+	}
+
+	if err := configureLXCFS(rt, c); err != nil {
+		return fmt.Errorf("failed to configure lxcfs: %w", err)
+	}
+
+	if err := configureMaxRuntime(c); err != nil {
+		return fmt.Errorf("failed to configure maximum runtime: %w", err)
+	}
+
+	if err := configureNetworkReadiness(c); err != nil {
+		return fmt.Errorf("failed to configure network readiness: %w", err)
+	}
+
+	if err := configureHealthCheck(c); err != nil {
+		return fmt.Errorf("failed to configure health check: %w", err)
+	}
+
+	if err := configureSecrets(rt, c); err != nil {
+		return fmt.Errorf("failed to configure secrets: %w", err)
+	}
+
+	if err := configureDevpts(c); err != nil {
+		return fmt.Errorf("failed to configure devpts: %w", err)
+	}
+
 	if err := configureMounts(rt, c); err != nil {
 		return fmt.Errorf("failed to configure mounts: %w", err)
 	}
@@ -292,6 +462,19 @@ func configureRootfs(rt *Runtime, c *Container) error {
 		return err
 	}
 
+	// liblxc has no option to disable pivot_root, but it enters the rootfs
+	// with chroot if the host root filesystem is an initramfs (see isRootfsRamfs).
+	// The container is not created if the request can not be honored.
+	if c.NoPivot {
+		isRamfs, err := isRootfsRamfs()
+		if err != nil {
+			return fmt.Errorf("failed to detect host root filesystem: %w", err)
+		}
+		if !isRamfs {
+			return fmt.Errorf("no-pivot is only supported if the host root filesystem is an initramfs - liblxc uses pivot_root otherwise")
+		}
+	}
+
 	// Resources not created by the container runtime MUST NOT be deleted by it.
 	if err := c.setConfigItem("lxc.ephemeral", "0"); err != nil {
 		return err
@@ -382,6 +565,15 @@ func configureHooks(rt *Runtime, c *Container) error {
 
 	c.Spec.Hooks = &hooks
 
+	// The annotations are passed to lxcri-hook and lxcri-init through the spec.
+	if len(rt.BestEffortHooks) > 0 {
+		paths := rt.BestEffortHooks
+		if v := c.Spec.Annotations[AnnotationBestEffortHooks]; v != "" {
+			paths = append(strings.Split(v, ","), paths...)
+		}
+		c.Spec.Annotations[AnnotationBestEffortHooks] = strings.Join(paths, ",")
+	}
+
 	// pass context information as environment variables to hook scripts
 	if err := c.setConfigItem("lxc.hook.version", "1"); err != nil {
 		return err
@@ -420,7 +612,7 @@ func cleanenv(c *Container, overwrite bool) {
 		newEnv, exist = specki.Setenv(newEnv, kv, overwrite)
 		if exist {
 			vals := strings.Split(kv, "=")
-			c.Log.Warn().Msgf("duplicate environment variable %s (overwrite=%t)", vals[0], overwrite)
+			c.warnf("DuplicateEnv", "duplicate environment variable %s (overwrite=%t)", vals[0], overwrite)
 		}
 	}
 	c.Spec.Process.Env = newEnv
@@ -0,0 +1,62 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// AnnotationMaxRuntime is the maximum runtime of the container
+// in the format accepted by time.ParseDuration e.g `1h30m`.
+// See ContainerConfig.MaxRuntime.
+const AnnotationMaxRuntime = "lxcri.max-runtime"
+
+// ExitReasonDeadlineExceeded is the ExitStatus.Reason of a container
+// that was stopped because ContainerConfig.MaxRuntime was exceeded.
+const ExitReasonDeadlineExceeded = "deadline exceeded"
+
+// deadlineFile is created in the container runtime directory
+// by the monitor process (lxcri-start) when the maximum runtime is exceeded.
+const deadlineFile = "deadline-exceeded"
+
+// configureMaxRuntime merges AnnotationMaxRuntime into ContainerConfig.MaxRuntime.
+// The shorter maximum runtime takes precedence.
+func configureMaxRuntime(c *Container) error {
+	if val, ok := c.Spec.Annotations[AnnotationMaxRuntime]; ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for annotation %s: %w", AnnotationMaxRuntime, err)
+		}
+		if c.MaxRuntime == 0 || d < c.MaxRuntime {
+			c.MaxRuntime = d
+		}
+	}
+	if c.MaxRuntime < 0 {
+		return fmt.Errorf("invalid maximum runtime %s", c.MaxRuntime)
+	}
+	if c.MaxRuntime > 0 && c.RestoreImageDir != "" {
+		c.warnf("MaxRuntimeIgnored", "maximum runtime is not enforced for restored containers")
+	}
+	return nil
+}
+
+// maxRuntimeEnv returns the environment variables for the monitor process,
+// that enforces the maximum runtime. The runtime is rounded up to full seconds.
+// The grace period between SIGTERM and SIGKILL is the KillTimeout.
+func (rt *Runtime) maxRuntimeEnv(c *Container) []string {
+	if c.MaxRuntime <= 0 || c.RestoreImageDir != "" {
+		return nil
+	}
+	seconds := int64((c.MaxRuntime + time.Second - 1) / time.Second)
+	return []string{
+		fmt.Sprintf("LXCRI_MAX_RUNTIME=%d", seconds),
+		fmt.Sprintf("LXCRI_MAX_RUNTIME_GRACE=%d", rt.Timeouts.KillTimeout),
+	}
+}
+
+// deadlineExceeded returns true if the monitor process stopped
+// the container because the maximum runtime was exceeded.
+func (c *Container) deadlineExceeded() bool {
+	_, err := os.Stat(c.RuntimePath(deadlineFile))
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package lxcri
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureMaxRuntime(t *testing.T) {
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: spec, MaxRuntime: time.Hour}}
+	require.NoError(t, configureMaxRuntime(c))
+	require.Equal(t, time.Hour, c.MaxRuntime)
+
+	// the shorter runtime takes precedence
+	spec.Annotations = map[string]string{AnnotationMaxRuntime: "90m"}
+	require.NoError(t, configureMaxRuntime(c))
+	require.Equal(t, time.Hour, c.MaxRuntime)
+	spec.Annotations[AnnotationMaxRuntime] = "10m"
+	require.NoError(t, configureMaxRuntime(c))
+	require.Equal(t, 10*time.Minute, c.MaxRuntime)
+
+	spec.Annotations[AnnotationMaxRuntime] = "-1s"
+	require.Error(t, configureMaxRuntime(c))
+	spec.Annotations[AnnotationMaxRuntime] = "1d"
+	require.Error(t, configureMaxRuntime(c))
+}
+
+func TestMaxRuntimeEnv(t *testing.T) {
+	rt := &Runtime{Timeouts: Timeouts{KillTimeout: 5}}
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	require.Nil(t, rt.maxRuntimeEnv(c))
+
+	c.MaxRuntime = 1500 * time.Millisecond
+	require.Equal(t, []string{"LXCRI_MAX_RUNTIME=2", "LXCRI_MAX_RUNTIME_GRACE=5"}, rt.maxRuntimeEnv(c))
+
+	c.RestoreImageDir = "/tmp/checkpoint"
+	require.Nil(t, rt.maxRuntimeEnv(c))
+}
+
+func TestExitStatusDeadlineExceeded(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{}, runtimeDir: t.TempDir()}
+	require.NoError(t, os.WriteFile(c.RuntimePath(exitStatusFile), []byte("15\n"), 0440))
+	status, err := c.ExitStatus()
+	require.NoError(t, err)
+	require.Empty(t, status.Reason)
+
+	require.NoError(t, os.WriteFile(c.RuntimePath(deadlineFile), nil, 0440))
+	status, err = c.ExitStatus()
+	require.NoError(t, err)
+	require.Equal(t, "SIGTERM", status.Signal)
+	require.Equal(t, ExitReasonDeadlineExceeded, status.Reason)
+}
@@ -0,0 +1,51 @@
+package lxcri
+
+import (
+	"path/filepath"
+
+	"github.com/lxc/lxcri/pkg/specki"
+)
+
+// applyDefaults merges the runtime defaults (Runtime.DefaultMounts, Runtime.DefaultEnv
+// and Runtime.DefaultSysctls) into the container spec.
+// The container spec takes precedence: A default is only added if the spec
+// has no mount with the same destination, no variable with the same name,
+// or no sysctl with the same key.
+func (rt *Runtime) applyDefaults(c *Container) {
+	for _, m := range rt.DefaultMounts {
+		if hasMountDestination(c.Spec, filepath.Clean(m.Destination)) {
+			c.Log.Debug().Str("dst", m.Destination).Msg("default mount overridden by spec")
+			continue
+		}
+		m.Options = append([]string{}, m.Options...)
+		c.Spec.Mounts = append(c.Spec.Mounts, m)
+	}
+
+	for _, kv := range rt.DefaultEnv {
+		c.Spec.Process.Env, _ = specki.Setenv(c.Spec.Process.Env, kv, false)
+	}
+
+	if len(rt.DefaultSysctls) == 0 {
+		return
+	}
+	specSysctls := make(map[string]bool, len(c.Spec.Linux.Sysctl))
+	for key := range c.Spec.Linux.Sysctl {
+		specSysctls[normalizeSysctl(key)] = true
+	}
+	for key, val := range rt.DefaultSysctls {
+		key = normalizeSysctl(key)
+		if specSysctls[key] {
+			continue
+		}
+		// A default must not fail the container create, e.g if the container
+		// shares the network namespace with the host.
+		if err := checkSysctl(c.Spec, key); err != nil {
+			c.warnf("DefaultSysctlIgnored", "default sysctl is ignored: %s", err)
+			continue
+		}
+		if c.Spec.Linux.Sysctl == nil {
+			c.Spec.Linux.Sysctl = make(map[string]string)
+		}
+		c.Spec.Linux.Sysctl[key] = val
+	}
+}
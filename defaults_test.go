@@ -0,0 +1,49 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	r := &Runtime{
+		DefaultMounts: []specs.Mount{
+			specki.BindMount("/etc/ssl/certs/ca-bundle.crt", "/etc/ssl/certs/ca-bundle.crt", "ro"),
+			specki.BindMount("/srv/default", "/data"),
+		},
+		DefaultEnv:     []string{"HTTP_PROXY=http://proxy:3128", "PATH=/default"},
+		DefaultSysctls: map[string]string{"net.core.somaxconn": "1024", "net/ipv4/ip_forward": "1", "kernel.shmmax": "1"},
+	}
+
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	spec.Process.Env = []string{"PATH=/bin"}
+	spec.Mounts = append(spec.Mounts, specki.BindMount("/srv/data", "/data/"))
+	spec.Linux.Sysctl = map[string]string{"net/core/somaxconn": "4096"}
+	spec.Linux.Namespaces = []specs.LinuxNamespace{{Type: specs.NetworkNamespace}}
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: spec}}
+
+	r.applyDefaults(c)
+
+	require.True(t, hasMountDestination(spec, "/etc/ssl/certs/ca-bundle.crt"))
+	n := 0
+	for _, m := range spec.Mounts {
+		if m.Destination == "/data" || m.Destination == "/data/" {
+			n++
+			require.Equal(t, "/srv/data", m.Source)
+		}
+	}
+	require.Equal(t, 1, n)
+
+	require.Equal(t, []string{"PATH=/bin", "HTTP_PROXY=http://proxy:3128"}, spec.Process.Env)
+
+	require.Equal(t, map[string]string{
+		"net/core/somaxconn":  "4096",
+		"net.ipv4.ip_forward": "1",
+	}, spec.Linux.Sysctl)
+	// kernel.shmmax requires a private IPC namespace
+	require.Len(t, c.Warnings, 1)
+	require.Equal(t, "DefaultSysctlIgnored", c.Warnings[0].Reason)
+}
@@ -0,0 +1,314 @@
+package lxcri
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// bpfInsn is an eBPF instruction (struct bpf_insn).
+// The lower 4 bits of regs are the destination register,
+// the upper 4 bits the source register.
+type bpfInsn struct {
+	code uint8
+	regs uint8
+	off  int16
+	imm  int32
+}
+
+// Registers used by the device filter program.
+// On entry r1 points to the struct bpf_cgroup_dev_ctx.
+const (
+	bpfR0 = iota // return value
+	bpfR1        // context and scratch register
+	bpfR2        // device type
+	bpfR3        // requested access
+	bpfR4        // major
+	bpfR5        // minor
+)
+
+func bpfLoadWord(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{code: unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W, regs: dst | src<<4, off: off}
+}
+
+func bpfALUImm(op, dst uint8, imm int32) bpfInsn {
+	return bpfInsn{code: unix.BPF_ALU | op | unix.BPF_K, regs: dst, imm: imm}
+}
+
+func bpfMovReg(dst, src uint8) bpfInsn {
+	return bpfInsn{code: unix.BPF_ALU | unix.BPF_MOV | unix.BPF_X, regs: dst | src<<4}
+}
+
+func bpfJumpNotEqualImm(dst uint8, imm int32, off int16) bpfInsn {
+	return bpfInsn{code: unix.BPF_JMP | unix.BPF_JNE | unix.BPF_K, regs: dst, off: off, imm: imm}
+}
+
+func bpfJumpNotEqualReg(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{code: unix.BPF_JMP | unix.BPF_JNE | unix.BPF_X, regs: dst | src<<4, off: off}
+}
+
+func bpfReturn(val int32) []bpfInsn {
+	return []bpfInsn{
+		{code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K, regs: bpfR0, imm: val},
+		{code: unix.BPF_JMP | unix.BPF_EXIT},
+	}
+}
+
+// deviceAccess converts the cgroup device access (e.g `rwm`) to the
+// BPF_DEVCG_ACC_* flags. An empty access permits everything.
+func deviceAccess(access string) (int32, error) {
+	if access == "" {
+		access = "rwm"
+	}
+	var flags int32
+	for _, a := range access {
+		switch a {
+		case 'r':
+			flags |= unix.BPF_DEVCG_ACC_READ
+		case 'w':
+			flags |= unix.BPF_DEVCG_ACC_WRITE
+		case 'm':
+			flags |= unix.BPF_DEVCG_ACC_MKNOD
+		default:
+			return 0, fmt.Errorf("invalid device access %q", access)
+		}
+	}
+	return flags, nil
+}
+
+// deviceFilterRule returns the instructions for a single device cgroup rule.
+// The program returns the rule verdict if the device matches the rule,
+// otherwise it jumps to the next rule. The boolean return value is true
+// if the rule matches any device.
+func deviceFilterRule(dev specs.LinuxDeviceCgroup) ([]bpfInsn, bool, error) {
+	var conds [][]bpfInsn
+
+	switch dev.Type {
+	case "", "a":
+	case "b":
+		conds = append(conds, []bpfInsn{bpfJumpNotEqualImm(bpfR2, unix.BPF_DEVCG_DEV_BLOCK, 0)})
+	case "c":
+		conds = append(conds, []bpfInsn{bpfJumpNotEqualImm(bpfR2, unix.BPF_DEVCG_DEV_CHAR, 0)})
+	default:
+		return nil, false, fmt.Errorf("invalid cgroup2 device - invalid type (allow:%t %s %s)", dev.Allow, dev.Type, dev.Access)
+	}
+
+	access, err := deviceAccess(dev.Access)
+	if err != nil {
+		return nil, false, err
+	}
+	allAccess := int32(unix.BPF_DEVCG_ACC_READ | unix.BPF_DEVCG_ACC_WRITE | unix.BPF_DEVCG_ACC_MKNOD)
+	if access != allAccess {
+		// The requested access must be a subset of the rule access.
+		conds = append(conds, []bpfInsn{
+			bpfMovReg(bpfR1, bpfR3),
+			bpfALUImm(unix.BPF_AND, bpfR1, access),
+			bpfJumpNotEqualReg(bpfR1, bpfR3, 0),
+		})
+	}
+	// A negative major or minor number is a wildcard.
+	if dev.Major != nil && *dev.Major >= 0 {
+		conds = append(conds, []bpfInsn{bpfJumpNotEqualImm(bpfR4, int32(*dev.Major), 0)})
+	}
+	if dev.Minor != nil && *dev.Minor >= 0 {
+		conds = append(conds, []bpfInsn{bpfJumpNotEqualImm(bpfR5, int32(*dev.Minor), 0)})
+	}
+
+	verdict := int32(0)
+	if dev.Allow {
+		verdict = 1
+	}
+
+	var insns []bpfInsn
+	for _, cond := range conds {
+		insns = append(insns, cond...)
+	}
+	insns = append(insns, bpfReturn(verdict)...)
+	// Conditional jumps are always the last instruction of a condition
+	// and skip to the first instruction after the block.
+	for i := range insns {
+		if insns[i].code&0x07 == unix.BPF_JMP && insns[i].code&0xf0 == unix.BPF_JNE {
+			insns[i].off = int16(len(insns) - i - 1)
+		}
+	}
+	return insns, len(conds) == 0, nil
+}
+
+func int64p(v int64) *int64 {
+	return &v
+}
+
+// defaultDeviceRules are the device cgroup rules that are always allowed,
+// like the default devices of the runtime spec and the runc default rules.
+// Creating device nodes is permitted, access to the nodes is still filtered.
+var defaultDeviceRules = []specs.LinuxDeviceCgroup{
+	{Allow: true, Type: "c", Access: "m"},
+	{Allow: true, Type: "b", Access: "m"},
+	{Allow: true, Type: "c", Major: int64p(1), Minor: int64p(3), Access: "rwm"}, // null
+	{Allow: true, Type: "c", Major: int64p(1), Minor: int64p(5), Access: "rwm"}, // zero
+	{Allow: true, Type: "c", Major: int64p(1), Minor: int64p(7), Access: "rwm"}, // full
+	{Allow: true, Type: "c", Major: int64p(1), Minor: int64p(8), Access: "rwm"}, // random
+	{Allow: true, Type: "c", Major: int64p(1), Minor: int64p(9), Access: "rwm"}, // urandom
+	{Allow: true, Type: "c", Major: int64p(5), Minor: int64p(0), Access: "rwm"}, // tty
+	{Allow: true, Type: "c", Major: int64p(5), Minor: int64p(1), Access: "rwm"}, // console
+	{Allow: true, Type: "c", Major: int64p(5), Minor: int64p(2), Access: "rwm"}, // ptmx
+	{Allow: true, Type: "c", Major: int64p(136), Access: "rwm"},                 // /dev/pts/{n}
+}
+
+// deviceFilterRules returns the container device cgroup rules followed by
+// the defaultDeviceRules, so that the default devices can not be denied.
+func deviceFilterRules(devices []specs.LinuxDeviceCgroup) []specs.LinuxDeviceCgroup {
+	rules := make([]specs.LinuxDeviceCgroup, 0, len(devices)+len(defaultDeviceRules))
+	rules = append(rules, devices...)
+	return append(rules, defaultDeviceRules...)
+}
+
+// deviceFilter returns the eBPF program (BPF_PROG_TYPE_CGROUP_DEVICE) for the device cgroup rules.
+// Like the cgroup1 device controller the last matching rule wins,
+// so the rules are evaluated in reverse order. Access to devices that match no rule is denied.
+func deviceFilter(devices []specs.LinuxDeviceCgroup) ([]bpfInsn, error) {
+	// struct bpf_cgroup_dev_ctx { u32 access_type; u32 major; u32 minor; }
+	// access_type is (access << 16) | type
+	insns := []bpfInsn{
+		bpfLoadWord(bpfR2, bpfR1, 0),
+		bpfALUImm(unix.BPF_AND, bpfR2, 0xffff),
+		bpfLoadWord(bpfR3, bpfR1, 0),
+		bpfALUImm(unix.BPF_RSH, bpfR3, 16),
+		bpfLoadWord(bpfR4, bpfR1, 4),
+		bpfLoadWord(bpfR5, bpfR1, 8),
+	}
+	for i := len(devices) - 1; i >= 0; i-- {
+		rule, matchAll, err := deviceFilterRule(devices[i])
+		if err != nil {
+			return nil, err
+		}
+		insns = append(insns, rule...)
+		// The verifier rejects unreachable instructions.
+		if matchAll {
+			return insns, nil
+		}
+	}
+	return append(insns, bpfReturn(0)...), nil
+}
+
+// bpfProgLoadAttr is the BPF_PROG_LOAD part of union bpf_attr.
+type bpfProgLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+	progName    [unix.BPF_OBJ_NAME_LEN]byte
+}
+
+// bpfProgAttachAttr is the BPF_PROG_ATTACH part of union bpf_attr.
+type bpfProgAttachAttr struct {
+	targetFd    uint32
+	attachBpfFd uint32
+	attachType  uint32
+	attachFlags uint32
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// loadDeviceFilter loads the device filter program and returns the program file descriptor.
+// If the verifier rejects the program, the verifier log is added to the error.
+func loadDeviceFilter(insns []bpfInsn) (int, error) {
+	license := []byte("GPL\x00")
+	attr := bpfProgLoadAttr{
+		progType: unix.BPF_PROG_TYPE_CGROUP_DEVICE,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+	copy(attr.progName[:], "lxcri_devices")
+
+	fd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err == unix.EACCES || err == unix.EINVAL {
+		logBuf := make([]byte, 64*1024)
+		attr.logLevel = 1
+		attr.logSize = uint32(len(logBuf))
+		attr.logBuf = uint64(uintptr(unsafe.Pointer(&logBuf[0])))
+		fd, err = bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+		if err != nil {
+			if i := bytes.IndexByte(logBuf, 0); i >= 0 {
+				logBuf = logBuf[:i]
+			}
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(logBuf)))
+		}
+		runtime.KeepAlive(logBuf)
+	}
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	return fd, err
+}
+
+// attachDeviceFilter attaches the device filter program for the device cgroup rules
+// (specs.LinuxResources.Devices and defaultDeviceRules) to the container cgroup.
+// The program is attached with BPF_F_ALLOW_MULTI, so that programs attached
+// to ancestor cgroups (e.g by systemd or a parent container runtime) still apply.
+// The program is detached by the kernel when the cgroup is removed.
+func (c *Container) attachDeviceFilter() error {
+	rules := deviceFilterRules(c.Spec.Linux.Resources.Devices)
+	insns, err := deviceFilter(rules)
+	if err != nil {
+		return err
+	}
+	prog, err := loadDeviceFilter(insns)
+	if err != nil {
+		return fmt.Errorf("failed to load device filter program: %w", err)
+	}
+	defer unix.Close(prog)
+
+	dir := filepath.Join(cgroupRoot, c.CgroupDir)
+	cg, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open cgroup %s: %w", dir, err)
+	}
+	defer unix.Close(cg)
+
+	attr := bpfProgAttachAttr{
+		targetFd:    uint32(cg),
+		attachBpfFd: uint32(prog),
+		attachType:  unix.BPF_CGROUP_DEVICE,
+		attachFlags: unix.BPF_F_ALLOW_MULTI,
+	}
+	if _, err := bpf(unix.BPF_PROG_ATTACH, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err != nil {
+		return fmt.Errorf("failed to attach device filter program to cgroup %s: %w", dir, err)
+	}
+	c.Log.Debug().Int("rules", len(rules)).Int("insns", len(insns)).Msg("attached device filter")
+	return nil
+}
+
+// configureDeviceFilter attaches the device filter to the container cgroup
+// if the cgroup devices feature is enabled (see RuntimeFeatures.CgroupDevices).
+// It must be called after the container cgroup is created and before
+// the container process is started.
+func (rt *Runtime) configureDeviceFilter(c *Container) error {
+	if !rt.Features.CgroupDevices || c.Spec.Linux.Resources == nil || c.Spec.Linux.Resources.Devices == nil {
+		return nil
+	}
+	err := c.attachDeviceFilter()
+	if err != nil && !rt.isPrivileged() && errors.Is(err, unix.EPERM) {
+		c.warnf("CgroupDevicesUnsupported", "device filter is not supported by the unprivileged runtime - access to all devices is granted: %s", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// runDeviceFilter interprets the device filter program for the device access.
+// Only the instructions generated by deviceFilter are supported.
+func runDeviceFilter(t *testing.T, insns []bpfInsn, devType int, access int, major int, minor int) int {
+	ctx := [3]uint64{uint64(access<<16 | devType), uint64(major), uint64(minor)}
+	var regs [11]uint64
+	for pc := 0; pc < len(insns); pc++ {
+		insn := insns[pc]
+		dst, src := insn.regs&0x0f, insn.regs>>4
+		switch insn.code {
+		case unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W:
+			require.Equal(t, uint8(bpfR1), src)
+			regs[dst] = ctx[insn.off/4]
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			regs[dst] = uint64(uint32(regs[dst]) & uint32(insn.imm))
+		case unix.BPF_ALU | unix.BPF_RSH | unix.BPF_K:
+			regs[dst] = uint64(uint32(regs[dst]) >> uint32(insn.imm))
+		case unix.BPF_ALU | unix.BPF_MOV | unix.BPF_X:
+			regs[dst] = uint64(uint32(regs[src]))
+		case unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K:
+			regs[dst] = uint64(int64(insn.imm))
+		case unix.BPF_JMP | unix.BPF_JNE | unix.BPF_K:
+			if regs[dst] != uint64(int64(insn.imm)) {
+				pc += int(insn.off)
+			}
+		case unix.BPF_JMP | unix.BPF_JNE | unix.BPF_X:
+			if regs[dst] != regs[src] {
+				pc += int(insn.off)
+			}
+		case unix.BPF_JMP | unix.BPF_EXIT:
+			return int(regs[bpfR0])
+		default:
+			t.Fatalf("unsupported instruction %#x at %d", insn.code, pc)
+		}
+	}
+	t.Fatal("program did not exit")
+	return -1
+}
+
+func TestDeviceFilter(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+	devices := []specs.LinuxDeviceCgroup{
+		{Allow: false, Access: "rwm"},
+		{Allow: true, Type: "c", Major: i64(1), Minor: i64(3), Access: "rwm"},
+		{Allow: true, Type: "c", Major: i64(136), Access: "rw"},
+		{Allow: true, Type: "b", Major: i64(8), Minor: i64(0), Access: "r"},
+		{Allow: false, Type: "c", Major: i64(136), Minor: i64(2), Access: "w"},
+	}
+	insns, err := deviceFilter(devices)
+	require.NoError(t, err)
+
+	const (
+		block = unix.BPF_DEVCG_DEV_BLOCK
+		char  = unix.BPF_DEVCG_DEV_CHAR
+		r     = unix.BPF_DEVCG_ACC_READ
+		w     = unix.BPF_DEVCG_ACC_WRITE
+		m     = unix.BPF_DEVCG_ACC_MKNOD
+	)
+	tests := []struct {
+		devType, access, major, minor int
+		allow                         int
+	}{
+		{char, r | w | m, 1, 3, 1},  // /dev/null
+		{char, r, 1, 5, 0},          // /dev/zero is not allowed
+		{char, r | w, 136, 0, 1},    // pts
+		{char, m, 136, 0, 0},        // pts mknod is not allowed
+		{char, r, 136, 2, 1},        // read of pts 2 is allowed
+		{char, w, 136, 2, 0},        // last matching rule wins
+		{block, r, 8, 0, 1},         // sda read
+		{block, r | w, 8, 0, 0},     // sda write is not allowed
+		{char, r, 8, 0, 0},          // type mismatch
+		{block, r | w | m, 1, 3, 0}, // type mismatch
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.allow, runDeviceFilter(t, insns, tc.devType, tc.access, tc.major, tc.minor), "%+v", tc)
+	}
+
+	// Rules before an unconditional rule are unreachable.
+	insns, err = deviceFilter(append(devices, specs.LinuxDeviceCgroup{Allow: true, Type: "a"}))
+	require.NoError(t, err)
+	require.Equal(t, 1, runDeviceFilter(t, insns, block, r|w, 8, 16))
+	require.Len(t, insns, 6+2)
+
+	_, err = deviceFilter([]specs.LinuxDeviceCgroup{{Allow: true, Type: "x"}})
+	require.Error(t, err)
+	_, err = deviceFilter([]specs.LinuxDeviceCgroup{{Allow: true, Type: "c", Access: "rx"}})
+	require.Error(t, err)
+}
+
+func TestDeviceFilterDefaultRules(t *testing.T) {
+	devices := []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}}
+	insns, err := deviceFilter(deviceFilterRules(devices))
+	require.NoError(t, err)
+
+	const (
+		block = unix.BPF_DEVCG_DEV_BLOCK
+		char  = unix.BPF_DEVCG_DEV_CHAR
+		rw    = unix.BPF_DEVCG_ACC_READ | unix.BPF_DEVCG_ACC_WRITE
+		m     = unix.BPF_DEVCG_ACC_MKNOD
+	)
+	tests := []struct {
+		devType, access, major, minor int
+		allow                         int
+	}{
+		{char, rw, 1, 3, 1},   // null
+		{char, rw, 1, 5, 1},   // zero
+		{char, rw, 1, 7, 1},   // full
+		{char, rw, 1, 8, 1},   // random
+		{char, rw, 1, 9, 1},   // urandom
+		{char, rw, 5, 0, 1},   // tty
+		{char, rw, 5, 1, 1},   // console
+		{char, rw, 5, 2, 1},   // ptmx
+		{char, rw, 136, 7, 1}, // pts
+		{char, m, 10, 200, 1}, // mknod of any char device
+		{block, m, 8, 0, 1},   // mknod of any block device
+		{char, rw, 10, 200, 0},
+		{block, rw, 8, 0, 0},
+		{char, rw | m, 1, 4, 0},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.allow, runDeviceFilter(t, insns, tc.devType, tc.access, tc.major, tc.minor), "%+v", tc)
+	}
+
+	// The default devices can not be denied.
+	i64 := func(v int64) *int64 { return &v }
+	insns, err = deviceFilter(deviceFilterRules([]specs.LinuxDeviceCgroup{{Allow: false, Type: "c", Major: i64(1), Minor: i64(3), Access: "rwm"}}))
+	require.NoError(t, err)
+	require.Equal(t, 1, runDeviceFilter(t, insns, char, rw, 1, 3))
+}
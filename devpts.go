@@ -0,0 +1,95 @@
+package lxcri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const devPts = "/dev/pts"
+
+// defaultPtmxMode is the mode of the pts/ptmx node of a private devpts instance.
+// The kernel default 0000 makes /dev/ptmx (a symlink to pts/ptmx) unusable.
+const defaultPtmxMode = "0666"
+
+// configureDevpts validates the /dev/pts mount of the container.
+// A devpts mount is made a private instance (newinstance) with an accessible
+// pts/ptmx node, so that /dev/ptmx can be a symlink to pts/ptmx (see lxcri-hook-builtin).
+// If /dev/pts is bind mounted from the host, the container shares the host pty instance,
+// and the host /dev/ptmx is bind mounted by lxcri-hook-builtin.
+func configureDevpts(c *Container) error {
+	for i, m := range c.Spec.Mounts {
+		if filepath.Clean(m.Destination) != devPts {
+			continue
+		}
+		if isBindMount(m.Type, m.Options) {
+			c.warnf("DevptsShared", "%s is bind mounted from %s - the container shares the pty instance of the host", devPts, m.Source)
+			return nil
+		}
+		if m.Type != "devpts" {
+			return fmt.Errorf("unsupported filesystem type %q for %s", m.Type, devPts)
+		}
+		opts, err := devptsOptions(m.Options)
+		if err != nil {
+			return err
+		}
+		c.Spec.Mounts[i].Options = opts
+		return nil
+	}
+	return nil
+}
+
+// devptsOptions validates the devpts mount options, and adds the options
+// `newinstance` and `ptmxmode=0666` if they are missing.
+func devptsOptions(options []string) ([]string, error) {
+	opts := append([]string{}, options...)
+	newinstance := false
+	ptmxmode := false
+	for _, opt := range opts {
+		key, val := opt, ""
+		if i := strings.Index(opt, "="); i > 0 {
+			key, val = opt[:i], opt[i+1:]
+		}
+		switch key {
+		case "newinstance":
+			newinstance = true
+		case "ptmxmode":
+			ptmxmode = true
+			mode, err := strconv.ParseUint(val, 8, 32)
+			if err != nil || mode > 0777 {
+				return nil, fmt.Errorf("invalid devpts option %q", opt)
+			}
+			if mode&0666 == 0 {
+				return nil, fmt.Errorf("devpts option %q makes /dev/ptmx inaccessible", opt)
+			}
+		case "mode":
+			if mode, err := strconv.ParseUint(val, 8, 32); err != nil || mode > 0777 {
+				return nil, fmt.Errorf("invalid devpts option %q", opt)
+			}
+		case "gid", "uid", "max":
+			if _, err := strconv.ParseUint(val, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid devpts option %q", opt)
+			}
+		}
+	}
+	if !newinstance {
+		opts = append(opts, "newinstance")
+	}
+	if !ptmxmode {
+		opts = append(opts, "ptmxmode="+defaultPtmxMode)
+	}
+	return opts, nil
+}
+
+func isBindMount(fsType string, options []string) bool {
+	if fsType == "bind" {
+		return true
+	}
+	for _, opt := range options {
+		if opt == "bind" || opt == "rbind" {
+			return true
+		}
+	}
+	return false
+}
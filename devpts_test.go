@@ -0,0 +1,37 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevptsOptions(t *testing.T) {
+	opts, err := devptsOptions([]string{"nosuid", "noexec", "gid=5", "mode=620"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"nosuid", "noexec", "gid=5", "mode=620", "newinstance", "ptmxmode=0666"}, opts)
+
+	opts, err = devptsOptions([]string{"newinstance", "ptmxmode=0620"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"newinstance", "ptmxmode=0620"}, opts)
+
+	for _, opt := range []string{"ptmxmode=000", "ptmxmode=999", "mode=rw", "gid=tty"} {
+		_, err = devptsOptions([]string{opt})
+		require.Error(t, err, opt)
+	}
+}
+
+func TestConfigureDevpts(t *testing.T) {
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	spec.Mounts = []specs.Mount{
+		{Destination: "/dev/pts/", Type: "devpts", Source: "devpts", Options: []string{"gid=5"}},
+	}
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: spec}}
+	require.NoError(t, configureDevpts(c))
+	require.Equal(t, []string{"gid=5", "newinstance", "ptmxmode=0666"}, spec.Mounts[0].Options)
+
+	spec.Mounts[0] = specs.Mount{Destination: "/dev/pts", Type: "tmpfs", Source: "tmpfs"}
+	require.Error(t, configureDevpts(c))
+}
@@ -0,0 +1,155 @@
+package lxcri
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// DNSConfig is the DNS resolver configuration of a container.
+// It is written to a runtime managed /etc/resolv.conf (see `man 5 resolv.conf`).
+type DNSConfig struct {
+	// Servers are the IP addresses of the name servers.
+	Servers []string `json:",omitempty"`
+	// Searches are the search domains.
+	Searches []string `json:",omitempty"`
+	// Options are the resolver options e.g `ndots:5`.
+	Options []string `json:",omitempty"`
+}
+
+// hostResolvConf is the resolver configuration propagated by Runtime.HostDNS.
+var hostResolvConf = "/etc/resolv.conf"
+
+// resolvedResolvConf is the resolver configuration of systemd-resolved with the
+// upstream name servers. It is used if /etc/resolv.conf only contains the local stub resolver.
+var resolvedResolvConf = "/run/systemd/resolve/resolv.conf"
+
+const resolvConf = "/etc/resolv.conf"
+
+// configureDNS bind mounts a runtime managed /etc/resolv.conf into the container.
+// The file is generated from ContainerConfig.DNS, or from the host resolv.conf
+// if Runtime.HostDNS is enabled. The container spec takes precedence,
+// nothing is done if the spec mounts /etc/resolv.conf.
+func configureDNS(rt *Runtime, c *Container) error {
+	if c.DNS == nil && !rt.HostDNS {
+		return nil
+	}
+	if hasMountDestination(c.Spec, resolvConf) {
+		if c.DNS != nil {
+			c.warnf("DNSIgnored", "DNS config is ignored - spec mounts %s", resolvConf)
+		}
+		return nil
+	}
+
+	dns := c.DNS
+	if dns == nil {
+		var err error
+		dns, err = loadHostDNS(!isNamespaceEnabled(c.Spec, specs.NetworkNamespace))
+		if err != nil {
+			return fmt.Errorf("failed to load host DNS config: %w", err)
+		}
+		if len(dns.Servers) == 0 {
+			c.warnf("DNSNoServers", "host %s has no name servers usable within the container", hostResolvConf)
+		}
+	}
+	for _, s := range dns.Servers {
+		if net.ParseIP(s) == nil {
+			return fmt.Errorf("invalid DNS server address %q", s)
+		}
+	}
+
+	filename := c.RuntimePath("resolv.conf")
+	// #nosec
+	if err := os.WriteFile(filename, dns.ResolvConf(), 0444); err != nil {
+		return err
+	}
+	c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+		Source:      filename,
+		Destination: resolvConf,
+		Type:        "bind",
+		Options:     []string{"bind", "ro", "nosuid", "nodev", "noexec", "create=file"},
+	})
+	return nil
+}
+
+// ResolvConf returns the resolv.conf file content for the DNS config.
+func (dns *DNSConfig) ResolvConf() []byte {
+	var b bytes.Buffer
+	for _, s := range dns.Servers {
+		fmt.Fprintf(&b, "nameserver %s\n", s)
+	}
+	if len(dns.Searches) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(dns.Searches, " "))
+	}
+	if len(dns.Options) > 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(dns.Options, " "))
+	}
+	return b.Bytes()
+}
+
+// loadHostDNS loads the DNS config from the host resolv.conf.
+// Loopback name servers are not reachable from a private network namespace
+// and are removed unless hostNetwork is true. The upstream name servers of
+// systemd-resolved are used if the host only uses the local stub resolver.
+func loadHostDNS(hostNetwork bool) (*DNSConfig, error) {
+	dns, err := parseResolvConf(hostResolvConf)
+	if err != nil || hostNetwork {
+		return dns, err
+	}
+	servers := nonLoopback(dns.Servers)
+	if len(servers) == 0 && len(dns.Servers) > 0 {
+		resolved, err := parseResolvConf(resolvedResolvConf)
+		if err == nil {
+			servers = nonLoopback(resolved.Servers)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	dns.Servers = servers
+	return dns, nil
+}
+
+func nonLoopback(servers []string) []string {
+	var l []string
+	for _, s := range servers {
+		if ip := net.ParseIP(s); ip != nil && !ip.IsLoopback() {
+			l = append(l, s)
+		}
+	}
+	return l
+}
+
+// parseResolvConf parses the name servers, search domains and options
+// from the given resolv.conf file. The last search line takes precedence.
+func parseResolvConf(filename string) (*DNSConfig, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec
+	defer f.Close()
+
+	dns := new(DNSConfig)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			dns.Servers = append(dns.Servers, fields[1])
+		case "search", "domain":
+			dns.Searches = fields[1:]
+		case "options":
+			dns.Options = append(dns.Options, fields[1:]...)
+		}
+	}
+	return dns, scanner.Err()
+}
@@ -0,0 +1,53 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSConfigResolvConf(t *testing.T) {
+	dns := DNSConfig{
+		Servers:  []string{"10.0.0.10", "fd00::10"},
+		Searches: []string{"default.svc.cluster.local", "svc.cluster.local"},
+		Options:  []string{"ndots:5", "edns0"},
+	}
+	require.Equal(t, "nameserver 10.0.0.10\nnameserver fd00::10\n"+
+		"search default.svc.cluster.local svc.cluster.local\noptions ndots:5 edns0\n", string(dns.ResolvConf()))
+
+	filename := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(filename, dns.ResolvConf(), 0644))
+	parsed, err := parseResolvConf(filename)
+	require.NoError(t, err)
+	require.Equal(t, dns, *parsed)
+}
+
+func TestLoadHostDNS(t *testing.T) {
+	tmp := t.TempDir()
+	defer func(a, b string) {
+		hostResolvConf, resolvedResolvConf = a, b
+	}(hostResolvConf, resolvedResolvConf)
+	hostResolvConf = filepath.Join(tmp, "resolv.conf")
+	resolvedResolvConf = filepath.Join(tmp, "resolved.conf")
+
+	stub := "# stub resolver\nnameserver 127.0.0.53\noptions edns0 trust-ad\nsearch example.com\n"
+	require.NoError(t, os.WriteFile(hostResolvConf, []byte(stub), 0644))
+
+	dns, err := loadHostDNS(true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.53"}, dns.Servers)
+
+	// without systemd-resolved upstream config
+	dns, err = loadHostDNS(false)
+	require.NoError(t, err)
+	require.Empty(t, dns.Servers)
+	require.Equal(t, []string{"example.com"}, dns.Searches)
+	require.Equal(t, []string{"edns0", "trust-ad"}, dns.Options)
+
+	require.NoError(t, os.WriteFile(resolvedResolvConf, []byte("nameserver 192.168.1.1\nnameserver ::1\n"), 0644))
+	dns, err = loadHostDNS(false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.168.1.1"}, dns.Servers)
+}
@@ -0,0 +1,23 @@
+//go:build embed
+// +build embed
+
+package lxcri
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// The runtime executables are copied to the libexec directory
+// by the Makefile target 'lxcri-embedded' before building.
+//
+//go:embed libexec
+var libexecFS embed.FS
+
+func init() {
+	fsys, err := fs.Sub(libexecFS, "libexec")
+	if err != nil {
+		panic(err)
+	}
+	embeddedLibexec = fsys
+}
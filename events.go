@@ -0,0 +1,536 @@
+package lxcri
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Event types emitted for container state changes.
+const (
+	EventCreated = "created"
+	EventStarted = "started"
+	EventStopped = "stopped"
+	EventDeleted = "deleted"
+	EventPaused  = "paused"
+	// EventResumed is emitted when a paused container is running again.
+	EventResumed = "resumed"
+	// EventHealthStatus is emitted when the health status of a container changes
+	// (see Event.Health and HealthCheck).
+	EventHealthStatus = "health_status"
+	// EventOOM is emitted when processes of the container were killed
+	// by the OOM killer (memory.events oom_kill).
+	EventOOM = "oom"
+	// EventExecStarted is emitted when a process is executed in the container
+	// (see Container.Exec and Container.ExecDetached). Only processes executed
+	// by the runtime instance that emits the events are reported.
+	EventExecStarted = "exec_started"
+)
+
+// Event is a container lifecycle event.
+type Event struct {
+	Type        string
+	ContainerID string
+	// Status is the container status after the event.
+	// Status is empty for EventDeleted and EventExecStarted.
+	Status specs.ContainerState `json:",omitempty"`
+	// Health is the health status of the container after the event.
+	// It is only set for EventHealthStatus.
+	Health string `json:",omitempty"`
+	// Pid is the PID of the executed process for EventExecStarted.
+	// It is zero if the process was executed with Container.Exec.
+	Pid int `json:",omitempty"`
+	// OOMKills is the number of processes killed by the OOM killer
+	// since the last event. It is only set for EventOOM.
+	OOMKills uint64 `json:",omitempty"`
+	Time     time.Time
+	// Replay is true for events that describe the status of a container
+	// at the time a client connected, and not a status change.
+	Replay bool `json:",omitempty"`
+}
+
+func eventType(s specs.ContainerState) string {
+	switch s {
+	case specs.StateCreated:
+		return EventCreated
+	case specs.StateRunning:
+		return EventStarted
+	case specs.StateStopped:
+		return EventStopped
+	case StatePaused:
+		return EventPaused
+	}
+	return ""
+}
+
+// containerSnapshot is the observed status of all containers, indexed by container ID.
+type containerSnapshot struct {
+	states map[string]specs.ContainerState
+	// health is the health status (see Container.Health).
+	// Containers without a HealthCheck are not in the health map.
+	health map[string]string
+	// oomKills are the oom_kill counters of the cgroup memory.events file.
+	oomKills map[string]uint64
+}
+
+// snapshotLockTimeout is the maximum time snapshot waits for the lock of a container.
+const snapshotLockTimeout = 100 * time.Millisecond
+
+// snapshot returns the status of all containers that can be loaded.
+// The containers are loaded with the shared container lock held.
+// A container that is locked exclusively (e.g while it is started)
+// keeps its status from prev, so that no events are reported for it.
+func (rt *Runtime) snapshot(ctx context.Context, prev containerSnapshot) (containerSnapshot, error) {
+	snap := containerSnapshot{
+		states:   make(map[string]specs.ContainerState),
+		health:   make(map[string]string),
+		oomKills: make(map[string]uint64),
+	}
+	ids, err := rt.List()
+	if err != nil {
+		return snap, err
+	}
+	for _, id := range ids {
+		lctx, cancel := context.WithTimeout(ctx, snapshotLockTimeout)
+		l, err := rt.Lock(lctx, id, false)
+		cancel()
+		if err != nil {
+			if err != ErrNotExist {
+				snap.keep(prev, id)
+			}
+			rt.Log.Debug().Str("cid", id).Msgf("skipping container: %s", err)
+			continue
+		}
+		rt.snapshotContainer(&snap, id)
+		if err := l.Unlock(); err != nil {
+			rt.Log.Warn().Str("cid", id).Msgf("failed to unlock container: %s", err)
+		}
+	}
+	return snap, nil
+}
+
+func (rt *Runtime) snapshotContainer(snap *containerSnapshot, id string) {
+	c, err := rt.Load(id)
+	if err != nil {
+		// The container may be in the process of being created or deleted.
+		rt.Log.Debug().Str("cid", id).Msgf("skipping container: %s", err)
+		return
+	}
+	s, err := c.ContainerState()
+	h, healthErr := c.Health()
+	oomKills, oomErr := c.oomKills()
+	if err := c.Release(); err != nil {
+		rt.Log.Warn().Str("cid", id).Msgf("failed to release container: %s", err)
+	}
+	if err != nil {
+		rt.Log.Debug().Str("cid", id).Msgf("skipping container: %s", err)
+		return
+	}
+	snap.states[id] = s
+	if healthErr == nil {
+		snap.health[id] = h.Status
+	}
+	if oomErr == nil {
+		snap.oomKills[id] = oomKills
+	}
+}
+
+// keep copies the status of the given container from prev.
+func (snap containerSnapshot) keep(prev containerSnapshot, id string) {
+	if s, ok := prev.states[id]; ok {
+		snap.states[id] = s
+	}
+	if h, ok := prev.health[id]; ok {
+		snap.health[id] = h
+	}
+	if n, ok := prev.oomKills[id]; ok {
+		snap.oomKills[id] = n
+	}
+}
+
+// oomKills returns the oom_kill counter of the container cgroup.
+func (c *Container) oomKills() (uint64, error) {
+	if c.CgroupDir == "" {
+		return 0, ErrNotExist
+	}
+	vals, err := readCgroupKeyValues(filepath.Join(cgroupRoot, c.CgroupDir, "memory.events"))
+	if err != nil {
+		return 0, err
+	}
+	return vals[MemoryEventOOMKill], nil
+}
+
+// diffSnapshots returns the events for all changes from prev to next.
+func diffSnapshots(prev, next containerSnapshot, now time.Time) []Event {
+	events := diffStates(prev.states, next.states, now)
+	events = append(events, diffHealth(prev.health, next.health, now)...)
+	return append(events, diffOOMKills(prev.oomKills, next.oomKills, next.states, now)...)
+}
+
+// diffStates returns the events for all status changes from prev to next.
+// Events are sorted by container ID.
+func diffStates(prev, next map[string]specs.ContainerState, now time.Time) []Event {
+	var events []Event
+	for id, s := range next {
+		if prev[id] == s {
+			continue
+		}
+		t := eventType(s)
+		if prev[id] == StatePaused && s == specs.StateRunning {
+			t = EventResumed
+		}
+		if t != "" {
+			events = append(events, Event{Type: t, ContainerID: id, Status: s, Time: now})
+		}
+	}
+	for id := range prev {
+		if _, exists := next[id]; !exists {
+			events = append(events, Event{Type: EventDeleted, ContainerID: id, Time: now})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ContainerID < events[j].ContainerID })
+	return events
+}
+
+// diffHealth returns the events for all health status changes from prev to next.
+// Events are sorted by container ID.
+func diffHealth(prev, next map[string]string, now time.Time) []Event {
+	var events []Event
+	for id, h := range next {
+		if prev[id] == h {
+			continue
+		}
+		events = append(events, Event{Type: EventHealthStatus, ContainerID: id, Health: h, Time: now})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ContainerID < events[j].ContainerID })
+	return events
+}
+
+// diffOOMKills returns the events for all increased oom_kill counters from prev to next.
+// Events are sorted by container ID.
+func diffOOMKills(prev, next map[string]uint64, states map[string]specs.ContainerState, now time.Time) []Event {
+	var events []Event
+	for id, n := range next {
+		if n <= prev[id] {
+			continue
+		}
+		events = append(events, Event{Type: EventOOM, ContainerID: id, Status: states[id], OOMKills: n - prev[id], Time: now})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ContainerID < events[j].ContainerID })
+	return events
+}
+
+// replayEvents returns the events that describe the given container states.
+func replayEvents(states map[string]specs.ContainerState, now time.Time) []Event {
+	events := diffStates(nil, states, now)
+	for i := range events {
+		events[i].Replay = true
+	}
+	return events
+}
+
+// EventSocketPath is the default path of the unix socket served by EventServer.
+func (rt *Runtime) EventSocketPath() string {
+	// The socket file is hidden, so it's not listed as container.
+	return filepath.Join(rt.containersDir(), ".events.sock")
+}
+
+// eventBufferSize is the number of events buffered per client.
+// Clients that do not keep up are disconnected.
+const eventBufferSize = 128
+
+// EventServer streams container events as JSON lines to connected clients.
+// Every client receives the current status of all containers (see Event.Replay)
+// before the status changes.
+type EventServer struct {
+	Runtime *ReloadableRuntime
+	// Interval is the interval for polling the container states.
+	Interval time.Duration
+	// Reload triggers ReloadableRuntime.Reload e.g on SIGHUP (see signal.Notify).
+	// The runtime configuration is not reloaded if Reload is nil.
+	Reload <-chan os.Signal
+
+	mu      sync.Mutex
+	snap    containerSnapshot
+	clients map[chan Event]bool
+}
+
+// ListenUnix creates the unix socket at the given path.
+// A stale socket file is removed.
+// The socket is only accessible by the runtime user.
+func ListenUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts client connections on l until ctx is done.
+func (s *EventServer) Serve(ctx context.Context, l net.Listener) error {
+	rt, release := s.Runtime.Acquire()
+	snap, err := rt.snapshot(ctx, containerSnapshot{})
+	release()
+	if err != nil {
+		return errorf("failed to load container states: %w", err)
+	}
+	s.mu.Lock()
+	s.snap = snap
+	s.clients = make(map[chan Event]bool)
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go s.poll(ctx)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(ctx, conn)
+	}
+}
+
+func (s *EventServer) poll(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.Reload:
+			if err := s.Runtime.Reload(); err != nil {
+				rt, release := s.Runtime.Acquire()
+				rt.Log.Error().Msgf("failed to reload runtime configuration: %s", err)
+				release()
+			}
+		case now := <-ticker.C:
+			rt, release := s.Runtime.Acquire()
+			s.mu.Lock()
+			prev := s.snap
+			s.mu.Unlock()
+			snap, err := rt.snapshot(ctx, prev)
+			if err != nil {
+				rt.Log.Error().Msgf("failed to load container states: %s", err)
+			} else {
+				s.publish(rt, snap, now)
+			}
+			release()
+		}
+	}
+}
+
+func (s *EventServer) publish(rt *Runtime, snap containerSnapshot, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := diffSnapshots(s.snap, snap, now)
+	s.snap = snap
+clients:
+	for ch := range s.clients {
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+			default:
+				rt.Log.Warn().Msg("disconnecting slow event client")
+				s.removeClient(ch)
+				continue clients
+			}
+		}
+	}
+}
+
+// removeClient must be called with s.mu held.
+func (s *EventServer) removeClient(ch chan Event) {
+	if s.clients[ch] {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+func (s *EventServer) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	ch := make(chan Event, eventBufferSize)
+	s.mu.Lock()
+	now := time.Now()
+	replay := replayEvents(s.snap.states, now)
+	for _, ev := range diffHealth(nil, s.snap.health, now) {
+		ev.Replay = true
+		replay = append(replay, ev)
+	}
+	s.clients[ch] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.removeClient(ch)
+		s.mu.Unlock()
+	}()
+
+	enc := json.NewEncoder(conn)
+	for _, ev := range replay {
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				// The client may be connected across reloads.
+				rt, release := s.Runtime.Acquire()
+				rt.Log.Debug().Msgf("event client disconnected: %s", err)
+				release()
+				return
+			}
+		}
+	}
+}
+
+// eventPollInterval is the interval for polling the container states
+// of a Runtime.Events subscription.
+const eventPollInterval = time.Second
+
+// eventBus delivers events to the subscribers of Runtime.Events.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan Event]bool)}
+}
+
+func (b *eventBus) subscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[ch] = true
+}
+
+// unsubscribe removes the subscriber and closes its channel.
+// It returns false if the subscriber was already removed.
+func (b *eventBus) unsubscribe(ch chan Event) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remove(ch)
+}
+
+// remove must be called with b.mu held.
+func (b *eventBus) remove(ch chan Event) bool {
+	if !b.subscribers[ch] {
+		return false
+	}
+	delete(b.subscribers, ch)
+	close(ch)
+	return true
+}
+
+// send sends the events to the given subscriber.
+// A subscriber that does not keep up is removed.
+// It returns false if the subscriber was removed.
+func (b *eventBus) send(ch chan Event, events ...Event) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sendLocked(ch, events)
+}
+
+func (b *eventBus) sendLocked(ch chan Event, events []Event) bool {
+	if !b.subscribers[ch] {
+		return false
+	}
+	for _, ev := range events {
+		select {
+		case ch <- ev:
+		default:
+			b.remove(ch)
+			return false
+		}
+	}
+	return true
+}
+
+// publish sends the events to all subscribers.
+// It is a noop if b is nil, e.g for a container that was not
+// created or loaded by an initialized runtime.
+func (b *eventBus) publish(events ...Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		b.sendLocked(ch, events)
+	}
+}
+
+// Events returns a channel that receives the container lifecycle events
+// (EventCreated, EventStarted, EventPaused, EventResumed, EventStopped,
+// EventDeleted, EventHealthStatus, EventOOM and EventExecStarted) until ctx is done.
+// The container states are polled, so the events include the changes
+// made by other runtime processes, e.g the `lxcri` CLI.
+// The channel is closed when ctx is done, or if the receiver
+// does not keep up with the events.
+func (rt *Runtime) Events(ctx context.Context) (<-chan Event, error) {
+	if rt.events == nil {
+		return nil, errorf("runtime is not initialized")
+	}
+	prev, err := rt.snapshot(ctx, containerSnapshot{})
+	if err != nil {
+		return nil, errorf("failed to load container states: %w", err)
+	}
+	ch := make(chan Event, eventBufferSize)
+	rt.events.subscribe(ch)
+
+	go func() {
+		ticker := time.NewTicker(eventPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				rt.events.unsubscribe(ch)
+				return
+			case now := <-ticker.C:
+				next, err := rt.snapshot(ctx, prev)
+				if err != nil {
+					rt.Log.Error().Msgf("failed to load container states: %s", err)
+					continue
+				}
+				if !rt.events.send(ch, diffSnapshots(prev, next, now)...) {
+					rt.Log.Warn().Msg("removed slow event subscriber")
+					return
+				}
+				prev = next
+			}
+		}
+	}()
+	return ch, nil
+}
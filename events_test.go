@@ -0,0 +1,128 @@
+package lxcri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffStates(t *testing.T) {
+	now := time.Now()
+	prev := map[string]specs.ContainerState{
+		"a": specs.StateCreated,
+		"b": specs.StateRunning,
+		"c": specs.StateRunning,
+	}
+	next := map[string]specs.ContainerState{
+		"a": specs.StateRunning,
+		"b": specs.StateRunning,
+		"d": specs.StateCreating,
+		"e": specs.StateCreated,
+	}
+	events := diffStates(prev, next, now)
+	require.Equal(t, []Event{
+		{Type: EventStarted, ContainerID: "a", Status: specs.StateRunning, Time: now},
+		{Type: EventDeleted, ContainerID: "c", Time: now},
+		{Type: EventCreated, ContainerID: "e", Status: specs.StateCreated, Time: now},
+	}, events)
+
+	events = replayEvents(next, now)
+	require.Len(t, events, 3)
+	for _, ev := range events {
+		require.True(t, ev.Replay)
+	}
+	require.Equal(t, "a", events[0].ContainerID)
+	require.Equal(t, EventStarted, events[0].Type)
+}
+
+func TestDiffHealth(t *testing.T) {
+	now := time.Now()
+	prev := map[string]string{"a": HealthStarting, "b": HealthHealthy}
+	next := map[string]string{"a": HealthHealthy, "b": HealthHealthy, "c": HealthStarting}
+	require.Equal(t, []Event{
+		{Type: EventHealthStatus, ContainerID: "a", Health: HealthHealthy, Time: now},
+		{Type: EventHealthStatus, ContainerID: "c", Health: HealthStarting, Time: now},
+	}, diffHealth(prev, next, now))
+}
+
+func TestDiffStatesPaused(t *testing.T) {
+	now := time.Now()
+	prev := map[string]specs.ContainerState{"a": specs.StateRunning, "b": StatePaused}
+	next := map[string]specs.ContainerState{"a": StatePaused, "b": specs.StateRunning}
+	require.Equal(t, []Event{
+		{Type: EventPaused, ContainerID: "a", Status: StatePaused, Time: now},
+		{Type: EventResumed, ContainerID: "b", Status: specs.StateRunning, Time: now},
+	}, diffStates(prev, next, now))
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	now := time.Now()
+	prev := containerSnapshot{
+		states:   map[string]specs.ContainerState{"a": specs.StateRunning, "b": specs.StateRunning},
+		oomKills: map[string]uint64{"a": 1, "b": 0},
+	}
+	next := containerSnapshot{
+		states:   map[string]specs.ContainerState{"a": specs.StateRunning, "b": specs.StateStopped},
+		health:   map[string]string{"a": HealthHealthy},
+		oomKills: map[string]uint64{"a": 1, "b": 2},
+	}
+	require.Equal(t, []Event{
+		{Type: EventStopped, ContainerID: "b", Status: specs.StateStopped, Time: now},
+		{Type: EventHealthStatus, ContainerID: "a", Health: HealthHealthy, Time: now},
+		{Type: EventOOM, ContainerID: "b", Status: specs.StateStopped, OOMKills: 2, Time: now},
+	}, diffSnapshots(prev, next, now))
+}
+
+func TestEventServerSlowClient(t *testing.T) {
+	now := time.Now()
+	s := &EventServer{Runtime: NewReloadableRuntime(rt), clients: make(map[chan Event]bool)}
+	slow := make(chan Event, 1)
+	fast := make(chan Event, 3)
+	s.clients[slow] = true
+	s.clients[fast] = true
+
+	snap := containerSnapshot{
+		states: map[string]specs.ContainerState{"a": specs.StateCreated, "b": specs.StateCreated, "c": specs.StateCreated},
+	}
+	s.publish(rt, snap, now)
+	require.Len(t, fast, 3)
+	require.False(t, s.clients[slow])
+
+	// the slow client is removed after the first event that does not fit
+	_, ok := <-slow
+	require.True(t, ok)
+	_, ok = <-slow
+	require.False(t, ok)
+}
+
+func TestEventBus(t *testing.T) {
+	b := newEventBus()
+	ch1 := make(chan Event, 2)
+	ch2 := make(chan Event, 1)
+	b.subscribe(ch1)
+	b.subscribe(ch2)
+
+	ev := Event{Type: EventExecStarted, ContainerID: "a", Pid: 42}
+	b.publish(ev, ev)
+	require.Equal(t, ev, <-ch1)
+	require.Equal(t, ev, <-ch1)
+
+	// ch2 did not keep up and was removed
+	require.Equal(t, ev, <-ch2)
+	_, ok := <-ch2
+	require.False(t, ok)
+	require.False(t, b.send(ch2, ev))
+
+	require.True(t, b.send(ch1, ev))
+	require.True(t, b.unsubscribe(ch1))
+	require.False(t, b.unsubscribe(ch1))
+	require.Equal(t, ev, <-ch1)
+	_, ok = <-ch1
+	require.False(t, ok)
+
+	// publish on a nil bus is a noop
+	var nilBus *eventBus
+	nilBus.publish(ev)
+}
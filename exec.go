@@ -0,0 +1,206 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// ExecContext executes the given process spec within the container
+// and waits for it to exit, like Container.Exec.
+// If the context is done before the process exits, the process and its
+// descendants are killed with SIGKILL. ErrExecTimeout is returned if the
+// context deadline was exceeded, the context error otherwise.
+func (c *Container) ExecContext(ctx context.Context, proc *specs.Process, execOpts *ExecOptions) (int, error) {
+	pid, err := c.ExecDetached(proc, execOpts)
+	if err != nil {
+		return 0, err
+	}
+	type result struct {
+		ws  unix.WaitStatus
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		for {
+			_, r.err = unix.Wait4(pid, &r.ws, 0, nil)
+			if r.err != unix.EINTR {
+				break
+			}
+		}
+		done <- r
+	}()
+
+	cgroup := ""
+	if execOpts != nil {
+		cgroup = execOpts.Cgroup
+	}
+
+	select {
+	case r := <-done:
+		if cgroup != "" {
+			c.removeExecCgroup(cgroup, false)
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		return r.ws.ExitStatus(), nil
+	case <-ctx.Done():
+		c.killProcessTree(pid)
+		<-done
+		if cgroup != "" {
+			c.removeExecCgroup(cgroup, true)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return 0, fmt.Errorf("%w: process %d killed", ErrExecTimeout, pid)
+		}
+		return 0, fmt.Errorf("exec process %d killed: %w", pid, ctx.Err())
+	}
+}
+
+// killProcessTree kills the process and all of its descendants with SIGKILL.
+// The descendants are collected before any process is killed,
+// because the children of a killed process are reparented.
+func (c *Container) killProcessTree(pid int) {
+	pids := append([]int{pid}, processDescendants(pid)...)
+	for _, p := range pids {
+		if err := unix.Kill(p, unix.SIGKILL); err != nil && err != unix.ESRCH {
+			c.Log.Warn().Int("pid", p).Msgf("failed to kill exec process: %s", err)
+		}
+	}
+}
+
+// processDescendants returns the PIDs of all descendants of the process
+// read from /proc/[pid]/task/[tid]/children (see `man 5 proc`).
+func processDescendants(pid int) []int {
+	var pids []int
+	for _, child := range processChildren(pid) {
+		pids = append(pids, child)
+		pids = append(pids, processDescendants(child)...)
+	}
+	return pids
+}
+
+func processChildren(pid int) []int {
+	tasks, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/children", pid))
+	if err != nil {
+		return nil
+	}
+	var children []int
+	for _, task := range tasks {
+		// #nosec
+		data, err := os.ReadFile(task)
+		if err != nil {
+			continue
+		}
+		for _, s := range strings.Fields(string(data)) {
+			if child, err := strconv.Atoi(s); err == nil {
+				children = append(children, child)
+			}
+		}
+	}
+	return children
+}
+
+// execCgroupPrefix is the name prefix of the exec sub-cgroups (see ExecOptions.Cgroup).
+const execCgroupPrefix = "exec-"
+
+// execCgroupRemoveTimeout is the maximum time to wait for the killed
+// processes of an exec sub-cgroup to exit.
+const execCgroupRemoveTimeout = 5 * time.Second
+
+func (c *Container) execCgroupDir(name string) (string, error) {
+	if c.CgroupDir == "" {
+		return "", fmt.Errorf("container cgroup is undefined")
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+		return "", fmt.Errorf("invalid exec cgroup name %q", name)
+	}
+	return filepath.Join(cgroupRoot, c.CgroupDir, execCgroupPrefix+name), nil
+}
+
+// runInExecCgroup calls fn with the process args wrapped by lxcri-init,
+// which joins the exec sub-cgroup before it executes the process.
+// The process never runs outside of the sub-cgroup, and can't escape it
+// by forking before it was moved. The sub-cgroup is created if it does not exist.
+//
+// lxcri-init is executed from the inherited file descriptor (/proc/self/fd/<fd>)
+// because it is not accessible within the container rootfs.
+// It joins the sub-cgroup by writing to the inherited cgroup.procs file descriptor,
+// and exits without executing the process if this fails.
+func (c *Container) runInExecCgroup(name string, args []string, fn func(args []string) error) error {
+	if c.InitPath == "" {
+		return fmt.Errorf("%s path is unknown (container was created by a previous runtime version)", ExecInit)
+	}
+	dir, err := c.execCgroupDir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	// The file descriptors are opened without O_CLOEXEC to be inherited
+	// by the attached process. Holding the fork lock prevents that
+	// they are leaked to processes forked concurrently by the runtime.
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+
+	procsFd, err := unix.Open(filepath.Join(dir, "cgroup.procs"), unix.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filepath.Join(dir, "cgroup.procs"), err)
+	}
+	defer unix.Close(procsFd)
+
+	initFd, err := unix.Open(c.InitPath, unix.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", c.InitPath, err)
+	}
+	defer unix.Close(initFd)
+
+	// NOTE keep in sync with execArg in cmd/lxcri-init
+	wrapped := []string{fmt.Sprintf("/proc/self/fd/%d", initFd), "exec", strconv.Itoa(procsFd), strconv.Itoa(initFd)}
+	c.Log.Debug().Str("cgroup", dir).Msg("start exec process in cgroup")
+	return fn(append(wrapped, args...))
+}
+
+// removeExecCgroup removes the exec sub-cgroup. If kill is true, the remaining
+// processes are killed with SIGKILL before. Otherwise a sub-cgroup that
+// still contains processes (e.g daemons started by the exec process) is kept.
+func (c *Container) removeExecCgroup(name string, kill bool) {
+	dir, err := c.execCgroupDir(name)
+	if err != nil {
+		return
+	}
+	if kill {
+		pids, err := cgroupPids(dir)
+		if err != nil {
+			c.Log.Warn().Msgf("failed to list exec cgroup processes: %s", err)
+		}
+		for _, pid := range pids {
+			if err := unix.Kill(pid, unix.SIGKILL); err != nil && err != unix.ESRCH {
+				c.Log.Warn().Int("pid", pid).Msgf("failed to kill exec process: %s", err)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), execCgroupRemoveTimeout)
+		defer cancel()
+		err = pollCgroupEvents(ctx, c.backoff, filepath.Join(dir, "cgroup.events"), func(ev cgroupEvents) bool {
+			return !ev.populated
+		})
+		if err != nil {
+			c.Log.Warn().Msgf("failed to wait for exec cgroup processes: %s", err)
+		}
+	}
+	if err := unix.Rmdir(dir); err != nil && err != unix.ENOENT {
+		c.Log.Debug().Str("cgroup", dir).Msgf("exec cgroup not removed: %s", err)
+	}
+}
@@ -0,0 +1,90 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestKillProcessTree(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "sleep 10 & sleep 10 & wait")
+	require.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Process.Kill() }()
+
+	var children []int
+	for i := 0; i < 100 && len(children) < 2; i++ {
+		time.Sleep(time.Millisecond * 10)
+		children = processDescendants(cmd.Process.Pid)
+	}
+	if len(children) == 0 {
+		t.Skip("/proc/[pid]/task/[tid]/children is not supported")
+	}
+	require.Len(t, children, 2)
+
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	c.killProcessTree(cmd.Process.Pid)
+	require.Error(t, cmd.Wait())
+	// The killed children are reaped by init.
+	require.Empty(t, processDescendants(cmd.Process.Pid))
+}
+
+func TestRunInExecCgroup(t *testing.T) {
+	root := t.TempDir()
+	prevRoot := cgroupRoot
+	cgroupRoot = root
+	defer func() { cgroupRoot = prevRoot }()
+
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "test"}}
+	for _, name := range []string{"", ".", "..", "a/b"} {
+		_, err := c.execCgroupDir(name)
+		require.Error(t, err, name)
+	}
+
+	dir, err := c.execCgroupDir("probe")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "test", "exec-probe"), dir)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), nil, 0644))
+
+	called := false
+	fn := func(args []string) error { called = true; return nil }
+	require.Error(t, c.runInExecCgroup("probe", []string{"sh"}, fn), "init path is unknown")
+	require.False(t, called)
+
+	c.InitPath, err = os.Executable()
+	require.NoError(t, err)
+	err = c.runInExecCgroup("probe", []string{"sh", "-c", "true"}, func(args []string) error {
+		require.Len(t, args, 7)
+		require.Equal(t, "exec", args[1])
+		require.Equal(t, []string{"sh", "-c", "true"}, args[4:])
+
+		// The file descriptors must be inherited.
+		procsFd, err := strconv.Atoi(args[2])
+		require.NoError(t, err)
+		flags, err := unix.FcntlInt(uintptr(procsFd), unix.F_GETFD, 0)
+		require.NoError(t, err)
+		require.Zero(t, flags&unix.FD_CLOEXEC)
+		_, err = unix.Write(procsFd, []byte("0"))
+		require.NoError(t, err)
+
+		initFd, err := strconv.Atoi(args[3])
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("/proc/self/fd/%d", initFd), args[0])
+		return nil
+	})
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	require.NoError(t, err)
+	require.Equal(t, "0", string(data))
+
+	// A cgroup in a regular filesystem is not removable, because it is not empty.
+	c.removeExecCgroup("probe", false)
+	require.DirExists(t, dir)
+}
@@ -0,0 +1,151 @@
+package lxcri
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/drachenfels-de/gocapability/capability"
+	"github.com/lxc/go-lxc"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Features describes the OCI runtime spec features supported by the runtime.
+// The document has the same format as the output of `runc features`
+// (see runtime-spec features.md), so that container engines can detect them.
+type Features struct {
+	OCIVersionMin string `json:"ociVersionMin,omitempty"`
+	OCIVersionMax string `json:"ociVersionMax,omitempty"`
+	// Hooks are the supported OCI hooks.
+	Hooks []string `json:"hooks,omitempty"`
+	// MountOptions are the mount options that are recognized by liblxc.
+	MountOptions []string       `json:"mountOptions,omitempty"`
+	Linux        *LinuxFeatures `json:"linux,omitempty"`
+	// Annotations contain implementation specific information
+	// e.g the runtime and the liblxc version.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// LinuxFeatures are the supported Linux specific features.
+type LinuxFeatures struct {
+	Namespaces   []string         `json:"namespaces,omitempty"`
+	Capabilities []string         `json:"capabilities,omitempty"`
+	Cgroup       *CgroupFeatures  `json:"cgroup,omitempty"`
+	Seccomp      *SeccompFeatures `json:"seccomp,omitempty"`
+	Apparmor     *EnabledFeature  `json:"apparmor,omitempty"`
+	Selinux      *EnabledFeature  `json:"selinux,omitempty"`
+	IntelRdt     *EnabledFeature  `json:"intelRdt,omitempty"`
+}
+
+// CgroupFeatures are the supported cgroup features.
+type CgroupFeatures struct {
+	V1      bool `json:"v1"`
+	V2      bool `json:"v2"`
+	Systemd bool `json:"systemd"`
+	// SystemdUser is true if the cgroup of a systemd user instance can be used.
+	SystemdUser bool `json:"systemdUser"`
+}
+
+// SeccompFeatures are the supported seccomp features.
+type SeccompFeatures struct {
+	Enabled   bool     `json:"enabled"`
+	Actions   []string `json:"actions,omitempty"`
+	Operators []string `json:"operators,omitempty"`
+	Archs     []string `json:"archs,omitempty"`
+}
+
+// EnabledFeature is a feature that is either enabled or disabled.
+type EnabledFeature struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Annotations in Features.Annotations.
+const (
+	FeatureAnnotationRuntimeVersion = "org.linuxcontainers.lxcri.version"
+	FeatureAnnotationLXCVersion     = "org.linuxcontainers.lxc.version"
+)
+
+// featureMountOptions are the mount options recognized by liblxc (see `man 5 lxc.container.conf`).
+var featureMountOptions = []string{
+	"async", "atime", "bind", "defaults", "dev", "diratime", "dirsync", "exec",
+	"iversion", "lazytime", "mand", "noatime", "nodev", "nodiratime", "noexec",
+	"noiversion", "nolazytime", "nomand", "norelatime", "nostrictatime", "nosuid",
+	"private", "rbind", "relatime", "remount", "ro", "rprivate", "rshared", "rslave",
+	"runbindable", "rw", "shared", "slave", "strictatime", "suid", "sync", "unbindable",
+}
+
+// seccompOperators are the supported seccomp argument comparison operators.
+var seccompOperators = []specs.LinuxSeccompOperator{
+	specs.OpNotEqual, specs.OpLessThan, specs.OpLessEqual, specs.OpEqualTo,
+	specs.OpGreaterEqual, specs.OpGreaterThan, specs.OpMaskedEqual,
+}
+
+// SupportedFeatures returns the OCI runtime spec features supported by the runtime.
+// Features that are disabled in the runtime configuration (see RuntimeFeatures)
+// or by the host are reported as disabled.
+func (rt *Runtime) SupportedFeatures() *Features {
+	f := &Features{
+		OCIVersionMin: "1.0.0",
+		OCIVersionMax: specs.Version,
+		Hooks:         []string{"prestart", "createRuntime", "createContainer", "startContainer", "poststart", "poststop"},
+		MountOptions:  featureMountOptions,
+		Linux: &LinuxFeatures{
+			Namespaces:   featureNamespaces(),
+			Capabilities: featureCapabilities(),
+			Cgroup:       &CgroupFeatures{V2: true, Systemd: true},
+			Seccomp:      featureSeccomp(rt.Features.Seccomp),
+			Apparmor:     &EnabledFeature{Enabled: rt.Features.Apparmor && checkApparmor() == nil},
+			// SELinux process labels are not supported.
+			Selinux:  &EnabledFeature{},
+			IntelRdt: &EnabledFeature{},
+		},
+		Annotations: map[string]string{
+			FeatureAnnotationRuntimeVersion: BuildInfo().Version,
+			FeatureAnnotationLXCVersion:     lxc.Version(),
+		},
+	}
+	return f
+}
+
+func featureNamespaces() []string {
+	namespaces := make([]string, 0, len(namespaceMap))
+	for t := range namespaceMap {
+		namespaces = append(namespaces, string(t))
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// featureCapabilities returns the capabilities known to the runtime and the host kernel.
+func featureCapabilities() []string {
+	var caps []string
+	for _, c := range capability.List() {
+		if c > capability.CAP_LAST_CAP {
+			continue
+		}
+		caps = append(caps, "CAP_"+strings.ToUpper(c.String()))
+	}
+	return caps
+}
+
+func featureSeccomp(enabled bool) *SeccompFeatures {
+	f := &SeccompFeatures{Enabled: enabled}
+	if !enabled {
+		return f
+	}
+	for a := range seccompAction {
+		// SCMP_ACT_KILL_PROCESS is only emulated by killing the thread.
+		if a == actKillProcess {
+			continue
+		}
+		f.Actions = append(f.Actions, string(a))
+	}
+	sort.Strings(f.Actions)
+	for _, op := range seccompOperators {
+		f.Operators = append(f.Operators, string(op))
+	}
+	for a := range seccompArchSections {
+		f.Archs = append(f.Archs, string(a))
+	}
+	sort.Strings(f.Archs)
+	return f
+}
@@ -0,0 +1,36 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportedFeatures(t *testing.T) {
+	rt := &Runtime{Features: RuntimeFeatures{Seccomp: true}}
+	f := rt.SupportedFeatures()
+	require.Equal(t, specs.Version, f.OCIVersionMax)
+	require.Contains(t, f.Linux.Namespaces, "network")
+	require.NotContains(t, f.Linux.Namespaces, "time")
+	require.Contains(t, f.Linux.Capabilities, "CAP_SYS_ADMIN")
+	require.True(t, f.Linux.Cgroup.V2)
+	require.False(t, f.Linux.Cgroup.V1)
+	require.True(t, f.Linux.Seccomp.Enabled)
+	require.Equal(t, []string{
+		"SCMP_ACT_ALLOW", "SCMP_ACT_ERRNO", "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD",
+		"SCMP_ACT_LOG", "SCMP_ACT_NOTIFY", "SCMP_ACT_TRACE", "SCMP_ACT_TRAP",
+	}, f.Linux.Seccomp.Actions)
+	require.Contains(t, f.Linux.Seccomp.Archs, "SCMP_ARCH_X86_64")
+	require.False(t, f.Linux.Selinux.Enabled)
+
+	data, err := json.Marshal(f)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"ociVersionMin":"1.0.0"`)
+	require.Contains(t, string(data), `"cgroup":{"v1":false,"v2":true,"systemd":true,"systemdUser":false}`)
+
+	rt.Features.Seccomp = false
+	f = rt.SupportedFeatures()
+	require.Equal(t, &SeccompFeatures{}, f.Linux.Seccomp)
+}
@@ -0,0 +1,79 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/lxc/go-lxc"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// StatePaused is the state of a running container whose processes
+// are frozen by Runtime.Pause. The state is not defined by the
+// OCI runtime spec v1.0.2, but it is used by runc and crun.
+const StatePaused specs.ContainerState = "paused"
+
+// Pause freezes all processes of the running container.
+// The container state is StatePaused until Runtime.Resume is called.
+func (rt *Runtime) Pause(ctx context.Context, c *Container) error {
+	rt.Log.Info().Str("cid", c.ContainerID).Msg("pause container")
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != specs.StateRunning {
+		return fmt.Errorf("invalid container state. expected %q, but was %q", specs.StateRunning, state)
+	}
+	return c.freeze(ctx, true)
+}
+
+// Resume thaws all processes of a container paused by Runtime.Pause.
+func (rt *Runtime) Resume(ctx context.Context, c *Container) error {
+	rt.Log.Info().Str("cid", c.ContainerID).Msg("resume container")
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state != StatePaused {
+		return fmt.Errorf("invalid container state. expected %q, but was %q", StatePaused, state)
+	}
+	return c.freeze(ctx, false)
+}
+
+// freeze freezes (or thaws) the container cgroup using the cgroup2 freezer,
+// and waits until the kernel reports the cgroup as frozen (or thawed).
+// The liblxc freezer is used if the container has no cgroup.
+func (c *Container) freeze(ctx context.Context, freeze bool) error {
+	if c.CgroupDir == "" {
+		if freeze {
+			return c.Freeze()
+		}
+		return c.Unfreeze()
+	}
+	rootDir := filepath.Join(cgroupRoot, c.CgroupDir)
+	if err := cgroupFreeze(filepath.Join(rootDir, "cgroup.freeze"), freeze); err != nil {
+		return errorf("failed to update cgroup freezer: %w", err)
+	}
+	err := pollCgroupEvents(ctx, c.backoff, filepath.Join(rootDir, "cgroup.events"), func(ev cgroupEvents) bool {
+		return ev.frozen == freeze
+	})
+	if err != nil {
+		return errorf("failed to wait for cgroup freezer: %w", err)
+	}
+	return nil
+}
+
+// isFrozen returns true if the container cgroup is frozen.
+// The given liblxc state is used if the container has no cgroup.
+func (c *Container) isFrozen(s lxc.State) bool {
+	if c.CgroupDir == "" {
+		return s == lxc.FROZEN
+	}
+	ev, err := parseCgroupEvents(filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events"))
+	if err != nil {
+		c.Log.Debug().Msgf("failed to parse cgroup events: %s", err)
+		return false
+	}
+	return ev.frozen
+}
@@ -0,0 +1,48 @@
+package lxcri
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lxc/go-lxc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreezeCgroup(t *testing.T) {
+	root := t.TempDir()
+	prevRoot := cgroupRoot
+	cgroupRoot = root
+	defer func() { cgroupRoot = prevRoot }()
+
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "test"}}
+	c.backoff = Backoff{InitialInterval: 1}
+	dir := filepath.Join(root, "test")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.freeze"), []byte("0\n"), 0644))
+
+	// The kernel does not update cgroup.events in a tmpfs, so emulate it.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 1\n"), 0644))
+	require.NoError(t, c.freeze(context.Background(), true))
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.freeze"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(data)[:1])
+	require.True(t, c.isFrozen(lxc.RUNNING))
+
+	// freeze must wait until the cgroup is thawed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	require.Error(t, c.freeze(ctx, false))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 0\n"), 0644))
+	require.NoError(t, c.freeze(context.Background(), false))
+	require.False(t, c.isFrozen(lxc.FROZEN))
+}
+
+func TestIsFrozenWithoutCgroup(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	require.True(t, c.isFrozen(lxc.FROZEN))
+	require.False(t, c.isFrozen(lxc.RUNNING))
+}
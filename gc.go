@@ -0,0 +1,97 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// GC removes the runtime directories of stale containers and returns their IDs.
+// A container is stale if its monitor process is gone and it is stopped
+// for at least GCMinAge, e.g because the container manager crashed
+// before it deleted the container.
+// Processes left over in the container cgroup are killed.
+// Runtime directories that can not be loaded are removed, if they are older
+// than the create timeout, because they may belong to a container that is being created.
+// Containers of a newer runtime or with configuration drift are never removed.
+func (rt *Runtime) GC(ctx context.Context) ([]string, error) {
+	ids, err := rt.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		ok, err := rt.gcContainer(ctx, id)
+		if err != nil {
+			rt.Log.Warn().Str("cid", id).Msgf("failed to remove stale container: %s", err)
+			continue
+		}
+		if ok {
+			rt.Log.Info().Str("cid", id).Msg("removed stale container")
+			removed = append(removed, id)
+		}
+	}
+	return removed, nil
+}
+
+// gcContainer removes the container if it is stale.
+// It returns true if the container was removed.
+func (rt *Runtime) gcContainer(ctx context.Context, id string) (bool, error) {
+	lock, err := rt.Lock(ctx, id, true)
+	if err == ErrNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer lock.Unlock()
+
+	c, err := rt.Load(id)
+	if err == ErrNotExist || errors.Is(err, ErrNewerRuntime) || errors.Is(err, ErrConfigDrift) {
+		return false, nil
+	}
+	if err != nil {
+		info, statErr := os.Stat(filepath.Join(rt.containersDir(), id))
+		if statErr != nil {
+			return false, nil
+		}
+		if time.Since(info.ModTime()) < time.Duration(rt.Timeouts.CreateTimeout)*time.Second {
+			return false, nil
+		}
+		return true, rt.Delete(ctx, id, true)
+	}
+
+	state, err := c.ContainerState()
+	if err != nil || state != specs.StateStopped || c.isMonitorRunning() || time.Since(c.stoppedAt()) < time.Duration(rt.GCMinAge)*time.Second {
+		if err := c.Release(); err != nil {
+			c.Log.Warn().Msgf("failed to release container: %s", err)
+		}
+		return false, err
+	}
+	// The container init process is gone, but processes it spawned
+	// may still run in the container cgroup.
+	if err := c.kill(ctx, unix.SIGKILL); err != nil {
+		c.Log.Warn().Msgf("failed to kill leftover processes: %s", err)
+	}
+	return true, c.Delete(ctx, true)
+}
+
+// stoppedAt returns the time the exit status was recorded,
+// or the last modification of the runtime directory if there is no exit status.
+func (c *Container) stoppedAt() time.Time {
+	if status, err := c.ExitStatus(); err == nil {
+		return status.ExitedAt
+	}
+	if info, err := os.Stat(c.RuntimePath()); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
@@ -0,0 +1,23 @@
+package lxcri
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerStoppedAt(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{}, runtimeDir: t.TempDir()}
+
+	// Without exit status the runtime directory modification time is used.
+	dirTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(c.RuntimePath(), dirTime, dirTime))
+	require.True(t, dirTime.Equal(c.stoppedAt()))
+
+	exitTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	require.NoError(t, os.WriteFile(c.RuntimePath(exitStatusFile), []byte("0\n"), 0440))
+	require.NoError(t, os.Chtimes(c.RuntimePath(exitStatusFile), exitTime, exitTime))
+	require.True(t, exitTime.Equal(c.stoppedAt()))
+}
@@ -0,0 +1,301 @@
+package lxcri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Health check annotations (see HealthCheck).
+// The command is executed with `/bin/sh -c` within the container.
+// The durations are in the format accepted by time.ParseDuration e.g `30s`.
+const (
+	AnnotationHealthCmd      = "lxcri.health-cmd"
+	AnnotationHealthInterval = "lxcri.health-interval"
+	AnnotationHealthTimeout  = "lxcri.health-timeout"
+	AnnotationHealthRetries  = "lxcri.health-retries"
+)
+
+// Health status values (see Health).
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Health check defaults.
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 30 * time.Second
+	DefaultHealthRetries  = 3
+)
+
+// healthFile is the file in the container runtime directory
+// that records the health status.
+const healthFile = "health.json"
+
+// HealthCheck is a probe executed periodically within the running container
+// (see ReloadableRuntime.MonitorHealth). The container is healthy if the command exits with 0.
+type HealthCheck struct {
+	// Cmd is the probe command and its arguments.
+	Cmd []string
+	// Interval is the time between two probes.
+	Interval time.Duration `json:",omitempty"`
+	// Timeout is the maximum duration of a probe.
+	// The probe process is killed and the probe fails if it does not exit in time.
+	Timeout time.Duration `json:",omitempty"`
+	// StartPeriod is the initialization time of the container process.
+	// Failed probes within the start period do not count as retries.
+	StartPeriod time.Duration `json:",omitempty"`
+	// Retries is the number of consecutive failed probes
+	// until the container is unhealthy.
+	Retries int `json:",omitempty"`
+	// KillUnhealthy kills the container when it becomes unhealthy.
+	// The kill does not stop the container explicitly, so the container
+	// is restarted according to its ContainerConfig.RestartPolicy
+	// (see ReloadableRuntime.MonitorRestarts).
+	KillUnhealthy bool `json:",omitempty"`
+}
+
+// Health is the health status of a container with a HealthCheck.
+type Health struct {
+	// Status is one of HealthStarting, HealthHealthy or HealthUnhealthy.
+	Status string
+	// FailingStreak is the number of consecutive failed probes.
+	FailingStreak int
+	// LastCheck is the time of the last probe.
+	LastCheck time.Time `json:",omitempty"`
+	// ExitCode is the exit code of the last probe.
+	ExitCode int
+	// Error is the reason why the last probe could not be executed.
+	Error string `json:",omitempty"`
+}
+
+// configureHealthCheck merges the health check annotations into ContainerConfig.HealthCheck
+// and sets the defaults.
+func configureHealthCheck(c *Container) error {
+	a := c.Spec.Annotations
+	if cmd := a[AnnotationHealthCmd]; cmd != "" {
+		if c.HealthCheck == nil {
+			c.HealthCheck = new(HealthCheck)
+		}
+		c.HealthCheck.Cmd = []string{"/bin/sh", "-c", cmd}
+	}
+	hc := c.HealthCheck
+	if hc == nil {
+		return nil
+	}
+	if len(hc.Cmd) == 0 {
+		return fmt.Errorf("health check command is empty")
+	}
+	for annotation, d := range map[string]*time.Duration{
+		AnnotationHealthInterval: &hc.Interval,
+		AnnotationHealthTimeout:  &hc.Timeout,
+	} {
+		if val, ok := a[annotation]; ok {
+			v, err := time.ParseDuration(val)
+			if err != nil || v <= 0 {
+				return fmt.Errorf("invalid value for annotation %s: %q", annotation, val)
+			}
+			*d = v
+		}
+	}
+	if val, ok := a[AnnotationHealthRetries]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid value for annotation %s: %q", AnnotationHealthRetries, val)
+		}
+		hc.Retries = n
+	}
+
+	if hc.Interval == 0 {
+		hc.Interval = DefaultHealthInterval
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = DefaultHealthTimeout
+	}
+	if hc.Retries == 0 {
+		hc.Retries = DefaultHealthRetries
+	}
+	return nil
+}
+
+// Health returns the health status of the container.
+// ErrNotExist is returned if the container has no HealthCheck.
+// The status is HealthStarting until the first probe completed.
+func (c *Container) Health() (*Health, error) {
+	if c.HealthCheck == nil {
+		return nil, ErrNotExist
+	}
+	h := &Health{Status: HealthStarting}
+	data, err := os.ReadFile(c.RuntimePath(healthFile))
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h, json.Unmarshal(data, h)
+}
+
+// CheckHealth executes the health check probe of the running container,
+// and records the updated health status, which is returned.
+func (c *Container) CheckHealth(ctx context.Context) (*Health, error) {
+	h, err := c.Health()
+	if err != nil {
+		return nil, err
+	}
+	state, err := c.ContainerState()
+	if err != nil {
+		return nil, err
+	}
+	if state != specs.StateRunning {
+		return nil, fmt.Errorf("invalid container state. expected %q, but was %q", specs.StateRunning, state)
+	}
+
+	hc := c.HealthCheck
+	probeCtx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+	proc := *c.Spec.Process
+	proc.Args = hc.Cmd
+	proc.Terminal = false
+	code, err := c.ExecContext(probeCtx, &proc, nil)
+
+	now := time.Now()
+	h.LastCheck = now
+	h.ExitCode = code
+	h.Error = ""
+	if err != nil {
+		h.Error = err.Error()
+	}
+	h.update(err == nil && code == 0, hc.Retries, now.Before(c.CreatedAt.Add(hc.StartPeriod)))
+
+	if err := specki.EncodeJSONFile(c.RuntimePath(healthFile), h, os.O_CREATE|os.O_TRUNC, 0640); err != nil {
+		return nil, fmt.Errorf("failed to write health status: %w", err)
+	}
+	return h, nil
+}
+
+// update updates the status with the result of a probe.
+// Failed probes within the start period do not count as retries.
+func (h *Health) update(success bool, retries int, starting bool) {
+	if success {
+		h.Status = HealthHealthy
+		h.FailingStreak = 0
+		return
+	}
+	if starting {
+		return
+	}
+	h.FailingStreak++
+	if h.FailingStreak >= retries {
+		h.Status = HealthUnhealthy
+	}
+}
+
+// MonitorHealth executes the health check probes of all running containers
+// with a HealthCheck until the context is done (see Container.CheckHealth).
+// The containers are scanned for due probes in the given interval.
+// Every scan uses the current runtime snapshot (see ReloadableRuntime.Acquire).
+// Only one MonitorHealth instance must run per runtime root.
+func (r *ReloadableRuntime) MonitorHealth(ctx context.Context, interval time.Duration) {
+	var mu sync.Mutex
+	running := make(map[string]bool)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rt, release := r.Acquire()
+			var wg sync.WaitGroup
+			rt.startHealthChecks(ctx, now, &mu, running, &wg)
+			// The snapshot is released when the started probes are done.
+			go func() {
+				wg.Wait()
+				release()
+			}()
+		}
+	}
+}
+
+// startHealthChecks starts the due health check probes.
+// Containers in running are skipped. The map is protected by mu.
+func (rt *Runtime) startHealthChecks(ctx context.Context, now time.Time, mu *sync.Mutex, running map[string]bool, wg *sync.WaitGroup) {
+	ids, err := rt.List()
+	if err != nil {
+		rt.Log.Error().Msgf("failed to list containers: %s", err)
+		return
+	}
+	for _, id := range ids {
+		mu.Lock()
+		busy := running[id]
+		mu.Unlock()
+		if busy {
+			continue
+		}
+		c, err := rt.Load(id)
+		if err != nil {
+			rt.Log.Debug().Str("cid", id).Msgf("skipping container: %s", err)
+			continue
+		}
+		if !rt.healthCheckDue(c, now) {
+			c.Release()
+			continue
+		}
+		mu.Lock()
+		running[id] = true
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer func() {
+				c.Release()
+				mu.Lock()
+				delete(running, c.ContainerID)
+				mu.Unlock()
+				wg.Done()
+			}()
+			rt.checkHealth(ctx, c)
+		}()
+	}
+}
+
+func (rt *Runtime) healthCheckDue(c *Container, now time.Time) bool {
+	h, err := c.Health()
+	if err != nil {
+		return false
+	}
+	if state, err := c.ContainerState(); err != nil || state != specs.StateRunning {
+		return false
+	}
+	return now.Sub(h.LastCheck) >= c.HealthCheck.Interval
+}
+
+func (rt *Runtime) checkHealth(ctx context.Context, c *Container) {
+	prev, _ := c.Health()
+	h, err := c.CheckHealth(ctx)
+	if err != nil {
+		c.Log.Warn().Msgf("health check failed: %s", err)
+		return
+	}
+	if prev != nil && prev.Status == h.Status {
+		return
+	}
+	c.Log.Info().Str("health", h.Status).Int("exit", h.ExitCode).Msg("health status changed")
+	if h.Status == HealthUnhealthy && c.HealthCheck.KillUnhealthy {
+		// Runtime.Kill would mark the container as stopped explicitly.
+		if err := c.kill(ctx, unix.SIGKILL); err != nil {
+			c.Log.Error().Msgf("failed to kill unhealthy container: %s", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package lxcri
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureHealthCheck(t *testing.T) {
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: spec}}
+	require.NoError(t, configureHealthCheck(c))
+	require.Nil(t, c.HealthCheck)
+
+	spec.Annotations = map[string]string{
+		AnnotationHealthCmd:      "curl -f http://localhost/",
+		AnnotationHealthInterval: "10s",
+		AnnotationHealthRetries:  "5",
+	}
+	require.NoError(t, configureHealthCheck(c))
+	require.Equal(t, &HealthCheck{
+		Cmd:      []string{"/bin/sh", "-c", "curl -f http://localhost/"},
+		Interval: 10 * time.Second,
+		Timeout:  DefaultHealthTimeout,
+		Retries:  5,
+	}, c.HealthCheck)
+
+	spec.Annotations[AnnotationHealthTimeout] = "-1s"
+	require.Error(t, configureHealthCheck(c))
+
+	c.HealthCheck = &HealthCheck{}
+	spec.Annotations = nil
+	require.Error(t, configureHealthCheck(c))
+}
+
+func TestHealthUpdate(t *testing.T) {
+	h := &Health{Status: HealthStarting}
+
+	// failed checks within the start period are not counted
+	h.update(false, 2, true)
+	require.Equal(t, &Health{Status: HealthStarting}, h)
+
+	h.update(false, 2, false)
+	require.Equal(t, &Health{Status: HealthStarting, FailingStreak: 1}, h)
+	h.update(false, 2, false)
+	require.Equal(t, &Health{Status: HealthUnhealthy, FailingStreak: 2}, h)
+
+	h.update(true, 2, false)
+	require.Equal(t, &Health{Status: HealthHealthy}, h)
+	h.update(false, 2, false)
+	require.Equal(t, &Health{Status: HealthHealthy, FailingStreak: 1}, h)
+}
+
+func TestContainerHealth(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{}, runtimeDir: t.TempDir()}
+	_, err := c.Health()
+	require.Equal(t, ErrNotExist, err)
+
+	c.HealthCheck = &HealthCheck{Cmd: []string{"true"}}
+	h, err := c.Health()
+	require.NoError(t, err)
+	require.Equal(t, HealthStarting, h.Status)
+
+	now := time.Now().UTC().Round(time.Second)
+	err = specki.EncodeJSONFile(c.RuntimePath(healthFile), &Health{Status: HealthUnhealthy, FailingStreak: 3, LastCheck: now, ExitCode: 1}, os.O_CREATE|os.O_TRUNC, 0640)
+	require.NoError(t, err)
+	h, err = c.Health()
+	require.NoError(t, err)
+	require.Equal(t, &Health{Status: HealthUnhealthy, FailingStreak: 3, LastCheck: now, ExitCode: 1}, h)
+}
@@ -0,0 +1,277 @@
+package lxcri
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lxc/lxcri/pkg/specki"
+)
+
+// HookFunc is a callback function that is executed within the container lifecycle.
+type HookFunc func(ctx context.Context, c *Container) error
+
+// HookPhase is the container lifecycle phase a Hook is executed in.
+type HookPhase string
+
+const (
+	// HookCreate hooks are called by Runtime.Create after the runtime directory
+	// is created and before the container is configured.
+	// Modifications of the container spec (Container.Spec) are applied
+	// to the container.
+	HookCreate HookPhase = "create"
+	// HookStart hooks are called by Runtime.Start before lxcri-init is unblocked
+	// to execute the container process.
+	HookStart HookPhase = "start"
+	// HookStopped hooks are called once after the runtime detected the exit
+	// of the container init process, either by Runtime.Wait or
+	// by Container.Delete. Errors are logged but do not abort the operation.
+	HookStopped HookPhase = "stopped"
+	// HookDelete hooks are called by Container.Delete after the container is stopped
+	// and before the container, its cgroup and the runtime directory are removed.
+	// If a HookFailFast hook fails, nothing is removed and Delete can be retried.
+	HookDelete HookPhase = "delete"
+)
+
+var hookPhases = []HookPhase{HookCreate, HookStart, HookStopped, HookDelete}
+
+// HookPolicy defines how the failure of a Hook is handled.
+type HookPolicy int
+
+const (
+	// HookFailFast aborts the lifecycle operation if the hook fails.
+	// The remaining hooks of the phase are not executed.
+	HookFailFast HookPolicy = iota
+	// HookWarn logs the failure of the hook as warning, and continues
+	// with the next hook.
+	HookWarn
+)
+
+// Hook is a named HookFunc that is registered for a lifecycle phase.
+type Hook struct {
+	// Name identifies the hook within its phase.
+	Name string
+	// Phase is the lifecycle phase the hook is executed in.
+	Phase HookPhase
+	// Order defines the execution order within the phase.
+	// Hooks with a lower order are executed first, hooks with
+	// the same order are executed in the order of registration.
+	Order int
+	// Policy defines how a failure of the hook is handled.
+	Policy HookPolicy
+	// Func is the hook function.
+	Func HookFunc
+}
+
+// LifecycleHooks is a registry of the hooks executed by the runtime
+// within the container lifecycle. Unlike OCI hooks (specs.Hooks) they
+// are executed within the runtime process, and not persisted.
+// Hooks must be registered before containers are created or loaded,
+// the registry is not safe for concurrent modification.
+// See package github.com/lxc/lxcri/pkg/hooks for ready-made HookFuncs.
+type LifecycleHooks struct {
+	hooks []Hook
+}
+
+// RegisterHook registers the hook for its phase.
+// An error is returned if the phase is unknown, the hook has no name or function,
+// or if a hook with the same name is already registered for the phase.
+func (r *LifecycleHooks) RegisterHook(h Hook) error {
+	if !isHookPhase(h.Phase) {
+		return fmt.Errorf("invalid hook %q: unknown phase %q", h.Name, h.Phase)
+	}
+	if h.Name == "" {
+		return fmt.Errorf("invalid %s hook: missing name", h.Phase)
+	}
+	if h.Func == nil {
+		return fmt.Errorf("invalid %s hook %q: missing function", h.Phase, h.Name)
+	}
+	for _, other := range r.hooks {
+		if other.Phase == h.Phase && other.Name == h.Name {
+			return fmt.Errorf("%s hook %q is already registered", h.Phase, h.Name)
+		}
+	}
+	r.hooks = append(r.hooks, h)
+	return nil
+}
+
+// UnregisterHook removes the hook with the given name from the phase.
+// It returns false if no such hook is registered.
+func (r *LifecycleHooks) UnregisterHook(phase HookPhase, name string) bool {
+	for i, h := range r.hooks {
+		if h.Phase == phase && h.Name == name {
+			r.hooks = append(r.hooks[:i:i], r.hooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PhaseHooks returns the hooks registered for the phase in execution order.
+func (r *LifecycleHooks) PhaseHooks(phase HookPhase) []Hook {
+	if r == nil {
+		return nil
+	}
+	var hooks []Hook
+	for _, h := range r.hooks {
+		if h.Phase == phase {
+			hooks = append(hooks, h)
+		}
+	}
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Order < hooks[j].Order
+	})
+	return hooks
+}
+
+// run executes the hooks of the phase in order.
+// It returns the error of the first failed HookFailFast hook.
+func (r *LifecycleHooks) run(ctx context.Context, phase HookPhase, c *Container) error {
+	for _, h := range r.PhaseHooks(phase) {
+		err := h.Func(ctx, c)
+		if err == nil {
+			continue
+		}
+		if h.Policy == HookWarn {
+			c.Log.Warn().Str("hook", h.Name).Msgf("%s hook failed: %s", phase, err)
+			continue
+		}
+		return fmt.Errorf("%s hook %q failed: %w", phase, h.Name, err)
+	}
+	return nil
+}
+
+func isHookPhase(phase HookPhase) bool {
+	for _, p := range hookPhases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// onStoppedFile records that the HookStopped hooks were called.
+const onStoppedFile = "on-stopped"
+
+// runOnStopped calls the HookStopped hooks, if they were not yet called for the container.
+func (c *Container) runOnStopped(ctx context.Context) {
+	if len(c.hooks.PhaseHooks(HookStopped)) == 0 {
+		return
+	}
+	f, err := os.OpenFile(c.RuntimePath(onStoppedFile), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0440)
+	if os.IsExist(err) {
+		return
+	}
+	if err != nil {
+		c.Log.Warn().Msgf("failed to record stopped hooks: %s", err)
+		return
+	}
+	f.Close()
+	if err := c.hooks.run(ctx, HookStopped, c); err != nil {
+		c.Log.Warn().Msgf("%s", err)
+	}
+}
+
+// hookResultsFile is written by lxcri-hook.
+// It contains the results of the executed OCI hooks as JSON lines.
+const hookResultsFile = "hooks-result.json"
+
+// maxHookErrorOutput is the maximum length of the hook output tail
+// included in the error returned by Runtime.Create.
+const maxHookErrorOutput = 512
+
+// HookResults returns the results of the OCI hooks executed by liblxc
+// (prestart, createRuntime and createContainer hooks) in execution order.
+// ErrNotExist is returned if no hook results were recorded.
+func (c *Container) HookResults() ([]specki.HookResult, error) {
+	// #nosec
+	data, err := os.ReadFile(c.RuntimePath(hookResultsFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseHookResults(data)
+}
+
+func parseHookResults(data []byte) ([]specki.HookResult, error) {
+	var results []specki.HookResult
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var res specki.HookResult
+		err := dec.Decode(&res)
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return results, fmt.Errorf("invalid hook result: %w", err)
+		}
+		results = append(results, res)
+	}
+}
+
+// hookError logs the results of the failed hooks and
+// returns an error that describes the first failed hook, or nil
+// if no hook failed.
+func (c *Container) hookError() error {
+	results, err := c.HookResults()
+	if err != nil {
+		if err != ErrNotExist {
+			c.Log.Warn().Msgf("failed to read hook results: %s", err)
+		}
+		return nil
+	}
+	var failed *specki.HookResult
+	for i, res := range results {
+		if res.Error == "" {
+			continue
+		}
+		c.Log.Error().Str("hook", res.Path).Int("exit", res.ExitCode).
+			Dur("duration", res.Duration).Str("output", res.Output).
+			Bool("best-effort", res.BestEffort).
+			Msgf("hook failed: %s", res.Error)
+		if failed == nil && !res.BestEffort {
+			failed = &results[i]
+		}
+	}
+	if failed == nil {
+		return nil
+	}
+	return fmt.Errorf("hook %s failed (exit code %d): %s", failed.Path, failed.ExitCode, outputTail(failed.Output, maxHookErrorOutput))
+}
+
+// outputTail returns the last (at most) max bytes of the trimmed output.
+func outputTail(output string, max int) string {
+	output = strings.TrimSpace(output)
+	if len(output) > max {
+		return "..." + output[len(output)-max:]
+	}
+	return output
+}
+
+// failedBestEffortHooks logs the failed best-effort hooks
+// and returns the number of failed best-effort hooks.
+func (c *Container) failedBestEffortHooks() int {
+	results, err := c.HookResults()
+	if err != nil {
+		if err != ErrNotExist {
+			c.Log.Warn().Msgf("failed to read hook results: %s", err)
+		}
+		return 0
+	}
+	n := 0
+	for _, res := range results {
+		if res.BestEffort && res.Error != "" {
+			c.Log.Warn().Str("hook", res.Path).Int("exit", res.ExitCode).
+				Str("output", res.Output).Msgf("best-effort hook failed: %s", res.Error)
+			n++
+		}
+	}
+	return n
+}
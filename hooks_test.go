@@ -0,0 +1,94 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHookResults(t *testing.T) {
+	data := []byte(`{"Path":"/bin/true","ExitCode":0,"Duration":1000}
+{"Path":"/bin/false","ExitCode":1,"Output":"failed\n","Error":"exit status 1","Duration":2000}
+{"Path":"/bin/false","ExitCode":1,"Error":"exit status 1","Duration":2000,"BestEffort":true}
+`)
+	results, err := parseHookResults(data)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, "/bin/false", results[1].Path)
+	require.Equal(t, 1, results[1].ExitCode)
+	require.Equal(t, "failed\n", results[1].Output)
+	require.False(t, results[1].BestEffort)
+	require.True(t, results[2].BestEffort)
+
+	_, err = parseHookResults([]byte("{"))
+	require.Error(t, err)
+
+	results, err = parseHookResults(nil)
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestOutputTail(t *testing.T) {
+	require.Equal(t, "abc", outputTail(" abc\n", 5))
+	require.Equal(t, "...def", outputTail("abcdef\n", 3))
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	var r LifecycleHooks
+	var calls []string
+	hook := func(name string, err error) HookFunc {
+		return func(ctx context.Context, c *Container) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	require.NoError(t, r.RegisterHook(Hook{Name: "b", Phase: HookCreate, Order: 10, Func: hook("b", nil)}))
+	require.NoError(t, r.RegisterHook(Hook{Name: "c", Phase: HookCreate, Order: 10, Policy: HookWarn, Func: hook("c", fmt.Errorf("failed"))}))
+	require.NoError(t, r.RegisterHook(Hook{Name: "a", Phase: HookCreate, Func: hook("a", nil)}))
+	require.NoError(t, r.RegisterHook(Hook{Name: "a", Phase: HookDelete, Func: hook("delete", fmt.Errorf("failed"))}))
+	require.NoError(t, r.RegisterHook(Hook{Name: "d", Phase: HookDelete, Func: hook("d", nil)}))
+
+	require.Error(t, r.RegisterHook(Hook{Name: "a", Phase: HookCreate, Func: hook("a", nil)}))
+	require.Error(t, r.RegisterHook(Hook{Name: "x", Phase: "unknown", Func: hook("x", nil)}))
+	require.Error(t, r.RegisterHook(Hook{Phase: HookStart, Func: hook("x", nil)}))
+	require.Error(t, r.RegisterHook(Hook{Name: "x", Phase: HookStart}))
+
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	require.NoError(t, r.run(context.Background(), HookCreate, c))
+	require.Equal(t, []string{"a", "b", "c"}, calls)
+
+	// a failed HookFailFast hook aborts the phase
+	calls = nil
+	require.Error(t, r.run(context.Background(), HookDelete, c))
+	require.Equal(t, []string{"delete"}, calls)
+
+	require.True(t, r.UnregisterHook(HookDelete, "a"))
+	require.False(t, r.UnregisterHook(HookDelete, "a"))
+	calls = nil
+	require.NoError(t, r.run(context.Background(), HookDelete, c))
+	require.Equal(t, []string{"d"}, calls)
+	require.Len(t, r.PhaseHooks(HookCreate), 3)
+
+	var nilHooks *LifecycleHooks
+	require.NoError(t, nilHooks.run(context.Background(), HookStart, c))
+}
+
+func TestRunOnStopped(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{}, runtimeDir: t.TempDir()}
+	// noop without hook
+	c.runOnStopped(context.Background())
+
+	calls := 0
+	c.hooks = &LifecycleHooks{}
+	err := c.hooks.RegisterHook(Hook{Name: "test", Phase: HookStopped, Func: func(ctx context.Context, c *Container) error {
+		calls++
+		return fmt.Errorf("hook failed")
+	}})
+	require.NoError(t, err)
+	c.runOnStopped(context.Background())
+	c.runOnStopped(context.Background())
+	require.Equal(t, 1, calls)
+	require.FileExists(t, c.RuntimePath(onStoppedFile))
+}
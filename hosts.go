@@ -0,0 +1,100 @@
+package lxcri
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// AnnotationExtraHosts are additional /etc/hosts entries (comma separated)
+// in the format `<hostname>:<ip>` e.g `db:10.0.0.5,registry:fd00::1`.
+// See ContainerConfig.ExtraHosts.
+const AnnotationExtraHosts = "lxcri.extra-hosts"
+
+// hostnameIP is the address of the container hostname in /etc/hosts.
+// The container IP address is unknown at create time, because the network
+// is usually configured afterwards, e.g by CNI plugins.
+const hostnameIP = "127.0.1.1"
+
+const etcHosts = "/etc/hosts"
+
+// HostEntry is an /etc/hosts entry.
+type HostEntry struct {
+	Hostname string
+	IP       string
+}
+
+// ParseHostEntry parses a host entry in the format `<hostname>:<ip>`.
+// The IP address may be an IPv6 address (which contains colons).
+func ParseHostEntry(s string) (HostEntry, error) {
+	i := strings.Index(s, ":")
+	if i < 1 {
+		return HostEntry{}, fmt.Errorf("invalid host entry %q", s)
+	}
+	h := HostEntry{Hostname: s[:i], IP: strings.Trim(s[i+1:], "[]")}
+	if net.ParseIP(h.IP) == nil {
+		return HostEntry{}, fmt.Errorf("invalid IP address in host entry %q", s)
+	}
+	return h, nil
+}
+
+// configureHosts bind mounts a runtime managed /etc/hosts into the container,
+// if Runtime.ManageHosts is enabled or extra hosts are defined
+// (see ContainerConfig.ExtraHosts and AnnotationExtraHosts).
+// The container spec takes precedence, nothing is done if the spec mounts /etc/hosts.
+func configureHosts(rt *Runtime, c *Container) error {
+	extraHosts := c.ExtraHosts
+	if val := c.Spec.Annotations[AnnotationExtraHosts]; val != "" {
+		for _, s := range strings.Split(val, ",") {
+			h, err := ParseHostEntry(strings.TrimSpace(s))
+			if err != nil {
+				return err
+			}
+			extraHosts = append(extraHosts, h)
+		}
+	}
+	if !rt.ManageHosts && len(extraHosts) == 0 {
+		return nil
+	}
+	if hasMountDestination(c.Spec, etcHosts) {
+		if len(extraHosts) > 0 {
+			c.warnf("ExtraHostsIgnored", "extra hosts are ignored - spec mounts %s", etcHosts)
+		}
+		return nil
+	}
+	for _, h := range extraHosts {
+		if h.Hostname == "" || net.ParseIP(h.IP) == nil {
+			return fmt.Errorf("invalid host entry %s:%s", h.Hostname, h.IP)
+		}
+	}
+
+	filename := c.RuntimePath("hosts")
+	// #nosec
+	if err := os.WriteFile(filename, hostsFile(c.Spec.Hostname, extraHosts), 0444); err != nil {
+		return err
+	}
+	c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+		Source:      filename,
+		Destination: etcHosts,
+		Type:        "bind",
+		Options:     []string{"bind", "ro", "nosuid", "nodev", "noexec", "create=file"},
+	})
+	return nil
+}
+
+func hostsFile(hostname string, extraHosts []HostEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString("127.0.0.1\tlocalhost\n")
+	b.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if hostname != "" {
+		fmt.Fprintf(&b, "%s\t%s\n", hostnameIP, hostname)
+	}
+	for _, h := range extraHosts {
+		fmt.Fprintf(&b, "%s\t%s\n", h.IP, h.Hostname)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,37 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostEntry(t *testing.T) {
+	h, err := ParseHostEntry("db:10.0.0.5")
+	require.NoError(t, err)
+	require.Equal(t, HostEntry{Hostname: "db", IP: "10.0.0.5"}, h)
+
+	h, err = ParseHostEntry("registry:fd00::1")
+	require.NoError(t, err)
+	require.Equal(t, HostEntry{Hostname: "registry", IP: "fd00::1"}, h)
+
+	h, err = ParseHostEntry("registry:[fd00::1]")
+	require.NoError(t, err)
+	require.Equal(t, "fd00::1", h.IP)
+
+	for _, s := range []string{"db", ":10.0.0.5", "db:", "db:10.0.0"} {
+		_, err := ParseHostEntry(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestHostsFile(t *testing.T) {
+	data := hostsFile("c1", []HostEntry{{Hostname: "db", IP: "10.0.0.5"}})
+	require.Equal(t, "127.0.0.1\tlocalhost\n"+
+		"::1\tlocalhost ip6-localhost ip6-loopback\n"+
+		"127.0.1.1\tc1\n"+
+		"10.0.0.5\tdb\n", string(data))
+
+	data = hostsFile("", nil)
+	require.Equal(t, "127.0.0.1\tlocalhost\n::1\tlocalhost ip6-localhost ip6-loopback\n", string(data))
+}
@@ -0,0 +1,142 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// HugepageMount is a hugetlbfs mount within the container.
+type HugepageMount struct {
+	// PageSize is the huge page size in the format of
+	// specs.LinuxHugepageLimit.Pagesize e.g `2MB` or `1GB`.
+	PageSize string
+	// Destination is the absolute mount path within the container.
+	Destination string
+	// Size is the maximum size of the filesystem e.g `1GB`.
+	// The size defaults to the hugetlb cgroup limit (specs.LinuxHugepageLimit)
+	// for the page size. The size is unlimited if both are unset.
+	Size string `json:",omitempty"`
+}
+
+// parseHugepageMounts parses the value of AnnotationHugepages.
+func parseHugepageMounts(val string) ([]HugepageMount, error) {
+	var mounts []HugepageMount
+	for _, s := range strings.Split(val, ",") {
+		fields := strings.Split(strings.TrimSpace(s), ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid hugepage mount %q: expected <pagesize>:<path>[:<size>]", s)
+		}
+		m := HugepageMount{PageSize: fields[0], Destination: fields[1]}
+		if len(fields) == 3 {
+			m.Size = fields[2]
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// parseByteSize parses sizes with an optional binary unit suffix,
+// e.g `2MB`, `2M` or `2097152` (all 2 MiB).
+func parseByteSize(s string) (uint64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	var shift uint
+	if n := len(num); n > 0 {
+		switch num[n-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		case 'T':
+			shift = 40
+		}
+		if shift > 0 {
+			num = num[:n-1]
+		}
+	}
+	v, err := strconv.ParseUint(num, 10, 64)
+	if err != nil || v == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if v > (1<<64-1)>>shift {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return v << shift, nil
+}
+
+// hugepageLimit returns the hugetlb cgroup limit for the given page size
+// or 0 if there is no limit.
+func hugepageLimit(spec *specs.Spec, pageSize uint64) uint64 {
+	if spec.Linux == nil || spec.Linux.Resources == nil {
+		return 0
+	}
+	for _, l := range spec.Linux.Resources.HugepageLimits {
+		if ps, err := parseByteSize(l.Pagesize); err == nil && ps == pageSize {
+			return l.Limit
+		}
+	}
+	return 0
+}
+
+// hugepageMount returns the hugetlbfs mount for m.
+func hugepageMount(spec *specs.Spec, m HugepageMount) (specs.Mount, error) {
+	if !strings.HasPrefix(m.Destination, "/") {
+		return specs.Mount{}, fmt.Errorf("hugepage mount destination %q is not absolute", m.Destination)
+	}
+	pageSize, err := parseByteSize(m.PageSize)
+	if err != nil {
+		return specs.Mount{}, fmt.Errorf("invalid hugepage size: %w", err)
+	}
+	size := hugepageLimit(spec, pageSize)
+	if m.Size != "" {
+		size, err = parseByteSize(m.Size)
+		if err != nil {
+			return specs.Mount{}, fmt.Errorf("invalid hugepage mount size: %w", err)
+		}
+	}
+	opts := []string{"nosuid", "nodev", "noexec", fmt.Sprintf("pagesize=%d", pageSize)}
+	if size > 0 {
+		if size%pageSize != 0 {
+			return specs.Mount{}, fmt.Errorf("hugepage mount size %d is not a multiple of the page size %d", size, pageSize)
+		}
+		opts = append(opts, fmt.Sprintf("size=%d", size))
+	}
+	return specs.Mount{Destination: m.Destination, Type: "hugetlbfs", Source: "hugetlbfs", Options: opts}, nil
+}
+
+// configureHugepageMounts adds the hugetlbfs mounts from ContainerConfig.HugepageMounts
+// and AnnotationHugepages to the container spec.
+func configureHugepageMounts(c *Container) error {
+	hugepageMounts := append([]HugepageMount{}, c.HugepageMounts...)
+	if val := c.Spec.Annotations[AnnotationHugepages]; val != "" {
+		parsed, err := parseHugepageMounts(val)
+		if err != nil {
+			return err
+		}
+		hugepageMounts = append(hugepageMounts, parsed...)
+	}
+	for _, hm := range hugepageMounts {
+		m, err := hugepageMount(c.Spec, hm)
+		if err != nil {
+			return err
+		}
+		pageSize, _ := parseByteSize(hm.PageSize)
+		sysDir := fmt.Sprintf("/sys/kernel/mm/hugepages/hugepages-%dkB", pageSize>>10)
+		if _, err := os.Stat(sysDir); err != nil {
+			return fmt.Errorf("huge page size %s is not supported by the host: %w", hm.PageSize, err)
+		}
+		if hugepageLimit(c.Spec, pageSize) == 0 {
+			c.warnf("HugepageUnlimited", "no hugetlb cgroup limit for page size %s mounted at %s", hm.PageSize, hm.Destination)
+		}
+		if isNamespaceEnabled(c.Spec, specs.UserNamespace) {
+			c.warnf("HugepageMountUserns", "hugetlbfs can not be mounted in a user namespace - mounting %s may fail", hm.Destination)
+		}
+		c.Spec.Mounts = append(c.Spec.Mounts, m)
+	}
+	return nil
+}
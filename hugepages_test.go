@@ -0,0 +1,57 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for s, v := range map[string]uint64{
+		"2MB":     2 << 20,
+		"2m":      2 << 20,
+		"1GB":     1 << 30,
+		"64KB":    64 << 10,
+		"2097152": 2 << 20,
+	} {
+		n, err := parseByteSize(s)
+		require.NoError(t, err, s)
+		require.Equal(t, v, n, s)
+	}
+	for _, s := range []string{"", "MB", "0", "-1M", "2XB", "99999999999T"} {
+		_, err := parseByteSize(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestHugepageMount(t *testing.T) {
+	mounts, err := parseHugepageMounts("2MB:/dev/hugepages, 1GB:/mnt/huge:2GB")
+	require.NoError(t, err)
+	require.Equal(t, []HugepageMount{
+		{PageSize: "2MB", Destination: "/dev/hugepages"},
+		{PageSize: "1GB", Destination: "/mnt/huge", Size: "2GB"},
+	}, mounts)
+
+	_, err = parseHugepageMounts("2MB")
+	require.Error(t, err)
+
+	spec := &specs.Spec{Linux: &specs.Linux{Resources: &specs.LinuxResources{
+		HugepageLimits: []specs.LinuxHugepageLimit{{Pagesize: "2MB", Limit: 64 << 20}},
+	}}}
+
+	// size defaults to the hugetlb limit
+	m, err := hugepageMount(spec, mounts[0])
+	require.NoError(t, err)
+	require.Equal(t, "hugetlbfs", m.Type)
+	require.Equal(t, []string{"nosuid", "nodev", "noexec", "pagesize=2097152", "size=67108864"}, m.Options)
+
+	m, err = hugepageMount(spec, mounts[1])
+	require.NoError(t, err)
+	require.Equal(t, []string{"nosuid", "nodev", "noexec", "pagesize=1073741824", "size=2147483648"}, m.Options)
+
+	_, err = hugepageMount(spec, HugepageMount{PageSize: "1GB", Destination: "/mnt", Size: "1536MB"})
+	require.Error(t, err)
+	_, err = hugepageMount(spec, HugepageMount{PageSize: "2MB", Destination: "mnt"})
+	require.Error(t, err)
+}
@@ -62,15 +62,21 @@ func configureInit(rt *Runtime, c *Container) error {
 		return err
 	}
 
+	initSource, err := rt.resolveInit(c)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", ExecInit, err)
+	}
+	c.InitPath = initSource
+
 	// bind mount lxcri-init into the container
 	initCmdPath := c.RuntimePath("lxcri-init")
-	err := touchFile(initCmdPath, 0)
+	err = touchFile(initCmdPath, 0)
 	if err != nil {
 		return fmt.Errorf("failed to create %s: %w", initCmdPath, err)
 	}
 	initCmd := filepath.Join(initDir, "lxcri-init")
 	c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
-		Source:      rt.libexec(ExecInit),
+		Source:      initSource,
 		Destination: strings.TrimLeft(initCmd, "/"),
 		Type:        "bind",
 		//Options:     []string{"slave", "bind", "ro", "nosuid"},
@@ -109,7 +115,9 @@ func configureInitUser(rt *Runtime, c *Container) error {
 		return err
 	}
 
-	if len(c.Spec.Process.User.AdditionalGids) > 0 && c.supportsConfigItem("lxc.init.groups") {
+	if len(c.Spec.Process.User.AdditionalGids) > 0 && !c.supportsConfigItem("lxc.init.groups") {
+		c.warnf("AdditionalGidsIgnored", "lxc.init.groups is not supported - additional gids %v are ignored", c.Spec.Process.User.AdditionalGids)
+	} else if len(c.Spec.Process.User.AdditionalGids) > 0 {
 		var b strings.Builder
 		for i, gid := range c.Spec.Process.User.AdditionalGids {
 			if i > 0 {
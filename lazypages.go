@@ -0,0 +1,145 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/go-lxc"
+	"golang.org/x/sys/unix"
+)
+
+// Lazy (post-copy) migration with CRIU:
+// The checkpoint (Container.Checkpoint with CheckpointOptions.PageServer)
+// writes all images except the memory pages, and then serves the memory pages
+// from the frozen container with the CRIU page server.
+// The restore (ContainerConfig.RestorePageServer) starts the `criu lazy-pages` daemon,
+// which fetches the memory pages on demand (userfaultfd) while the container is running.
+//
+// liblxc has no options for lazy migration, so they are passed to criu
+// with a CRIU configuration file (CRIU_CONFIG_FILE). The environment variable
+// is only set for the child processes that run the lazy dump and restore
+// (lxcri-start), because criu inherits the environment from the liblxc caller.
+
+// Files in the container runtime directory used for lazy migration.
+const (
+	criuDumpConfigFile    = "criu-dump.conf"
+	criuRestoreConfigFile = "criu-restore.conf"
+)
+
+// lazyPagesLogFile is the log file of the lazy-pages daemon in the image directory.
+const lazyPagesLogFile = "lazy-pages.log"
+
+// writeLazyDumpConfig writes the CRIU configuration file for a lazy dump
+// with the page server listening on addr, and returns its path.
+func (c *Container) writeLazyDumpConfig(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid page server address %q: %w", addr, err)
+	}
+	conf := c.RuntimePath(criuDumpConfigFile)
+	data := fmt.Sprintf("lazy-pages\naddress %s\nport %s\n", host, port)
+	if err := os.WriteFile(conf, []byte(data), 0640); err != nil {
+		return "", err
+	}
+	return conf, nil
+}
+
+// lazyDump dumps the container with lxcri-start in a child process,
+// which passes the CRIU configuration file conf to criu (see LXCRI_DUMP_DIR in lxcri-start.c).
+// The environment of the runtime process is not modified.
+func (c *Container) lazyDump(mo lxc.MigrateOptions, conf string) error {
+	if c.StartPath == "" {
+		return fmt.Errorf("%s path is unknown (container was created by a previous runtime version)", ExecStart)
+	}
+	// #nosec
+	cmd := exec.Command(c.StartPath, c.linuxContainer.Name(), filepath.Dir(c.runtimeDir), c.ConfigFilePath())
+	cmd.Env = append(os.Environ(), "CRIU_CONFIG_FILE="+conf, "LXCRI_DUMP_DIR="+mo.Directory)
+	if mo.PredumpDir != "" {
+		cmd.Env = append(cmd.Env, "LXCRI_DUMP_PREDUMP_DIR="+mo.PredumpDir)
+	}
+	if mo.ActionScript != "" {
+		cmd.Env = append(cmd.Env, "LXCRI_DUMP_ACTION_SCRIPT="+mo.ActionScript)
+	}
+	if mo.Verbose {
+		cmd.Env = append(cmd.Env, "LXCRI_DUMP_VERBOSE=1")
+	}
+	if mo.Stop {
+		cmd.Env = append(cmd.Env, "LXCRI_DUMP_STOP=1")
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("lazy dump failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// lazyRestoreEnv starts the lazy-pages daemon for the restore and returns
+// the environment variables for the monitor process, which restores
+// the container with lazy pages. The daemon exits when all memory pages
+// are transferred. The returned stop function kills the daemon
+// and must be called if the restore fails.
+func (c *Container) lazyRestoreEnv(ctx context.Context) (env []string, stop func(), err error) {
+	conf := c.RuntimePath(criuRestoreConfigFile)
+	if err := os.WriteFile(conf, []byte("lazy-pages\n"), 0640); err != nil {
+		return nil, nil, err
+	}
+	var cmd *exec.Cmd
+	timer := c.backoff.timer()
+	// The page server on the source may not be ready yet.
+	for {
+		cmd, err = c.startLazyPagesDaemon()
+		if err == nil {
+			break
+		}
+		c.Log.Debug().Msgf("lazy-pages daemon failed: %s", err)
+		if werr := timer.wait(ctx); werr != nil {
+			return nil, nil, fmt.Errorf("failed to start lazy-pages daemon (see %s in the image dir): %w", lazyPagesLogFile, err)
+		}
+	}
+	stop = func() {
+		_ = cmd.Process.Kill()
+	}
+	return []string{"CRIU_CONFIG_FILE=" + conf}, stop, nil
+}
+
+// startLazyPagesDaemon starts the lazy-pages daemon and waits until it is ready.
+func (c *Container) startLazyPagesDaemon() (*exec.Cmd, error) {
+	host, port, err := net.SplitHostPort(c.RestorePageServer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page server address %q: %w", c.RestorePageServer, err)
+	}
+	statusR, statusW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer statusR.Close()
+
+	// #nosec
+	cmd := exec.Command("criu", "lazy-pages", "--page-server", "--address", host, "--port", port,
+		"--images-dir", c.RestoreImageDir, "--log-file", lazyPagesLogFile, "--status-fd", "3")
+	cmd.ExtraFiles = []*os.File{statusW}
+	// The daemon must not be killed together with the runtime process.
+	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	statusW.Close()
+	if err != nil {
+		return nil, err
+	}
+	// The daemon writes a zero byte to the status fd when it is ready.
+	buf := make([]byte, 1)
+	if n, _ := statusR.Read(buf); n != 1 {
+		err := cmd.Wait()
+		return nil, fmt.Errorf("lazy-pages daemon exited: %v", err)
+	}
+	// Reap the daemon, when it exits after the pages are transferred.
+	go func() {
+		_ = cmd.Wait()
+	}()
+	c.Log.Info().Int("pid", cmd.Process.Pid).Str("page-server", c.RestorePageServer).Msg("lazy-pages daemon started")
+	return cmd, nil
+}
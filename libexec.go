@@ -0,0 +1,152 @@
+package lxcri
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// embeddedLibexec contains the runtime executables if the runtime
+// was built with the 'embed' build tag (see embed_libexec.go).
+var embeddedLibexec fs.FS
+
+// HasEmbeddedLibexec returns true if the runtime executables
+// are embedded into the runtime binary.
+func HasEmbeddedLibexec() bool {
+	return embeddedLibexec != nil
+}
+
+type embeddedFile struct {
+	name   string
+	data   []byte
+	digest string
+}
+
+func readEmbeddedLibexec(fsys fs.FS) ([]embeddedFile, error) {
+	var files []embeddedFile
+	for _, name := range []string{ExecStart, ExecHook, ExecHookBuiltin, ExecInit} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("embedded executable %s: %w", name, err)
+		}
+		sum := sha256.Sum256(data)
+		files = append(files, embeddedFile{name: name, data: data, digest: "sha256:" + hex.EncodeToString(sum[:])})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// libexecCacheKey returns a directory name that is unique
+// for the content of the given files.
+func libexecCacheKey(files []embeddedFile) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s %s\n", f.digest, f.name)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// extractLibexec extracts the runtime executables from fsys into
+// a content addressed subdirectory of dir and returns the subdirectory.
+// Existing executables are reused if their digest matches the embedded executables.
+// Otherwise the executables are extracted into a temporary directory,
+// which is atomically renamed, so that concurrent runtime invocations
+// never see partially written executables.
+func extractLibexec(fsys fs.FS, dir string) (string, error) {
+	files, err := readEmbeddedLibexec(fsys)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, libexecCacheKey(files))
+
+	err = verifyLibexec(target, files)
+	if err == nil {
+		return target, nil
+	}
+	if !os.IsNotExist(err) {
+		// The executables were modified after extraction.
+		if err := os.RemoveAll(target); err != nil {
+			return "", fmt.Errorf("failed to remove corrupted libexec dir: %w", err)
+		}
+	}
+
+	// The libexec directory must be accessible from within the container
+	// because lxcri-init and the hooks are executed there.
+	// #nosec
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(dir, ".extract-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	// #nosec
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		// #nosec
+		if err := os.WriteFile(filepath.Join(tmp, f.name), f.data, 0555); err != nil {
+			return "", err
+		}
+	}
+	if err := verifyLibexec(tmp, files); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		// A concurrent runtime invocation extracted the executables first.
+		if err := verifyLibexec(target, files); err == nil {
+			return target, nil
+		}
+		return "", err
+	}
+	return target, nil
+}
+
+// verifyLibexec checks the integrity of the extracted executables in dir.
+func verifyLibexec(dir string, files []embeddedFile) error {
+	for _, f := range files {
+		filename := filepath.Join(dir, f.name)
+		digest, err := fileDigest(filename)
+		if err != nil {
+			return err
+		}
+		if digest != f.digest {
+			return fmt.Errorf("integrity check failed for %s: digest %s does not match embedded digest %s", filename, digest, f.digest)
+		}
+	}
+	return nil
+}
+
+// libexecCacheDir returns the per-user cache directory
+// for the extracted runtime executables.
+func (rt *Runtime) libexecCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(rt.Root, ".libexec")
+	}
+	return filepath.Join(dir, "lxcri", "libexec")
+}
+
+// initLibexec sets LibexecDir to the directory of the extracted embedded executables,
+// if LibexecDir is empty. A non-empty LibexecDir overrides the embedded executables.
+func (rt *Runtime) initLibexec() error {
+	if rt.LibexecDir != "" {
+		return nil
+	}
+	if embeddedLibexec == nil {
+		return fmt.Errorf("libexec directory is not set and the runtime executables are not embedded")
+	}
+	dir, err := extractLibexec(embeddedLibexec, rt.libexecCacheDir())
+	if err != nil {
+		return fmt.Errorf("failed to extract embedded executables: %w", err)
+	}
+	rt.Log.Debug().Msgf("Using embedded runtime executables from %s", dir)
+	rt.LibexecDir = dir
+	return nil
+}
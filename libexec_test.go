@@ -0,0 +1,56 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testLibexecFS() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range []string{ExecStart, ExecHook, ExecHookBuiltin, ExecInit} {
+		fsys[name] = &fstest.MapFile{Data: []byte("#!/bin/sh\necho " + name + "\n"), Mode: 0555}
+	}
+	return fsys
+}
+
+func TestExtractLibexec(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "lxcri-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	fsys := testLibexecFS()
+	dir, err := extractLibexec(fsys, tmpdir)
+	require.NoError(t, err)
+	require.NoError(t, canExecute(filepath.Join(dir, ExecInit)))
+
+	// extracted executables are reused
+	dir2, err := extractLibexec(fsys, tmpdir)
+	require.NoError(t, err)
+	require.Equal(t, dir, dir2)
+
+	// modified executables are replaced
+	// #nosec
+	require.NoError(t, os.Chmod(filepath.Join(dir, ExecStart), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ExecStart), []byte("modified"), 0555))
+	dir2, err = extractLibexec(fsys, tmpdir)
+	require.NoError(t, err)
+	require.Equal(t, dir, dir2)
+	data, err := os.ReadFile(filepath.Join(dir, ExecStart))
+	require.NoError(t, err)
+	require.Equal(t, fsys[ExecStart].Data, data)
+
+	// changed content is extracted into a new directory
+	fsys[ExecInit] = &fstest.MapFile{Data: []byte("changed"), Mode: 0555}
+	dir2, err = extractLibexec(fsys, tmpdir)
+	require.NoError(t, err)
+	require.NotEqual(t, dir, dir2)
+
+	// missing executables
+	delete(fsys, ExecHook)
+	_, err = extractLibexec(fsys, tmpdir)
+	require.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Lock is an advisory lock (see `man 2 flock`) on the runtime directory of a container.
+// It serializes concurrent runtime invocations for the same container,
+// e.g a create retried by the container manager and a kill or delete
+// that races with it, so that they do not corrupt the container state
+// (lxcri.json) or the liblxc config file.
+type Lock struct {
+	f *os.File
+}
+
+// Lock acquires a lock on the runtime directory of the container.
+// An exclusive lock is required to modify the container, a shared lock
+// is sufficient to read the container state.
+// Lock blocks until the lock is acquired or the context is done.
+// ErrNotExist is returned if the container does not exist.
+// The lock must be released with Lock.Unlock.
+func (rt *Runtime) Lock(ctx context.Context, containerID string, exclusive bool) (*Lock, error) {
+	return lockDir(ctx, filepath.Join(rt.containersDir(), containerID), exclusive, rt.Backoff)
+}
+
+func lockDir(ctx context.Context, dir string, exclusive bool, b Backoff) (*Lock, error) {
+	// #nosec
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	// flock can not be interrupted by the context,
+	// so the lock is polled with LOCK_NB.
+	timer := b.timer()
+	for {
+		err := unix.Flock(int(f.Fd()), how|unix.LOCK_NB)
+		if err == nil {
+			return &Lock{f: f}, nil
+		}
+		if err != unix.EWOULDBLOCK && err != unix.EINTR {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", dir, err)
+		}
+		if err := timer.wait(ctx); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", dir, err)
+		}
+	}
+}
+
+// Unlock releases the lock. It is safe to call Unlock on a nil Lock.
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,45 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	b := Backoff{InitialInterval: 1}
+
+	shared, err := lockDir(context.Background(), dir, false, b)
+	require.NoError(t, err)
+	shared2, err := lockDir(context.Background(), dir, false, b)
+	require.NoError(t, err)
+
+	// An exclusive lock must wait until all shared locks are released.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, err = lockDir(ctx, dir, true, b)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	require.NoError(t, shared.Unlock())
+	require.NoError(t, shared2.Unlock())
+	require.NoError(t, shared2.Unlock())
+
+	excl, err := lockDir(context.Background(), dir, true, b)
+	require.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, err = lockDir(ctx, dir, false, b)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.NoError(t, excl.Unlock())
+
+	_, err = lockDir(context.Background(), filepath.Join(dir, "missing"), true, b)
+	require.Equal(t, ErrNotExist, err)
+
+	var l *Lock
+	require.NoError(t, l.Unlock())
+}
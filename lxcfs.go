@@ -0,0 +1,103 @@
+package lxcri
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// LXCFSAuto enables LXCFS with the mountpoint detected from /proc/self/mountinfo.
+// See Runtime.LXCFS.
+const LXCFSAuto = "auto"
+
+// AnnotationLXCFS disables the LXCFS bind mounts for the container if set to `false`.
+const AnnotationLXCFS = "lxcri.lxcfs"
+
+// lxcfsFiles are the files virtualized by LXCFS, relative to the LXCFS mountpoint.
+// They are bind mounted to the same path (without the mountpoint) within the container.
+var lxcfsFiles = []string{
+	"proc/cpuinfo",
+	"proc/diskstats",
+	"proc/loadavg",
+	"proc/meminfo",
+	"proc/slabinfo",
+	"proc/stat",
+	"proc/swaps",
+	"proc/uptime",
+	"sys/devices/system/cpu/online",
+}
+
+// mountinfoPath is the mountinfo file used to detect the LXCFS mountpoint.
+var mountinfoPath = "/proc/self/mountinfo"
+
+// lxcfsMountpoint returns the mountpoint of the first LXCFS filesystem (fstype fuse.lxcfs).
+func lxcfsMountpoint() (string, error) {
+	// #nosec
+	f, err := os.Open(mountinfoPath)
+	if err != nil {
+		return "", err
+	}
+	// #nosec
+	defer f.Close()
+
+	// from `man 5 proc`:
+	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && len(fields) > 4 {
+				if fields[i+1] == "fuse.lxcfs" {
+					return unescapeMountinfo(fields[4]), nil
+				}
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no lxcfs mount found")
+}
+
+// configureLXCFS bind mounts the LXCFS proc and sys files into the container,
+// so that tools like `free` and `top` report the container limits
+// instead of the host resources. The files that the spec mounts are skipped.
+// NOTE The LXCFS cgroup view is not mounted, because it only supports cgroup v1.
+// With cgroup v2 and a cgroup namespace the container sees its own cgroup at /sys/fs/cgroup.
+func configureLXCFS(rt *Runtime, c *Container) error {
+	if rt.LXCFS == "" || c.Spec.Annotations[AnnotationLXCFS] == "false" {
+		return nil
+	}
+	mountpoint := rt.LXCFS
+	if mountpoint == LXCFSAuto {
+		var err error
+		if mountpoint, err = lxcfsMountpoint(); err != nil {
+			c.warnf("LXCFSUnavailable", "lxcfs is not mounted: %s", err)
+			return nil
+		}
+	}
+
+	for _, p := range lxcfsFiles {
+		src := filepath.Join(mountpoint, p)
+		dest := "/" + p
+		if hasMountDestination(c.Spec, dest) {
+			continue
+		}
+		// The files that the kernel does not provide are not virtualized either.
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+			Source:      src,
+			Destination: dest,
+			Type:        "bind",
+			Options:     []string{"bind", "ro", "nosuid", "nodev", "noexec"},
+		})
+	}
+	return nil
+}
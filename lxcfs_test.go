@@ -0,0 +1,44 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLXCFSMountpoint(t *testing.T) {
+	defer func(p string) { mountinfoPath = p }(mountinfoPath)
+	mountinfoPath = filepath.Join(t.TempDir(), "mountinfo")
+
+	proc := "22 1 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw\n"
+	lxcfs := "45 22 0:41 / /var/lib/lxcfs rw,nosuid,nodev,relatime shared:25 - fuse.lxcfs lxcfs rw,user_id=0,group_id=0,allow_other\n"
+	require.NoError(t, os.WriteFile(mountinfoPath, []byte(proc+lxcfs), 0644))
+	mountpoint, err := lxcfsMountpoint()
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/lxcfs", mountpoint)
+
+	require.NoError(t, os.WriteFile(mountinfoPath, []byte(proc), 0644))
+	_, err = lxcfsMountpoint()
+	require.Error(t, err)
+}
+
+func TestConfigureLXCFS(t *testing.T) {
+	mountpoint := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(mountpoint, "proc"), 0755))
+	for _, name := range []string{"meminfo", "uptime"} {
+		require.NoError(t, os.WriteFile(filepath.Join(mountpoint, "proc", name), nil, 0644))
+	}
+
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	spec.Mounts = append(spec.Mounts, specki.BindMount("/srv/uptime", "/proc/uptime"))
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: spec}}
+	n := len(spec.Mounts)
+
+	require.NoError(t, configureLXCFS(&Runtime{LXCFS: mountpoint}, c))
+	require.Len(t, spec.Mounts, n+1)
+	require.Equal(t, filepath.Join(mountpoint, "proc/meminfo"), spec.Mounts[n].Source)
+	require.Equal(t, "/proc/meminfo", spec.Mounts[n].Destination)
+}
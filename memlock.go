@@ -0,0 +1,66 @@
+package lxcri
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// rlimitInfinity is the value of an unlimited resource limit (RLIM_INFINITY).
+const rlimitInfinity = ^uint64(0)
+
+// configureMemoryLock configures ContainerConfig.MemoryLock and ContainerConfig.NoSwap
+// which are merged with AnnotationMemoryLock and AnnotationNoSwap.
+// Memory locks are removed by execve, so the container process must lock
+// its memory itself (e.g with mlockall). The runtime ensures that RLIMIT_MEMLOCK
+// does not prevent this, and excludes the container memory from swap.
+func configureMemoryLock(c *Container) error {
+	for annotation, enable := range map[string]*bool{
+		AnnotationMemoryLock: &c.MemoryLock,
+		AnnotationNoSwap:     &c.NoSwap,
+	} {
+		if val, ok := c.Spec.Annotations[annotation]; ok {
+			enabled, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for annotation %s: %w", annotation, err)
+			}
+			*enable = *enable || enabled
+		}
+	}
+
+	if c.MemoryLock {
+		if err := setMemlockRlimit(c.Spec); err != nil {
+			return err
+		}
+	}
+
+	if c.MemoryLock || c.NoSwap {
+		// Fail instead of starting the container without the requested guarantee.
+		if !c.hasCgroupController("memory") {
+			return fmt.Errorf("swap exclusion requires the cgroup memory controller")
+		}
+		if err := c.setCgroupItem("memory.swap.max", "0"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMemlockRlimit adds an unlimited RLIMIT_MEMLOCK to the spec if it has none.
+// An error is returned if the spec limits RLIMIT_MEMLOCK.
+func setMemlockRlimit(spec *specs.Spec) error {
+	for _, limit := range spec.Process.Rlimits {
+		if limit.Type != "RLIMIT_MEMLOCK" {
+			continue
+		}
+		if limit.Soft != rlimitInfinity || limit.Hard != rlimitInfinity {
+			return fmt.Errorf("memory locking requires an unlimited RLIMIT_MEMLOCK (soft:%d hard:%d)", limit.Soft, limit.Hard)
+		}
+		return nil
+	}
+	spec.Process.Rlimits = append(spec.Process.Rlimits, specs.POSIXRlimit{
+		Type: "RLIMIT_MEMLOCK", Soft: rlimitInfinity, Hard: rlimitInfinity,
+	})
+	return nil
+}
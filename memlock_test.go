@@ -0,0 +1,33 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMemlockRlimit(t *testing.T) {
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	require.NoError(t, setMemlockRlimit(spec))
+	require.Equal(t, []specs.POSIXRlimit{{Type: "RLIMIT_MEMLOCK", Soft: rlimitInfinity, Hard: rlimitInfinity}}, spec.Process.Rlimits)
+
+	// an unlimited rlimit is kept
+	require.NoError(t, setMemlockRlimit(spec))
+	require.Len(t, spec.Process.Rlimits, 1)
+
+	spec.Process.Rlimits = []specs.POSIXRlimit{{Type: "RLIMIT_MEMLOCK", Soft: 65536, Hard: 65536}}
+	require.Error(t, setMemlockRlimit(spec))
+}
+
+func TestConfigureMemoryLock(t *testing.T) {
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	spec.Annotations = map[string]string{AnnotationNoSwap: "true"}
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: spec}, cgroupControllers: map[string]bool{"pids": true}}
+	require.Error(t, configureMemoryLock(c))
+	require.True(t, c.NoSwap)
+
+	spec.Annotations[AnnotationNoSwap] = "yes"
+	require.Error(t, configureMemoryLock(c))
+}
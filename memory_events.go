@@ -0,0 +1,149 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Counters in the cgroup2 memory.events and memory.events.local files.
+const (
+	MemoryEventLow     = "low"
+	MemoryEventHigh    = "high"
+	MemoryEventMax     = "max"
+	MemoryEventOOM     = "oom"
+	MemoryEventOOMKill = "oom_kill"
+)
+
+// MemoryThreshold defines when a MemoryEvent is emitted.
+type MemoryThreshold struct {
+	// Counter is the name of the memory.events counter e.g MemoryEventHigh.
+	Counter string
+	// Local selects memory.events.local instead of memory.events.
+	// The counters in memory.events.local do not include the events
+	// of the descendant cgroups.
+	Local bool
+	// Increase is the minimum increase of the counter to emit an event.
+	// A value of 0 is treated as 1.
+	Increase uint64
+}
+
+// MemoryEvent is emitted when a memory.events counter
+// increases by at least MemoryThreshold.Increase.
+type MemoryEvent struct {
+	// Time is the time when the increase was detected.
+	Time time.Time
+	// Threshold is the threshold that was reached.
+	Threshold MemoryThreshold
+	// Value is the current counter value.
+	Value uint64
+	// Increase is the increase since the last event (or since the watch was started).
+	Increase uint64
+}
+
+// MemoryEventFunc is called by WatchMemoryEvents for every emitted MemoryEvent.
+type MemoryEventFunc func(ev MemoryEvent)
+
+// WatchMemoryEvents calls fn whenever one of the given thresholds is reached,
+// until the context is done or the container cgroup is removed.
+// The kernel notifies about modifications of the memory events files,
+// so no polling is required. This allows userspace OOM handlers to react
+// e.g on memory.high breaches, before the kernel OOM killer is invoked.
+func (c *Container) WatchMemoryEvents(ctx context.Context, thresholds []MemoryThreshold, fn MemoryEventFunc) error {
+	if c.CgroupDir == "" {
+		return fmt.Errorf("container cgroup is undefined")
+	}
+	dir := filepath.Join(cgroupRoot, c.CgroupDir)
+	files := map[bool]string{
+		false: filepath.Join(dir, "memory.events"),
+		true:  filepath.Join(dir, "memory.events.local"),
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to create inotify instance: %w", err)
+	}
+	// A non-blocking file is registered with the runtime poller,
+	// so reads can be interrupted by closing the file.
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	defer inotify.Close()
+
+	for _, local := range []bool{false, true} {
+		if _, err := unix.InotifyAddWatch(fd, files[local], unix.IN_MODIFY|unix.IN_DELETE_SELF); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", files[local], err)
+		}
+	}
+
+	read := func() ([]uint64, error) {
+		counters := make(map[bool]map[string]uint64)
+		for local, filename := range files {
+			vals, err := readCgroupKeyValues(filename)
+			if err != nil {
+				return nil, err
+			}
+			counters[local] = vals
+		}
+		current := make([]uint64, len(thresholds))
+		for i, t := range thresholds {
+			current[i] = counters[t.Local][t.Counter]
+		}
+		return current, nil
+	}
+	last, err := read()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			inotify.Close()
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, unix.SizeofInotifyEvent*16+unix.PathMax)
+	for {
+		if _, err := inotify.Read(buf); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		current, err := read()
+		if os.IsNotExist(err) || err == unix.ENODEV {
+			// cgroup was removed
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, ev := range memoryEvents(thresholds, last, current, time.Now()) {
+			fn(ev)
+		}
+	}
+}
+
+// memoryEvents returns the events for the thresholds that are reached by the
+// current counter values and updates the last counter values accordingly.
+func memoryEvents(thresholds []MemoryThreshold, last []uint64, current []uint64, now time.Time) []MemoryEvent {
+	var events []MemoryEvent
+	for i, t := range thresholds {
+		increase := t.Increase
+		if increase == 0 {
+			increase = 1
+		}
+		if current[i] < last[i]+increase {
+			continue
+		}
+		events = append(events, MemoryEvent{Time: now, Threshold: t, Value: current[i], Increase: current[i] - last[i]})
+		last[i] = current[i]
+	}
+	return events
+}
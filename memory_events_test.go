@@ -0,0 +1,30 @@
+package lxcri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryEvents(t *testing.T) {
+	thresholds := []MemoryThreshold{
+		{Counter: MemoryEventHigh, Increase: 10},
+		{Counter: MemoryEventOOMKill, Local: true},
+	}
+	now := time.Now()
+	last := []uint64{5, 0}
+
+	events := memoryEvents(thresholds, last, []uint64{14, 0}, now)
+	require.Empty(t, events)
+
+	events = memoryEvents(thresholds, last, []uint64{15, 1}, now)
+	require.Equal(t, []MemoryEvent{
+		{Time: now, Threshold: thresholds[0], Value: 15, Increase: 10},
+		{Time: now, Threshold: thresholds[1], Value: 1, Increase: 1},
+	}, events)
+	require.Equal(t, []uint64{15, 1}, last)
+
+	events = memoryEvents(thresholds, last, []uint64{20, 1}, now)
+	require.Empty(t, events)
+}
@@ -0,0 +1,113 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// MemoryPressurePolicy defines the action taken on sustained memory pressure
+// of the container cgroup (see Container.WatchMemoryPressure).
+// The pressure is measured with a PSI trigger (see kernel Documentation/accounting/psi.rst).
+type MemoryPressurePolicy struct {
+	// Full selects the `full` stall time (all non-idle tasks are stalled)
+	// instead of the `some` stall time (at least one task is stalled).
+	Full bool
+	// Stall is the stall time threshold within Window.
+	Stall time.Duration
+	// Window is the time window for the stall time threshold.
+	// It must be in the range 500ms to 10s.
+	// The policy is triggered at most once per window.
+	Window time.Duration
+	// Signal is sent to all container processes when the threshold is exceeded
+	// (e.g SIGUSR1 for a cache to drop entries). No signal is sent if it is 0.
+	Signal unix.Signal
+	// Hook is called when the threshold is exceeded.
+	Hook HookFunc
+}
+
+// trigger returns the PSI trigger written to the memory.pressure file.
+func (p MemoryPressurePolicy) trigger() (string, error) {
+	if p.Window < 500*time.Millisecond || p.Window > 10*time.Second {
+		return "", fmt.Errorf("memory pressure window %s is not within 500ms and 10s", p.Window)
+	}
+	if p.Stall <= 0 || p.Stall > p.Window {
+		return "", fmt.Errorf("memory pressure stall %s is not within 0 and the window %s", p.Stall, p.Window)
+	}
+	kind := "some"
+	if p.Full {
+		kind = "full"
+	}
+	return fmt.Sprintf("%s %d %d", kind, p.Stall.Microseconds(), p.Window.Microseconds()), nil
+}
+
+// WatchMemoryPressure applies the policy whenever the memory stall time of the
+// container exceeds the threshold, until the context is done or the container
+// cgroup is removed. This allows graceful degradation, e.g of caches and JVMs,
+// before the kernel OOM killer is invoked. It requires kernel >= 5.2.
+// Errors of the policy hook are logged and do not stop the watch.
+func (c *Container) WatchMemoryPressure(ctx context.Context, policy MemoryPressurePolicy) error {
+	if c.CgroupDir == "" {
+		return fmt.Errorf("container cgroup is undefined")
+	}
+	trigger, err := policy.trigger()
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(cgroupRoot, c.CgroupDir, "memory.pressure")
+	// #nosec
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	// #nosec
+	defer f.Close()
+	// The trigger is active until the file is closed.
+	if _, err := f.Write([]byte(trigger)); err != nil {
+		return fmt.Errorf("failed to create memory pressure trigger %q: %w", trigger, err)
+	}
+
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Poll with a timeout to check the context.
+		n, err := unix.Poll(fds, 1000)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to poll %s: %w", filename, err)
+		}
+		if n == 0 {
+			continue
+		}
+		if fds[0].Revents&unix.POLLERR != 0 {
+			// cgroup was removed
+			return nil
+		}
+		if fds[0].Revents&unix.POLLPRI != 0 {
+			c.onMemoryPressure(ctx, policy)
+		}
+	}
+}
+
+func (c *Container) onMemoryPressure(ctx context.Context, policy MemoryPressurePolicy) {
+	c.Log.Warn().Bool("full", policy.Full).Dur("stall", policy.Stall).Dur("window", policy.Window).
+		Msg("memory pressure threshold exceeded")
+	if policy.Signal != 0 {
+		if err := c.kill(ctx, policy.Signal); err != nil {
+			c.Log.Error().Msgf("failed to signal container processes on memory pressure: %s", err)
+		}
+	}
+	if policy.Hook != nil {
+		if err := policy.Hook(ctx, c); err != nil {
+			c.Log.Error().Msgf("memory pressure hook failed: %s", err)
+		}
+	}
+}
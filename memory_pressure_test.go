@@ -0,0 +1,31 @@
+package lxcri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryPressurePolicyTrigger(t *testing.T) {
+	p := MemoryPressurePolicy{Stall: 150 * time.Millisecond, Window: time.Second}
+	trigger, err := p.trigger()
+	require.NoError(t, err)
+	require.Equal(t, "some 150000 1000000", trigger)
+
+	p.Full = true
+	trigger, err = p.trigger()
+	require.NoError(t, err)
+	require.Equal(t, "full 150000 1000000", trigger)
+
+	invalid := []MemoryPressurePolicy{
+		{Stall: 100 * time.Millisecond, Window: 100 * time.Millisecond},
+		{Stall: time.Second, Window: 11 * time.Second},
+		{Stall: 0, Window: time.Second},
+		{Stall: 2 * time.Second, Window: time.Second},
+	}
+	for _, p := range invalid {
+		_, err := p.trigger()
+		require.Error(t, err, "%+v", p)
+	}
+}
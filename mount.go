@@ -39,6 +39,32 @@ func filterMountOptions(rt *Runtime, fs string, opts []string) []string {
 	return opts
 }
 
+// isRootfsRamfs returns true if the root filesystem of the runtime
+// mount namespace is the initramfs (rootfs). This is the same check
+// liblxc uses to decide whether pivot_root can be used.
+func isRootfsRamfs() (bool, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// e.g `1 0 0:1 / / rw - rootfs rootfs rw`
+		vals := strings.SplitN(line, " - ", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		fields := strings.Fields(vals[0])
+		fsFields := strings.Fields(vals[1])
+		if len(fields) < 5 || len(fsFields) < 1 {
+			continue
+		}
+		if fields[4] == "/" && fsFields[0] == "rootfs" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 type mounts []specs.Mount
 
 func (m mounts) Len() int {
@@ -66,6 +92,9 @@ func configureMounts(rt *Runtime, c *Container) error {
 	for i := range c.Spec.Mounts {
 		ms := c.Spec.Mounts[i]
 		if ms.Type == "cgroup" || ms.Type == "cgroup2" {
+			if ms.Type == "cgroup" {
+				c.warnf("MountRewritten", "cgroup v1 mount %s is replaced with an optional cgroup2 mount", ms.Destination)
+			}
 			// TODO check if hieararchy is cgroup v2 only (unified mode)
 			ms.Type = "cgroup2"
 			ms.Source = "cgroup2"
@@ -97,7 +126,10 @@ func configureMounts(rt *Runtime, c *Container) error {
 			return err
 		}
 
-		ms.Options = filterMountOptions(rt, ms.Type, ms.Options)
+		if opts := filterMountOptions(rt, ms.Type, ms.Options); len(opts) != len(ms.Options) {
+			c.warnf("MountRewritten", "unsupported options removed from %s mount %s", ms.Type, ms.Destination)
+			ms.Options = opts
+		}
 
 		mnt := fmt.Sprintf("%s %s %s %s", ms.Source, ms.Destination, ms.Type, strings.Join(ms.Options, ","))
 
@@ -219,3 +251,99 @@ func resolveMountDestination(rootfs string, dst string) (dstPath string, err err
 	}
 	return currentPath, err
 }
+
+// hostTimezoneFiles are the timezone files bind mounted by configureLocaltime.
+var hostTimezoneFiles = []string{"/etc/localtime", "/etc/timezone"}
+
+// configureLocaltime bind mounts the host timezone files into the container,
+// if the container rootfs lacks them and the spec does not mount them.
+func configureLocaltime(rt *Runtime, c *Container) error {
+	if !rt.HostLocaltime && !c.HostLocaltime {
+		return nil
+	}
+	for _, p := range hostTimezoneFiles {
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if hasMountDestination(c.Spec, p) {
+			continue
+		}
+		// The file may be a dangling symlink (relative to the container rootfs)
+		// which is still considered as existent.
+		if _, err := os.Lstat(filepath.Join(c.Spec.Root.Path, p)); err == nil {
+			continue
+		}
+		c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+			Source:      p,
+			Destination: p,
+			Type:        "bind",
+			Options:     []string{"bind", "ro", "nosuid", "nodev", "noexec"},
+		})
+	}
+	return nil
+}
+
+func hasMountDestination(spec *specs.Spec, dest string) bool {
+	for _, m := range spec.Mounts {
+		if filepath.Clean(m.Destination) == dest {
+			return true
+		}
+	}
+	return false
+}
+
+// configureProcMount adds the ContainerConfig.ProcMountOptions
+// and the options from AnnotationProcOptions to the /proc mount.
+func configureProcMount(c *Container) error {
+	opts := append([]string{}, c.ProcMountOptions...)
+	if val := c.Spec.Annotations[AnnotationProcOptions]; val != "" {
+		opts = append(opts, strings.Split(val, ",")...)
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	if err := checkProcMountOptions(opts, checkKernelVersion); err != nil {
+		return err
+	}
+	for i, m := range c.Spec.Mounts {
+		if m.Type == "proc" && filepath.Clean(m.Destination) == "/proc" {
+			c.Spec.Mounts[i].Options = append(m.Options, opts...)
+			return nil
+		}
+	}
+	return fmt.Errorf("proc mount options %s require a /proc mount", strings.Join(opts, ","))
+}
+
+// checkProcMountOptions validates the given /proc mount options.
+// Per mount instance options (subset and named hidepid values) require kernel >= 5.8.
+// Before, hidepid applies to all procfs mounts of the PID namespace.
+func checkProcMountOptions(opts []string, kernelAtLeast func(major, minor int) error) error {
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("unsupported proc mount option %q", opt)
+		}
+		switch kv[0] {
+		case "hidepid":
+			switch kv[1] {
+			case "0", "1", "2":
+			case "invisible", "noaccess", "ptraceable", "4":
+				if err := kernelAtLeast(5, 8); err != nil {
+					return fmt.Errorf("proc mount option %q is not supported: %w", opt, err)
+				}
+			default:
+				return fmt.Errorf("invalid proc mount option %q", opt)
+			}
+		case "subset":
+			if kv[1] != "pid" {
+				return fmt.Errorf("invalid proc mount option %q", opt)
+			}
+			if err := kernelAtLeast(5, 8); err != nil {
+				return fmt.Errorf("proc mount option %q is not supported: %w", opt, err)
+			}
+		default:
+			return fmt.Errorf("unsupported proc mount option %q", opt)
+		}
+	}
+	return nil
+}
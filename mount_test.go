@@ -1,11 +1,13 @@
 package lxcri
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -90,3 +92,69 @@ func TestSliceDelete(t *testing.T) {
 	a1 := append(a[:2], a[2+1:]...)
 	require.Equal(t, a[:2], a1)
 }
+
+func TestConfigureLocaltime(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	localtime := filepath.Join(tmpdir, "localtime")
+	timezone := filepath.Join(tmpdir, "timezone")
+	require.NoError(t, os.WriteFile(localtime, nil, 0640))
+	hostTimezoneFiles = []string{localtime, timezone}
+	defer func() { hostTimezoneFiles = []string{"/etc/localtime", "/etc/timezone"} }()
+
+	rootfs := filepath.Join(tmpdir, "rootfs")
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, tmpdir), 0750))
+
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{Root: &specs.Root{Path: rootfs}},
+	}}
+	rt := &Runtime{}
+	require.NoError(t, configureLocaltime(rt, c))
+	require.Empty(t, c.Spec.Mounts)
+
+	c.HostLocaltime = true
+	require.NoError(t, configureLocaltime(rt, c))
+	require.Len(t, c.Spec.Mounts, 1)
+	require.Equal(t, localtime, c.Spec.Mounts[0].Destination)
+
+	// rootfs contains the file
+	c.Spec.Mounts = nil
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, localtime), nil, 0640))
+	require.NoError(t, configureLocaltime(rt, c))
+	require.Empty(t, c.Spec.Mounts)
+}
+
+func TestCheckProcMountOptions(t *testing.T) {
+	oldKernel := func(major, minor int) error {
+		return fmt.Errorf("kernel version 5.4 < %d.%d", major, minor)
+	}
+	newKernel := func(major, minor int) error { return nil }
+
+	require.NoError(t, checkProcMountOptions([]string{"hidepid=2"}, oldKernel))
+	require.NoError(t, checkProcMountOptions([]string{"hidepid=invisible", "subset=pid"}, newKernel))
+	require.Error(t, checkProcMountOptions([]string{"subset=pid"}, oldKernel))
+	require.Error(t, checkProcMountOptions([]string{"hidepid=invisible"}, oldKernel))
+	require.Error(t, checkProcMountOptions([]string{"hidepid=5"}, newKernel))
+	require.Error(t, checkProcMountOptions([]string{"subset=net"}, newKernel))
+	require.Error(t, checkProcMountOptions([]string{"gid=100"}, newKernel))
+	require.Error(t, checkProcMountOptions([]string{"hidepid"}, newKernel))
+}
+
+func TestConfigureProcMount(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{
+			Mounts: []specs.Mount{
+				{Destination: "/proc", Type: "proc", Source: "proc", Options: []string{"nosuid"}},
+			},
+			Annotations: map[string]string{AnnotationProcOptions: "hidepid=2"},
+		},
+		ProcMountOptions: []string{"hidepid=1"},
+	}}
+	require.NoError(t, configureProcMount(c))
+	require.Equal(t, []string{"nosuid", "hidepid=1", "hidepid=2"}, c.Spec.Mounts[0].Options)
+
+	c.Spec.Mounts = nil
+	require.Error(t, configureProcMount(c))
+}
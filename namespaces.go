@@ -116,8 +116,12 @@ func isNamespaceSharedWithRuntime(ns *specs.LinuxNamespace) (bool, error) {
 		return false, err
 	}
 
+	n, supported := namespaceMap[ns.Type]
+	if !supported {
+		return false, fmt.Errorf("unsupported namespace %s", ns.Type)
+	}
 	var stat1 unix.Stat_t
-	err = unix.Stat("/proc/self/ns/pid", &stat1)
+	err = unix.Stat("/proc/self/ns/"+n.Name, &stat1)
 	if err != nil {
 		return false, err
 	}
@@ -159,3 +163,61 @@ func setHostname(nsPath string, hostname string) error {
 	}
 	return nil
 }
+
+func (o *ExecOptions) namespacePaths() map[specs.LinuxNamespaceType]string {
+	if o == nil {
+		return nil
+	}
+	return o.NamespacePaths
+}
+
+// runInNamespaces calls fn on a locked OS thread that has joined the given namespaces.
+// Processes forked by fn (e.g liblxc attach) inherit the namespaces of the thread.
+// Namespaces that can only be joined by single-threaded processes
+// (mount and user namespace) are not supported.
+func runInNamespaces(paths map[specs.LinuxNamespaceType]string, fn func() error) error {
+	if len(paths) == 0 {
+		return fn()
+	}
+	return runOnLockedThread(func() error {
+		if err := joinNamespaces(paths); err != nil {
+			return err
+		}
+		return fn()
+	})
+}
+
+// runOnLockedThread calls fn on a new goroutine that is locked to its OS thread.
+// The thread is not unlocked, because restoring the thread attributes
+// changed by fn (e.g namespaces) may fail.
+// The runtime terminates the thread when the goroutine exits.
+func runOnLockedThread(fn func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		errc <- fn()
+	}()
+	return <-errc
+}
+
+func joinNamespaces(paths map[specs.LinuxNamespaceType]string) error {
+	for t, path := range paths {
+		if err := setns(path, namespaceMap[t]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setns(path string, ns namespace) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s namespace %q: %w", ns.Name, path, err)
+	}
+	// #nosec
+	defer f.Close()
+	if err := unix.Setns(int(f.Fd()), ns.CloneFlag); err != nil {
+		return fmt.Errorf("failed to join %s namespace %q: %w", ns.Name, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package lxcri
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Network readiness annotations (see NetworkReadiness).
+const (
+	AnnotationNetworkReadyInterface = "lxcri.network-ready.interface"
+	AnnotationNetworkReadyAddress   = "lxcri.network-ready.address"
+	AnnotationNetworkReadyFile      = "lxcri.network-ready.file"
+	AnnotationNetworkReadyTimeout   = "lxcri.network-ready.timeout"
+)
+
+// DefaultNetworkReadyTimeout is the default of NetworkReadiness.Timeout.
+const DefaultNetworkReadyTimeout = 10 * time.Second
+
+// NetworkReadiness are the conditions that Runtime.Start waits for,
+// before the container process is started. This prevents the container process
+// from starting before the network is configured, e.g by CNI plugins.
+// All conditions must be met.
+type NetworkReadiness struct {
+	// Interface is the name of a network interface that must exist
+	// in the container network namespace.
+	Interface string `json:",omitempty"`
+	// Address requires a (non-loopback, non-link-local) IP address
+	// in the container network namespace.
+	Address bool `json:",omitempty"`
+	// File is the path of a file that must exist on the host,
+	// e.g created by a hook to signal readiness.
+	File string `json:",omitempty"`
+	// Timeout is the maximum time Runtime.Start waits for the conditions.
+	Timeout time.Duration `json:",omitempty"`
+}
+
+// configureNetworkReadiness merges the network readiness annotations
+// into ContainerConfig.NetworkReady.
+func configureNetworkReadiness(c *Container) error {
+	a := c.Spec.Annotations
+	nr := c.NetworkReady
+	if nr == nil {
+		nr = &NetworkReadiness{}
+	}
+	if val, ok := a[AnnotationNetworkReadyInterface]; ok {
+		nr.Interface = val
+	}
+	if val, ok := a[AnnotationNetworkReadyAddress]; ok {
+		enabled, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for annotation %s: %w", AnnotationNetworkReadyAddress, err)
+		}
+		nr.Address = enabled
+	}
+	if val, ok := a[AnnotationNetworkReadyFile]; ok {
+		nr.File = val
+	}
+	if val, ok := a[AnnotationNetworkReadyTimeout]; ok {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid value for annotation %s: %q", AnnotationNetworkReadyTimeout, val)
+		}
+		nr.Timeout = d
+	}
+
+	if nr.Interface == "" && !nr.Address && nr.File == "" {
+		c.NetworkReady = nil
+		return nil
+	}
+	if (nr.Interface != "" || nr.Address) && getNamespace(c.Spec, specs.NetworkNamespace) == nil {
+		return fmt.Errorf("network readiness conditions require a network namespace")
+	}
+	if nr.Timeout == 0 {
+		nr.Timeout = DefaultNetworkReadyTimeout
+	}
+	c.NetworkReady = nr
+	return nil
+}
+
+// waitNetworkReady waits until the network readiness conditions are met.
+// ErrNetworkNotReady is returned if the timeout is exceeded.
+func (c *Container) waitNetworkReady(ctx context.Context) error {
+	nr := c.NetworkReady
+	if nr == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, nr.Timeout)
+	defer cancel()
+
+	timer := c.backoff.timer()
+	for {
+		reason, err := c.networkNotReady()
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			return nil
+		}
+		if err := timer.wait(ctx); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %s", ErrNetworkNotReady, nr.Timeout, reason)
+			}
+			return err
+		}
+	}
+}
+
+// networkNotReady returns the unmet network readiness condition,
+// or an empty string if all conditions are met.
+// The network namespace is inspected through /proc/<pid>/net
+// of the container init process, which avoids setns.
+func (c *Container) networkNotReady() (string, error) {
+	nr := c.NetworkReady
+	if nr.File != "" {
+		if _, err := os.Stat(nr.File); os.IsNotExist(err) {
+			return fmt.Sprintf("file %s does not exist", nr.File), nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if nr.Interface == "" && !nr.Address {
+		return "", nil
+	}
+
+	pid := c.linuxContainer.InitPid()
+	if pid < 1 {
+		return "", fmt.Errorf("%w: init process is not running", ErrInitExited)
+	}
+	procNet := fmt.Sprintf("/proc/%d/net/", pid)
+
+	if nr.Interface != "" {
+		// #nosec
+		data, err := os.ReadFile(procNet + "dev")
+		if err != nil {
+			return "", err
+		}
+		devices, err := parseNetDev(data)
+		if err != nil {
+			return "", err
+		}
+		if !hasNetworkInterface(devices, nr.Interface) {
+			return fmt.Sprintf("interface %s does not exist", nr.Interface), nil
+		}
+	}
+
+	if nr.Address {
+		// #nosec
+		fibTrie, err := os.ReadFile(procNet + "fib_trie")
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		// #nosec
+		ifInet6, err := os.ReadFile(procNet + "if_inet6")
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if !hasIPv4Address(fibTrie) && !hasIPv6Address(ifInet6) {
+			return "no IP address assigned", nil
+		}
+	}
+	return "", nil
+}
+
+func hasNetworkInterface(devices []NetworkStats, name string) bool {
+	for _, dev := range devices {
+		if dev.Interface == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIPv4Address returns true if the /proc/net/fib_trie contents
+// contain a local address that is neither a loopback nor a link-local address.
+// Local addresses are listed as leaf followed by a `/32 host LOCAL` line e.g
+//
+//	|-- 10.0.0.5
+//	   /32 host LOCAL
+func hasIPv4Address(fibTrie []byte) bool {
+	var leaf net.IP
+	scanner := bufio.NewScanner(bytes.NewReader(fibTrie))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "|-- ") {
+			leaf = net.ParseIP(strings.TrimPrefix(line, "|-- "))
+			continue
+		}
+		if leaf != nil && strings.HasPrefix(line, "/32 host LOCAL") && isUsableIP(leaf) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIPv6Address returns true if the /proc/net/if_inet6 contents
+// contain an address that is neither a loopback nor a link-local address.
+// Each line has the fields `address ifindex prefixlen scope flags devname`.
+func hasIPv6Address(ifInet6 []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(ifInet6))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || len(fields[0]) != 32 {
+			continue
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i := range ip {
+			b, err := strconv.ParseUint(fields[0][2*i:2*i+2], 16, 8)
+			if err != nil {
+				ip = nil
+				break
+			}
+			ip[i] = byte(b)
+		}
+		if ip != nil && isUsableIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUsableIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
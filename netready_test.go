@@ -0,0 +1,88 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+const testFibTrie = `Main:
+  +-- 0.0.0.0/0 3 0 5
+     |-- 0.0.0.0
+        /0 universe UNICAST
+     |-- 10.88.0.0
+        /16 link UNICAST
+     |-- 10.88.0.5
+        /32 host LOCAL
+Local:
+  +-- 127.0.0.0/8 2 0 2
+     |-- 127.0.0.1
+        /32 host LOCAL
+`
+
+func TestHasIPv4Address(t *testing.T) {
+	require.True(t, hasIPv4Address([]byte(testFibTrie)))
+
+	loopback := `Local:
+  +-- 127.0.0.0/8 2 0 2
+     |-- 127.0.0.0
+        /32 link BROADCAST
+     |-- 127.0.0.1
+        /32 host LOCAL
+`
+	require.False(t, hasIPv4Address([]byte(loopback)))
+	require.False(t, hasIPv4Address(nil))
+}
+
+func TestHasIPv6Address(t *testing.T) {
+	linkLocal := "fe80000000000000b0a1c2fffed3e4f5 02 40 20 80 eth0\n" +
+		"00000000000000000000000000000001 01 80 10 80 lo\n"
+	require.False(t, hasIPv6Address([]byte(linkLocal)))
+
+	global := linkLocal + "fd000000000000000000000000000005 02 40 00 80 eth0\n"
+	require.True(t, hasIPv6Address([]byte(global)))
+}
+
+func TestConfigureNetworkReadiness(t *testing.T) {
+	spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+	c := &Container{ContainerConfig: &ContainerConfig{Spec: spec}}
+	require.NoError(t, configureNetworkReadiness(c))
+	require.Nil(t, c.NetworkReady)
+
+	spec.Annotations = map[string]string{
+		AnnotationNetworkReadyInterface: "eth0",
+		AnnotationNetworkReadyTimeout:   "3s",
+	}
+	require.NoError(t, configureNetworkReadiness(c))
+	require.Equal(t, &NetworkReadiness{Interface: "eth0", Timeout: 3 * time.Second}, c.NetworkReady)
+
+	spec.Annotations[AnnotationNetworkReadyAddress] = "maybe"
+	require.Error(t, configureNetworkReadiness(c))
+
+	// requires a network namespace
+	spec.Annotations[AnnotationNetworkReadyAddress] = "true"
+	spec.Linux.Namespaces = []specs.LinuxNamespace{{Type: specs.MountNamespace}}
+	require.Error(t, configureNetworkReadiness(c))
+}
+
+func TestWaitNetworkReadyFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ready")
+	c := &Container{
+		ContainerConfig: &ContainerConfig{
+			NetworkReady: &NetworkReadiness{File: file, Timeout: 50 * time.Millisecond},
+		},
+		backoff: Backoff{InitialInterval: 10},
+	}
+	err := c.waitNetworkReady(context.Background())
+	require.True(t, errors.Is(err, ErrNetworkNotReady))
+
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	require.NoError(t, c.waitNetworkReady(context.Background()))
+}
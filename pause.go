@@ -0,0 +1,76 @@
+package lxcri
+
+import (
+	"path/filepath"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// AnnotationPause is set to `true` by the runtime for a container that is
+// created through the pause container fast path (see Runtime.PauseFastPath).
+// The init process `lxcri-init` then holds the container namespaces itself,
+// instead of executing the container process.
+// NOTE keep in sync with cmd/lxcri-init
+const AnnotationPause = "lxcri.pause"
+
+// pauseMounts are the mount destinations of a pause container spec,
+// as generated by the container engine (e.g cri-o) for a pod sandbox.
+var pauseMounts = []string{
+	"/proc", "/dev", "/dev/pts", "/dev/shm", "/dev/mqueue",
+	"/sys", "/sys/fs/cgroup",
+	"/etc/resolv.conf", "/etc/hostname", "/etc/hosts",
+}
+
+// isPauseContainer returns true if the spec is a pause (infra) container
+// that only holds the namespaces of a pod sandbox:
+// The process is the `pause` binary or `sleep infinity` without terminal,
+// the spec has no hooks and no mounts beyond the defaults (see pauseMounts
+// and Runtime.DefaultMounts),
+// and the runtime has no OCI hooks other than the builtin hook (see Runtime.Init).
+func (rt *Runtime) isPauseContainer(spec *specs.Spec) bool {
+	if spec.Process == nil || spec.Process.Terminal {
+		return false
+	}
+	args := spec.Process.Args
+	isPause := len(args) == 1 && filepath.Base(args[0]) == "pause"
+	isSleep := len(args) == 2 && filepath.Base(args[0]) == "sleep" && args[1] == "infinity"
+	if !isPause && !isSleep {
+		return false
+	}
+	if rt.hasUserHooks() || (spec.Hooks != nil && hasHooks(spec.Hooks)) {
+		return false
+	}
+	defaults := &specs.Spec{Mounts: rt.DefaultMounts}
+	for _, m := range spec.Mounts {
+		dest := filepath.Clean(m.Destination)
+		if indexOf(pauseMounts, dest) < 0 && !hasMountDestination(defaults, dest) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasUserHooks returns true if the runtime has OCI hooks besides
+// the builtin CreateContainer hook, which is set by Runtime.Init.
+// The builtin hook has nothing to do for a pause container,
+// because the fast path drops the spec devices.
+func (rt *Runtime) hasUserHooks() bool {
+	hooks := rt.Hooks
+	hooks.CreateContainer = nil
+	builtin := rt.libexec(ExecHookBuiltin)
+	for _, h := range rt.Hooks.CreateContainer {
+		if h.Path != builtin {
+			hooks.CreateContainer = append(hooks.CreateContainer, h)
+		}
+	}
+	return hasHooks(&hooks)
+}
+
+func hasHooks(hooks *specs.Hooks) bool {
+	return len(hooks.Prestart) > 0 ||
+		len(hooks.CreateRuntime) > 0 ||
+		len(hooks.CreateContainer) > 0 ||
+		len(hooks.StartContainer) > 0 ||
+		len(hooks.Poststart) > 0 ||
+		len(hooks.Poststop) > 0
+}
@@ -0,0 +1,46 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPauseContainer(t *testing.T) {
+	// The runtime initialized by the test setup has the builtin hook.
+	r := rt
+	require.NotEmpty(t, r.Hooks.CreateContainer)
+
+	spec := specki.NewSpec("/tmp/rootfs", "/pause")
+	spec.Mounts = append(spec.Mounts, specs.Mount{Destination: "/etc/resolv.conf/", Source: "/run/resolv.conf", Type: "bind"})
+	require.True(t, r.isPauseContainer(spec))
+
+	spec.Process.Args = []string{"sleep", "infinity"}
+	require.True(t, r.isPauseContainer(spec))
+
+	spec.Process.Args = []string{"sleep", "10"}
+	require.False(t, r.isPauseContainer(spec))
+
+	spec.Process.Args = []string{"/pause"}
+	spec.Process.Terminal = true
+	require.False(t, r.isPauseContainer(spec))
+	spec.Process.Terminal = false
+
+	spec.Hooks = &specs.Hooks{Poststop: []specs.Hook{{Path: "/bin/true"}}}
+	require.False(t, r.isPauseContainer(spec))
+	spec.Hooks = nil
+
+	r.Hooks.Prestart = []specs.Hook{{Path: "/bin/true"}}
+	require.False(t, r.isPauseContainer(spec))
+	r.Hooks.Prestart = nil
+
+	builtin := r.Hooks.CreateContainer
+	r.Hooks.CreateContainer = append(append([]specs.Hook{}, builtin...), specs.Hook{Path: "/bin/true"})
+	require.False(t, r.isPauseContainer(spec))
+	r.Hooks.CreateContainer = builtin
+
+	spec.Mounts = append(spec.Mounts, specs.Mount{Destination: "/data", Source: "/srv/data", Type: "bind"})
+	require.False(t, r.isPauseContainer(spec))
+}
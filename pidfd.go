@@ -0,0 +1,148 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// pidfdOpen returns a process file descriptor for the given pid (see `man 2 pidfd_open`).
+// A process file descriptor always refers to the same process,
+// even if the process exited and the pid was reused.
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// pidfdSendSignal sends the signal sig to the process referred to by pidfd.
+func pidfdSendSignal(pidfd int, sig unix.Signal) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PIDFD_SEND_SIGNAL, uintptr(pidfd), uintptr(sig), 0, 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// pidfdExited returns true if the process referred to by pidfd has exited.
+// A process file descriptor becomes readable when the process exits.
+func pidfdExited(pidfd int) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(pidfd), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+}
+
+// processStartTime returns the start time of the process with the given pid
+// in clock ticks after system boot (see `man 5 proc`, /proc/[pid]/stat field 22).
+// The PID and start time fingerprint a process across PID reuse.
+func processStartTime(pid int) (uint64, error) {
+	// #nosec
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	return parseProcessStartTime(string(data))
+}
+
+// parseProcessStat returns the fields of /proc/[pid]/stat starting with field 3 (state).
+func parseProcessStat(stat string, minFields int) ([]string, error) {
+	// The command name (field 2) is enclosed in parentheses
+	// and may contain spaces and parentheses.
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid process stat %q", stat)
+	}
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < minFields {
+		return nil, fmt.Errorf("invalid process stat %q", stat)
+	}
+	return fields, nil
+}
+
+func parseProcessStartTime(stat string) (uint64, error) {
+	fields, err := parseProcessStat(stat, 20)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// processExitStatus returns the wait status of an exited process
+// that was not yet reaped by its parent (a zombie process).
+// /proc/[pid]/stat field 52 contains the exit status (since Linux 3.5).
+func processExitStatus(pid int) (unix.WaitStatus, error) {
+	// #nosec
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	return parseProcessExitStatus(string(data))
+}
+
+func parseProcessExitStatus(stat string) (unix.WaitStatus, error) {
+	fields, err := parseProcessStat(stat, 50)
+	if err != nil {
+		return 0, err
+	}
+	if fields[0] != "Z" {
+		return 0, fmt.Errorf("process has not exited (state %s)", fields[0])
+	}
+	val, err := strconv.ParseUint(fields[49], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return unix.WaitStatus(val), nil
+}
+
+// openMonitor returns a process file descriptor for the monitor process.
+// unix.ESRCH is returned if the monitor process does not exist anymore,
+// or if the monitor PID was reused by another process.
+// The caller must close the returned file descriptor.
+func (c *Container) openMonitor() (int, error) {
+	if c.Pid < 2 {
+		return -1, unix.ESRCH
+	}
+	pidfd, err := pidfdOpen(c.Pid)
+	if err != nil {
+		return -1, err
+	}
+	// The PID can not be reused while the process file descriptor is open,
+	// so the fingerprint check is not racy.
+	if c.MonitorStartTime != 0 {
+		startTime, err := processStartTime(c.Pid)
+		if err != nil || startTime != c.MonitorStartTime {
+			unix.Close(pidfd)
+			return -1, unix.ESRCH
+		}
+	}
+	return pidfd, nil
+}
+
+// killProcess sends the signal sig to the process with the given pid.
+// The signal is sent through a process file descriptor, which narrows the
+// window for PID reuse to the time between reading the PID and pidfd_open.
+func killProcess(pid int, sig unix.Signal) error {
+	pidfd, err := pidfdOpen(pid)
+	if err == unix.ENOSYS {
+		// pidfd_open requires kernel >= 5.3
+		return unix.Kill(pid, sig)
+	}
+	if err != nil {
+		return err
+	}
+	defer unix.Close(pidfd)
+	return pidfdSendSignal(pidfd, sig)
+}
@@ -0,0 +1,68 @@
+package lxcri
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseProcessStartTime(t *testing.T) {
+	stat := "4661 (cmd (with) spaces) S 1 4661 4661 0 -1 4194560 7025 0 0 0 39 7 0 0 20 0 11 0 123456 1000 100"
+	startTime, err := parseProcessStartTime(stat)
+	require.NoError(t, err)
+	require.Equal(t, uint64(123456), startTime)
+
+	_, err = parseProcessStartTime("4661 (cmd) S 1")
+	require.Error(t, err)
+}
+
+func TestOpenMonitor(t *testing.T) {
+	startTime, err := processStartTime(os.Getpid())
+	require.NoError(t, err)
+
+	c := &Container{Pid: os.Getpid(), MonitorStartTime: startTime}
+	pidfd, err := c.openMonitor()
+	if err == unix.ENOSYS {
+		t.Skip("pidfd_open is not supported")
+	}
+	require.NoError(t, err)
+	exited, err := pidfdExited(pidfd)
+	require.NoError(t, err)
+	require.False(t, exited)
+	require.NoError(t, unix.Close(pidfd))
+
+	// reused PID
+	c.MonitorStartTime = startTime + 1
+	_, err = c.openMonitor()
+	require.Equal(t, unix.ESRCH, err)
+}
+
+func TestParseProcessExitStatus(t *testing.T) {
+	fields := make([]string, 52)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = "1234"
+	fields[1] = "(lxcri-init)"
+	fields[2] = "Z"
+	fields[51] = "9" // killed by SIGKILL
+	stat := strings.Join(fields, " ")
+
+	status, err := parseProcessExitStatus(stat)
+	require.NoError(t, err)
+	require.True(t, status.Signaled())
+	require.Equal(t, unix.SIGKILL, status.Signal())
+
+	fields[51] = "256" // exit status 1
+	status, err = parseProcessExitStatus(strings.Join(fields, " "))
+	require.NoError(t, err)
+	require.True(t, status.Exited())
+	require.Equal(t, 1, status.ExitStatus())
+
+	fields[2] = "S"
+	_, err = parseProcessExitStatus(strings.Join(fields, " "))
+	require.Error(t, err)
+}
@@ -0,0 +1,6 @@
+// Package api contains the gRPC service definition (runtime.proto)
+// of the runtime API served by lxcrid (see package daemon),
+// and the Go code generated from it.
+package api
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative runtime.proto
@@ -0,0 +1,464 @@
+// Package daemon exposes the lxcri Runtime API to clients of a unix socket.
+//
+// The API is served using gRPC (see the service definition in pkg/daemon/api/runtime.proto),
+// so that it can be used from any language with gRPC support.
+// Container events are streamed by the Events method, and by a lxcri.EventServer
+// on a separate socket for clients without gRPC support.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/daemon/api"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Service implements the gRPC runtime API (api.RuntimeServer) for a lxcri.Runtime.
+// The container stdio of created containers is the stdio of the daemon process,
+// clients should use a console socket or a CRI log file instead.
+//
+// Operations for the same container are serialized by the container lock
+// (see lxcri.Runtime.Lock), which also serializes them with concurrent
+// `lxcri` CLI invocations. Operations for different containers run concurrently.
+// Every operation uses the runtime snapshot that is current when it starts
+// (see lxcri.ReloadableRuntime.Acquire), so the configuration can be reloaded
+// while operations are in progress.
+type Service struct {
+	api.UnimplementedRuntimeServer
+
+	Runtime *lxcri.ReloadableRuntime
+}
+
+// SocketPath returns the default path of the daemon socket in the runtime root.
+func SocketPath(rt *lxcri.Runtime) string {
+	// The socket file is hidden, so it's not listed as container.
+	return filepath.Join(rt.Root, ".lxcrid.sock")
+}
+
+// Dial connects to the daemon socket.
+func Dial(ctx context.Context, socket string) (api.RuntimeClient, *grpc.ClientConn, error) {
+	conn, err := grpc.DialContext(ctx, "unix://"+socket, grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
+	}
+	return api.NewRuntimeClient(conn), conn, nil
+}
+
+// grpcError converts the runtime error to a gRPC status error.
+func grpcError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, lxcri.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, lxcri.ErrExist):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func invalidArgument(format string, args ...interface{}) error {
+	return status.Errorf(codes.InvalidArgument, format, args...)
+}
+
+func timeout(ctx context.Context, sec uint) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(sec)*time.Second)
+}
+
+func load(rt *lxcri.Runtime, id string) (*lxcri.Container, error) {
+	c, err := rt.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	c.Log = rt.Log.With().Str("cid", id).Logger()
+	if err := c.SetLog(rt.LogConfig.ContainerLogFile, rt.LogConfig.ContainerLogLevel); err != nil {
+		release(rt, c)
+		return nil, err
+	}
+	return c, nil
+}
+
+func release(rt *lxcri.Runtime, c *lxcri.Container) {
+	if err := c.Release(); err != nil {
+		rt.Log.Error().Str("cid", c.ContainerID).Msgf("failed to release container: %s", err)
+	}
+}
+
+func unlock(rt *lxcri.Runtime, id string, l *lxcri.Lock) {
+	if err := l.Unlock(); err != nil {
+		rt.Log.Error().Str("cid", id).Msgf("failed to unlock container: %s", err)
+	}
+}
+
+// withContainer calls fn with the loaded container while the container lock is held.
+// The lock is exclusive for operations that modify the container.
+func withContainer(ctx context.Context, rt *lxcri.Runtime, id string, exclusive bool, fn func(*lxcri.Container) error) error {
+	l, err := rt.Lock(ctx, id, exclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock(rt, id, l)
+	c, err := load(rt, id)
+	if err != nil {
+		return err
+	}
+	defer release(rt, c)
+	return fn(c)
+}
+
+// Create creates a new container.
+func (s *Service) Create(ctx context.Context, req *api.CreateRequest) (*api.CreateResponse, error) {
+	if req.Id == "" {
+		return nil, invalidArgument("container ID is required")
+	}
+	rt, done := s.Runtime.Acquire()
+	defer done()
+
+	cfg := lxcri.ContainerConfig{
+		ContainerID:   req.Id,
+		BundlePath:    req.BundlePath,
+		ConsoleSocket: req.ConsoleSocket,
+		CRILogFile:    req.CriLogFile,
+		Labels:        req.Labels,
+		Log:           rt.Log.With().Str("cid", req.Id).Logger(),
+		LogFile:       rt.LogConfig.ContainerLogFile,
+		LogLevel:      rt.LogConfig.ContainerLogLevel,
+	}
+	if len(req.Spec) > 0 {
+		cfg.Spec = new(specs.Spec)
+		if err := json.Unmarshal(req.Spec, cfg.Spec); err != nil {
+			return nil, invalidArgument("invalid container spec: %s", err)
+		}
+	} else {
+		spec, err := specki.LoadSpecJSON(filepath.Join(req.BundlePath, lxcri.BundleConfigFile))
+		if err != nil {
+			return nil, invalidArgument("failed to load container spec from bundle: %s", err)
+		}
+		cfg.Spec = spec
+	}
+
+	// Runtime.Create holds the container lock while the container is created.
+	createCtx, cancel := timeout(ctx, rt.Timeouts.CreateTimeout)
+	defer cancel()
+	c, err := rt.Create(createCtx, &cfg)
+	if err != nil {
+		// The container is nil if the runtime dir was not created,
+		// e.g the runtime dir of an existing container must not be deleted.
+		if c != nil {
+			cleanup(rt, req.Id)
+		}
+		return nil, grpcError(err)
+	}
+	defer release(rt, c)
+	resp := &api.CreateResponse{Pid: int32(c.Pid)}
+	for _, w := range c.Warnings {
+		resp.Warnings = append(resp.Warnings, &api.Warning{Reason: w.Reason, Message: w.Message})
+	}
+	return resp, nil
+}
+
+// cleanup destroys the remains of a failed create.
+// The client context is not used, because it may be cancelled already.
+func cleanup(rt *lxcri.Runtime, id string) {
+	ctx, cancel := timeout(context.Background(), rt.Timeouts.DeleteTimeout)
+	defer cancel()
+	l, err := rt.Lock(ctx, id, true)
+	if err == lxcri.ErrNotExist {
+		return
+	}
+	if err != nil {
+		rt.Log.Error().Str("cid", id).Msgf("failed to destroy container: %s", err)
+		return
+	}
+	defer unlock(rt, id, l)
+	if err := rt.Delete(ctx, id, true); err != nil && err != lxcri.ErrNotExist {
+		rt.Log.Error().Str("cid", id).Msgf("failed to destroy container: %s", err)
+	}
+}
+
+// Start starts the container process of a created container.
+func (s *Service) Start(ctx context.Context, req *api.ContainerRequest) (*api.Empty, error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	ctx, cancel := timeout(ctx, rt.Timeouts.StartTimeout)
+	defer cancel()
+	err := withContainer(ctx, rt, req.Id, true, func(c *lxcri.Container) error {
+		return rt.Start(ctx, c)
+	})
+	return &api.Empty{}, grpcError(err)
+}
+
+// Kill sends a signal to the container process.
+func (s *Service) Kill(ctx context.Context, req *api.KillRequest) (*api.Empty, error) {
+	if req.Signal <= 0 {
+		return nil, invalidArgument("invalid signal %d", req.Signal)
+	}
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	ctx, cancel := timeout(ctx, rt.Timeouts.KillTimeout)
+	defer cancel()
+	err := withContainer(ctx, rt, req.Id, true, func(c *lxcri.Container) error {
+		return rt.Kill(ctx, c, unix.Signal(req.Signal))
+	})
+	return &api.Empty{}, grpcError(err)
+}
+
+// ResizeTerminal sets the terminal size of a container process.
+func (s *Service) ResizeTerminal(ctx context.Context, req *api.ResizeRequest) (*api.Empty, error) {
+	if req.Width > 0xffff || req.Height > 0xffff {
+		return nil, invalidArgument("invalid terminal size %dx%d", req.Width, req.Height)
+	}
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	err := withContainer(ctx, rt, req.Id, false, func(c *lxcri.Container) error {
+		return c.ResizeTerminal(int(req.Pid), lxcri.TerminalSize{Width: uint16(req.Width), Height: uint16(req.Height)})
+	})
+	return &api.Empty{}, grpcError(err)
+}
+
+// Pause freezes all processes of a running container.
+func (s *Service) Pause(ctx context.Context, req *api.ContainerRequest) (*api.Empty, error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	ctx, cancel := timeout(ctx, rt.Timeouts.KillTimeout)
+	defer cancel()
+	err := withContainer(ctx, rt, req.Id, true, func(c *lxcri.Container) error {
+		return rt.Pause(ctx, c)
+	})
+	return &api.Empty{}, grpcError(err)
+}
+
+// Resume thaws all processes of a paused container.
+func (s *Service) Resume(ctx context.Context, req *api.ContainerRequest) (*api.Empty, error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	ctx, cancel := timeout(ctx, rt.Timeouts.KillTimeout)
+	defer cancel()
+	err := withContainer(ctx, rt, req.Id, true, func(c *lxcri.Container) error {
+		return rt.Resume(ctx, c)
+	})
+	return &api.Empty{}, grpcError(err)
+}
+
+// Update updates the resource limits of a container.
+func (s *Service) Update(ctx context.Context, req *api.UpdateRequest) (*api.Empty, error) {
+	resources := new(specs.LinuxResources)
+	if err := json.Unmarshal(req.Resources, resources); err != nil {
+		return nil, invalidArgument("invalid resources: %s", err)
+	}
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	ctx, cancel := timeout(ctx, rt.Timeouts.KillTimeout)
+	defer cancel()
+	err := withContainer(ctx, rt, req.Id, true, func(c *lxcri.Container) error {
+		return rt.Update(ctx, c, resources)
+	})
+	return &api.Empty{}, grpcError(err)
+}
+
+// Delete deletes a container. Deleting a non-existing container is a noop.
+func (s *Service) Delete(ctx context.Context, req *api.DeleteRequest) (*api.Empty, error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	ctx, cancel := timeout(ctx, rt.Timeouts.DeleteTimeout)
+	defer cancel()
+	l, err := rt.Lock(ctx, req.Id, true)
+	if err == lxcri.ErrNotExist {
+		return &api.Empty{}, nil
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	defer unlock(rt, req.Id, l)
+	err = rt.Delete(ctx, req.Id, req.Force)
+	if err == lxcri.ErrNotExist {
+		return &api.Empty{}, nil
+	}
+	return &api.Empty{}, grpcError(err)
+}
+
+// Exec executes a process in a running container and returns its PID.
+func (s *Service) Exec(ctx context.Context, req *api.ExecRequest) (*api.ExecResponse, error) {
+	if len(req.Process) == 0 {
+		return nil, invalidArgument("process is required")
+	}
+	proc := new(specs.Process)
+	if err := json.Unmarshal(req.Process, proc); err != nil {
+		return nil, invalidArgument("invalid process: %s", err)
+	}
+	resp := new(api.ExecResponse)
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	err := withContainer(ctx, rt, req.Id, false, func(c *lxcri.Container) error {
+		pid, err := c.ExecDetached(proc, nil)
+		resp.Pid = int32(pid)
+		return err
+	})
+	return resp, grpcError(err)
+}
+
+// State returns the state of a container.
+func (s *Service) State(ctx context.Context, req *api.ContainerRequest) (*api.StateResponse, error) {
+	state, err := s.state(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	data, err := json.Marshal(state)
+	return &api.StateResponse{State: data}, grpcError(err)
+}
+
+func (s *Service) state(ctx context.Context, id string) (state *lxcri.State, err error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	err = withContainer(ctx, rt, id, false, func(c *lxcri.Container) error {
+		state, err = c.State()
+		return err
+	})
+	return state, err
+}
+
+// Stats returns the resource usage statistics of a container.
+func (s *Service) Stats(ctx context.Context, req *api.ContainerRequest) (*api.StatsResponse, error) {
+	stats, err := s.stats(ctx, req.Id, false)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	data, err := json.Marshal(stats)
+	return &api.StatsResponse{Stats: data}, grpcError(err)
+}
+
+// stats returns the resource usage statistics of a container,
+// and the root filesystem usage if rootfs is true.
+func (s *Service) stats(ctx context.Context, id string, rootfs bool) (stats *lxcri.Stats, err error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	err = withContainer(ctx, rt, id, false, func(c *lxcri.Container) error {
+		stats, err = c.Stats()
+		if err != nil || !rootfs {
+			return err
+		}
+		stats.Rootfs, err = c.RootfsStats()
+		return err
+	})
+	return stats, err
+}
+
+// Processes returns the processes running in a container.
+func (s *Service) Processes(ctx context.Context, req *api.ContainerRequest) (*api.ProcessesResponse, error) {
+	var procs []lxcri.Process
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	err := withContainer(ctx, rt, req.Id, false, func(c *lxcri.Container) (err error) {
+		procs, err = c.Processes()
+		return err
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	data, err := json.Marshal(procs)
+	return &api.ProcessesResponse{Processes: data}, grpcError(err)
+}
+
+// List returns the IDs of all containers.
+func (s *Service) List(ctx context.Context, req *api.Empty) (*api.ListResponse, error) {
+	ids, err := s.list()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &api.ListResponse{Ids: ids}, nil
+}
+
+func (s *Service) list() ([]string, error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	return rt.List()
+}
+
+// Events streams the container lifecycle events (see lxcri.Runtime.Events)
+// until the client cancels the call.
+func (s *Service) Events(req *api.EventsRequest, stream api.Runtime_EventsServer) error {
+	ids := make(map[string]bool, len(req.Ids))
+	for _, id := range req.Ids {
+		ids[id] = true
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	// The snapshot is used until the stream is closed.
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	events, err := rt.Events(ctx)
+	if err != nil {
+		return grpcError(err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return status.Error(codes.ResourceExhausted, "event receiver does not keep up")
+			}
+			if len(ids) > 0 && !ids[ev.ContainerID] {
+				continue
+			}
+			if err := stream.Send(eventMessage(ev)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func eventMessage(ev lxcri.Event) *api.Event {
+	return &api.Event{
+		Type:        ev.Type,
+		ContainerId: ev.ContainerID,
+		Status:      string(ev.Status),
+		Health:      ev.Health,
+		Pid:         int32(ev.Pid),
+		OomKills:    ev.OOMKills,
+		Time:        timestamppb.New(ev.Time),
+	}
+}
+
+// Reload reloads the runtime configuration (see lxcri.ReloadableRuntime.Reload).
+// Operations in progress complete with the previous configuration.
+func (s *Service) Reload() error {
+	return s.Runtime.Reload()
+}
+
+// Serve serves the gRPC API on the listener l until the context is cancelled.
+func Serve(ctx context.Context, l net.Listener, s *Service) error {
+	server := grpc.NewServer()
+	api.RegisterRuntimeServer(server, s)
+
+	go func() {
+		<-ctx.Done()
+		// Event streams are only closed by the client,
+		// so the server is not stopped gracefully.
+		server.Stop()
+	}()
+	if err := server.Serve(l); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to serve runtime API: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/daemon/api"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServeInvalidArgs(t *testing.T) {
+	rt := &lxcri.Runtime{Root: t.TempDir()}
+	l, err := lxcri.ListenUnix(SocketPath(rt))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, l, &Service{Runtime: lxcri.NewReloadableRuntime(rt)})
+	}()
+
+	client, conn, err := Dial(ctx, filepath.Join(rt.Root, ".lxcrid.sock"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = client.Kill(ctx, &api.KillRequest{Id: "c1", Signal: 0})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, "invalid signal 0", status.Convert(err).Message())
+
+	_, err = client.Exec(ctx, &api.ExecRequest{Id: "c1"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, "process is required", status.Convert(err).Message())
+
+	_, err = client.Create(ctx, &api.CreateRequest{Id: "c1", Spec: []byte("{")})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.State(ctx, &api.ContainerRequest{Id: "c1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Delete(ctx, &api.DeleteRequest{Id: "c1"})
+	require.NoError(t, err)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestTailOffset(t *testing.T) {
+	tail := func(data string, n int) string {
+		offset, err := tailOffset(strings.NewReader(data), int64(len(data)), n)
+		require.NoError(t, err)
+		return data[offset:]
+	}
+	data := "a\nb\nc\n"
+	require.Equal(t, "c\n", tail(data, 1))
+	require.Equal(t, "b\nc\n", tail(data, 2))
+	require.Equal(t, "a\nb\nc\n", tail(data, 5))
+	require.Equal(t, "b\nc", tail("a\nb\nc", 2))
+	require.Empty(t, tail(data, 0))
+	require.Empty(t, tail("", 1))
+
+	// lines across block boundaries
+	line := strings.Repeat("x", tailBlockSize/3) + "\n"
+	long := strings.Repeat(line, 10)
+	require.Equal(t, strings.Repeat(line, 4), tail(long, 4))
+	require.Equal(t, long, tail(long, 11))
+}
+
+func TestServeHTTP(t *testing.T) {
+	rt := &lxcri.Runtime{Root: t.TempDir()}
+	socket := filepath.Join(rt.Root, ".http.sock")
+	l, err := lxcri.ListenUnix(socket)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeHTTP(ctx, l, &HTTPHandler{Service: &Service{Runtime: lxcri.NewReloadableRuntime(rt)}})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	for path, code := range map[string]int{
+		"/foo":                       http.StatusNotFound,
+		"/containers/../state":       http.StatusNotFound,
+		"/containers/c1":             http.StatusNotFound,
+		"/containers/c1/logs?tail=x": http.StatusBadRequest,
+	} {
+		resp, err := client.Get("http://lxcrid" + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, code, resp.StatusCode, path)
+	}
+
+	resp, err := client.Get("http://lxcrid/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = client.Post("http://lxcrid/containers", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var b bytes.Buffer
+	writeMetrics(&b, map[string]*lxcri.Timings{
+		"c2": {Create: 1500 * time.Millisecond},
+		"c1": {MonitorSpawn: 20 * time.Millisecond, Start: time.Second},
+	})
+	require.Equal(t, `# HELP lxcri_container_lifecycle_seconds Duration of the container lifecycle operation phases.
+# TYPE lxcri_container_lifecycle_seconds gauge
+lxcri_container_lifecycle_seconds{container="c1",phase="monitor_spawn"} 0.02
+lxcri_container_lifecycle_seconds{container="c1",phase="start"} 1
+lxcri_container_lifecycle_seconds{container="c2",phase="create"} 1.5
+`, b.String())
+}
@@ -0,0 +1,326 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxcri"
+	"golang.org/x/sys/unix"
+)
+
+// HTTPHandler serves a read-only management API for the Service.
+// All responses are JSON encoded, except for the container logs.
+//
+//	GET /containers               - list of container IDs
+//	GET /containers/{id}/state    - container state
+//	GET /containers/{id}/stats    - container resource usage statistics
+//	GET /containers/{id}/logs     - container CRI log file (optional ?tail=<lines>)
+//	GET /metrics                  - container lifecycle timings in the Prometheus text format
+//
+// Clients are authenticated by the credentials of the unix socket peer.
+// Only root, the daemon user and the users in AllowedUIDs are accepted.
+type HTTPHandler struct {
+	Service *Service
+	// AllowedUIDs are the user IDs allowed to use the API
+	// in addition to root and the daemon user.
+	AllowedUIDs []uint32
+}
+
+type peerCredKey struct{}
+
+// ServeHTTP serves the HTTP API on the unix socket listener l until ctx is done.
+func ServeHTTP(ctx context.Context, l net.Listener, h *HTTPHandler) error {
+	srv := &http.Server{
+		Handler: h,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			if uc, ok := conn.(*net.UnixConn); ok {
+				if cred, err := peerCred(uc); err == nil {
+					return context.WithValue(ctx, peerCredKey{}, cred)
+				}
+			}
+			return ctx
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	err := srv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func peerCred(conn *net.UnixConn) (*unix.Ucred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cred, credErr
+}
+
+func (h *HTTPHandler) authorized(r *http.Request) bool {
+	cred, ok := r.Context().Value(peerCredKey{}).(*unix.Ucred)
+	if !ok {
+		return false
+	}
+	if cred.Uid == 0 || cred.Uid == uint32(os.Getuid()) {
+		return true
+	}
+	for _, uid := range h.AllowedUIDs {
+		if cred.Uid == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		httpError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "metrics" {
+		h.serveMetrics(r.Context(), w)
+		return
+	}
+	parts := strings.Split(path, "/")
+	if parts[0] != "containers" || len(parts) > 3 {
+		httpError(w, http.StatusNotFound, fmt.Errorf("path %q not found", r.URL.Path))
+		return
+	}
+	if len(parts) == 1 {
+		ids, err := h.Service.list()
+		writeJSON(w, ids, err)
+		return
+	}
+	// IDs of hidden files are rejected, to prevent path traversal (e.g `..`).
+	if len(parts) != 3 || parts[1] == "" || strings.HasPrefix(parts[1], ".") {
+		httpError(w, http.StatusNotFound, fmt.Errorf("path %q not found", r.URL.Path))
+		return
+	}
+
+	id := parts[1]
+	switch parts[2] {
+	case "state":
+		state, err := h.Service.state(r.Context(), id)
+		writeJSON(w, state, err)
+	case "stats":
+		stats, err := h.Service.stats(r.Context(), id, r.URL.Query().Get("rootfs") == "true")
+		writeJSON(w, stats, err)
+	case "logs":
+		h.serveLogs(w, r, id)
+	default:
+		httpError(w, http.StatusNotFound, fmt.Errorf("path %q not found", r.URL.Path))
+	}
+}
+
+func (h *HTTPHandler) serveLogs(w http.ResponseWriter, r *http.Request, id string) {
+	tail := -1
+	if val := r.URL.Query().Get("tail"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			httpError(w, http.StatusBadRequest, fmt.Errorf("invalid tail value %q", val))
+			return
+		}
+		tail = n
+	}
+
+	logFile, err := h.Service.criLogFile(r.Context(), id)
+	if err != nil {
+		httpError(w, statusCode(err), err)
+		return
+	}
+	if logFile == "" {
+		httpError(w, http.StatusNotFound, fmt.Errorf("container %s has no CRI log file", id))
+		return
+	}
+	f, err := os.Open(logFile)
+	if err != nil {
+		httpError(w, statusCode(err), err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if tail < 0 {
+		_, _ = io.Copy(w, f)
+		return
+	}
+	info, err := f.Stat()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// Lines appended after Stat are not returned.
+	size := info.Size()
+	offset, err := tailOffset(f, size, tail)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, _ = io.Copy(w, io.NewSectionReader(f, offset, size-offset))
+}
+
+// criLogFile returns the CRI log file of the container.
+func (s *Service) criLogFile(ctx context.Context, id string) (logFile string, err error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	err = withContainer(ctx, rt, id, false, func(c *lxcri.Container) error {
+		logFile = c.CRILogFile
+		return nil
+	})
+	return logFile, err
+}
+
+func (h *HTTPHandler) serveMetrics(ctx context.Context, w http.ResponseWriter) {
+	timings, err := h.Service.timings(ctx)
+	if err != nil {
+		httpError(w, statusCode(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, timings)
+}
+
+// timings returns the lifecycle timings of all containers, indexed by container ID.
+// Containers without timings are skipped. Each container is loaded
+// while the shared container lock is held (see withContainer).
+func (s *Service) timings(ctx context.Context) (map[string]*lxcri.Timings, error) {
+	rt, done := s.Runtime.Acquire()
+	defer done()
+	ids, err := rt.List()
+	if err != nil {
+		return nil, err
+	}
+	timings := make(map[string]*lxcri.Timings, len(ids))
+	for _, id := range ids {
+		err := withContainer(ctx, rt, id, false, func(c *lxcri.Container) error {
+			t, err := c.Timings()
+			if err == nil {
+				timings[id] = t
+			}
+			return nil
+		})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			rt.Log.Debug().Str("cid", id).Msgf("skipping container timings: %s", err)
+		}
+	}
+	return timings, nil
+}
+
+// writeMetrics writes the container lifecycle timings in the Prometheus text format.
+// The metrics are sorted by container ID.
+func writeMetrics(w io.Writer, timings map[string]*lxcri.Timings) {
+	ids := make([]string, 0, len(timings))
+	for id := range timings {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	fmt.Fprintln(w, "# HELP lxcri_container_lifecycle_seconds Duration of the container lifecycle operation phases.")
+	fmt.Fprintln(w, "# TYPE lxcri_container_lifecycle_seconds gauge")
+	for _, id := range ids {
+		t := timings[id]
+		for _, phase := range []struct {
+			name string
+			d    time.Duration
+		}{
+			{"config_generation", t.ConfigGeneration},
+			{"monitor_spawn", t.MonitorSpawn},
+			{"init_ready", t.InitReady},
+			{"create", t.Create},
+			{"start", t.Start},
+		} {
+			if phase.d == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "lxcri_container_lifecycle_seconds{container=%q,phase=%q} %g\n", id, phase.name, phase.d.Seconds())
+		}
+	}
+}
+
+// tailBlockSize is the size of the blocks a file is read backwards with by tailOffset.
+const tailBlockSize = 8192
+
+// tailOffset returns the offset of the last n lines in the first size bytes of r.
+// r is read backwards in blocks from size, so only the tail is read.
+// The newline at the end of the last line is not counted.
+func tailOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n == 0 {
+		return size, nil
+	}
+	buf := make([]byte, tailBlockSize)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		block := buf[:end-start]
+		if _, err := r.ReadAt(block, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(block) - 1; i >= 0; i-- {
+			if block[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			n--
+			if n == 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+func statusCode(err error) int {
+	if errors.Is(err, lxcri.ErrNotExist) || errors.Is(err, os.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		httpError(w, statusCode(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,257 @@
+// Package hooks provides ready-made lxcri.HookFunc implementations
+// for common container spec mutations.
+// The hooks can be combined with Compose and registered as lxcri.HookCreate hook e.g
+//
+//	err := rt.RegisterHook(lxcri.Hook{
+//		Name:  "data",
+//		Phase: lxcri.HookCreate,
+//		Func: hooks.Compose(
+//			hooks.BindMount("/var/lib/data", "/data", "ro"),
+//			hooks.Sysctl("net.ipv4.ip_unprivileged_port_start", "0"),
+//		),
+//	})
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxcri"
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Compose returns a HookFunc that calls the given hooks in order.
+// The first hook that fails aborts the execution.
+func Compose(hooks ...lxcri.HookFunc) lxcri.HookFunc {
+	return func(ctx context.Context, c *lxcri.Container) error {
+		for _, h := range hooks {
+			if h == nil {
+				continue
+			}
+			if err := h(ctx, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// InjectDevice adds the device to the container and
+// allows access to it in the device cgroup.
+func InjectDevice(dev specs.LinuxDevice) lxcri.HookFunc {
+	return func(ctx context.Context, c *lxcri.Container) error {
+		linux := linuxSpec(c)
+		for _, d := range linux.Devices {
+			if d.Path == dev.Path {
+				return fmt.Errorf("device %s already exists", dev.Path)
+			}
+		}
+		linux.Devices = append(linux.Devices, dev)
+
+		if linux.Resources == nil {
+			linux.Resources = &specs.LinuxResources{}
+		}
+		major, minor := dev.Major, dev.Minor
+		linux.Resources.Devices = append(linux.Resources.Devices, specs.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   dev.Type,
+			Major:  &major,
+			Minor:  &minor,
+			Access: "rwm",
+		})
+		return nil
+	}
+}
+
+// BindMount adds a bind mount from the host path src to
+// the container path dst with the given additional mount options.
+func BindMount(src string, dst string, opts ...string) lxcri.HookFunc {
+	return func(ctx context.Context, c *lxcri.Container) error {
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("invalid bind mount source: %w", err)
+		}
+		c.Spec.Mounts = append(c.Spec.Mounts, specki.BindMount(src, dst, opts...))
+		return nil
+	}
+}
+
+// Sysctl sets the (namespaced) kernel parameter key to value.
+// An existing value in the container spec is overwritten.
+func Sysctl(key string, value string) lxcri.HookFunc {
+	return func(ctx context.Context, c *lxcri.Container) error {
+		linux := linuxSpec(c)
+		if linux.Sysctl == nil {
+			linux.Sysctl = make(map[string]string)
+		}
+		linux.Sysctl[key] = value
+		return nil
+	}
+}
+
+// ResolvConf writes a resolv.conf file with the given nameservers,
+// search domains and options to the container runtime directory,
+// and bind mounts it (read-only) to /etc/resolv.conf.
+func ResolvConf(nameservers []string, search []string, options []string) lxcri.HookFunc {
+	return func(ctx context.Context, c *lxcri.Container) error {
+		src := c.RuntimePath("resolv.conf")
+		dns := lxcri.DNSConfig{Servers: nameservers, Searches: search, Options: options}
+		// #nosec
+		if err := os.WriteFile(src, dns.ResolvConf(), 0644); err != nil {
+			return fmt.Errorf("failed to write resolv.conf: %w", err)
+		}
+		// chmod is required because umask is applied to WriteFile
+		if err := os.Chmod(src, 0644); err != nil {
+			return err
+		}
+		c.Spec.Mounts = append(c.Spec.Mounts, specki.BindMount(src, "/etc/resolv.conf", "ro"))
+		return nil
+	}
+}
+
+// CreateUser adds a user with the given name, UID, GID and home directory
+// to /etc/passwd and a group with the same name and GID to /etc/group in
+// the container rootfs. Existing entries are not modified.
+// The home directory is not created.
+func CreateUser(name string, uid uint32, gid uint32, home string) lxcri.HookFunc {
+	return func(ctx context.Context, c *lxcri.Container) error {
+		rootfs := c.Spec.Root.Path
+		if !filepath.IsAbs(rootfs) {
+			rootfs = filepath.Join(c.BundlePath, rootfs)
+		}
+		passwd := fmt.Sprintf("%s:x:%d:%d::%s:/bin/sh", name, uid, gid, home)
+		if err := addEntry(rootfs, "etc/passwd", name, uid, passwd); err != nil {
+			return fmt.Errorf("failed to add user %s: %w", name, err)
+		}
+		group := fmt.Sprintf("%s:x:%d:", name, gid)
+		if err := addEntry(rootfs, "etc/group", name, gid, group); err != nil {
+			return fmt.Errorf("failed to add group %s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+// addEntry appends the entry to the passwd(5) or group(5) formatted file
+// with the given path relative to the rootfs (see openInRootfs).
+// Nothing is done if an entry with the same name and ID exists.
+// An error is returned if an entry has either the same name or the same ID.
+func addEntry(rootfs string, filename string, name string, id uint32, entry string) error {
+	f, err := openInRootfs(rootfs, filename, unix.O_RDWR|unix.O_CREAT|unix.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			continue
+		}
+		sameName := fields[0] == name
+		sameID := fields[2] == strconv.FormatUint(uint64(id), 10)
+		if sameName && sameID {
+			return nil
+		}
+		if sameName || sameID {
+			return fmt.Errorf("conflicting entry %q in %s", line, filename)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			entry = "\n" + entry
+		}
+	}
+	_, err = f.WriteString(entry + "\n")
+	return err
+}
+
+// openInRootfs opens the regular file with the given path relative to the rootfs.
+// The rootfs is untrusted, so the path must not contain symlinks,
+// which could point to files on the host (e.g /etc/passwd).
+func openInRootfs(rootfs string, name string, flags int, perm uint32) (*os.File, error) {
+	root, err := unix.Open(rootfs, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: rootfs, Err: err}
+	}
+	defer unix.Close(root)
+
+	how := unix.OpenHow{
+		Flags:   uint64(flags | unix.O_NOFOLLOW | unix.O_CLOEXEC),
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS,
+	}
+	if flags&unix.O_CREAT != 0 {
+		how.Mode = uint64(perm)
+	}
+	fd, err := unix.Openat2(root, name, &how)
+	if err == unix.ENOSYS {
+		// openat2 requires Linux 5.6
+		fd, err = openatNoFollow(root, name, flags, perm)
+	}
+	filename := filepath.Join(rootfs, name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), filename)
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a regular file", filename)
+	}
+	return f, nil
+}
+
+// openatNoFollow opens the path relative to dirfd component by component
+// and fails if a component is a symlink.
+func openatNoFollow(dirfd int, name string, flags int, perm uint32) (int, error) {
+	parts := strings.Split(filepath.Clean(name), "/")
+	fd := dirfd
+	for _, p := range parts[:len(parts)-1] {
+		if p == ".." {
+			return -1, unix.EXDEV
+		}
+		next, err := unix.Openat(fd, p, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if fd != dirfd {
+			unix.Close(fd)
+		}
+		if err != nil {
+			return -1, err
+		}
+		fd = next
+	}
+	file, err := unix.Openat(fd, parts[len(parts)-1], flags|unix.O_NOFOLLOW|unix.O_CLOEXEC, perm)
+	if fd != dirfd {
+		unix.Close(fd)
+	}
+	return file, err
+}
+
+func linuxSpec(c *lxcri.Container) *specs.Linux {
+	if c.Spec.Linux == nil {
+		c.Spec.Linux = &specs.Linux{}
+	}
+	return c.Spec.Linux
+}
@@ -0,0 +1,96 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lxc/lxcri"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func newContainer(rootfs string) *lxcri.Container {
+	return &lxcri.Container{ContainerConfig: &lxcri.ContainerConfig{
+		Spec: &specs.Spec{Root: &specs.Root{Path: rootfs}},
+	}}
+}
+
+func TestCompose(t *testing.T) {
+	c := newContainer("/")
+	dev := specs.LinuxDevice{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 229}
+	hook := Compose(
+		Sysctl("net.ipv4.ip_forward", "1"),
+		InjectDevice(dev),
+		BindMount("/", "/host", "ro"),
+	)
+	require.NoError(t, hook(context.Background(), c))
+	require.Equal(t, "1", c.Spec.Linux.Sysctl["net.ipv4.ip_forward"])
+	require.Equal(t, []specs.LinuxDevice{dev}, c.Spec.Linux.Devices)
+	require.Len(t, c.Spec.Linux.Resources.Devices, 1)
+	require.True(t, c.Spec.Linux.Resources.Devices[0].Allow)
+	require.Len(t, c.Spec.Mounts, 1)
+	require.Equal(t, "/host", c.Spec.Mounts[0].Destination)
+
+	// duplicate device
+	require.Error(t, InjectDevice(dev)(context.Background(), c))
+	// missing bind mount source
+	require.Error(t, BindMount("/does/not/exist", "/x")(context.Background(), c))
+}
+
+func TestCreateUser(t *testing.T) {
+	rootfs, err := os.MkdirTemp("", "lxcri-test-hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootfs)
+
+	require.NoError(t, os.Mkdir(filepath.Join(rootfs, "etc"), 0755))
+	passwd := filepath.Join(rootfs, "etc", "passwd")
+	require.NoError(t, os.WriteFile(passwd, []byte("root:x:0:0::/root:/bin/sh"), 0644))
+
+	c := newContainer(rootfs)
+	hook := CreateUser("app", 1000, 1000, "/home/app")
+	require.NoError(t, hook(context.Background(), c))
+	// adding the same user again is a noop
+	require.NoError(t, hook(context.Background(), c))
+
+	data, err := os.ReadFile(passwd)
+	require.NoError(t, err)
+	require.Equal(t, "root:x:0:0::/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(rootfs, "etc", "group"))
+	require.NoError(t, err)
+	require.Equal(t, "app:x:1000:\n", string(data))
+
+	// conflicting UID
+	require.Error(t, CreateUser("other", 1000, 1001, "/")(context.Background(), c))
+}
+
+func TestCreateUserSymlink(t *testing.T) {
+	rootfs := t.TempDir()
+	host := filepath.Join(t.TempDir(), "passwd")
+	require.NoError(t, os.WriteFile(host, []byte("root:x:0:0::/root:/bin/sh\n"), 0644))
+
+	// etc/passwd points to a host file
+	require.NoError(t, os.Mkdir(filepath.Join(rootfs, "etc"), 0755))
+	require.NoError(t, os.Symlink(host, filepath.Join(rootfs, "etc", "passwd")))
+	c := newContainer(rootfs)
+	require.Error(t, CreateUser("app", 1000, 1000, "/home/app")(context.Background(), c))
+
+	// etc points to a host directory
+	require.NoError(t, os.RemoveAll(filepath.Join(rootfs, "etc")))
+	require.NoError(t, os.Symlink(filepath.Dir(host), filepath.Join(rootfs, "etc")))
+	require.Error(t, CreateUser("app", 1000, 1000, "/home/app")(context.Background(), c))
+
+	data, err := os.ReadFile(host)
+	require.NoError(t, err)
+	require.Equal(t, "root:x:0:0::/root:/bin/sh\n", string(data))
+
+	// the fallback for kernels without openat2 refuses symlinks as well
+	root, err := unix.Open(rootfs, unix.O_PATH|unix.O_DIRECTORY, 0)
+	require.NoError(t, err)
+	defer unix.Close(root)
+	_, err = openatNoFollow(root, "etc/passwd", unix.O_RDWR|unix.O_APPEND, 0)
+	require.Error(t, err)
+}
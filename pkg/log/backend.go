@@ -0,0 +1,275 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Backend is a log sink with its own minimum log level.
+// Log events below the backend level are not written to the backend.
+// Backend implements zerolog.LevelWriter.
+type Backend interface {
+	io.WriteCloser
+	WriteLevel(level zerolog.Level, p []byte) (int, error)
+	Level() zerolog.Level
+}
+
+type writerBackend struct {
+	zerolog.LevelWriter
+	level  zerolog.Level
+	closer io.Closer
+}
+
+func (b *writerBackend) Level() zerolog.Level {
+	return b.level
+}
+
+func (b *writerBackend) Close() error {
+	if b.closer == nil {
+		return nil
+	}
+	return b.closer.Close()
+}
+
+type levelWriterAdapter struct {
+	io.Writer
+}
+
+func (w levelWriterAdapter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	return w.Write(p)
+}
+
+// WriterBackend returns a Backend that writes the JSON log events to w.
+// Close closes w if it implements io.Closer.
+func WriterBackend(w io.Writer, level zerolog.Level) Backend {
+	b := &writerBackend{level: level}
+	if lw, ok := w.(zerolog.LevelWriter); ok {
+		b.LevelWriter = lw
+	} else {
+		b.LevelWriter = levelWriterAdapter{w}
+	}
+	if c, ok := w.(io.Closer); ok {
+		b.closer = c
+	}
+	return b
+}
+
+// FileBackend returns a Backend that appends to the given log file (see OpenFile).
+func FileBackend(name string, mode os.FileMode, level zerolog.Level) (Backend, error) {
+	f, err := OpenFile(name, mode)
+	if err != nil {
+		return nil, err
+	}
+	return WriterBackend(f, level), nil
+}
+
+// ConsoleBackend returns a Backend that writes human readable log events to stdout.
+func ConsoleBackend(color bool, level zerolog.Level) Backend {
+	return &writerBackend{
+		LevelWriter: levelWriterAdapter{zerolog.ConsoleWriter{Out: os.Stdout, NoColor: !color, TimeFormat: TimeFormat}},
+		level:       level,
+	}
+}
+
+// SyslogBackend returns a Backend that writes to the local syslog daemon
+// with the facility LOG_DAEMON and the given tag.
+func SyslogBackend(tag string, level zerolog.Level) (Backend, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &writerBackend{LevelWriter: zerolog.SyslogLevelWriter(w), level: level, closer: w}, nil
+}
+
+// JournaldSocket is the path of the systemd-journald native protocol socket.
+var JournaldSocket = "/run/systemd/journal/socket"
+
+type journaldWriter struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// JournaldBackend returns a Backend that sends log events to systemd-journald
+// using the native journal protocol. The log message is sent as MESSAGE field,
+// all other event fields are sent as upper case fields e.g `CID`.
+// The identifier is sent as SYSLOG_IDENTIFIER.
+func JournaldBackend(identifier string, level zerolog.Level) (Backend, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: JournaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	w := &journaldWriter{conn: conn, identifier: identifier}
+	return &writerBackend{LevelWriter: w, level: level, closer: conn}, nil
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *journaldWriter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	writeJournalField(&buf, "PRIORITY", fmt.Sprintf("%d", journalPriority(l)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", w.identifier)
+	for k, v := range fields {
+		switch k {
+		case zerolog.LevelFieldName, zerolog.TimestampFieldName:
+			continue
+		case zerolog.MessageFieldName:
+			k = "MESSAGE"
+		}
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		writeJournalField(&buf, journalFieldName(k), s)
+	}
+	if _, err := w.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeJournalField writes the field in the binary safe format
+// `<NAME>\n<64bit little endian size><value>\n`.
+func writeJournalField(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName converts the name to a valid journal field name,
+// which consists of upper case letters, digits and underscores only.
+func journalFieldName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z':
+			b[i] = c - 'a' + 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	// Fields starting with an underscore are trusted fields set by journald.
+	if len(b) == 0 || b[0] == '_' {
+		return "X" + string(b)
+	}
+	return string(b)
+}
+
+func journalPriority(l zerolog.Level) syslog.Priority {
+	switch l {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return syslog.LOG_DEBUG
+	case zerolog.WarnLevel:
+		return syslog.LOG_WARNING
+	case zerolog.ErrorLevel:
+		return syslog.LOG_ERR
+	case zerolog.FatalLevel:
+		return syslog.LOG_CRIT
+	case zerolog.PanicLevel:
+		return syslog.LOG_EMERG
+	default:
+		return syslog.LOG_INFO
+	}
+}
+
+// MemoryBackend is a Backend that keeps the log events in memory.
+// It is safe for concurrent use.
+type MemoryBackend struct {
+	level  zerolog.Level
+	mutex  sync.Mutex
+	events [][]byte
+}
+
+// NewMemoryBackend returns a new MemoryBackend with the given level.
+func NewMemoryBackend(level zerolog.Level) *MemoryBackend {
+	return &MemoryBackend{level: level}
+}
+
+// Write implements io.Writer.
+func (b *MemoryBackend) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.events = append(b.events, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (b *MemoryBackend) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	return b.Write(p)
+}
+
+// Level implements Backend.
+func (b *MemoryBackend) Level() zerolog.Level {
+	return b.level
+}
+
+// Close implements Backend.
+func (b *MemoryBackend) Close() error {
+	return nil
+}
+
+// Events returns a copy of the JSON encoded log events.
+func (b *MemoryBackend) Events() [][]byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([][]byte(nil), b.events...)
+}
+
+// multiBackend writes log events to all backends
+// whose level is lower or equal to the event level.
+type multiBackend []Backend
+
+func (m multiBackend) Write(p []byte) (int, error) {
+	return m.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (m multiBackend) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	var firstErr error
+	for _, b := range m {
+		if l != zerolog.NoLevel && l < b.Level() {
+			continue
+		}
+		if _, err := b.WriteLevel(l, p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return len(p), firstErr
+}
+
+// minLevel returns the lowest level of all backends.
+func (m multiBackend) minLevel() zerolog.Level {
+	level := zerolog.Disabled
+	for _, b := range m {
+		if b.Level() < level {
+			level = b.Level()
+		}
+	}
+	return level
+}
+
+// NewMultiLogger creates a new zerolog.Context that writes to all the given backends.
+// Each backend only receives the events that match its level.
+// The returned context is configured to log with timestamp and caller information.
+func NewMultiLogger(backends ...Backend) zerolog.Context {
+	m := multiBackend(backends)
+	return NewLogger(m, m.minLevel())
+}
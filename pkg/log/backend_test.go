@@ -0,0 +1,42 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiLogger(t *testing.T) {
+	debug := NewMemoryBackend(DebugLevel)
+	warn := NewMemoryBackend(WarnLevel)
+	l := NewMultiLogger(debug, warn).Logger()
+
+	l.Trace().Msg("trace")
+	l.Debug().Msg("debug")
+	l.Info().Msg("info")
+	l.Warn().Msg("warn")
+	l.Log().Msg("nolevel")
+
+	require.Len(t, debug.Events(), 4)
+	require.Len(t, warn.Events(), 2)
+	require.Contains(t, string(warn.Events()[0]), `"m":"warn"`)
+	require.Contains(t, string(warn.Events()[1]), `"m":"nolevel"`)
+}
+
+func TestJournalField(t *testing.T) {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", "foo\nbar")
+	expected := []byte("MESSAGE\n")
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, 7)
+	expected = append(expected, size...)
+	expected = append(expected, []byte("foo\nbar\n")...)
+	require.Equal(t, expected, buf.Bytes())
+
+	require.Equal(t, "CID", journalFieldName("cid"))
+	require.Equal(t, "EXIT_CODE", journalFieldName("exit-code"))
+	require.Equal(t, "X_TRUSTED", journalFieldName("_trusted"))
+	require.Equal(t, "X_", journalFieldName("1"))
+}
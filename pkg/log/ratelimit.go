@@ -0,0 +1,122 @@
+package log
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// RateLimit limits the number of log events to Burst events per Period.
+type RateLimit struct {
+	// Burst is the number of events logged per Period.
+	// A Burst of zero disables the rate limit.
+	Burst uint `json:",omitempty"`
+	// Period is the rate limit period in milliseconds.
+	Period uint `json:",omitempty"`
+}
+
+// maxRateLimitKeys is the number of event types that are tracked.
+// Expired periods are dropped if the limit is reached,
+// because the messages of formatted events (Msgf) are unbounded.
+const maxRateLimitKeys = 1024
+
+type rateLimitCounter struct {
+	start      time.Time
+	count      uint
+	suppressed uint
+}
+
+// RateLimiter is a zerolog.Hook that rate limits log events by message.
+// Events with the same message are of the same type.
+// The first event of a new period has the field `suppressed`,
+// if events were discarded in the previous period.
+type RateLimiter struct {
+	// MaxLevel is the maximum level of rate limited events.
+	// Events above MaxLevel (e.g warnings and errors) are always logged.
+	MaxLevel zerolog.Level
+	// Default is the rate limit for events without an explicit rate limit.
+	Default RateLimit
+	// Limits are the rate limits for specific event messages.
+	Limits map[string]RateLimit
+
+	mutex    sync.Mutex
+	counters map[string]*rateLimitCounter
+	now      func() time.Time
+}
+
+// NewRateLimiter returns a new RateLimiter for debug and trace events.
+func NewRateLimiter(def RateLimit, limits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{
+		MaxLevel: zerolog.DebugLevel,
+		Default:  def,
+		Limits:   limits,
+		counters: make(map[string]*rateLimitCounter),
+		now:      time.Now,
+	}
+}
+
+// Run implements zerolog.Hook.
+func (r *RateLimiter) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level > r.MaxLevel || level == zerolog.NoLevel {
+		return
+	}
+	limit, ok := r.Limits[msg]
+	if !ok {
+		limit = r.Default
+	}
+	if limit.Burst == 0 {
+		return
+	}
+	allow, suppressed := r.allow(msg, limit)
+	if !allow {
+		e.Discard()
+		return
+	}
+	if suppressed > 0 {
+		e.Uint("suppressed", suppressed)
+	}
+}
+
+func (r *RateLimiter) allow(key string, limit RateLimit) (bool, uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+	period := time.Duration(limit.Period) * time.Millisecond
+	c, exist := r.counters[key]
+	if !exist {
+		if len(r.counters) >= maxRateLimitKeys {
+			r.expire(now, period)
+		}
+		c = &rateLimitCounter{start: now}
+		r.counters[key] = c
+	}
+
+	var suppressed uint
+	if now.Sub(c.start) >= period {
+		suppressed = c.suppressed
+		c.start = now
+		c.count = 0
+		c.suppressed = 0
+	}
+	if c.count >= limit.Burst {
+		c.suppressed++
+		return false, 0
+	}
+	c.count++
+	return true, suppressed
+}
+
+// expire removes the counters whose period has expired.
+// All counters are removed if none has expired.
+func (r *RateLimiter) expire(now time.Time, period time.Duration) {
+	for k, c := range r.counters {
+		if now.Sub(c.start) >= period {
+			delete(r.counters, k)
+		}
+	}
+	if len(r.counters) >= maxRateLimitKeys {
+		r.counters = make(map[string]*rateLimitCounter)
+	}
+}
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimiter(RateLimit{Burst: 2, Period: 1000}, map[string]RateLimit{
+		"unlimited": {},
+	})
+	r.now = func() time.Time { return now }
+
+	mem := NewMemoryBackend(TraceLevel)
+	l := NewMultiLogger(mem).Logger().Hook(r)
+
+	for i := 0; i < 5; i++ {
+		l.Debug().Msg("poll")
+		l.Debug().Msg("unlimited")
+		l.Warn().Msg("warn")
+	}
+	require.Len(t, mem.Events(), 2+5+5)
+
+	now = now.Add(time.Second)
+	l.Trace().Msg("poll")
+	events := mem.Events()
+	require.Len(t, events, 13)
+	require.Contains(t, string(events[12]), `"suppressed":3`)
+}
+
+func TestRateLimiterExpire(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimiter(RateLimit{Burst: 1, Period: 1000}, nil)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < maxRateLimitKeys; i++ {
+		allow, _ := r.allow(string(rune(i)), r.Default)
+		require.True(t, allow)
+	}
+	require.Len(t, r.counters, maxRateLimitKeys)
+
+	now = now.Add(time.Second)
+	allow, _ := r.allow("new", r.Default)
+	require.True(t, allow)
+	require.Len(t, r.counters, 1)
+}
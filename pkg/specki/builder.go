@@ -0,0 +1,196 @@
+package specki
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Builder constructs a specs.Spec step by step.
+// The first error of a builder method is recorded and returned by Build.
+// Methods called after an error are ignored.
+type Builder struct {
+	spec *specs.Spec
+	err  error
+}
+
+// NewBuilder returns a Builder that starts with the spec returned by NewSpec.
+func NewBuilder(rootfs string, cmd string, args ...string) *Builder {
+	return &Builder{spec: NewSpec(rootfs, cmd, args...)}
+}
+
+// Build validates the spec (see Validate) and returns it.
+func (b *Builder) Build() (*specs.Spec, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := Validate(b.spec); err != nil {
+		return nil, err
+	}
+	return b.spec, nil
+}
+
+func (b *Builder) with(fn func(spec *specs.Spec) error) *Builder {
+	if b.err == nil {
+		b.err = fn(b.spec)
+	}
+	return b
+}
+
+// WithUser sets the user and group IDs of the container process.
+func (b *Builder) WithUser(uid uint32, gid uint32, additionalGids ...uint32) *Builder {
+	return b.with(func(spec *specs.Spec) error {
+		spec.Process.User = specs.User{UID: uid, GID: gid, AdditionalGids: additionalGids}
+		return nil
+	})
+}
+
+// WithIDMappings sets the user and group ID mappings and
+// adds the user namespace if it is not defined.
+func (b *Builder) WithIDMappings(uidMappings []specs.LinuxIDMapping, gidMappings []specs.LinuxIDMapping) *Builder {
+	return b.with(func(spec *specs.Spec) error {
+		if len(uidMappings) == 0 || len(gidMappings) == 0 {
+			return fmt.Errorf("uid and gid mappings are required")
+		}
+		spec.Linux.UIDMappings = uidMappings
+		spec.Linux.GIDMappings = gidMappings
+		if !hasNamespace(spec, specs.UserNamespace) {
+			spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+		}
+		return nil
+	})
+}
+
+// WithMount adds the given mount. A mount with the same destination is replaced.
+func (b *Builder) WithMount(m specs.Mount) *Builder {
+	return b.with(func(spec *specs.Spec) error {
+		for i := range spec.Mounts {
+			if spec.Mounts[i].Destination == m.Destination {
+				spec.Mounts[i] = m
+				return nil
+			}
+		}
+		spec.Mounts = append(spec.Mounts, m)
+		return nil
+	})
+}
+
+// WithDevice adds the given device and a device cgroup rule,
+// that grants the given access (e.g `rwm`) to the device.
+func (b *Builder) WithDevice(dev specs.LinuxDevice, access string) *Builder {
+	return b.with(func(spec *specs.Spec) error {
+		exist, err := IsDeviceEnabled(spec, dev)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			spec.Linux.Devices = append(spec.Linux.Devices, dev)
+		}
+		if spec.Linux.Resources == nil {
+			spec.Linux.Resources = &specs.LinuxResources{}
+		}
+		spec.Linux.Resources.Devices = append(spec.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+			Allow: true, Type: dev.Type, Major: int64p(dev.Major), Minor: int64p(dev.Minor), Access: access,
+		})
+		return nil
+	})
+}
+
+// WithSeccompProfile loads the JSON encoded seccomp profile
+// (specs.LinuxSeccomp) from the given file.
+func (b *Builder) WithSeccompProfile(filename string) *Builder {
+	return b.with(func(spec *specs.Spec) error {
+		seccomp := new(specs.LinuxSeccomp)
+		if err := DecodeJSONFile(filename, seccomp); err != nil {
+			return fmt.Errorf("failed to load seccomp profile: %w", err)
+		}
+		spec.Linux.Seccomp = seccomp
+		return nil
+	})
+}
+
+// WithCaps sets the bounding, effective and permitted capabilities
+// of the container process. The capability names are case insensitive
+// and the prefix `CAP_` is optional e.g `CAP_SYS_ADMIN` or `sys_admin`.
+func (b *Builder) WithCaps(caps ...string) *Builder {
+	return b.with(func(spec *specs.Spec) error {
+		names := make([]string, len(caps))
+		for i, c := range caps {
+			name := strings.ToUpper(c)
+			if !strings.HasPrefix(name, "CAP_") {
+				name = "CAP_" + name
+			}
+			names[i] = name
+		}
+		spec.Process.Capabilities = &specs.LinuxCapabilities{
+			Bounding:  names,
+			Effective: names,
+			Permitted: names,
+		}
+		return nil
+	})
+}
+
+func hasNamespace(spec *specs.Spec, t specs.LinuxNamespaceType) bool {
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the given spec for errors that would
+// prevent the container from being created.
+func Validate(spec *specs.Spec) error {
+	if spec.Root == nil || spec.Root.Path == "" {
+		return fmt.Errorf("root path is required")
+	}
+	if spec.Process == nil || len(spec.Process.Args) == 0 {
+		return fmt.Errorf("process args are required")
+	}
+	if !filepath.IsAbs(spec.Process.Cwd) {
+		return fmt.Errorf("process cwd %q is not an absolute path", spec.Process.Cwd)
+	}
+	if spec.Linux == nil {
+		return fmt.Errorf("linux section is required")
+	}
+	for _, m := range spec.Mounts {
+		if !filepath.IsAbs(m.Destination) {
+			return fmt.Errorf("mount destination %q is not an absolute path", m.Destination)
+		}
+	}
+	for _, dev := range spec.Linux.Devices {
+		if !filepath.IsAbs(dev.Path) {
+			return fmt.Errorf("device path %q is not an absolute path", dev.Path)
+		}
+		switch dev.Type {
+		case "c", "b", "u", "p":
+		default:
+			return fmt.Errorf("device %s has invalid type %q", dev.Path, dev.Type)
+		}
+	}
+	if caps := spec.Process.Capabilities; caps != nil {
+		for _, set := range [][]string{caps.Bounding, caps.Effective, caps.Permitted, caps.Inheritable, caps.Ambient} {
+			for _, c := range set {
+				if !strings.HasPrefix(c, "CAP_") {
+					return fmt.Errorf("invalid capability name %q", c)
+				}
+			}
+		}
+	}
+	hasMappings := len(spec.Linux.UIDMappings) > 0 || len(spec.Linux.GIDMappings) > 0
+	if hasMappings && !hasNamespace(spec, specs.UserNamespace) {
+		return fmt.Errorf("id mappings require a user namespace")
+	}
+	for _, mappings := range [][]specs.LinuxIDMapping{spec.Linux.UIDMappings, spec.Linux.GIDMappings} {
+		for _, m := range mappings {
+			if m.Size == 0 {
+				return fmt.Errorf("id mapping %d:%d has size zero", m.ContainerID, m.HostID)
+			}
+		}
+	}
+	return nil
+}
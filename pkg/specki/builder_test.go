@@ -0,0 +1,79 @@
+package specki
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	tmpdir := t.TempDir()
+	profile := filepath.Join(tmpdir, "seccomp.json")
+	require.NoError(t, os.WriteFile(profile, []byte(`{"defaultAction":"SCMP_ACT_ERRNO"}`), 0640))
+
+	fuse := specs.LinuxDevice{Type: "c", Major: 10, Minor: 229, Path: "/dev/fuse"}
+	spec, err := NewBuilder("/rootfs", "/bin/sh", "-c", "true").
+		WithUser(1000, 1000, 10).
+		WithIDMappings(
+			[]specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}},
+			[]specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}},
+		).
+		WithMount(BindMount("/etc/hosts", "/etc/hosts", "ro")).
+		WithMount(specs.Mount{Destination: "/dev", Source: "tmpfs", Type: "tmpfs"}).
+		WithDevice(fuse, "rwm").
+		WithSeccompProfile(profile).
+		WithCaps("CAP_CHOWN", "net_bind_service").
+		Build()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"/bin/sh", "-c", "true"}, spec.Process.Args)
+	require.Equal(t, specs.User{UID: 1000, GID: 1000, AdditionalGids: []uint32{10}}, spec.Process.User)
+	require.True(t, hasNamespace(spec, specs.UserNamespace))
+	require.Len(t, spec.Mounts, 3)
+	require.Equal(t, "tmpfs", spec.Mounts[1].Type)
+	require.Equal(t, "/etc/hosts", spec.Mounts[2].Destination)
+	enabled, err := IsDeviceEnabled(spec, fuse)
+	require.NoError(t, err)
+	require.True(t, enabled)
+	require.Equal(t, specs.ActErrno, spec.Linux.Seccomp.DefaultAction)
+	require.Equal(t, []string{"CAP_CHOWN", "CAP_NET_BIND_SERVICE"}, spec.Process.Capabilities.Permitted)
+}
+
+func TestBuilderError(t *testing.T) {
+	// The first error is returned.
+	_, err := NewBuilder("/rootfs", "/bin/sh").
+		WithSeccompProfile("/nonexistent.json").
+		WithIDMappings(nil, nil).
+		Build()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "seccomp")
+
+	_, err = NewBuilder("/rootfs", "/bin/sh").
+		WithDevice(specs.LinuxDevice{Type: "x", Path: "/dev/foo"}, "rwm").
+		Build()
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	spec := NewSpec("/rootfs", "/bin/sh")
+	require.NoError(t, Validate(spec))
+
+	spec.Process.Cwd = "tmp"
+	require.Error(t, Validate(spec))
+	spec.Process.Cwd = "/"
+
+	spec.Mounts = append(spec.Mounts, specs.Mount{Destination: "relative"})
+	require.Error(t, Validate(spec))
+	spec.Mounts = spec.Mounts[:len(spec.Mounts)-1]
+
+	spec.Linux.UIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+	require.Error(t, Validate(spec))
+	spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+	require.NoError(t, Validate(spec))
+
+	spec.Process.Capabilities = &specs.LinuxCapabilities{Bounding: []string{"sys_admin"}}
+	require.Error(t, Validate(spec))
+}
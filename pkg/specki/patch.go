@@ -0,0 +1,347 @@
+package specki
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// PatchOperation is a JSON patch operation (RFC 6902).
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// PatchSpec applies the JSON patch document (RFC 6902) to a copy of the given spec.
+// The patch is applied atomically, the copy is only returned
+// if all operations were successful.
+func PatchSpec(spec *specs.Spec, patch []byte) (*specs.Spec, error) {
+	var ops []PatchOperation
+	if err := decodeJSON(patch, &ops); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON patch: %w", err)
+	}
+	doc, err := toJSONValue(spec)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		doc, err = applyPatchOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s) failed: %w", i, op.Op, op.Path, err)
+		}
+	}
+	return fromJSONValue(doc)
+}
+
+// MergeSpec overlays the partial JSON encoded spec document on a copy of the given spec.
+// The merge follows the JSON merge patch semantics (RFC 7386):
+// Objects are merged recursively and a null value removes the member.
+// Arrays are replaced, except for the following arrays whose elements
+// are merged by a key. An overlay element replaces the base element
+// with the same key, other overlay elements are appended.
+//
+//	mounts         - by destination
+//	linux.devices  - by path
+//	process.env    - by variable name
+func MergeSpec(spec *specs.Spec, overlay []byte) (*specs.Spec, error) {
+	var patch interface{}
+	if err := decodeJSON(overlay, &patch); err != nil {
+		return nil, fmt.Errorf("failed to decode spec overlay: %w", err)
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("spec overlay must be a JSON object")
+	}
+	doc, err := toJSONValue(spec)
+	if err != nil {
+		return nil, err
+	}
+	return fromJSONValue(mergeJSONValue(doc, patch, ""))
+}
+
+// mergeKeys are the functions that return the merge key
+// of the elements of the array at the given path.
+var mergeKeys = map[string]func(v interface{}) (string, bool){
+	"/mounts":        memberKey("destination"),
+	"/linux/devices": memberKey("path"),
+	"/process/env": func(v interface{}) (string, bool) {
+		s, ok := v.(string)
+		if !ok {
+			return "", false
+		}
+		return strings.SplitN(s, "=", 2)[0], true
+	},
+}
+
+func memberKey(name string) func(v interface{}) (string, bool) {
+	return func(v interface{}) (string, bool) {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		key, ok := obj[name].(string)
+		return key, ok
+	}
+}
+
+func mergeJSONValue(base interface{}, patch interface{}, path string) interface{} {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			b = make(map[string]interface{})
+		}
+		for k, v := range p {
+			if v == nil {
+				delete(b, k)
+				continue
+			}
+			b[k] = mergeJSONValue(b[k], v, path+"/"+escapePointerToken(k))
+		}
+		return b
+	case []interface{}:
+		keyFn, ok := mergeKeys[path]
+		b, isArray := base.([]interface{})
+		if !ok || !isArray {
+			return p
+		}
+		return mergeArray(b, p, keyFn)
+	default:
+		return patch
+	}
+}
+
+func mergeArray(base []interface{}, patch []interface{}, keyFn func(v interface{}) (string, bool)) []interface{} {
+	index := make(map[string]int, len(base))
+	for i, v := range base {
+		if key, ok := keyFn(v); ok {
+			index[key] = i
+		}
+	}
+	for _, v := range patch {
+		if key, ok := keyFn(v); ok {
+			if i, exist := index[key]; exist {
+				base[i] = v
+				continue
+			}
+			index[key] = len(base)
+		}
+		base = append(base, v)
+	}
+	return base
+}
+
+func applyPatchOperation(doc interface{}, op PatchOperation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, op.Value)
+	case "remove":
+		return removeValue(doc, path)
+	case "replace":
+		if len(path) == 0 {
+			return op.Value, nil
+		}
+		doc, err = removeValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, op.Value)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		val, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			doc, err = removeValue(doc, from)
+		} else {
+			val, err = copyJSONValue(val)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, val)
+	case "test":
+		val, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(val, op.Value) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// parsePointer parses a JSON pointer (RFC 6901) into its reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func escapePointerToken(t string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1")
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || strconv.Itoa(i) != token {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			val, ok := v[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", t)
+			}
+			doc = val
+		case []interface{}:
+			i, err := arrayIndex(t, len(v)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("can not resolve %q in a scalar value", t)
+		}
+	}
+	return doc, nil
+}
+
+// updateValue calls fn with the parent of the value at the given path and
+// the last reference token, and replaces the parent with the result of fn.
+func updateValue(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	child, err := getValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = updateValue(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		v[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(v)-1)
+		v[i] = child
+	}
+	return doc, nil
+}
+
+func addValue(doc interface{}, path []string, val interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	return updateValue(doc, path, func(parent interface{}, t string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			v[t] = val
+			return v, nil
+		case []interface{}:
+			if t == "-" {
+				return append(v, val), nil
+			}
+			i, err := arrayIndex(t, len(v))
+			if err != nil {
+				return nil, err
+			}
+			v = append(v, nil)
+			copy(v[i+1:], v[i:])
+			v[i] = val
+			return v, nil
+		default:
+			return nil, fmt.Errorf("can not add %q to a scalar value", t)
+		}
+	})
+}
+
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("can not remove the document root")
+	}
+	return updateValue(doc, path, func(parent interface{}, t string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := v[t]; !ok {
+				return nil, fmt.Errorf("member %q does not exist", t)
+			}
+			delete(v, t)
+			return v, nil
+		case []interface{}:
+			i, err := arrayIndex(t, len(v)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(v[:i], v[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("can not remove %q from a scalar value", t)
+		}
+	})
+}
+
+// decodeJSON decodes numbers as json.Number to preserve
+// the precision of large integer values e.g memory limits.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	err = decodeJSON(data, &doc)
+	return doc, err
+}
+
+func copyJSONValue(v interface{}) (interface{}, error) {
+	return toJSONValue(v)
+}
+
+func fromJSONValue(doc interface{}) (*specs.Spec, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	spec := new(specs.Spec)
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	return spec, nil
+}
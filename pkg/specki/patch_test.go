@@ -0,0 +1,84 @@
+package specki
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchSpec(t *testing.T) {
+	spec := NewSpec("/rootfs", "/bin/sh")
+	spec.Hostname = "foo"
+	spec.Process.Env = []string{"A=1", "B=2"}
+
+	patch := `[
+		{"op": "test", "path": "/hostname", "value": "foo"},
+		{"op": "replace", "path": "/hostname", "value": "bar"},
+		{"op": "add", "path": "/mounts/1", "value": {"destination": "/sys", "type": "sysfs", "source": "sysfs"}},
+		{"op": "remove", "path": "/mounts/0"},
+		{"op": "add", "path": "/process/env/-", "value": "C=3"},
+		{"op": "copy", "from": "/process/env/0", "path": "/process/args/-"},
+		{"op": "move", "from": "/hostname", "path": "/process/cwd"}
+	]`
+	patched, err := PatchSpec(spec, []byte(patch))
+	require.NoError(t, err)
+	require.Equal(t, "", patched.Hostname)
+	require.Equal(t, "bar", patched.Process.Cwd)
+	require.Len(t, patched.Mounts, 2)
+	require.Equal(t, "/sys", patched.Mounts[0].Destination)
+	require.Equal(t, "/dev", patched.Mounts[1].Destination)
+	require.Equal(t, []string{"A=1", "B=2", "C=3"}, patched.Process.Env)
+	require.Equal(t, []string{"/bin/sh", "A=1"}, patched.Process.Args)
+
+	// the given spec is not modified
+	require.Equal(t, "foo", spec.Hostname)
+	require.Len(t, spec.Mounts, 2)
+	require.Equal(t, "/proc", spec.Mounts[0].Destination)
+
+	// the patch is applied atomically
+	_, err = PatchSpec(spec, []byte(`[{"op": "add", "path": "/hostname", "value": "baz"}, {"op": "remove", "path": "/nonexistent"}]`))
+	require.Error(t, err)
+	require.Equal(t, "foo", spec.Hostname)
+
+	_, err = PatchSpec(spec, []byte(`[{"op": "test", "path": "/hostname", "value": "bar"}]`))
+	require.Error(t, err)
+
+	_, err = PatchSpec(spec, []byte(`[{"op": "add", "path": "/mounts/5", "value": {}}]`))
+	require.Error(t, err)
+}
+
+func TestMergeSpec(t *testing.T) {
+	spec := NewSpec("/rootfs", "/bin/sh")
+	spec.Hostname = "foo"
+	spec.Process.Env = []string{"A=1", "B=2"}
+	var limit int64 = 1 << 62
+	spec.Linux.Resources.Memory = &specs.LinuxMemory{Limit: &limit}
+
+	overlay := `{
+		"hostname": null,
+		"mounts": [
+			{"destination": "/dev", "type": "devtmpfs", "source": "devtmpfs"},
+			{"destination": "/run", "type": "tmpfs", "source": "tmpfs"}
+		],
+		"process": {"env": ["B=3", "C=4"], "args": ["/bin/true"]},
+		"linux": {"devices": [{"path": "/dev/fuse", "type": "c", "major": 10, "minor": 229}]}
+	}`
+	merged, err := MergeSpec(spec, []byte(overlay))
+	require.NoError(t, err)
+	require.Equal(t, "", merged.Hostname)
+	require.Len(t, merged.Mounts, 3)
+	require.Equal(t, "/proc", merged.Mounts[0].Destination)
+	require.Equal(t, "devtmpfs", merged.Mounts[1].Type)
+	require.Equal(t, "/run", merged.Mounts[2].Destination)
+	require.Equal(t, []string{"A=1", "B=3", "C=4"}, merged.Process.Env)
+	require.Equal(t, []string{"/bin/true"}, merged.Process.Args)
+	require.Len(t, merged.Linux.Devices, len(EssentialDevices)+1)
+	require.Equal(t, limit, *merged.Linux.Resources.Memory.Limit)
+
+	require.Equal(t, "foo", spec.Hostname)
+	require.Len(t, spec.Mounts, 2)
+
+	_, err = MergeSpec(spec, []byte(`[]`))
+	require.Error(t, err)
+}
@@ -6,12 +6,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
@@ -41,24 +43,74 @@ func UnmapContainerID(id uint32, idmaps []specs.LinuxIDMapping) uint32 {
 // RunHooks calls RunHook for each of the given runtime hooks.
 // The given runtime state is serialized as JSON and passed to each RunHook call.
 func RunHooks(ctx context.Context, state *specs.State, hooks []specs.Hook, continueOnError bool) error {
+	_, err := RunHooksResults(ctx, state, hooks, continueOnError)
+	return err
+}
+
+// MaxHookOutput is the maximum number of bytes of hook output
+// that is retained in HookResult.Output.
+const MaxHookOutput = 4096
+
+// HookResult is the result of a hook execution.
+type HookResult struct {
+	Path string
+	// ExitCode is the exit code of the hook process
+	// or -1 if the hook was killed or could not be executed.
+	ExitCode int
+	// Output is the tail of the combined stdout and stderr of the hook.
+	// The output is truncated to at most MaxHookOutput bytes.
+	Output string `json:",omitempty"`
+	// Error is the error returned by RunHook.
+	Error    string `json:",omitempty"`
+	Duration time.Duration
+	// BestEffort is true if a failure of the hook does not abort
+	// the execution of the remaining hooks (see RunHooksBestEffort).
+	BestEffort bool `json:",omitempty"`
+}
+
+// RunHooksResults is like RunHooks but additionally returns the
+// results of all executed hooks.
+func RunHooksResults(ctx context.Context, state *specs.State, hooks []specs.Hook, continueOnError bool) ([]HookResult, error) {
+	return RunHooksBestEffort(ctx, state, hooks, func(specs.Hook) bool { return continueOnError })
+}
+
+// RunHooksBestEffort is like RunHooksResults but the execution of the
+// remaining hooks continues if a hook, for which bestEffort returns true, fails.
+func RunHooksBestEffort(ctx context.Context, state *specs.State, hooks []specs.Hook, bestEffort func(specs.Hook) bool) ([]HookResult, error) {
 	if len(hooks) == 0 {
-		return nil
+		return nil, nil
 	}
 	stateJSON, err := json.Marshal(state)
 	if err != nil {
-		return fmt.Errorf("failed to serialize spec state: %w", err)
+		return nil, fmt.Errorf("failed to serialize spec state: %w", err)
 	}
+	results := make([]HookResult, 0, len(hooks))
 	for i, h := range hooks {
 		fmt.Printf("running hook[%d] path:%s\n", i, h.Path)
-		err := RunHook(ctx, stateJSON, h)
+		res, err := RunHookResult(ctx, stateJSON, h)
+		res.BestEffort = bestEffort(h)
+		results = append(results, res)
 		if err != nil {
 			fmt.Printf("hook[%d] failed: %s\n", i, err)
-			if !continueOnError {
-				return err
+			if !res.BestEffort {
+				return results, err
 			}
 		}
 	}
-	return nil
+	return results, nil
+}
+
+// HookPathMatcher returns a function that returns true
+// for all hooks with one of the given paths.
+func HookPathMatcher(paths []string) func(specs.Hook) bool {
+	return func(h specs.Hook) bool {
+		for _, p := range paths {
+			if p != "" && h.Path == p {
+				return true
+			}
+		}
+		return false
+	}
 }
 
 // RunHook executes the command defined by the given hook.
@@ -66,6 +118,33 @@ func RunHooks(ctx context.Context, state *specs.State, hooks []specs.Hook, conti
 // The command is executed with the given context ctx, or a sub-context
 // of it if Hook.Timeout is not nil.
 func RunHook(ctx context.Context, stateJSON []byte, hook specs.Hook) error {
+	_, err := RunHookResult(ctx, stateJSON, hook)
+	return err
+}
+
+// RunHookResult is like RunHook but additionally captures
+// the exit code and the (truncated) output of the hook.
+// The hook output is still written to stdout.
+func RunHookResult(ctx context.Context, stateJSON []byte, hook specs.Hook) (HookResult, error) {
+	res := HookResult{Path: hook.Path, ExitCode: -1}
+	out := &tailBuffer{max: MaxHookOutput}
+	start := time.Now()
+	err := runHook(ctx, stateJSON, hook, io.MultiWriter(os.Stdout, out), io.MultiWriter(os.Stderr, out))
+	res.Duration = time.Since(start)
+	res.Output = out.String()
+	if err != nil {
+		res.Error = err.Error()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			res.ExitCode = exitErr.ExitCode()
+		}
+		return res, err
+	}
+	res.ExitCode = 0
+	return res, nil
+}
+
+func runHook(ctx context.Context, stateJSON []byte, hook specs.Hook, stdout io.Writer, stderr io.Writer) error {
 	if hook.Timeout != nil {
 		hookCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(*hook.Timeout))
 		defer cancel()
@@ -73,8 +152,8 @@ func RunHook(ctx context.Context, stateJSON []byte, hook specs.Hook) error {
 	}
 	cmd := exec.CommandContext(ctx, hook.Path, hook.Args...)
 	cmd.Env = hook.Env
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+	cmd.Stderr = stderr
+	cmd.Stdout = stdout
 	in, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdin pipe: %w", err)
@@ -89,6 +168,34 @@ func RunHook(ctx context.Context, stateJSON []byte, hook specs.Hook) error {
 	return cmd.Wait()
 }
 
+// tailBuffer is an io.Writer that retains the last max bytes written.
+// It is safe for concurrent use.
+type tailBuffer struct {
+	max int
+	buf []byte
+	mu  sync.Mutex
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	if len(p) > b.max {
+		p = p[len(p)-b.max:]
+	}
+	if drop := len(b.buf) + len(p) - b.max; drop > 0 {
+		b.buf = b.buf[drop:]
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
 // DecodeJSONFile reads the next JSON-encoded value from
 // the file with the given filename and stores it in the value pointed to by v.
 func DecodeJSONFile(filename string, v interface{}) error {
@@ -145,7 +252,9 @@ func modep(m os.FileMode) *os.FileMode {
 	return &m
 }
 
-// FIXME runtime mandates that /dev/ptmx should be bind mount from host - why ?
+// NOTE /dev/ptmx is not an essential device. It is created by lxcri-hook-builtin
+// for the /dev/pts mount, either as symlink to pts/ptmx (private devpts instance)
+// or as bind mount of the host /dev/ptmx (if /dev/pts is bind mounted from the host).
 // `man 2 mount` | devpts
 // ` To use this option effectively, /dev/ptmx must be a symbolic link to pts/ptmx.
 // See Documentation/filesystems/devpts.txt in the Linux kernel source tree for details.`
@@ -288,6 +397,20 @@ func NewSpecProcess(cmd string, args ...string) *specs.Process {
 	return proc
 }
 
+// ReadSpecJSON parses the JSON encoded specs.Spec from the given reader.
+func ReadSpecJSON(r io.Reader) (*specs.Spec, error) {
+	spec := new(specs.Spec)
+	err := json.NewDecoder(r).Decode(spec)
+	return spec, err
+}
+
+// ReadSpecProcessJSON parses the JSON encoded specs.Process from the given reader.
+func ReadSpecProcessJSON(r io.Reader) (*specs.Process, error) {
+	proc := new(specs.Process)
+	err := json.NewDecoder(r).Decode(proc)
+	return proc, err
+}
+
 // ReadSpecStateJSON parses the JSON encoded specs.State from the given reader.
 func ReadSpecStateJSON(r io.Reader) (*specs.State, error) {
 	state := new(specs.State)
@@ -0,0 +1,367 @@
+package lxcri
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// ProcessOverrideFile is the name of the file in the container runtime directory,
+// that overrides the container process arguments, environment and working directory.
+// It is read by the init process `lxcri-init` when the container is started.
+// NOTE keep in sync with cmd/lxcri-init
+const ProcessOverrideFile = "process.json"
+
+// Pool keeps a number of containers created from a template in state created,
+// and hands them out on demand (see Pool.Claim).
+// Starting a created container is much faster than creating it,
+// which reduces the cold-start latency e.g for FaaS workloads.
+//
+// The container ID can not be changed after the container is created,
+// because it is the liblxc container name. Pool containers are named
+// `<Template.ContainerID>-<random hex>`, so that the IDs do not collide with
+// containers created by a previous pool instance.
+// The ID of a claimed container is returned by Claim.
+type Pool struct {
+	Runtime *Runtime
+	// Template is the config for the pool containers.
+	// Template.ContainerID is used as prefix for the container IDs.
+	Template ContainerConfig
+	// Size is the number of created containers kept in the pool.
+	Size int
+	// Dir is the host directory for the claim mount slots.
+	Dir string
+	// ClaimMounts are the mount destinations within the container that
+	// are bound to a host directory when the container is claimed (see ClaimOptions.Mounts).
+	// A shared mount slot from Dir is mounted to each destination on create,
+	// and mounts on the slot propagate into the container.
+	// Claim mounts require the privilege to create mounts on the host.
+	ClaimMounts []string
+
+	mu   sync.Mutex
+	idle []string
+}
+
+// ClaimOptions rebind the process and mounts of a pool container.
+type ClaimOptions struct {
+	// Args replace the process arguments if not empty.
+	Args []string
+	// Env is merged into the process environment.
+	// A variable replaces a template variable with the same name.
+	Env []string
+	// Cwd replaces the process working directory if not empty.
+	Cwd string
+	// Mounts are bind mounts whose destination must be one of Pool.ClaimMounts.
+	// The option `ro` creates a read-only bind mount.
+	Mounts []specs.Mount
+}
+
+// Idle returns the number of unclaimed containers.
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Fill creates containers until the pool has Size unclaimed containers.
+func (p *Pool) Fill(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if len(p.idle) >= p.Size {
+			p.mu.Unlock()
+			return nil
+		}
+		p.mu.Unlock()
+
+		id, err := p.newID()
+		if err != nil {
+			return err
+		}
+		if err := p.create(ctx, id); err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		p.idle = append(p.idle, id)
+		p.mu.Unlock()
+	}
+}
+
+// newID returns a random container ID with the template ID as prefix,
+// that is used neither by a container nor by the claim mount slots.
+func (p *Pool) newID() (string, error) {
+	b := make([]byte, 4)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to generate pool container ID: %w", err)
+		}
+		id := fmt.Sprintf("%s-%x", p.Template.ContainerID, b)
+		if exists(filepath.Join(p.Runtime.containersDir(), id)) {
+			continue
+		}
+		if len(p.ClaimMounts) > 0 && exists(filepath.Join(p.Dir, id)) {
+			continue
+		}
+		return id, nil
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+func (p *Pool) slotDir(id string, i int) string {
+	return filepath.Join(p.Dir, id, strconv.Itoa(i))
+}
+
+func (p *Pool) create(ctx context.Context, id string) error {
+	if len(p.ClaimMounts) > 0 && !filepath.IsAbs(p.Dir) {
+		return fmt.Errorf("pool dir %q is not an absolute path", p.Dir)
+	}
+	spec, err := copySpec(p.Template.Spec)
+	if err != nil {
+		return err
+	}
+	cfg := p.Template
+	cfg.ContainerID = id
+	cfg.Spec = spec
+	cfg.Log = p.Runtime.Log.With().Str("cid", id).Logger()
+
+	for i, dest := range p.ClaimMounts {
+		slot := p.slotDir(id, i)
+		if err := createSharedSlot(slot); err != nil {
+			p.releaseSlots(id)
+			return errorf("failed to create claim mount slot: %w", err)
+		}
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Source:      slot,
+			Destination: dest,
+			Type:        "bind",
+			Options:     []string{"rbind", "rslave"},
+		})
+	}
+
+	c, err := p.Runtime.Create(ctx, &cfg)
+	if err != nil {
+		// The container is nil if the runtime dir was not created,
+		// e.g the runtime dir of an existing container must not be deleted.
+		if c != nil {
+			if err := p.Runtime.Delete(ctx, id, true); err != nil && err != ErrNotExist {
+				p.Runtime.Log.Error().Str("cid", id).Msgf("failed to destroy pool container: %s", err)
+			}
+		}
+		p.releaseSlots(id)
+		return errorf("failed to create pool container %s: %w", id, err)
+	}
+	return c.Release()
+}
+
+// createSharedSlot creates the directory and turns it into a shared mount point.
+func createSharedSlot(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := unix.Mount(dir, dir, "", unix.MS_BIND, ""); err != nil {
+		return err
+	}
+	return unix.Mount("", dir, "", unix.MS_SHARED, "")
+}
+
+// mountReadonly bind mounts source read-only to the shared slot.
+// A read-only remount of the slot is not propagated to the copy
+// of the mount in the container, so source is mounted and remounted
+// read-only at a private staging mount point, which is then moved to the slot.
+func mountReadonly(source, slot string) error {
+	staging, err := os.MkdirTemp(filepath.Dir(slot), ".staging-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(staging)
+	// A mount can not be moved if its parent mount is shared.
+	if err := unix.Mount(staging, staging, "", unix.MS_BIND, ""); err != nil {
+		return err
+	}
+	defer unix.Unmount(staging, unix.MNT_DETACH)
+	if err := unix.Mount("", staging, "", unix.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+
+	mnt := filepath.Join(staging, "mnt")
+	if err := os.Mkdir(mnt, 0700); err != nil {
+		return err
+	}
+	defer os.Remove(mnt)
+	if err := unix.Mount(source, mnt, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	if err := unix.Mount("", mnt, "", flags, ""); err != nil {
+		unix.Unmount(mnt, unix.MNT_DETACH)
+		return err
+	}
+	if err := unix.Mount(mnt, slot, "", unix.MS_MOVE, ""); err != nil {
+		unix.Unmount(mnt, unix.MNT_DETACH)
+		return err
+	}
+	return nil
+}
+
+// Claim removes a container from the pool, applies the given options
+// and returns the container, which must be started with Runtime.Start
+// and released with Container.Release.
+// Pool.Release must be called after the claimed container was deleted.
+func (p *Pool) Claim(ctx context.Context, opts ClaimOptions) (*Container, error) {
+	p.mu.Lock()
+	if len(p.idle) == 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("no container available in pool %s", p.Template.ContainerID)
+	}
+	id := p.idle[0]
+	p.idle = p.idle[1:]
+	p.mu.Unlock()
+
+	// The claim modifies the container, so the exclusive lock is required.
+	lock, err := p.Runtime.Lock(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	c, err := p.Runtime.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.claim(c, opts); err != nil {
+		c.Release()
+		// The container may be partially claimed and is not reused.
+		if err := p.Runtime.Delete(ctx, id, true); err != nil {
+			p.Runtime.Log.Error().Str("cid", id).Msgf("failed to destroy pool container: %s", err)
+		}
+		if err := p.releaseSlots(id); err != nil {
+			p.Runtime.Log.Error().Str("cid", id).Msgf("failed to release claim mount slots: %s", err)
+		}
+		return nil, errorf("failed to claim pool container %s: %w", id, err)
+	}
+	return c, nil
+}
+
+func (p *Pool) claim(c *Container, opts ClaimOptions) error {
+	for _, m := range opts.Mounts {
+		i := indexOf(p.ClaimMounts, m.Destination)
+		if i < 0 {
+			return fmt.Errorf("mount destination %s is not a claim mount", m.Destination)
+		}
+		slot := p.slotDir(c.ContainerID, i)
+		if indexOf(m.Options, "ro") >= 0 {
+			if err := mountReadonly(m.Source, slot); err != nil {
+				return fmt.Errorf("failed to mount %s read-only to %s: %w", m.Source, m.Destination, err)
+			}
+			continue
+		}
+		if err := unix.Mount(m.Source, slot, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to mount %s to %s: %w", m.Source, m.Destination, err)
+		}
+	}
+
+	if len(opts.Args) == 0 && len(opts.Env) == 0 && opts.Cwd == "" {
+		return nil
+	}
+	proc := *c.Spec.Process
+	if len(opts.Args) > 0 {
+		proc.Args = opts.Args
+	}
+	if opts.Cwd != "" {
+		if !filepath.IsAbs(opts.Cwd) {
+			return fmt.Errorf("cwd %q is not an absolute path", opts.Cwd)
+		}
+		proc.Cwd = opts.Cwd
+	}
+	proc.Env = append([]string{}, proc.Env...)
+	for _, kv := range opts.Env {
+		proc.Env, _ = specki.Setenv(proc.Env, kv, true)
+	}
+	return specki.EncodeJSONFile(c.RuntimePath(ProcessOverrideFile), &proc, os.O_EXCL|os.O_CREATE, 0444)
+}
+
+// Release unmounts and removes the claim mount slots of a container
+// claimed from the pool. It should be called after the container is deleted.
+func (p *Pool) Release(id string) error {
+	return p.releaseSlots(id)
+}
+
+func (p *Pool) releaseSlots(id string) error {
+	if len(p.ClaimMounts) == 0 {
+		return nil
+	}
+	for i := range p.ClaimMounts {
+		slot := p.slotDir(id, i)
+		// Unmount the claim mount and the slot itself.
+		for {
+			err := unix.Unmount(slot, unix.MNT_DETACH)
+			if err == unix.EINVAL || os.IsNotExist(err) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to unmount %s: %w", slot, err)
+			}
+		}
+		// Remove must not be recursive, to never delete the mount source.
+		if err := os.Remove(slot); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(filepath.Join(p.Dir, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Drain deletes all unclaimed containers.
+func (p *Pool) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	var firstErr error
+	for _, id := range idle {
+		err := p.Runtime.Delete(ctx, id, true)
+		if err == nil || err == ErrNotExist {
+			err = p.releaseSlots(id)
+		}
+		if err != nil {
+			p.Runtime.Log.Error().Str("cid", id).Msgf("failed to delete pool container: %s", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func copySpec(spec *specs.Spec) (*specs.Spec, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	cp := new(specs.Spec)
+	return cp, json.Unmarshal(data, cp)
+}
+
+func indexOf(values []string, s string) int {
+	for i, v := range values {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,60 @@
+package lxcri
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolClaimEmpty(t *testing.T) {
+	p := &Pool{Template: ContainerConfig{ContainerID: "fn"}}
+	require.Equal(t, 0, p.Idle())
+	_, err := p.Claim(context.Background(), ClaimOptions{})
+	require.EqualError(t, err, "no container available in pool fn")
+}
+
+func TestPoolClaimProcess(t *testing.T) {
+	c := &Container{
+		ContainerConfig: &ContainerConfig{
+			ContainerID: "fn-1",
+			Spec: &specs.Spec{Process: &specs.Process{
+				Args: []string{"/bin/sleep", "inf"},
+				Env:  []string{"PATH=/bin", "MODE=warm"},
+				Cwd:  "/",
+			}},
+		},
+		runtimeDir: t.TempDir(),
+	}
+	p := &Pool{}
+
+	err := p.claim(c, ClaimOptions{Cwd: "relative"})
+	require.Error(t, err)
+
+	err = p.claim(c, ClaimOptions{Mounts: []specs.Mount{{Source: "/tmp", Destination: "/data"}}})
+	require.EqualError(t, err, "mount destination /data is not a claim mount")
+
+	err = p.claim(c, ClaimOptions{Args: []string{"/bin/handler"}, Env: []string{"MODE=hot", "REQ=1"}, Cwd: "/app"})
+	require.NoError(t, err)
+
+	proc := new(specs.Process)
+	require.NoError(t, specki.DecodeJSONFile(c.RuntimePath(ProcessOverrideFile), proc))
+	require.Equal(t, []string{"/bin/handler"}, proc.Args)
+	require.Equal(t, []string{"PATH=/bin", "MODE=hot", "REQ=1"}, proc.Env)
+	require.Equal(t, "/app", proc.Cwd)
+	// The template spec is not modified.
+	require.Equal(t, []string{"PATH=/bin", "MODE=warm"}, c.Spec.Process.Env)
+}
+
+func TestPoolNewID(t *testing.T) {
+	p := &Pool{Runtime: &Runtime{Root: t.TempDir()}, Template: ContainerConfig{ContainerID: "fn"}}
+	id, err := p.newID()
+	require.NoError(t, err)
+	require.Regexp(t, `^fn-[0-9a-f]{8}$`, id)
+
+	id2, err := p.newID()
+	require.NoError(t, err)
+	require.NotEqual(t, id, id2)
+}
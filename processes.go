@@ -0,0 +1,196 @@
+package lxcri
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Process describes a process within the container cgroup.
+type Process struct {
+	Pid  int
+	PPid int
+	// UID is the real user ID of the process (in the initial user namespace).
+	UID int
+	// State is the process state e.g 'S' (sleeping) or 'Z' (zombie).
+	State string
+	// Command is the command name (see `man 5 proc`, /proc/[pid]/comm).
+	Command string
+	// Args is the command line of the process. It is empty for zombie processes.
+	Args []string `json:",omitempty"`
+	// CPUTime is the user and system time consumed by the process.
+	CPUTime time.Duration
+	// RSS is the resident set size in bytes.
+	RSS uint64
+}
+
+// clockTicks is the kernel clock tick rate (USER_HZ) of the /proc/[pid]/stat times.
+// It is 100 on all architectures supported by Linux.
+const clockTicks = 100
+
+// Pids returns the PIDs of all processes within the container cgroup
+// (including nested cgroups), equivalent to `runc ps --format json`.
+// The monitor process is not included.
+func (c *Container) Pids() ([]int, error) {
+	if c.CgroupDir == "" {
+		return nil, fmt.Errorf("container cgroup is undefined")
+	}
+	pids, err := cgroupPids(filepath.Join(cgroupRoot, c.CgroupDir))
+	if err != nil {
+		return nil, err
+	}
+	for i, pid := range pids {
+		if pid == c.Pid {
+			return append(pids[:i], pids[i+1:]...), nil
+		}
+	}
+	return pids, nil
+}
+
+// Processes returns the details of all processes within the container cgroup,
+// read from the /proc filesystem (see Container.Pids).
+// Processes that exit while they are inspected are omitted.
+func (c *Container) Processes() ([]Process, error) {
+	pids, err := c.Pids()
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]Process, 0, len(pids))
+	for _, pid := range pids {
+		p, err := readProcess(pid)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read process %d: %w", pid, err)
+		}
+		procs = append(procs, *p)
+	}
+	return procs, nil
+}
+
+// cgroupPids returns the PIDs in cgroup.procs of dir and its child cgroups.
+func cgroupPids(dir string) ([]int, error) {
+	var pids []int
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			// The child cgroup may have been removed.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Name() != "cgroup.procs" {
+			return nil
+		}
+		// #nosec
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		p, err := parseCgroupProcs(data)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", path, err)
+		}
+		pids = append(pids, p...)
+		return nil
+	})
+	return pids, err
+}
+
+// parseCgroupProcs parses the newline separated PIDs of a cgroup.procs file.
+func parseCgroupProcs(data []byte) ([]int, error) {
+	var pids []int
+	for _, s := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func readProcess(pid int) (*Process, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	// #nosec
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	p, err := parseProcess(pid, string(stat))
+	if err != nil {
+		return nil, err
+	}
+	// #nosec
+	status, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+	if p.UID, err = parseProcessUID(string(status)); err != nil {
+		return nil, err
+	}
+	// #nosec
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	if s := strings.TrimRight(string(cmdline), "\x00"); s != "" {
+		p.Args = strings.Split(s, "\x00")
+	}
+	return p, nil
+}
+
+// parseProcess parses the /proc/[pid]/stat content of the process.
+func parseProcess(pid int, stat string) (*Process, error) {
+	fields, err := parseProcessStat(stat, 22)
+	if err != nil {
+		return nil, err
+	}
+	p := &Process{Pid: pid, State: fields[0]}
+	if i := strings.IndexByte(stat, '('); i >= 0 {
+		p.Command = stat[i+1 : strings.LastIndexByte(stat, ')')]
+	}
+	if p.PPid, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, err
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	p.CPUTime = time.Duration(utime+stime) * time.Second / clockTicks
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if rss > 0 {
+		p.RSS = uint64(rss) * uint64(os.Getpagesize())
+	}
+	return p, nil
+}
+
+// parseProcessUID returns the real user ID from the /proc/[pid]/status content.
+func parseProcessUID(status string) (int, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(line[len("Uid:"):])
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.Atoi(fields[0])
+	}
+	return 0, fmt.Errorf("missing Uid in process status")
+}
@@ -0,0 +1,64 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcess(t *testing.T) {
+	stat := "42 (my (proc)) S 1 42 42 0 -1 4194560 1000 0 0 0 150 50 0 0 20 0 1 0 12345 1000000 3 18446744073709551615"
+	p, err := parseProcess(42, stat)
+	require.NoError(t, err)
+	require.Equal(t, 42, p.Pid)
+	require.Equal(t, 1, p.PPid)
+	require.Equal(t, "S", p.State)
+	require.Equal(t, "my (proc)", p.Command)
+	require.Equal(t, 2*time.Second, p.CPUTime)
+	require.Equal(t, uint64(3*os.Getpagesize()), p.RSS)
+
+	_, err = parseProcess(42, "42 (proc) S 1")
+	require.Error(t, err)
+}
+
+func TestParseProcessUID(t *testing.T) {
+	uid, err := parseProcessUID("Name:\tsleep\nUid:\t1000\t1000\t1000\t1000\nGid:\t100\t100\t100\t100\n")
+	require.NoError(t, err)
+	require.Equal(t, 1000, uid)
+
+	_, err = parseProcessUID("Name:\tsleep\n")
+	require.Error(t, err)
+}
+
+func TestContainerPids(t *testing.T) {
+	root := t.TempDir()
+	prevRoot := cgroupRoot
+	cgroupRoot = root
+	defer func() { cgroupRoot = prevRoot }()
+
+	dir := filepath.Join(root, "test")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "exec"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte("10\n11\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "exec", "cgroup.procs"), []byte("20\n"), 0644))
+
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "test"}}
+	c.Pid = 11
+	pids, err := c.Pids()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int{10, 20}, pids)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte("x\n"), 0644))
+	_, err = c.Pids()
+	require.Error(t, err)
+}
+
+func TestReadProcess(t *testing.T) {
+	p, err := readProcess(os.Getpid())
+	require.NoError(t, err)
+	require.Equal(t, os.Getpid(), p.Pid)
+	require.Equal(t, os.Getuid(), p.UID)
+	require.NotEmpty(t, p.Args)
+}
@@ -0,0 +1,152 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lxc/lxcri/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// reloadableConfig are the runtime settings that can be changed by Reload.
+type reloadableConfig struct {
+	LogConfig LogConfig
+	Timeouts  Timeouts
+	Features  RuntimeFeatures
+}
+
+// reloaded returns a copy of the runtime with the log configuration,
+// the timeouts and the feature gates reloaded from the runtime config file
+// (ConfigPath), and a new logger instance. The runtime itself is unchanged.
+// Settings that are not defined in the config file are unchanged.
+// All other settings (e.g Root) are not reloaded, because the existing
+// containers and their monitor processes depend on them.
+func (rt *Runtime) reloaded() (*Runtime, error) {
+	if rt.ConfigPath == "" {
+		return nil, fmt.Errorf("no config file loaded")
+	}
+	data, err := os.ReadFile(rt.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	next := *rt
+	next.LogConfig.file = nil
+	// The config file is merged into the maps, so they must be copied.
+	if rt.LogConfig.RateLimits != nil {
+		next.LogConfig.RateLimits = make(map[string]log.RateLimit, len(rt.LogConfig.RateLimits))
+		for msg, limit := range rt.LogConfig.RateLimits {
+			next.LogConfig.RateLimits[msg] = limit
+		}
+	}
+	cfg := reloadableConfig{
+		LogConfig: next.LogConfig,
+		Timeouts:  next.Timeouts,
+		Features:  next.Features,
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to load config file %s: %w", rt.ConfigPath, err)
+	}
+	next.LogConfig = cfg.LogConfig
+	next.Timeouts = cfg.Timeouts
+	next.Features = cfg.Features
+	if err := next.configureLogger(); err != nil {
+		return nil, fmt.Errorf("failed to reconfigure logger: %w", err)
+	}
+	return &next, nil
+}
+
+// ReloadableRuntime is a Runtime whose configuration can be reloaded
+// while it is in use by long running runtime processes.
+// Every reload creates a new immutable Runtime snapshot.
+// The log file of a replaced snapshot is closed when the last user
+// has released it (see Acquire).
+type ReloadableRuntime struct {
+	current  atomic.Value // *runtimeSnapshot
+	reloadMu sync.Mutex
+}
+
+type runtimeSnapshot struct {
+	rt *Runtime
+
+	mu      sync.Mutex
+	users   int
+	retired bool
+}
+
+// NewReloadableRuntime returns a ReloadableRuntime for the given
+// initialized runtime. The runtime must not be modified afterwards.
+func NewReloadableRuntime(rt *Runtime) *ReloadableRuntime {
+	r := &ReloadableRuntime{}
+	r.current.Store(&runtimeSnapshot{rt: rt})
+	return r
+}
+
+// Acquire returns the current runtime snapshot and the function
+// that must be called when the snapshot is no longer used.
+// The snapshot is not changed by Reload.
+func (r *ReloadableRuntime) Acquire() (*Runtime, func()) {
+	for {
+		s := r.current.Load().(*runtimeSnapshot)
+		s.mu.Lock()
+		if s.retired {
+			// Reload has just replaced the snapshot.
+			s.mu.Unlock()
+			continue
+		}
+		s.users++
+		s.mu.Unlock()
+
+		var once sync.Once
+		return s.rt, func() { once.Do(s.release) }
+	}
+}
+
+// Reload reloads the log configuration, the timeouts and the feature gates
+// from the runtime config file (ConfigPath) and replaces the current
+// runtime snapshot. Settings that are not defined in the config file are unchanged.
+// All other settings (e.g Root) are not reloaded, because the existing
+// containers and their monitor processes depend on them.
+// Reload is intended to be called by long running runtime processes
+// e.g when they receive SIGHUP.
+// The current snapshot is kept if the configuration can not be reloaded.
+func (r *ReloadableRuntime) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	prev := r.current.Load().(*runtimeSnapshot)
+	next, err := prev.rt.reloaded()
+	if err != nil {
+		return err
+	}
+	r.current.Store(&runtimeSnapshot{rt: next})
+	prev.retire()
+	next.Log.Info().Str("config", next.ConfigPath).Msg("reloaded runtime configuration")
+	return nil
+}
+
+func (s *runtimeSnapshot) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users--
+	if s.retired && s.users == 0 {
+		s.closeLogFile()
+	}
+}
+
+func (s *runtimeSnapshot) retire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retired = true
+	if s.users == 0 {
+		s.closeLogFile()
+	}
+}
+
+func (s *runtimeSnapshot) closeLogFile() {
+	if s.rt.LogConfig.file != nil {
+		s.rt.LogConfig.file.Close()
+	}
+}
@@ -0,0 +1,59 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	tmpdir := t.TempDir()
+	configPath := filepath.Join(tmpdir, "lxcri.yaml")
+
+	rt := &Runtime{
+		ConfigPath: configPath,
+		LogConfig:  LogConfig{LogFile: filepath.Join(tmpdir, "lxcri.log"), LogLevel: "info"},
+		Timeouts:   Timeouts{CreateTimeout: 10, StartTimeout: 10},
+	}
+	require.NoError(t, rt.ConfigureLogger())
+	rr := NewReloadableRuntime(rt)
+
+	prev, release := rr.Acquire()
+	require.Same(t, rt, prev)
+
+	config := "LogConfig:\n  LogLevel: debug\nTimeouts:\n  StartTimeout: 5\nFeatures:\n  Seccomp: true\nRoot: /nonexistent\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(config), 0640))
+	require.NoError(t, rr.Reload())
+
+	next, releaseNext := rr.Acquire()
+	defer releaseNext()
+	require.Equal(t, "debug", next.LogConfig.LogLevel)
+	require.Equal(t, zerolog.DebugLevel, next.Log.GetLevel())
+	require.Equal(t, uint(10), next.Timeouts.CreateTimeout)
+	require.Equal(t, uint(5), next.Timeouts.StartTimeout)
+	require.True(t, next.Features.Seccomp)
+	require.Equal(t, "", next.Root)
+
+	// The previous snapshot is unchanged and its log file
+	// is closed when it is released.
+	require.Equal(t, "info", prev.LogConfig.LogLevel)
+	require.Equal(t, uint(10), prev.Timeouts.StartTimeout)
+	require.False(t, prev.Features.Seccomp)
+	_, err := prev.LogConfig.file.Stat()
+	require.NoError(t, err)
+	release()
+	_, err = prev.LogConfig.file.Stat()
+	require.Error(t, err)
+
+	// The previous configuration is kept if the logger can not be configured.
+	require.NoError(t, os.WriteFile(configPath, []byte("LogConfig:\n  LogLevel: invalid\n"), 0640))
+	require.Error(t, rr.Reload())
+	current, releaseCurrent := rr.Acquire()
+	defer releaseCurrent()
+	require.Same(t, next, current)
+	_, err = next.LogConfig.file.Stat()
+	require.NoError(t, err)
+}
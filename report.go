@@ -0,0 +1,214 @@
+package lxcri
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Cgroup hierarchy modes reported in HostReport.CgroupMode.
+const (
+	CgroupModeUnified = "unified"
+	CgroupModeHybrid  = "hybrid"
+	CgroupModeLegacy  = "legacy"
+)
+
+// Names of the host checks in HostReport.Checks
+// (apart from the libexec checks which use the executable name).
+const (
+	CheckMonitorCgroup = "monitor-cgroup-writable"
+	CheckNewUIDMap     = "newuidmap"
+	CheckNewGIDMap     = "newgidmap"
+	CheckApparmor      = "apparmor"
+	CheckSELinux       = "selinux"
+	// CheckProcfs and CheckCgroup2 abort Init if they fail,
+	// unless they are ignored (see Runtime.IgnoreChecks).
+	CheckProcfs  = "procfs"
+	CheckCgroup2 = "cgroup2"
+)
+
+// HostCheck is the result of a single host check.
+type HostCheck struct {
+	// Name is the name of the check.
+	Name string
+	// OK is true if the check passed.
+	OK bool
+	// Required is true if the runtime can not work properly
+	// if the check fails.
+	Required bool `json:",omitempty"`
+	// Message describes why the check failed.
+	Message string `json:",omitempty"`
+	// Hint describes how to fix the failed check.
+	Hint string `json:",omitempty"`
+}
+
+// HostReport is the summary of the host checks performed by Runtime.Init.
+type HostReport struct {
+	// LXCVersion is the liblxc runtime version.
+	LXCVersion string
+	// CgroupMode is the cgroup hierarchy mode of the host.
+	CgroupMode string
+	// CgroupRoot is the detected cgroup root.
+	CgroupRoot string
+	// Checks are the results of the performed host checks.
+	Checks []HostCheck
+}
+
+func (r *HostReport) add(name string, err error) *HostCheck {
+	check := HostCheck{Name: name, OK: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+	return &r.Checks[len(r.Checks)-1]
+}
+
+// require adds a check that is required for the runtime to work properly.
+// The given hint is added if the check failed.
+func (r *HostReport) require(name string, err error, hint string) {
+	c := r.add(name, err)
+	c.Required = true
+	if err != nil {
+		c.Hint = hint
+	}
+}
+
+// recommend adds an optional check.
+// The given hint is added if the check failed.
+func (r *HostReport) recommend(name string, err error, hint string) {
+	if c := r.add(name, err); err != nil {
+		c.Hint = hint
+	}
+}
+
+// Check returns the check with the given name, or nil if it does not exist.
+func (r *HostReport) Check(name string) *HostCheck {
+	for i := range r.Checks {
+		if r.Checks[i].Name == name {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// Degraded returns the checks that failed.
+func (r *HostReport) Degraded() []HostCheck {
+	var failed []HostCheck
+	for _, c := range r.Checks {
+		if !c.OK {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// Failed returns true if any of the required checks failed.
+func (r *HostReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Required && !c.OK {
+			return true
+		}
+	}
+	return false
+}
+
+// Report returns the host report created by Init.
+// Report returns nil if Init was not called.
+func (rt *Runtime) Report() *HostReport {
+	return rt.report
+}
+
+func detectCgroupMode() string {
+	if isFilesystem("/sys/fs/cgroup", "cgroup2") == nil {
+		return CgroupModeUnified
+	}
+	if isFilesystem("/sys/fs/cgroup/unified", "cgroup2") == nil {
+		return CgroupModeHybrid
+	}
+	return CgroupModeLegacy
+}
+
+// checkCgroupWritable checks whether the given cgroup (relative to cgroupRoot)
+// is writable. If the cgroup does not exist yet, the closest existing
+// parent cgroup must be writable, so that the cgroup can be created.
+func checkCgroupWritable(cgroup string) error {
+	dir := filepath.Join(cgroupRoot, cgroup)
+	for {
+		err := unix.Access(dir, unix.W_OK)
+		if err == nil || !os.IsNotExist(err) || dir == cgroupRoot || dir == "/" {
+			if err != nil {
+				return errorf("cgroup %s is not writable: %w", dir, err)
+			}
+			return nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func checkApparmor() error {
+	data, err := os.ReadFile("/sys/module/apparmor/parameters/enabled")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != "Y" {
+		return errorf("apparmor is not enabled")
+	}
+	return nil
+}
+
+func checkSELinux() error {
+	return isFilesystem("/sys/fs/selinux", "selinuxfs")
+}
+
+// reportHost runs the host checks that do not abort Init.
+func (rt *Runtime) reportHost() {
+	rt.report.CgroupMode = detectCgroupMode()
+	rt.report.CgroupRoot = cgroupRoot
+
+	if rt.MonitorCgroup != "" {
+		rt.report.require(CheckMonitorCgroup, checkCgroupWritable(rt.MonitorCgroup),
+			"delegate the cgroup to the runtime user: `chown -R $(whoami) "+filepath.Join(cgroupRoot, rt.MonitorCgroup)+"`")
+	}
+
+	// newuidmap and newgidmap are used by liblxc to setup
+	// the ID mappings for unprivileged containers.
+	mapHint := "install the package providing newuidmap and newgidmap (e.g uidmap or shadow-utils)"
+	_, errUID := exec.LookPath("newuidmap")
+	_, errGID := exec.LookPath("newgidmap")
+	if rt.isPrivileged() {
+		rt.report.recommend(CheckNewUIDMap, errUID, mapHint)
+		rt.report.recommend(CheckNewGIDMap, errGID, mapHint)
+	} else {
+		rt.report.require(CheckNewUIDMap, errUID, mapHint)
+		rt.report.require(CheckNewGIDMap, errGID, mapHint)
+	}
+
+	if rt.Features.Apparmor {
+		rt.report.recommend(CheckApparmor, checkApparmor(), "enable apparmor or disable the runtime apparmor feature")
+	} else {
+		rt.report.add(CheckApparmor, checkApparmor())
+	}
+	rt.report.add(CheckSELinux, checkSELinux())
+
+	for _, c := range rt.report.Degraded() {
+		rt.Log.Debug().Str("check", c.Name).Msg(c.Message)
+	}
+}
+
+// checkFailed returns the given error of the failed check,
+// or nil if the check is listed in Runtime.IgnoreChecks.
+func (rt *Runtime) checkFailed(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, ignored := range rt.IgnoreChecks {
+		if ignored == name {
+			rt.Log.Warn().Str("check", name).Msgf("IGNORING FAILED HOST CHECK - the runtime may not work properly: %s", err)
+			return nil
+		}
+	}
+	return err
+}
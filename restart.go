@@ -0,0 +1,291 @@
+package lxcri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Restart policy names (see RestartPolicy).
+const (
+	RestartNo            = "no"
+	RestartOnFailure     = "on-failure"
+	RestartAlways        = "always"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+// RestartPolicy defines whether a container is restarted when it exits.
+// The policy is evaluated by ReloadableRuntime.MonitorRestarts, which recreates
+// and starts the container if ShouldRestart returns true.
+type RestartPolicy struct {
+	// Name is one of RestartNo, RestartOnFailure, RestartAlways or RestartUnlessStopped.
+	Name string
+	// MaxRetries is the maximum number of restarts for RestartOnFailure.
+	// The number of restarts is unlimited if MaxRetries is 0.
+	MaxRetries int
+}
+
+// ParseRestartPolicy parses a restart policy in the format
+// `no`, `on-failure[:max-retries]`, `always` or `unless-stopped`.
+// An empty string is parsed as RestartNo.
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	vals := strings.SplitN(s, ":", 2)
+	p := RestartPolicy{Name: vals[0]}
+	switch p.Name {
+	case "":
+		p.Name = RestartNo
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+	case RestartOnFailure:
+		if len(vals) == 2 {
+			n, err := strconv.Atoi(vals[1])
+			if err != nil || n < 0 {
+				return p, fmt.Errorf("invalid restart policy %q: invalid max retries %q", s, vals[1])
+			}
+			p.MaxRetries = n
+		}
+		return p, nil
+	default:
+		return p, fmt.Errorf("invalid restart policy %q", s)
+	}
+	if len(vals) == 2 {
+		return p, fmt.Errorf("invalid restart policy %q: max retries is only supported for %s", s, RestartOnFailure)
+	}
+	return p, nil
+}
+
+func (p RestartPolicy) String() string {
+	if p.Name == RestartOnFailure && p.MaxRetries > 0 {
+		return fmt.Sprintf("%s:%d", p.Name, p.MaxRetries)
+	}
+	return p.Name
+}
+
+// ShouldRestart returns true if a container, that exited with the given status,
+// must be restarted. restarts is the number of restarts performed so far,
+// and stopped is true if the container was stopped explicitly (e.g by Runtime.Kill).
+func (p RestartPolicy) ShouldRestart(status *ExitStatus, restarts int, stopped bool) bool {
+	switch p.Name {
+	case RestartAlways, RestartUnlessStopped:
+		// An explicitly stopped container is never restarted.
+		return !stopped
+	case RestartOnFailure:
+		if stopped || status == nil || status.Code == 0 {
+			return false
+		}
+		return p.MaxRetries == 0 || restarts < p.MaxRetries
+	default:
+		return false
+	}
+}
+
+// RestartDelay returns the delay before the given restart (starting with 0).
+// The delay grows exponentially as defined by the given backoff,
+// so that a crash looping container does not overload the host.
+func RestartDelay(b Backoff, restarts int) time.Duration {
+	b.Jitter = 0
+	timer := b.timer()
+	d := timer.next()
+	for i := 0; i < restarts; i++ {
+		d = timer.next()
+	}
+	return d
+}
+
+// restartFile is the file in the container runtime directory that records
+// the container config for restarts (see ReloadableRuntime.MonitorRestarts).
+const restartFile = "restart.json"
+
+// stoppedFile marks a container that was stopped explicitly with Runtime.Kill.
+const stoppedFile = "stopped"
+
+// restartState is the content of the restartFile.
+type restartState struct {
+	// Config is the ContainerConfig as passed to Runtime.Create,
+	// before it is modified by the runtime.
+	Config json.RawMessage
+	// Restarts is the number of restarts performed so far.
+	Restarts int
+}
+
+// newRestartState returns the restart state for the container config,
+// or nil if the container is never restarted.
+func newRestartState(cfg *ContainerConfig) (*restartState, error) {
+	p, err := ParseRestartPolicy(cfg.RestartPolicy)
+	if err != nil || p.Name == RestartNo {
+		return nil, err
+	}
+	// The restarted container is created from scratch.
+	data, err := encodeCreateConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &restartState{Config: data}, nil
+}
+
+// checkRestartConfig checks that a container with a restart policy
+// can be recreated from the persisted container config.
+func checkRestartConfig(cfg *ContainerConfig) error {
+	if cfg.RestartPolicy == "" || cfg.RestartPolicy == RestartNo {
+		return nil
+	}
+	if cfg.ConsoleSocket != "" {
+		return fmt.Errorf("restart policy %q requires inherited stdio", cfg.RestartPolicy)
+	}
+	for _, s := range cfg.Secrets {
+		// The secret data is never persisted.
+		if len(s.Data) > 0 {
+			return fmt.Errorf("restart policy %q requires a source for secret %s", cfg.RestartPolicy, s.Target)
+		}
+	}
+	return nil
+}
+
+// isStopSignal returns true if Runtime.Kill with the signal
+// stops the container explicitly (see RestartPolicy.ShouldRestart).
+func isStopSignal(signum unix.Signal) bool {
+	switch signum {
+	case unix.SIGKILL, unix.SIGTERM, unix.SIGINT, unix.SIGQUIT:
+		return true
+	}
+	return false
+}
+
+// MonitorRestarts restarts stopped containers with a restart policy
+// (see ContainerConfig.RestartPolicy) until the context is done.
+// A container is restarted by deleting it, and creating and starting it
+// from the container config passed to Runtime.Create.
+// The restarts are delayed by RestartDelay with Runtime.RestartBackoff.
+// The containers are scanned for stopped containers in the given interval.
+// Every scan uses the current runtime snapshot (see ReloadableRuntime.Acquire).
+// Only one MonitorRestarts instance must run per runtime root.
+// The runtime itself never restarts containers, the restart policies
+// are applied only by the process that calls MonitorRestarts (lxcrid).
+func (r *ReloadableRuntime) MonitorRestarts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rt, release := r.Acquire()
+			rt.restartStopped(ctx, now)
+			release()
+		}
+	}
+}
+
+// restartStopped restarts the stopped containers that are due for a restart.
+func (rt *Runtime) restartStopped(ctx context.Context, now time.Time) {
+	ids, err := rt.List()
+	if err != nil {
+		rt.Log.Error().Msgf("failed to list containers: %s", err)
+		return
+	}
+	for _, id := range ids {
+		if err := rt.restartIfDue(ctx, id, now); err != nil {
+			rt.Log.Error().Str("cid", id).Msgf("failed to restart container: %s", err)
+		}
+	}
+}
+
+// restartIfDue restarts the container if it is due for a restart.
+// The restart is serialized with concurrent runtime invocations
+// for the container (e.g `lxcri delete`) by the container lock.
+func (rt *Runtime) restartIfDue(ctx context.Context, id string, now time.Time) error {
+	lock, err := rt.Lock(ctx, id, true)
+	if err == ErrNotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	c, err := rt.Load(id)
+	if err != nil {
+		rt.Log.Debug().Str("cid", id).Msgf("skipping container: %s", err)
+		return nil
+	}
+	r, err := rt.restartDue(c, now)
+	c.Release()
+	if err != nil {
+		rt.Log.Warn().Str("cid", id).Msgf("failed to evaluate restart policy: %s", err)
+		return nil
+	}
+	if r == nil {
+		return nil
+	}
+	return rt.restart(ctx, id, r)
+}
+
+// restartDue returns the restart state of the container
+// if the stopped container must be restarted now.
+func (rt *Runtime) restartDue(c *Container, now time.Time) (*restartState, error) {
+	if c.RestartPolicy == "" || c.RestartPolicy == RestartNo {
+		return nil, nil
+	}
+	state, err := c.ContainerState()
+	if err != nil || state != specs.StateStopped {
+		return nil, err
+	}
+	r := new(restartState)
+	if err := specki.DecodeJSONFile(c.RuntimePath(restartFile), r); err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(c.RuntimePath(stoppedFile))
+	stopped := err == nil
+	ok, err := c.ShouldRestart(r.Restarts, stopped)
+	if !ok || err != nil {
+		return nil, err
+	}
+	exitedAt := c.CreatedAt
+	if status, err := c.ExitStatus(); err == nil {
+		exitedAt = status.ExitedAt
+	}
+	if now.Before(exitedAt.Add(RestartDelay(rt.RestartBackoff, r.Restarts))) {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func (rt *Runtime) restart(ctx context.Context, id string, r *restartState) error {
+	cfg := new(ContainerConfig)
+	if err := json.Unmarshal(r.Config, cfg); err != nil {
+		return fmt.Errorf("invalid restart config: %w", err)
+	}
+	cfg.Log = rt.Log.With().Str("cid", id).Logger()
+	cfg.Log.Info().Int("restarts", r.Restarts).Msg("restarting container")
+
+	if err := rt.Delete(ctx, id, true); err != nil {
+		return fmt.Errorf("failed to delete container: %w", err)
+	}
+	c, err := rt.Create(ctx, cfg)
+	if c != nil {
+		defer c.Release()
+		// A failed restart counts as restart, so that the delay increases.
+		r.Restarts++
+		if err := specki.EncodeJSONFile(c.RuntimePath(restartFile), r, os.O_CREATE|os.O_TRUNC, 0640); err != nil {
+			c.Log.Error().Msgf("failed to update restart count: %s", err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// The lock of the deleted runtime directory is held by the caller,
+	// the new runtime directory is locked for the start.
+	lock, err := rt.Lock(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return rt.Start(ctx, c)
+}
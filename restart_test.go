@@ -0,0 +1,101 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	valid := map[string]RestartPolicy{
+		"":               {Name: RestartNo},
+		"no":             {Name: RestartNo},
+		"always":         {Name: RestartAlways},
+		"unless-stopped": {Name: RestartUnlessStopped},
+		"on-failure":     {Name: RestartOnFailure},
+		"on-failure:3":   {Name: RestartOnFailure, MaxRetries: 3},
+	}
+	for s, expected := range valid {
+		p, err := ParseRestartPolicy(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expected, p)
+	}
+
+	for _, s := range []string{"never", "always:3", "on-failure:", "on-failure:-1", "on-failure:x"} {
+		_, err := ParseRestartPolicy(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	failed := &ExitStatus{Code: 1}
+	success := &ExitStatus{Code: 0}
+
+	p := RestartPolicy{Name: RestartOnFailure, MaxRetries: 2}
+	require.True(t, p.ShouldRestart(failed, 0, false))
+	require.True(t, p.ShouldRestart(failed, 1, false))
+	require.False(t, p.ShouldRestart(failed, 2, false))
+	require.False(t, p.ShouldRestart(success, 0, false))
+	require.False(t, p.ShouldRestart(failed, 0, true))
+
+	p = RestartPolicy{Name: RestartUnlessStopped}
+	require.True(t, p.ShouldRestart(success, 10, false))
+	require.False(t, p.ShouldRestart(failed, 0, true))
+
+	p = RestartPolicy{Name: RestartAlways}
+	require.True(t, p.ShouldRestart(success, 0, false))
+	require.True(t, p.ShouldRestart(failed, 10, false))
+	require.False(t, p.ShouldRestart(success, 0, true))
+	require.False(t, p.ShouldRestart(failed, 0, true))
+
+	p = RestartPolicy{Name: RestartNo}
+	require.False(t, p.ShouldRestart(failed, 0, false))
+}
+
+func TestRestartDelay(t *testing.T) {
+	b := Backoff{InitialInterval: 100, MaxInterval: 1000, Factor: 2, Jitter: 0.5}
+	ms := time.Millisecond
+	require.Equal(t, 100*ms, RestartDelay(b, 0))
+	require.Equal(t, 200*ms, RestartDelay(b, 1))
+	require.Equal(t, 800*ms, RestartDelay(b, 3))
+	require.Equal(t, 1000*ms, RestartDelay(b, 10))
+}
+
+func TestRestartState(t *testing.T) {
+	cfg := &ContainerConfig{ContainerID: "a", Spec: specki.NewSpec("/rootfs", "/bin/sh")}
+	r, err := newRestartState(cfg)
+	require.NoError(t, err)
+	require.Nil(t, r)
+
+	cfg.RestartPolicy = "on-failure:3"
+	cfg.RestoreImageDir = "/tmp/checkpoint"
+	cfg.RestorePageServer = "10.0.0.1:27000"
+	r, err = newRestartState(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	restored := new(ContainerConfig)
+	require.NoError(t, json.Unmarshal(r.Config, restored))
+	require.Equal(t, "a", restored.ContainerID)
+	require.Equal(t, "on-failure:3", restored.RestartPolicy)
+	require.Equal(t, "", restored.RestoreImageDir)
+	require.Equal(t, "", restored.RestorePageServer)
+	require.Equal(t, "/rootfs", restored.Spec.Root.Path)
+	require.Equal(t, []string{"/bin/sh"}, restored.Spec.Process.Args)
+	require.Equal(t, "/tmp/checkpoint", cfg.RestoreImageDir)
+}
+
+func TestCheckRestartConfig(t *testing.T) {
+	cfg := &ContainerConfig{ConsoleSocket: "/run/console.sock", Secrets: []Secret{{Target: "/run/secret", Data: []byte("x")}}}
+	require.NoError(t, checkRestartConfig(cfg))
+
+	cfg.RestartPolicy = RestartAlways
+	require.Error(t, checkRestartConfig(cfg))
+	cfg.ConsoleSocket = ""
+	require.Error(t, checkRestartConfig(cfg))
+	cfg.Secrets[0] = Secret{Target: "/run/secret", Source: "/etc/secret"}
+	require.NoError(t, checkRestartConfig(cfg))
+}
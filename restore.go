@@ -0,0 +1,68 @@
+package lxcri
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// Restore creates a running container from the CRIU images in checkpointDir
+// (see Container.Checkpoint). The liblxc configuration is generated from the
+// container config, like for Runtime.Create, and the container process tree
+// is restored by the monitor process instead of starting the init process.
+//
+// If the checkpoint metadata is available (see ReadCheckpointInfo), the container
+// is restored into the cgroup of the checkpointed container, unless the spec
+// defines a cgroups path or systemd cgroups are used, or the checkpointed
+// container may still use its cgroup (see restoreCgroupsPath).
+// A process terminal is passed to the ContainerConfig.ConsoleSocket, as on create.
+func (rt *Runtime) Restore(ctx context.Context, cfg *ContainerConfig, checkpointDir string) (*Container, error) {
+	dir, err := filepath.Abs(checkpointDir)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Spec == nil {
+		return nil, errorf("invalid container config: spec is nil")
+	}
+	if cfg.Spec.Process != nil && cfg.Spec.Process.Terminal && cfg.ConsoleSocket == "" {
+		return nil, errorf("invalid container config: restoring a container with terminal requires a console socket")
+	}
+
+	info, err := ReadCheckpointInfo(dir)
+	if err == ErrNotExist {
+		rt.Log.Warn().Str("dir", dir).Msg("checkpoint metadata not found")
+	} else if err != nil {
+		return nil, errorf("failed to read checkpoint metadata: %w", err)
+	}
+	if info != nil {
+		if info.ContainerID != cfg.ContainerID {
+			rt.Log.Warn().Str("cid", cfg.ContainerID).Msgf("restoring checkpoint of container %q", info.ContainerID)
+		}
+		if restoreCgroupsPath(cfg, info) {
+			rt.Log.Info().Str("cgroup", info.CgroupDir).Msg("restore into cgroup of checkpointed container")
+		}
+	}
+
+	cfg.RestoreImageDir = dir
+	return rt.Create(ctx, cfg)
+}
+
+// restoreCgroupsPath sets the cgroups path of the spec to the cgroup of the
+// checkpointed container, if the spec does not define a cgroups path.
+// The cgroup is not reused if the checkpointed container was left running
+// or if the cgroup is populated, because a container can only be created
+// in an empty cgroup (see checkCgroup).
+// It returns true if the cgroups path was set.
+func restoreCgroupsPath(cfg *ContainerConfig, info *CheckpointInfo) bool {
+	if cfg.SystemdCgroup || info.CgroupDir == "" || cfg.Spec.Linux == nil || cfg.Spec.Linux.CgroupsPath != "" {
+		return false
+	}
+	if info.LeaveRunning {
+		return false
+	}
+	ev, err := parseCgroupEvents(filepath.Join(cgroupRoot, info.CgroupDir, "cgroup.events"))
+	if err == nil && ev.populated {
+		return false
+	}
+	cfg.Spec.Linux.CgroupsPath = info.CgroupDir
+	return true
+}
@@ -0,0 +1,49 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreCgroupsPath(t *testing.T) {
+	prevRoot := cgroupRoot
+	cgroupRoot = t.TempDir()
+	defer func() { cgroupRoot = prevRoot }()
+
+	info := &CheckpointInfo{ContainerID: "c1", CgroupDir: "lxcri/c1.scope"}
+	cfg := &ContainerConfig{ContainerID: "c1", Spec: &specs.Spec{Linux: &specs.Linux{}}}
+	require.True(t, restoreCgroupsPath(cfg, info))
+	require.Equal(t, "lxcri/c1.scope", cfg.Spec.Linux.CgroupsPath)
+
+	cfg.Spec.Linux.CgroupsPath = "kubepods/c1"
+	require.False(t, restoreCgroupsPath(cfg, info))
+	require.Equal(t, "kubepods/c1", cfg.Spec.Linux.CgroupsPath)
+
+	cfg.Spec.Linux.CgroupsPath = ""
+	cfg.SystemdCgroup = true
+	require.False(t, restoreCgroupsPath(cfg, info))
+	require.Empty(t, cfg.Spec.Linux.CgroupsPath)
+
+	// the cgroup of a container that was left running is still in use
+	cfg.SystemdCgroup = false
+	info.LeaveRunning = true
+	require.False(t, restoreCgroupsPath(cfg, info))
+	require.Empty(t, cfg.Spec.Linux.CgroupsPath)
+
+	// the cgroup is populated
+	info.LeaveRunning = false
+	dir := filepath.Join(cgroupRoot, info.CgroupDir)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 0\n"), 0644))
+	require.False(t, restoreCgroupsPath(cfg, info))
+	require.Empty(t, cfg.Spec.Linux.CgroupsPath)
+
+	// the cgroup is empty
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 0\nfrozen 0\n"), 0644))
+	require.True(t, restoreCgroupsPath(cfg, info))
+	require.Equal(t, "lxcri/c1.scope", cfg.Spec.Linux.CgroupsPath)
+}
@@ -3,11 +3,15 @@ package lxcri
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/creack/pty"
@@ -43,6 +47,23 @@ var (
 var (
 	// ErrNotExist is returned if the container (runtime dir) does not exist.
 	ErrNotExist = fmt.Errorf("container does not exist")
+	// ErrExist is returned by Runtime.Create if the container (runtime dir) already exists.
+	ErrExist = fmt.Errorf("container already exists")
+	// ErrNewerRuntime is returned if the container state was written
+	// by a runtime with a newer, unsupported SchemaVersion.
+	ErrNewerRuntime = fmt.Errorf("container was created by a newer runtime")
+	// ErrConfigDrift is returned by Runtime.Load if the generated container
+	// configuration was modified after the container was created.
+	ErrConfigDrift = fmt.Errorf("container configuration was modified")
+	// ErrInitExited is returned by Runtime.Start if the container init process
+	// exited before the container process was started.
+	ErrInitExited = fmt.Errorf("container init process exited")
+	// ErrNetworkNotReady is returned by Runtime.Start if the network readiness
+	// conditions are not met within NetworkReadiness.Timeout.
+	ErrNetworkNotReady = fmt.Errorf("container network not ready")
+	// ErrExecTimeout is returned by Container.ExecContext if the process
+	// was killed because the context deadline was exceeded.
+	ErrExecTimeout = fmt.Errorf("exec process timed out")
 )
 
 // RuntimeFeatures are (security) features supported by the Runtime.
@@ -53,6 +74,10 @@ type RuntimeFeatures struct {
 	Capabilities  bool
 	Apparmor      bool
 	CgroupDevices bool
+	// CPURealtime enables the realtime CPU bandwidth limits (specs.LinuxCPU.RealtimeRuntime
+	// and specs.LinuxCPU.RealtimePeriod). It is disabled by default, because realtime
+	// group scheduling is not available with cgroup2 on most kernels (see configureCPURealtime).
+	CPURealtime bool
 }
 
 // Runtime is a factory for creating and managing containers.
@@ -68,6 +93,18 @@ type Runtime struct {
 	// are created within this directory.
 	Root string `json:",omitempty"`
 
+	// MultiTenant enables an isolated subdirectory within Root per user (UID),
+	// that can only be listed and modified by the user. Container IDs are unique per user
+	// and List, Load and Delete only see the containers of the calling user.
+	// The subdirectories of users other than root must be created by root
+	// with Runtime.AddTenant.
+	MultiTenant bool `json:",omitempty"`
+
+	// RuntimeDirPermissions is the policy for the permissions of
+	// the container runtime directories, either RuntimeDirPermissionsMinimal
+	// (the default if empty) or RuntimeDirPermissionsWorld.
+	RuntimeDirPermissions string `json:",omitempty"`
+
 	// MonitorCgroup is the path to the lxc monitor cgroup (lxc specific feature).
 	// This is the cgroup where the liblxc monitor process (lxcri-start)
 	// will be placed in. It's similar to /etc/crio/crio.conf#conmon_cgroup
@@ -78,14 +115,98 @@ type Runtime struct {
 	PayloadCgroup string `json:",omitempty"`
 
 	// LibexecDir is the the directory that contains the runtime executables.
+	// If LibexecDir is empty the executables embedded into the runtime binary
+	// (see HasEmbeddedLibexec) are extracted to the per-user cache directory.
 	LibexecDir string `json:",omitempty"`
 
 	// Featuress are runtime (security) features that apply to all containers
 	// created by the runtime.
 	Features RuntimeFeatures
 
+	// AllowConfigDrift disables the refusal to load containers whose
+	// liblxc config file or spec file were modified after create.
+	// A warning is logged instead.
+	AllowConfigDrift bool `json:",omitempty"`
+
+	// GCMinAge is the minimum time in seconds since a container has stopped,
+	// before Runtime.GC removes it. It gives the container manager the time
+	// to read the exit status and to delete the container.
+	GCMinAge uint `json:",omitempty"`
+
+	// CgroupRoot is the mountpoint of the cgroup2 hierarchy.
+	// The cgroup root is detected if CgroupRoot is empty.
+	CgroupRoot string `json:",omitempty"`
+
+	// IgnoreChecks are the names of the host checks, that do not abort Init
+	// if they fail (see CheckProcfs and CheckCgroup2). This allows to use the runtime
+	// in environments (e.g chroots, WSL or CI sandboxes) with an equivalent setup.
+	// A warning is logged for every ignored check that failed.
+	IgnoreChecks []string `json:",omitempty"`
+
+	// CPUPool is the list of CPUs (e.g `2-15`) from which CPUs are allocated
+	// exclusively for containers (see AnnotationCPUSet and AnnotationCPUSetCount).
+	// Containers without exclusive CPUs are restricted to their requested
+	// CPUs (spec cpuset) that are not allocated exclusively.
+	// If CPUPool is not set, only containers created after the first exclusive
+	// allocation in the runtime root are restricted.
+	// Use CPUPoolIsolated for the CPUs isolated with the `isolcpus` kernel parameter.
+	CPUPool string `json:",omitempty"`
+
+	// HostLocaltime enables ContainerConfig.HostLocaltime for all containers.
+	HostLocaltime bool `json:",omitempty"`
+
+	// HostDNS propagates the host DNS config (/etc/resolv.conf) to containers
+	// without ContainerConfig.DNS, unless the spec mounts /etc/resolv.conf.
+	// Loopback name servers are removed for containers with a private network namespace.
+	HostDNS bool `json:",omitempty"`
+
+	// ManageHosts generates /etc/hosts with localhost, the container hostname
+	// and the extra hosts (see ContainerConfig.ExtraHosts) for all containers,
+	// unless the spec mounts /etc/hosts.
+	ManageHosts bool `json:",omitempty"`
+
+	// LXCFS is the LXCFS mountpoint (e.g /var/lib/lxcfs), or LXCFSAuto to detect it.
+	// The LXCFS proc and sys files are bind mounted into all containers,
+	// unless AnnotationLXCFS is `false`. LXCFS is disabled if empty.
+	LXCFS string `json:",omitempty"`
+
+	// PauseFastPath enables the fast path for pause (infra) containers of a pod sandbox
+	// (see AnnotationPause). A pause container is created without seccomp profile,
+	// device files and hooks, and `lxcri-init` holds the container namespaces
+	// in place of the pause binary. This reduces the per-pod overhead on dense nodes.
+	PauseFastPath bool `json:",omitempty"`
+
+	// SeccompDefault enables a default seccomp profile for containers
+	// whose spec has no seccomp profile (see AnnotationSeccompUnconfined).
+	SeccompDefault bool `json:",omitempty"`
+	// SeccompDefaultProfile is the path to the default seccomp profile
+	// in the OCI spec format (linux.seccomp). The builtin profile,
+	// derived from the containers-common default profile, is used if empty.
+	SeccompDefaultProfile string `json:",omitempty"`
+
+	// DefaultMounts are added to every container, unless the container spec
+	// has a mount with the same destination (e.g a CA certificate bundle).
+	DefaultMounts []specs.Mount `json:",omitempty"`
+	// DefaultEnv are environment variables (KEY=value) added to every container process,
+	// unless the container spec sets a variable with the same name (e.g HTTP_PROXY).
+	DefaultEnv []string `json:",omitempty"`
+	// DefaultSysctls are added to every container, unless the container spec
+	// sets the same sysctl. A default sysctl is ignored with a warning
+	// if the container has no private namespace for it.
+	// The defaults are applied before the HookCreate lifecycle hooks.
+	DefaultSysctls map[string]string `json:",omitempty"`
+
 	specs.Hooks `json:",omitempty"`
 
+	// LifecycleHooks are the hooks executed by the runtime
+	// within the container lifecycle (see LifecycleHooks.RegisterHook).
+	LifecycleHooks `json:"-"`
+
+	// BestEffortHooks are the paths of OCI hooks whose failure does not
+	// abort the container creation or start (see AnnotationBestEffortHooks).
+	// The hooks are added to the AnnotationBestEffortHooks of every container.
+	BestEffortHooks []string `json:",omitempty"`
+
 	// Environment passed to `lxcri-start`
 	env []string
 
@@ -99,8 +220,18 @@ type Runtime struct {
 
 	LogConfig LogConfig
 	Timeouts  Timeouts
+	// Backoff are the poll intervals used while waiting for
+	// container state changes.
+	Backoff Backoff
+	// RestartBackoff are the delays between the restarts
+	// of a container (see ReloadableRuntime.MonitorRestarts).
+	RestartBackoff Backoff
 
 	ConfigPath string `json:"-"`
+
+	report *HostReport
+	// events are the subscribers of Runtime.Events.
+	events *eventBus
 }
 
 // LogConfig is the runtime log configuration.
@@ -114,6 +245,20 @@ type LogConfig struct {
 	LogConsole bool              `json:"-"`
 	LogContext map[string]string `json:"-"`
 
+	// ConsoleLogLevel enables an additional console log backend
+	// with the given level, if LogConsole is false.
+	ConsoleLogLevel string `json:",omitempty"`
+	// Backends are additional log backends (e.g log.JournaldBackend)
+	// the runtime writes to. Each backend has its own log level.
+	// The backends are not closed by the runtime.
+	Backends []log.Backend `json:"-"`
+
+	// RateLimit is the default rate limit for debug and trace log events
+	// with the same message e.g from state polling.
+	RateLimit log.RateLimit `json:",omitempty"`
+	// RateLimits are the rate limits for debug and trace log events by message.
+	RateLimits map[string]log.RateLimit `json:",omitempty"`
+
 	ContainerLogLevel string `json:",omitempty"`
 	ContainerLogFile  string `json:",omitempty"`
 }
@@ -153,15 +298,29 @@ func (rt *Runtime) isPrivileged() bool {
 // Init initializes the runtime instance.
 // It creates required directories and checks the runtimes system configuration.
 // Unsupported runtime features are disabled and a warning message is logged.
+// The results of the host checks are available from Report,
+// even if Init returns with an error.
 // Init must be called once for a runtime instance before calling any other method.
 func (rt *Runtime) Init() error {
 	if err := rt.ConfigureLogger(); err != nil {
 		return err
 	}
+	rt.report = &HostReport{LXCVersion: lxc.Version()}
+	// The host report is completed on every return path.
+	defer rt.reportHost()
+	if rt.events == nil {
+		rt.events = newEventBus()
+	}
+
 	rt.Log.Debug().Msgf("Using runtime root %s", rt.Root)
 	if err := os.MkdirAll(rt.Root, 0711); err != nil {
 		return errorf("failed to create rootfs %s: %w", rt.Root, err)
 	}
+	if rt.MultiTenant {
+		if err := rt.initTenantDir(); err != nil {
+			return errorf("failed to initialize tenant dir: %w", err)
+		}
+	}
 
 	_, rt.usernsConfigured = os.LookupEnv("_CONTAINERS_USERNS_CONFIGURED")
 
@@ -176,13 +335,34 @@ func (rt *Runtime) Init() error {
 
 	rt.keepEnv("HOME", "XDG_RUNTIME_DIR", "PATH", "LISTEN_FDS")
 
-	err = canExecute(rt.libexec(ExecStart), rt.libexec(ExecHook), rt.libexec(ExecInit))
-	if err != nil {
-		return errorf("access check failed: %w", err)
+	if err := rt.initLibexec(); err != nil {
+		return errorf("failed to setup runtime executables: %w", err)
 	}
 
-	if err := isFilesystem("/proc", "proc"); err != nil {
-		return errorf("procfs not mounted on /proc: %w", err)
+	// All checks are recorded in the host report before the first
+	// failed required check is returned, so that `lxcri check`
+	// reports every problem of the host setup at once.
+	var checkErr error
+	for _, name := range []string{ExecStart, ExecHook, ExecHookBuiltin, ExecInit} {
+		err := canExecute(rt.libexec(name))
+		rt.report.require(name, err, "install the runtime executables or set the libexec directory to "+rt.LibexecDir)
+		if err != nil && checkErr == nil {
+			checkErr = errorf("access check failed: %w", err)
+		}
+	}
+
+	err = isFilesystem("/proc", "proc")
+	rt.report.require(CheckProcfs, err, "mount procfs on /proc: `mount -t proc proc /proc`")
+	if err := rt.checkFailed(CheckProcfs, err); err != nil && checkErr == nil {
+		checkErr = errorf("procfs not mounted on /proc: %w", err)
+	}
+
+	if rt.CgroupRoot != "" {
+		err := isFilesystem(rt.CgroupRoot, "cgroup2")
+		rt.report.require(CheckCgroup2, err, "mount the cgroup2 hierarchy on "+rt.CgroupRoot+" or change the cgroup root")
+		if err := rt.checkFailed(CheckCgroup2, err); err != nil && checkErr == nil {
+			checkErr = errorf("cgroup2 not mounted on %s: %w", rt.CgroupRoot, err)
+		}
 	}
 
 	cgroupRoot, err = detectCgroupRoot(rt)
@@ -191,6 +371,10 @@ func (rt *Runtime) Init() error {
 	}
 	rt.Log.Info().Msgf("using cgroup root %s", cgroupRoot)
 
+	if checkErr != nil {
+		return checkErr
+	}
+
 	if !lxc.VersionAtLeast(3, 1, 0) {
 		return errorf("liblxc runtime version is %s, but >= 3.1.0 is required", lxc.Version())
 	}
@@ -212,47 +396,68 @@ func (rt *Runtime) Init() error {
 // ConfigureLogger creates the logger instance for the Runtime.
 // The ContainerLogFile  is set to /dev/stdout if LogConsole is enabled.
 // ConfigureLogger is already called from Init.
-// NOTE: Don't call ConfigureLogger while the logger is in use.
+// NOTE: Don't call ConfigureLogger while the logger is in use,
+// use ReloadableRuntime to reconfigure the logger of a runtime in use.
 func (rt *Runtime) ConfigureLogger() error {
-	level, err := zerolog.ParseLevel(rt.LogConfig.LogLevel)
-	if err != nil {
-		return fmt.Errorf("failed to parse log level: %w", err)
-	}
-
 	oldLogFile := rt.LogConfig.file
 	if oldLogFile != nil {
 		rt.Log.Info().Msgf("reconfigure logger - closing current log file %s", oldLogFile.Name())
 	}
+	if err := rt.configureLogger(); err != nil {
+		return err
+	}
+	// The new logger instance is ready, so we can close the old one now.
+	if oldLogFile != nil {
+		oldLogFile.Close()
+	}
+	return nil
+}
+
+// configureLogger creates the logger instance without closing the previous log file.
+func (rt *Runtime) configureLogger() error {
+	level, err := zerolog.ParseLevel(rt.LogConfig.LogLevel)
+	if err != nil {
+		return fmt.Errorf("failed to parse log level: %w", err)
+	}
 
-	var logCtx zerolog.Context
+	var file *os.File
+	var backends []log.Backend
 	if rt.LogConfig.LogConsole {
 		// TODO use console logger if filepath is /dev/stdout or /dev/stderr ?
-		logCtx = log.ConsoleLogger(true, level)
+		backends = append(backends, log.ConsoleBackend(true, level))
 		// FIXME not a good idea to change the configuration here
 		rt.LogConfig.ContainerLogFile = "/dev/stdout"
 	} else {
+		var consoleLevel zerolog.Level
+		if rt.LogConfig.ConsoleLogLevel != "" {
+			consoleLevel, err = log.ParseLevel(rt.LogConfig.ConsoleLogLevel)
+			if err != nil {
+				return fmt.Errorf("failed to parse console log level: %w", err)
+			}
+		}
 		if err := os.MkdirAll(filepath.Dir(rt.LogConfig.LogFile), 0750); err != nil {
 			return err
 		}
-		l, err := log.OpenFile(rt.LogConfig.LogFile, 0600)
+		file, err = log.OpenFile(rt.LogConfig.LogFile, 0600)
 		if err != nil {
 			return fmt.Errorf("failed to open log file %q: %w", rt.LogConfig.LogFile, err)
 		}
-		rt.LogConfig.file = l
-		logCtx = log.NewLogger(rt.LogConfig.file, level)
+		backends = append(backends, log.WriterBackend(file, level))
+		if rt.LogConfig.ConsoleLogLevel != "" {
+			backends = append(backends, log.ConsoleBackend(true, consoleLevel))
+		}
 	}
+	backends = append(backends, rt.LogConfig.Backends...)
+
+	logCtx := log.NewMultiLogger(backends...)
 	for k, v := range rt.LogConfig.LogContext {
 		logCtx = logCtx.Str(k, v)
 	}
 	rt.Log = logCtx.Logger()
-
-	// The new logger instance is ready, so we can close the old one now.
-	// FIXME what about race-conditions with parallel calls to the logger ?
-	// -> replace rt.Log with function and protect Logger configuration with mutex ?
-	if oldLogFile != nil {
-		oldLogFile.Close()
+	if rt.LogConfig.RateLimit.Burst > 0 || len(rt.LogConfig.RateLimits) > 0 {
+		rt.Log = rt.Log.Hook(log.NewRateLimiter(rt.LogConfig.RateLimit, rt.LogConfig.RateLimits))
 	}
-
+	rt.LogConfig.file = file
 	return nil
 }
 
@@ -260,6 +465,26 @@ func (rt *Runtime) checkConfig(cfg *ContainerConfig) error {
 	if len(cfg.ContainerID) == 0 {
 		return errorf("missing container ID")
 	}
+	if _, err := ParseRestartPolicy(cfg.RestartPolicy); err != nil {
+		return errorf("invalid container config: %w", err)
+	}
+	if err := checkRestartConfig(cfg); err != nil {
+		return errorf("invalid container config: %w", err)
+	}
+	if cfg.CRILogFile != "" {
+		if !filepath.IsAbs(cfg.CRILogFile) {
+			return errorf("invalid container config: CRI log file %q is not an absolute path", cfg.CRILogFile)
+		}
+		if cfg.ConsoleSocket != "" || (cfg.Spec != nil && cfg.Spec.Process != nil && cfg.Spec.Process.Terminal) {
+			return errorf("invalid container config: CRI log file requires inherited stdio")
+		}
+	}
+	if cfg.RestoreImageDir != "" && !filepath.IsAbs(cfg.RestoreImageDir) {
+		return errorf("invalid container config: restore image dir %q is not an absolute path", cfg.RestoreImageDir)
+	}
+	if cfg.RestorePageServer != "" && cfg.RestoreImageDir == "" {
+		return errorf("invalid container config: restore page server requires a restore image dir")
+	}
 	return rt.checkSpec(cfg.Spec)
 }
 
@@ -319,7 +544,7 @@ func (rt *Runtime) keepEnv(names ...string) {
 // A loaded Container must be released with Container.Release after use.
 func (rt *Runtime) Load(containerID string) (*Container, error) {
 	rt.Log.Debug().Str("cid", containerID).Msg("loading container")
-	dir := filepath.Join(rt.Root, containerID)
+	dir := filepath.Join(rt.containersDir(), containerID)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return nil, ErrNotExist
 	}
@@ -327,20 +552,33 @@ func (rt *Runtime) Load(containerID string) (*Container, error) {
 		ContainerConfig: &ContainerConfig{
 			Log: rt.Log.With().Str("cid", containerID).Logger(),
 		},
-		runtimeDir: dir,
+		runtimeDir:         dir,
+		backoff:            rt.Backoff,
+		cpuAllocationsFile: rt.cpuAllocationsFile(),
+		events:             rt.events,
+		hooks:              &rt.LifecycleHooks,
 	}
 	if err := c.load(); err != nil {
 		return nil, err
 	}
+	if err := c.verifyDigests(); err != nil {
+		if !rt.AllowConfigDrift {
+			c.Release()
+			return nil, err
+		}
+		c.Log.Warn().Msgf("loading modified container: %s", err)
+	}
 	return c, nil
 }
 
 // Start starts the given container.
 // Start simply unblocks the init process `lxcri-init`,
 // which then executes the container process.
+// If the container has NetworkReadiness conditions, Start waits for them first.
 // The given container must have been created with Runtime.Create.
 func (rt *Runtime) Start(ctx context.Context, c *Container) error {
 	rt.Log.Info().Msg("notify init to start container process")
+	started := time.Now()
 
 	state, err := c.State()
 	if err != nil {
@@ -350,11 +588,25 @@ func (rt *Runtime) Start(ctx context.Context, c *Container) error {
 		return fmt.Errorf("invalid container state. expected %q, but was %q", specs.StateCreated, state.SpecState.Status)
 	}
 
+	if err := c.waitNetworkReady(ctx); err != nil {
+		return err
+	}
+
+	if err := c.hooks.run(ctx, HookStart, c); err != nil {
+		return errorf("%w", err)
+	}
+
 	err = c.start(ctx)
 	if err != nil {
 		return err
 	}
 
+	if t, err := c.Timings(); err == nil {
+		c.timings = *t
+		c.timings.Start = time.Since(started)
+		c.recordTimings()
+	}
+
 	if c.Spec.Hooks != nil {
 		state, err := c.State()
 		if err != nil {
@@ -366,8 +618,9 @@ func (rt *Runtime) Start(ctx context.Context, c *Container) error {
 }
 
 func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
+	c.StartPath = rt.libexec(ExecStart)
 	// #nosec
-	cmd := exec.Command(rt.libexec(ExecStart), c.LinuxContainer.Name(), rt.Root, c.ConfigFilePath())
+	cmd := exec.Command(c.StartPath, c.linuxContainer.Name(), filepath.Dir(c.runtimeDir), c.ConfigFilePath())
 	cmd.Env = rt.env // environment variables required for liblxc
 	cmd.Dir = c.Spec.Root.Path
 
@@ -384,24 +637,90 @@ func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
 
 	// NOTE any config change via clxc.setConfigItem
 	// must be done before calling SaveConfigFile
-	err = c.LinuxContainer.SaveConfigFile(c.ConfigFilePath())
+	err = c.linuxContainer.SaveConfigFile(c.ConfigFilePath())
 	if err != nil {
 		return errorf("failed to save config file to %q: %w", c.ConfigFilePath(), err)
 	}
 
+	if err := c.updateDigests(); err != nil {
+		return errorf("failed to create config digests: %w", err)
+	}
+
+	// The monitor reports failures through the error pipe.
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		return errorf("failed to create error pipe: %w", err)
+	}
+	defer errR.Close()
+	// Keep the file descriptors passed for socket activation (LISTEN_FDS)
+	// at their position and append the write end of the error pipe.
+	// File descriptors leaked by the caller of the runtime are closed
+	// by the monitor process, so that they are not kept open by the container.
+	cmd.ExtraFiles, err = listenFiles()
+	if err != nil {
+		errW.Close()
+		return errorf("failed to duplicate socket activation file descriptors: %w", err)
+	}
+	defer closeFiles(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, errW)
+	cmd.Env = append(append([]string{}, rt.env...), fmt.Sprintf("LXCRI_ERROR_FD=%d", 2+len(cmd.ExtraFiles)))
+	if c.ConsoleSocket != "" {
+		// The monitor resizes the terminal on requests written to the control FIFOs.
+		if err := c.createCtlFifos(); err != nil {
+			errW.Close()
+			return errorf("failed to create terminal control FIFOs: %w", err)
+		}
+		cmd.Env = append(cmd.Env, "LXCRI_CTL=1")
+	}
+	if c.CRILogFile != "" {
+		// The monitor copies the container stdout and stderr to the CRI log file.
+		cmd.Env = append(cmd.Env, "LXCRI_CRI_LOG="+c.CRILogFile)
+	}
+	if c.RestoreImageDir != "" {
+		// The monitor restores the container from the CRIU images.
+		cmd.Env = append(cmd.Env, "LXCRI_RESTORE_DIR="+c.RestoreImageDir)
+	}
+	if c.RestorePageServer != "" {
+		var env []string
+		var stop func()
+		env, stop, err = c.lazyRestoreEnv(ctx)
+		if err != nil {
+			errW.Close()
+			return errorf("failed to prepare lazy restore: %w", err)
+		}
+		// The daemon waits for the restore forever.
+		defer func() {
+			if err != nil {
+				stop()
+			}
+		}()
+		cmd.Env = append(cmd.Env, env...)
+	}
+	// The monitor stops the container when the maximum runtime is exceeded.
+	cmd.Env = append(cmd.Env, rt.maxRuntimeEnv(c)...)
+
 	rt.Log.Debug().Msg("starting lxc monitor process")
+	spawn := time.Now()
 	if c.ConsoleSocket != "" {
 		err = rt.runStartCmdConsole(ctx, cmd, c.ConsoleSocket)
 	} else {
 		err = cmd.Start()
 	}
+	// The parent must close the write end, otherwise reading
+	// from the error pipe blocks even if the monitor has exited.
+	errW.Close()
 
 	if err != nil {
 		return err
 	}
 
 	c.CreatedAt = time.Now()
+	c.timings.MonitorSpawn = c.CreatedAt.Sub(spawn)
 	c.Pid = cmd.Process.Pid
+	// The monitor may have already died, waitCreated reports the failure.
+	if c.MonitorStartTime, err = processStartTime(c.Pid); err != nil {
+		rt.Log.Warn().Msgf("failed to get monitor process start time: %s", err)
+	}
 	rt.Log.Info().Int("pid", cmd.Process.Pid).Msg("monitor process started")
 
 	p := c.RuntimePath("lxcri.json")
@@ -414,13 +733,109 @@ func (rt *Runtime) runStartCmd(ctx context.Context, c *Container) (err error) {
 	defer cancel()
 
 	rt.Log.Debug().Msg("waiting for init")
-	if err := c.waitCreated(ctx); err != nil {
+	wait := c.waitCreated
+	if c.RestoreImageDir != "" {
+		wait = c.waitRestored
+	}
+	if err := wait(ctx); err != nil {
+		if merr := readMonitorError(errR); merr != nil {
+			merr.Err = err
+			return merr
+		}
 		return err
 	}
-
+	// The cgroup is created by the monitor process.
+	if err := rt.configureDeviceFilter(c); err != nil {
+		return errorf("failed to configure device filter: %w", err)
+	}
+	if err := rt.configureSharedCPUs(c); err != nil {
+		return errorf("failed to restrict cpus: %w", err)
+	}
+	c.timings.InitReady = time.Since(c.CreatedAt)
 	return nil
 }
 
+// MonitorError is the failure reported by the monitor process (lxcri-start)
+// through the error pipe.
+type MonitorError struct {
+	// Reason is a CamelCase identifier for the failure e.g StartFailed.
+	Reason string
+	// Message describes the failure.
+	Message string
+	// Err is the error returned while waiting for the container,
+	// e.g ErrInitExited.
+	Err error
+}
+
+func (e *MonitorError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("monitor failed (%s): %s: %s", e.Reason, e.Message, e.Err)
+	}
+	return fmt.Sprintf("monitor failed (%s): %s", e.Reason, e.Message)
+}
+
+// Unwrap returns the error returned while waiting for the container.
+func (e *MonitorError) Unwrap() error {
+	return e.Err
+}
+
+// parseMonitorError parses the first line '<reason> <message>'
+// written by the monitor process to the error pipe.
+// It returns nil if data does not contain a failure.
+func parseMonitorError(data []byte) *MonitorError {
+	line := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+	if line == "" {
+		return nil
+	}
+	vals := strings.SplitN(line, " ", 2)
+	e := &MonitorError{Reason: vals[0]}
+	if len(vals) == 2 {
+		e.Message = strings.TrimSpace(vals[1])
+	}
+	return e
+}
+
+// readMonitorError reads the failure reported by the monitor process.
+// The monitor may still be running (e.g if the container init process failed
+// but the monitor did not yet exit), so the read times out quickly.
+func readMonitorError(r *os.File) *MonitorError {
+	if err := r.SetReadDeadline(time.Now().Add(time.Millisecond * 100)); err != nil {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	n, _ := io.ReadAtLeast(r, buf, 1)
+	return parseMonitorError(buf[:n])
+}
+
+// listenFiles returns duplicates of the file descriptors passed to the runtime
+// for socket activation (see `man sd_listen_fds`).
+// The file descriptors are duplicated, because they are owned by the caller
+// of the runtime (e.g an application that embeds the runtime), and an *os.File
+// closes its file descriptor when it is garbage collected.
+// The returned files must be closed with closeFiles.
+func listenFiles() ([]*os.File, error) {
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	files := make([]*os.File, 0, n)
+	for fd := 3; fd < 3+n; fd++ {
+		dup, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 3)
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("failed to duplicate fd %d: %w", fd, err)
+		}
+		files = append(files, os.NewFile(uintptr(dup), fmt.Sprintf("listen-fd-%d", fd)))
+	}
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
 func (rt *Runtime) runStartCmdConsole(ctx context.Context, cmd *exec.Cmd, consoleSocket string) error {
 	rt.Log.Debug().Msgf("running command in console %s", consoleSocket)
 	dialer := net.Dialer{}
@@ -446,6 +861,7 @@ func (rt *Runtime) runStartCmdConsole(ctx context.Context, cmd *exec.Cmd, consol
 	if err != nil {
 		return fmt.Errorf("failed to get file from unix connection: %w", err)
 	}
+	defer sockFile.Close()
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		return fmt.Errorf("failed to start with pty: %w", err)
@@ -473,6 +889,12 @@ func (rt *Runtime) Kill(ctx context.Context, c *Container, signum unix.Signal) e
 	if state == specs.StateStopped {
 		return errorf("container already stopped")
 	}
+	// The restart policy is not applied to a container stopped explicitly.
+	if isStopSignal(signum) {
+		if err := os.WriteFile(c.RuntimePath(stoppedFile), nil, 0640); err != nil {
+			return errorf("failed to mark container as stopped: %w", err)
+		}
+	}
 	return c.kill(ctx, signum)
 }
 
@@ -486,10 +908,25 @@ func (rt *Runtime) Delete(ctx context.Context, containerID string, force bool) e
 	if err == ErrNotExist {
 		return err
 	}
+	// Never remove the state of a container managed by a newer runtime.
+	if errors.Is(err, ErrNewerRuntime) {
+		return err
+	}
+	// The runtime dir must not be removed while the monitor may still be running.
+	// Containers with configuration drift can be deleted with AllowConfigDrift enabled.
+	if errors.Is(err, ErrConfigDrift) {
+		return err
+	}
 	if err != nil {
 		// NOTE hooks won't run in this case
 		rt.Log.Warn().Msgf("deleting runtime dir for unloadable container: %s", err)
-		return os.RemoveAll(filepath.Join(rt.Root, containerID))
+		if err := shredSecrets(filepath.Join(rt.containersDir(), containerID, "secrets")); err != nil {
+			rt.Log.Error().Msgf("failed to remove secrets: %s", err)
+		}
+		if err := releaseCPUs(rt.cpuAllocationsFile(), filepath.Join(rt.containersDir(), containerID), rt.Log); err != nil {
+			rt.Log.Error().Msgf("failed to release cpus: %s", err)
+		}
+		return os.RemoveAll(filepath.Join(rt.containersDir(), containerID))
 	}
 
 	return c.Delete(ctx, force)
@@ -516,22 +953,29 @@ func (c *Container) Delete(ctx context.Context, force bool) error {
 		}
 	}
 
-	if err := c.waitMonitorStopped(ctx); err != nil {
+	if err := c.waitMonitorExited(ctx); err != nil {
 		c.Log.Error().Msgf("failed to stop monitor process %d: %s", c.Pid, err)
 	}
+	c.runOnStopped(ctx)
+
+	// Run the delete hooks before any resources are released,
+	// so that a failing hook aborts the deletion and it can be retried.
+	if err := c.hooks.run(ctx, HookDelete, c); err != nil {
+		return errorf("%w", err)
+	}
 
 	// From OCI runtime spec
 	// "Note that resources associated with the container, but not
 	// created by this container, MUST NOT be deleted."
 	// The *lxc.Container is created with `rootfs.managed=0`,
 	// so calling *lxc.Container.Destroy will not delete container resources.
-	if err := c.LinuxContainer.Destroy(); err != nil {
+	if err := c.linuxContainer.Destroy(); err != nil {
 		return fmt.Errorf("failed to destroy container: %w", err)
 	}
 
 	// the monitor might be part of the cgroup so wait for it to exit
 	eventsFile := filepath.Join(cgroupRoot, c.CgroupDir, "cgroup.events")
-	err = pollCgroupEvents(ctx, eventsFile, func(ev cgroupEvents) bool {
+	err = pollCgroupEvents(ctx, c.backoff, eventsFile, func(ev cgroupEvents) bool {
 		return !ev.populated
 	})
 	if err != nil && !os.IsNotExist(err) {
@@ -552,12 +996,37 @@ func (c *Container) Delete(ctx context.Context, force bool) error {
 		specki.RunHooks(ctx, &state.SpecState, c.Spec.Hooks.Poststop, true)
 	}
 
+	if err := shredSecrets(c.secretsDir()); err != nil {
+		return errorf("failed to remove secrets: %w", err)
+	}
+	if err := releaseCPUs(c.cpuAllocationsFile, c.runtimeDir, c.Log); err != nil {
+		return errorf("failed to release cpus: %w", err)
+	}
 	return os.RemoveAll(c.RuntimePath())
 }
 
+// ListFilter selects the containers returned by Runtime.List.
+type ListFilter func(cfg *ContainerConfig) bool
+
+// WithLabel returns a ListFilter that matches containers with the given label.
+// The label is either a key, which matches any label value,
+// or a key value pair in the form `key=value`.
+func WithLabel(label string) ListFilter {
+	kv := strings.SplitN(label, "=", 2)
+	return func(cfg *ContainerConfig) bool {
+		val, exist := cfg.Labels[kv[0]]
+		if !exist {
+			return false
+		}
+		return len(kv) == 1 || val == kv[1]
+	}
+}
+
 // List returns the IDs for all existing containers.
-func (rt *Runtime) List() ([]string, error) {
-	dir, err := os.Open(rt.Root)
+// If filters are given, only the IDs of containers that match
+// all of the filters are returned.
+func (rt *Runtime) List(filters ...ListFilter) ([]string, error) {
+	dir, err := os.Open(rt.containersDir())
 	if err != nil {
 		return nil, err
 	}
@@ -569,13 +1038,38 @@ func (rt *Runtime) List() ([]string, error) {
 	// ignore hidden elements
 	visible := make([]string, 0, len(names))
 	for _, name := range names {
-		if name[0] != '.' {
-			visible = append(visible, name)
+		if name[0] == '.' {
+			continue
+		}
+		if len(filters) > 0 && !rt.matchContainer(name, filters) {
+			continue
 		}
+		visible = append(visible, name)
 	}
 	return visible, nil
 }
 
+func (rt *Runtime) matchContainer(containerID string, filters []ListFilter) bool {
+	// #nosec
+	data, err := os.ReadFile(filepath.Join(rt.containersDir(), containerID, "lxcri.json"))
+	if err != nil {
+		// The container may be in the process of being created or deleted.
+		rt.Log.Debug().Str("cid", containerID).Msgf("skipping container: %s", err)
+		return false
+	}
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	if err := decodeContainerState(data, c); err != nil {
+		rt.Log.Warn().Str("cid", containerID).Msgf("skipping container: %s", err)
+		return false
+	}
+	for _, match := range filters {
+		if !match(c.ContainerConfig) {
+			return false
+		}
+	}
+	return true
+}
+
 // DefaultRuntime is the default Runtime configuration.
 var DefaultRuntime = Runtime{
 	Root:          "/run/lxcri",
@@ -595,12 +1089,27 @@ var DefaultRuntime = Runtime{
 		ContainerLogLevel: "warn",
 	},
 
+	GCMinAge: 3600,
+
 	Timeouts: Timeouts{
 		CreateTimeout: 60,
 		StartTimeout:  30,
 		KillTimeout:   10,
 		DeleteTimeout: 10,
 	},
+
+	Backoff: Backoff{
+		InitialInterval: 5,
+		MaxInterval:     100,
+		Factor:          2,
+		Jitter:          0.2,
+	},
+
+	RestartBackoff: Backoff{
+		InitialInterval: 100,
+		MaxInterval:     60000,
+		Factor:          2,
+	},
 }
 
 // NewRuntime creates a new runtime instance.
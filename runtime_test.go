@@ -2,9 +2,11 @@ package lxcri
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -119,7 +121,7 @@ func TestSharedPIDNamespace(t *testing.T) {
 
 // TODO test uts namespace (shared with host)
 
-// NOTE  works only if cgroup root is writable
+// NOTE  works only if cgroup root is writable (see `lxcri check`)
 // sudo chown -R $(whoami):$(whoami) /sys/fs/cgroup/$(cat /proc/self/cgroup  | grep '^0:' | cut -d: -f3)
 func TestNonEmptyCgroup(t *testing.T) {
 	t.Parallel()
@@ -194,6 +196,7 @@ func TestRuntimePrivileged(t *testing.T) {
 // sudo chown -R $(whoami):$(whoami) /sys/fs/cgroup/unified$(cat /proc/self/cgroup  | grep '^0:' | cut -d: -f3)
 // sudo chown -R $(whoami):$(whoami) /sys/fs/cgroup$(cat /proc/self/cgroup  | grep '^0:' | cut -d: -f3)
 //
+// Run `lxcri check` as the test user to verify the host setup.
 func TestRuntimeUnprivileged(t *testing.T) {
 	t.Parallel()
 	if os.Getuid() == 0 {
@@ -253,3 +256,46 @@ func testRuntime(t *testing.T, rt *Runtime, cfg *ContainerConfig) {
 	err = c.Delete(ctx, true)
 	require.NoError(t, err)
 }
+
+func TestParseMonitorError(t *testing.T) {
+	require.Nil(t, parseMonitorError(nil))
+	require.Nil(t, parseMonitorError([]byte("\n")))
+
+	e := parseMonitorError([]byte("StartFailed failed to start container (error 1): no rootfs\nLoadConfig ignored\n"))
+	require.NotNil(t, e)
+	require.Equal(t, "StartFailed", e.Reason)
+	require.Equal(t, "failed to start container (error 1): no rootfs", e.Message)
+
+	e = parseMonitorError([]byte("CloseFds"))
+	require.Equal(t, &MonitorError{Reason: "CloseFds"}, e)
+
+	err := fmt.Errorf("%w: init exited", e)
+	var merr *MonitorError
+	require.True(t, errors.As(err, &merr))
+	require.Equal(t, "CloseFds", merr.Reason)
+
+	e = parseMonitorError([]byte("StartFailed no rootfs"))
+	e.Err = ErrInitExited
+	require.Equal(t, "monitor failed (StartFailed): no rootfs: "+ErrInitExited.Error(), e.Error())
+	require.True(t, errors.Is(e, ErrInitExited))
+}
+
+func TestListenFiles(t *testing.T) {
+	// Use the file descriptor 3 opened by the test process as socket activation fd.
+	if _, err := unix.FcntlInt(3, unix.F_GETFD, 0); err != nil {
+		t.Skip("fd 3 is not open")
+	}
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	files, err := listenFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.NotEqual(t, uintptr(3), files[0].Fd())
+	closeFiles(files)
+	runtime.GC()
+
+	// The passed file descriptor is still open.
+	_, err = unix.FcntlInt(3, unix.F_GETFD, 0)
+	require.NoError(t, err)
+}
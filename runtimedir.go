@@ -0,0 +1,85 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Policies for the permissions of the container runtime directory
+// (see Runtime.RuntimeDirPermissions).
+const (
+	// RuntimeDirPermissionsMinimal grants the container only the permissions
+	// on the runtime directory it requires. This is the default policy.
+	RuntimeDirPermissionsMinimal = "minimal"
+	// RuntimeDirPermissionsWorld makes the runtime directory world-writable (0777).
+	// Use this only for compatibility, e.g if a hook that runs as another user
+	// writes to the runtime directory.
+	RuntimeDirPermissionsWorld = "world"
+)
+
+// dirPermissions are the mode and ownership of a directory.
+// A UID or GID of -1 leaves the owner unchanged.
+type dirPermissions struct {
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+func (p dirPermissions) apply(dir string) error {
+	if p.UID != -1 || p.GID != -1 {
+		if err := os.Chown(dir, p.UID, p.GID); err != nil {
+			return fmt.Errorf("failed to chown %s: %w", dir, err)
+		}
+	}
+	// chmod is required because umask is applied to mkdir
+	// and chown clears the setgid bit.
+	if err := os.Chmod(dir, p.Mode); err != nil {
+		return fmt.Errorf("failed to chmod %s: %w", dir, err)
+	}
+	return nil
+}
+
+// runtimeDirPermissions computes the permissions of the container runtime
+// directory for the given policy. The runtime directory is bind mounted into
+// the container. It must be searchable by the (mapped) container root user,
+// which sets up the container, and by the container process user,
+// which runs lxcri-init. uid is the UID of the runtime process.
+func runtimeDirPermissions(policy string, spec *specs.Spec, uid int) (dirPermissions, error) {
+	switch policy {
+	case RuntimeDirPermissionsWorld:
+		return dirPermissions{Mode: 0777, UID: -1, GID: -1}, nil
+	case "", RuntimeDirPermissionsMinimal:
+	default:
+		return dirPermissions{}, fmt.Errorf("invalid runtime dir permissions policy %q", policy)
+	}
+
+	var uidMappings, gidMappings []specs.LinuxIDMapping
+	if spec.Linux != nil {
+		uidMappings = spec.Linux.UIDMappings
+		gidMappings = spec.Linux.GIDMappings
+	}
+	var user specs.User
+	if spec.Process != nil {
+		user = spec.Process.User
+	}
+	rootUID := int(specki.UnmapContainerID(0, uidMappings))
+	processUID := int(specki.UnmapContainerID(user.UID, uidMappings))
+	processGID := int(specki.UnmapContainerID(user.GID, gidMappings))
+
+	if rootUID == uid && processUID == uid {
+		return dirPermissions{Mode: 0700, UID: -1, GID: -1}, nil
+	}
+	// An unprivileged runtime can not change the owner,
+	// so every user must be allowed to search (but not to list or modify) the directory.
+	if uid != 0 {
+		return dirPermissions{Mode: 0711, UID: -1, GID: -1}, nil
+	}
+	// The directory is owned by the mapped container root user, because
+	// capabilities within the user namespace do not apply to unmapped inodes.
+	// The group of the container process is set for searching the directory.
+	// New files inherit the group because the setgid bit is set.
+	return dirPermissions{Mode: 0710 | os.ModeSetgid, UID: rootUID, GID: processGID}, nil
+}
@@ -0,0 +1,54 @@
+package lxcri
+
+import (
+	"os"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeDirPermissions(t *testing.T) {
+	spec := &specs.Spec{
+		Process: &specs.Process{User: specs.User{UID: 0, GID: 0}},
+		Linux:   &specs.Linux{},
+	}
+
+	p, err := runtimeDirPermissions(RuntimeDirPermissionsWorld, spec, 0)
+	require.NoError(t, err)
+	require.Equal(t, dirPermissions{Mode: 0777, UID: -1, GID: -1}, p)
+
+	_, err = runtimeDirPermissions("public", spec, 0)
+	require.Error(t, err)
+
+	// no user namespace, privileged runtime, process runs as root
+	p, err = runtimeDirPermissions("", spec, 0)
+	require.NoError(t, err)
+	require.Equal(t, dirPermissions{Mode: 0700, UID: -1, GID: -1}, p)
+
+	// no user namespace, process runs as non-root user
+	spec.Process.User = specs.User{UID: 1000, GID: 100}
+	p, err = runtimeDirPermissions(RuntimeDirPermissionsMinimal, spec, 0)
+	require.NoError(t, err)
+	require.Equal(t, dirPermissions{Mode: 0710 | os.ModeSetgid, UID: 0, GID: 100}, p)
+
+	// user namespace, privileged runtime
+	spec.Linux.UIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 20000, Size: 65536}}
+	spec.Linux.GIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 20000, Size: 65536}}
+	p, err = runtimeDirPermissions(RuntimeDirPermissionsMinimal, spec, 0)
+	require.NoError(t, err)
+	require.Equal(t, dirPermissions{Mode: 0710 | os.ModeSetgid, UID: 20000, GID: 20100}, p)
+
+	// user namespace, unprivileged runtime
+	p, err = runtimeDirPermissions(RuntimeDirPermissionsMinimal, spec, 1000)
+	require.NoError(t, err)
+	require.Equal(t, dirPermissions{Mode: 0711, UID: -1, GID: -1}, p)
+
+	// container root and process user are mapped to the runtime user
+	spec.Process.User = specs.User{UID: 0, GID: 0}
+	spec.Linux.UIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+	spec.Linux.GIDMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}}
+	p, err = runtimeDirPermissions(RuntimeDirPermissionsMinimal, spec, 1000)
+	require.NoError(t, err)
+	require.Equal(t, dirPermissions{Mode: 0700, UID: -1, GID: -1}, p)
+}
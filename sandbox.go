@@ -0,0 +1,119 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// SandboxLabel is the label of the containers that joined a pod sandbox
+// (see ContainerConfig.SandboxID). The label value is the sandbox container ID.
+const SandboxLabel = "lxcri.sandbox"
+
+// SandboxNamespaces are the namespaces of the sandbox joined by the pod containers.
+var SandboxNamespaces = []specs.LinuxNamespaceType{
+	specs.NetworkNamespace,
+	specs.IPCNamespace,
+	specs.UTSNamespace,
+}
+
+// joinSandbox configures the container to join the SandboxNamespaces
+// of the sandbox container and adds the SandboxLabel.
+// The sandbox container must be created or running.
+func (rt *Runtime) joinSandbox(cfg *ContainerConfig) error {
+	sandbox, err := rt.Load(cfg.SandboxID)
+	if err != nil {
+		return fmt.Errorf("failed to load sandbox %s: %w", cfg.SandboxID, err)
+	}
+	defer sandbox.Release()
+
+	if sandbox.SandboxID != "" {
+		return fmt.Errorf("container %s is a member of sandbox %s", cfg.SandboxID, sandbox.SandboxID)
+	}
+	pid := sandbox.InitPid()
+	if pid < 1 {
+		return fmt.Errorf("sandbox %s is not running", cfg.SandboxID)
+	}
+
+	for _, nsType := range SandboxNamespaces {
+		path := fmt.Sprintf("/proc/%d/ns/%s", pid, namespaceMap[nsType].Name)
+		joined := false
+		for i, ns := range cfg.Spec.Linux.Namespaces {
+			if ns.Type == nsType {
+				cfg.Spec.Linux.Namespaces[i].Path = path
+				joined = true
+			}
+		}
+		if !joined {
+			cfg.Spec.Linux.Namespaces = append(cfg.Spec.Linux.Namespaces, specs.LinuxNamespace{Type: nsType, Path: path})
+		}
+	}
+
+	if cfg.Labels == nil {
+		cfg.Labels = make(map[string]string)
+	}
+	cfg.Labels[SandboxLabel] = cfg.SandboxID
+	return nil
+}
+
+// SandboxMembers returns the IDs of the containers that joined the given sandbox.
+// The sandbox itself is not included.
+func (rt *Runtime) SandboxMembers(sandboxID string) ([]string, error) {
+	return rt.List(WithLabel(SandboxLabel + "=" + sandboxID))
+}
+
+// KillSandbox sends the signal to all containers of the pod, that are not stopped.
+// The sandbox is signaled after its members.
+func (rt *Runtime) KillSandbox(ctx context.Context, sandboxID string, signum unix.Signal) error {
+	ids, err := rt.SandboxMembers(sandboxID)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, id := range append(ids, sandboxID) {
+		if err := rt.killContainer(ctx, id, signum); err != nil {
+			rt.Log.Error().Str("cid", id).Msgf("failed to kill pod container: %s", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (rt *Runtime) killContainer(ctx context.Context, id string, signum unix.Signal) error {
+	c, err := rt.Load(id)
+	if err == ErrNotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+	state, err := c.ContainerState()
+	if err != nil {
+		return err
+	}
+	if state == specs.StateStopped {
+		return nil
+	}
+	return c.kill(ctx, signum)
+}
+
+// DeleteSandbox deletes all containers of the pod.
+// The sandbox is deleted after its members.
+// The sandbox is not deleted if a member can not be deleted.
+func (rt *Runtime) DeleteSandbox(ctx context.Context, sandboxID string, force bool) error {
+	ids, err := rt.SandboxMembers(sandboxID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := rt.Delete(ctx, id, force); err != nil && err != ErrNotExist {
+			return fmt.Errorf("failed to delete pod container %s: %w", id, err)
+		}
+	}
+	return rt.Delete(ctx, sandboxID, force)
+}
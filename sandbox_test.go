@@ -0,0 +1,26 @@
+package lxcri
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinSandboxNotExist(t *testing.T) {
+	cfg := &ContainerConfig{
+		ContainerID: "c1",
+		SandboxID:   "missing-sandbox",
+		Spec:        &specs.Spec{Linux: &specs.Linux{}},
+	}
+	err := rt.joinSandbox(cfg)
+	require.True(t, errors.Is(err, ErrNotExist))
+	require.NotContains(t, cfg.Labels, SandboxLabel)
+}
+
+func TestDeleteSandboxNotExist(t *testing.T) {
+	err := rt.DeleteSandbox(context.Background(), "missing-sandbox", true)
+	require.Equal(t, ErrNotExist, err)
+}
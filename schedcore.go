@@ -0,0 +1,70 @@
+package lxcri
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// prctl(2) core scheduling commands (linux/prctl.h, kernel >= 5.14).
+// NOTE keep in sync with cmd/lxcri-init
+const (
+	prSchedCore          = 62
+	prSchedCoreShareFrom = 3
+	pidtypePID           = 0
+)
+
+func configureCoreScheduling(c *Container) error {
+	if val, ok := c.Spec.Annotations[AnnotationCoreScheduling]; ok {
+		enabled, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for annotation %s: %w", AnnotationCoreScheduling, err)
+		}
+		c.CoreScheduling = c.CoreScheduling || enabled
+	}
+	if !c.CoreScheduling {
+		return nil
+	}
+	// Fail instead of starting the container without the requested isolation.
+	if err := checkKernelVersion(5, 14); err != nil {
+		return fmt.Errorf("core scheduling is not supported: %w", err)
+	}
+	// lxcri-init creates the cookie before it executes the container process.
+	c.Spec.Annotations[AnnotationCoreScheduling] = "true"
+	return nil
+}
+
+// schedCoreShareFrom pulls the core scheduling cookie from the given pid
+// to the calling thread. Processes forked by the thread inherit the cookie.
+func schedCoreShareFrom(pid int) error {
+	err := unix.Prctl(prSchedCore, prSchedCoreShareFrom, uintptr(pid), pidtypePID, 0)
+	if err != nil {
+		return fmt.Errorf("failed to share core scheduling cookie from pid %d: %w", pid, err)
+	}
+	return nil
+}
+
+// runAttach calls fn, which attaches a process to the container,
+// with the namespace paths from execOpts joined.
+// If core scheduling is enabled, fn is called on a thread
+// that shares the core scheduling cookie of the container init process.
+func (c *Container) runAttach(execOpts *ExecOptions, fn func() error) error {
+	paths := execOpts.namespacePaths()
+	if !c.CoreScheduling {
+		return runInNamespaces(paths, fn)
+	}
+	pid := c.InitPid()
+	if pid < 1 {
+		return fmt.Errorf("failed to share core scheduling cookie: init process is not running")
+	}
+	return runOnLockedThread(func() error {
+		if err := joinNamespaces(paths); err != nil {
+			return err
+		}
+		if err := schedCoreShareFrom(pid); err != nil {
+			return err
+		}
+		return fn()
+	})
+}
@@ -0,0 +1,28 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureCoreScheduling(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{
+		Spec: &specs.Spec{Annotations: map[string]string{}},
+	}}
+	require.NoError(t, configureCoreScheduling(c))
+	require.False(t, c.CoreScheduling)
+	require.NotContains(t, c.Spec.Annotations, AnnotationCoreScheduling)
+
+	c.Spec.Annotations[AnnotationCoreScheduling] = "yes"
+	require.Error(t, configureCoreScheduling(c))
+
+	if err := checkKernelVersion(5, 14); err != nil {
+		t.Skipf("core scheduling is not supported: %s", err)
+	}
+	c.Spec.Annotations[AnnotationCoreScheduling] = "1"
+	require.NoError(t, configureCoreScheduling(c))
+	require.True(t, c.CoreScheduling)
+	require.Equal(t, "true", c.Spec.Annotations[AnnotationCoreScheduling])
+}
@@ -0,0 +1,70 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the persisted container state (lxcri.json).
+// It must be incremented whenever a change to Container or ContainerConfig
+// requires existing state files to be migrated, and a migration from the
+// previous version must be appended to schemaMigrations.
+const SchemaVersion = 1
+
+// schemaDocument is the generic representation of the persisted container state.
+type schemaDocument map[string]json.RawMessage
+
+// schemaMigrations migrates a state document from version i to version i+1.
+var schemaMigrations = []func(doc schemaDocument) error{
+	// Version 0 is the unversioned layout written by lxcri before
+	// SchemaVersion was introduced. It differs from version 1 only
+	// by the missing SchemaVersion field.
+	func(doc schemaDocument) error {
+		return nil
+	},
+}
+
+func (doc schemaDocument) version() (int, error) {
+	raw, exist := doc["SchemaVersion"]
+	if !exist {
+		return 0, nil
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, fmt.Errorf("invalid SchemaVersion %s: %w", raw, err)
+	}
+	return v, nil
+}
+
+// decodeContainerState decodes the persisted container state from data into c.
+// State documents written by an older runtime are migrated to the current
+// SchemaVersion before decoding. ErrNewerRuntime is returned if the document
+// was written by a runtime with a newer SchemaVersion.
+func decodeContainerState(data []byte, c *Container) error {
+	var doc schemaDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	version, err := doc.version()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: schema version %d is newer than the supported version %d", ErrNewerRuntime, version, SchemaVersion)
+	}
+	if version < 0 {
+		return fmt.Errorf("invalid schema version %d", version)
+	}
+	if version < SchemaVersion {
+		for v := version; v < SchemaVersion; v++ {
+			if err := schemaMigrations[v](doc); err != nil {
+				return fmt.Errorf("failed to migrate schema version %d to %d: %w", v, v+1, err)
+			}
+		}
+		doc["SchemaVersion"] = json.RawMessage(fmt.Sprintf("%d", SchemaVersion))
+		if data, err = json.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, c)
+}
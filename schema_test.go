@@ -0,0 +1,31 @@
+package lxcri
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaMigrations(t *testing.T) {
+	require.Equal(t, SchemaVersion, len(schemaMigrations))
+}
+
+func TestDecodeContainerStateUnversioned(t *testing.T) {
+	data := []byte(`{"ContainerID":"c1","BundlePath":"/tmp/bundle","Pid":42}`)
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	err := decodeContainerState(data, c)
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersion, c.SchemaVersion)
+	require.Equal(t, "c1", c.ContainerID)
+	require.Equal(t, "/tmp/bundle", c.BundlePath)
+	require.Equal(t, 42, c.Pid)
+}
+
+func TestDecodeContainerStateNewer(t *testing.T) {
+	data := []byte(`{"SchemaVersion":9999,"ContainerID":"c1"}`)
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	err := decodeContainerState(data, c)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrNewerRuntime))
+}
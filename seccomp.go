@@ -4,21 +4,31 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"strings"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
+// Seccomp actions added to the runtime-spec after v1.0.2.
+const (
+	actKillProcess = specs.LinuxSeccompAction("SCMP_ACT_KILL_PROCESS")
+	actKillThread  = specs.LinuxSeccompAction("SCMP_ACT_KILL_THREAD")
+)
+
+// seccompAction maps seccomp actions to liblxc seccomp policy keywords.
+// liblxc has no keywords for the log, trace and kill_process actions,
+// so they are emulated (see seccompRuleAction).
 var seccompAction = map[specs.LinuxSeccompAction]string{
 	specs.ActKill:  "kill",
+	actKillThread:  "kill",
+	actKillProcess: "kill",
 	specs.ActTrap:  "trap",
 	specs.ActErrno: "errno",
 	specs.ActAllow: "allow",
-	//specs.ActTrace: "trace",
-	//specs.ActLog: "log",
-	//specs.ActKillProcess: "kill_process",
+	specs.ActTrace: "errno",
+	specs.ActLog:   "allow",
+	actNotify:      "notify",
 }
 
 // Note seccomp flags (see `man 2 seccomp`) are currently not supported
@@ -41,9 +51,13 @@ func writeSeccompProfile(profilePath string, seccomp *specs.LinuxSeccomp) error
 	if err != nil {
 		return err
 	}
-	fmt.Fprintf(w, "allowlist %s\n", action)
+	fmt.Fprintf(w, "%s %s\n", seccompPolicyMode(seccomp), action)
 
-	platformArchs, err := seccompArchs(seccomp)
+	host, err := hostArch()
+	if err != nil {
+		return err
+	}
+	platformArchs, err := seccompArchs(seccomp, host)
 	if err != nil {
 		return fmt.Errorf("failed to detect platform architecture: %w", err)
 	}
@@ -62,59 +76,133 @@ func writeSeccompProfile(profilePath string, seccomp *specs.LinuxSeccomp) error
 	return profile.Sync()
 }
 
+// seccompPolicyMode returns the liblxc policy mode for the default action.
+// A profile whose default action permits system calls is a denylist
+// of the blocked system calls (e.g the docker style profiles),
+// otherwise it is an allowlist of the permitted system calls.
+func seccompPolicyMode(seccomp *specs.LinuxSeccomp) string {
+	if seccompRuleAction(seccomp.DefaultAction, nil) == "allow" {
+		return "denylist"
+	}
+	return "allowlist"
+}
+
 func defaultAction(seccomp *specs.LinuxSeccomp) (string, error) {
-	switch seccomp.DefaultAction {
-	case specs.ActKill:
-		return "kill", nil
-	case specs.ActTrap:
-		return "trap", nil
+	// The kernel rejects filters with notify as default action.
+	if _, ok := seccompAction[seccomp.DefaultAction]; !ok || seccomp.DefaultAction == actNotify {
+		return "kill", fmt.Errorf("unsupported seccomp default action %q", seccomp.DefaultAction)
+	}
+	// The spec has no errno for the default action (see seccompRuleAction).
+	return seccompRuleAction(seccomp.DefaultAction, nil), nil
+}
+
+// seccompRuleAction returns the liblxc policy action for the given seccomp action.
+// Actions without a liblxc keyword are emulated:
+//   - SCMP_ACT_LOG allows the system call (without logging it).
+//   - SCMP_ACT_TRACE fails the system call with ENOSYS,
+//     which is what the kernel does when no tracer is attached.
+//   - SCMP_ACT_KILL_PROCESS kills the thread (SCMP_ACT_KILL).
+//     The other threads of the process keep running (see hasSeccompAction).
+func seccompRuleAction(action specs.LinuxSeccompAction, errnoRet *uint) string {
+	switch action {
 	case specs.ActErrno:
-		return "errno 0", nil
-	case specs.ActAllow:
-		return "allow", nil
-	case specs.ActTrace, specs.ActLog: // Not (yet) supported by lxc
-		fallthrough
-	//case specs.ActKillProcess: fallthrough // specs > 1.0.2
+		// Like runc return EPERM if no errno is set,
+		// because 'errno 0' would let denied system calls appear successful.
+		ret := uint(unix.EPERM)
+		if errnoRet != nil {
+			ret = *errnoRet
+		}
+		return fmt.Sprintf("errno %d", ret)
+	case specs.ActTrace:
+		return fmt.Sprintf("errno %d", unix.ENOSYS)
 	default:
-		return "kill", fmt.Errorf("unsupported seccomp default action %q", seccomp.DefaultAction)
+		return seccompAction[action]
 	}
 }
 
-func seccompArchs(seccomp *specs.LinuxSeccomp) ([]string, error) {
-	var uts unix.Utsname
-	if err := unix.Uname(&uts); err != nil {
-		return nil, err
+// hasSeccompAction returns true if the default action
+// or any of the system call rules uses the given action.
+func hasSeccompAction(seccomp *specs.LinuxSeccomp, action specs.LinuxSeccompAction) bool {
+	if seccomp.DefaultAction == action {
+		return true
 	}
-	nativeArch := nullTerminatedString(uts.Machine[:])
-	if len(seccomp.Architectures) == 0 {
-		return []string{nativeArch}, nil
+	for _, sc := range seccomp.Syscalls {
+		if sc.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// seccompArchSections maps seccomp architectures to the
+// architecture section names of the liblxc seccomp policy (version 2).
+var seccompArchSections = map[specs.Arch]string{
+	specs.ArchX86_64:                "x86_64",
+	specs.ArchX86:                   "x86",
+	specs.ArchX32:                   "x32",
+	specs.ArchAARCH64:               "arm64",
+	specs.ArchARM:                   "arm",
+	specs.ArchPPC64LE:               "ppc64le",
+	specs.ArchPPC64:                 "ppc64",
+	specs.ArchPPC:                   "ppc",
+	specs.ArchS390X:                 "s390x",
+	specs.ArchS390:                  "s390",
+	specs.ArchMIPS64:                "mips64",
+	specs.ArchMIPS64N32:             "mips64n32",
+	specs.ArchMIPS:                  "mips",
+	specs.ArchMIPSEL64:              "mipsel64",
+	specs.ArchMIPSEL64N32:           "mipsel64n32",
+	specs.ArchMIPSEL:                "mipsel",
+	specs.Arch("SCMP_ARCH_RISCV64"): "riscv64",
+}
+
+// seccompCompatArchs are the architectures whose executables
+// can run natively on the given architecture.
+var seccompCompatArchs = map[specs.Arch][]specs.Arch{
+	specs.ArchX86_64:   {specs.ArchX86, specs.ArchX32},
+	specs.ArchAARCH64:  {specs.ArchARM},
+	specs.ArchPPC64:    {specs.ArchPPC},
+	specs.ArchS390X:    {specs.ArchS390},
+	specs.ArchMIPS64:   {specs.ArchMIPS, specs.ArchMIPS64N32},
+	specs.ArchMIPSEL64: {specs.ArchMIPSEL, specs.ArchMIPSEL64N32},
+}
+
+// seccompArchs returns the liblxc seccomp policy sections for the
+// seccomp architectures. If no architectures are defined,
+// the host architecture (`uname -m`) and its compat architectures are returned.
+// Architectures unknown to liblxc are ignored.
+func seccompArchs(seccomp *specs.LinuxSeccomp, host string) ([]string, error) {
+	archs := seccomp.Architectures
+	if len(archs) == 0 {
+		info := lookupArch(host)
+		if info == nil {
+			return nil, fmt.Errorf("unsupported host architecture %q", host)
+		}
+		archs = append([]specs.Arch{info.seccomp}, seccompCompatArchs[info.seccomp]...)
 	}
-	archs := make([]string, len(seccomp.Architectures))
-	for _, a := range seccomp.Architectures {
-		s := strings.ToLower(strings.TrimPrefix(string(a), "SCMP_ARCH_"))
-		if strings.ToLower(nativeArch) == s {
-			// lxc seccomp code automatically adds syscalls to compat architectures
-			return []string{nativeArch}, nil
+
+	sections := make([]string, 0, len(archs))
+	seen := make(map[string]bool, len(archs))
+	for _, a := range archs {
+		s, ok := seccompArchSections[a]
+		if !ok || seen[s] {
+			continue
 		}
-		archs = append(archs, s)
+		seen[s] = true
+		sections = append(sections, s)
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("none of the seccomp architectures %s is supported", archs)
 	}
-	return archs, nil
+	return sections, nil
 }
 
 func writeSeccompSyscall(w *bufio.Writer, sc specs.LinuxSyscall) error {
 	for _, name := range sc.Names {
-		action, ok := seccompAction[sc.Action]
-		if !ok {
+		if _, ok := seccompAction[sc.Action]; !ok {
 			return fmt.Errorf("unsupported seccomp action: %s", sc.Action)
 		}
-
-		if sc.Action == specs.ActErrno {
-			var ret uint = 0
-			if sc.ErrnoRet != nil {
-				ret = *sc.ErrnoRet
-			}
-			action = fmt.Sprintf("%s %d", action, ret)
-		}
+		action := seccompRuleAction(sc.Action, sc.ErrnoRet)
 
 		if len(sc.Args) == 0 {
 			fmt.Fprintf(w, "%s %s\n", name, action)
@@ -0,0 +1,143 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// AnnotationSeccompUnconfined disables the default seccomp profile
+// (see Runtime.SeccompDefault) for the container if set to `true`.
+// It has no effect if the container spec defines a seccomp profile.
+const AnnotationSeccompUnconfined = "lxcri.seccomp-unconfined"
+
+// defaultSeccompSyscalls are the system calls allowed by the default seccomp profile.
+// The list is derived from the default profile of containers-common,
+// without the rules that depend on capabilities, which are not granted by default.
+// Syscalls unknown to the host architecture are ignored by liblxc.
+var defaultSeccompSyscalls = []string{
+	"_llseek", "_newselect", "accept", "accept4", "access", "adjtimex", "alarm",
+	"bind", "brk", "capget", "capset", "chdir", "chmod", "chown", "chown32",
+	"clock_adjtime", "clock_adjtime64", "clock_getres", "clock_getres_time64",
+	"clock_gettime", "clock_gettime64", "clock_nanosleep", "clock_nanosleep_time64",
+	"clone", "clone3", "close", "close_range", "connect", "copy_file_range", "creat",
+	"dup", "dup2", "dup3",
+	"epoll_create", "epoll_create1", "epoll_ctl", "epoll_ctl_old", "epoll_pwait", "epoll_pwait2",
+	"epoll_wait", "epoll_wait_old", "eventfd", "eventfd2",
+	"execve", "execveat", "exit", "exit_group",
+	"faccessat", "faccessat2", "fadvise64", "fadvise64_64", "fallocate", "fanotify_mark",
+	"fchdir", "fchmod", "fchmodat", "fchown", "fchown32", "fchownat", "fcntl", "fcntl64",
+	"fdatasync", "fgetxattr", "flistxattr", "flock", "fork", "fremovexattr", "fsetxattr",
+	"fstat", "fstat64", "fstatat64", "fstatfs", "fstatfs64", "fsync", "ftruncate", "ftruncate64",
+	"futex", "futex_time64", "futex_waitv", "futimesat",
+	"get_robust_list", "get_thread_area", "getcpu", "getcwd", "getdents", "getdents64",
+	"getegid", "getegid32", "geteuid", "geteuid32", "getgid", "getgid32",
+	"getgroups", "getgroups32", "getitimer", "getpeername", "getpgid", "getpgrp",
+	"getpid", "getppid", "getpriority", "getrandom", "getresgid", "getresgid32",
+	"getresuid", "getresuid32", "getrlimit", "getrusage", "getsid", "getsockname",
+	"getsockopt", "gettid", "gettimeofday", "getuid", "getuid32", "getxattr",
+	"inotify_add_watch", "inotify_init", "inotify_init1", "inotify_rm_watch",
+	"io_cancel", "io_destroy", "io_getevents", "io_pgetevents", "io_pgetevents_time64",
+	"io_setup", "io_submit", "io_uring_enter", "io_uring_register", "io_uring_setup",
+	"ioctl", "ioprio_get", "ioprio_set", "ipc", "kill",
+	"landlock_add_rule", "landlock_create_ruleset", "landlock_restrict_self",
+	"lchown", "lchown32", "lgetxattr", "link", "linkat", "listen", "listxattr", "llistxattr",
+	"lremovexattr", "lseek", "lsetxattr", "lstat", "lstat64",
+	"madvise", "membarrier", "memfd_create", "memfd_secret", "mincore", "mkdir", "mkdirat",
+	"mknod", "mknodat", "mlock", "mlock2", "mlockall", "mmap", "mmap2", "mprotect",
+	"mq_getsetattr", "mq_notify", "mq_open", "mq_timedreceive", "mq_timedreceive_time64",
+	"mq_timedsend", "mq_timedsend_time64", "mq_unlink", "mremap",
+	"msgctl", "msgget", "msgrcv", "msgsnd", "msync", "munlock", "munlockall", "munmap",
+	"name_to_handle_at", "nanosleep", "newfstatat", "open", "openat", "openat2", "pause",
+	"pidfd_getfd", "pidfd_open", "pidfd_send_signal", "pipe", "pipe2", "pkey_alloc",
+	"pkey_free", "pkey_mprotect", "poll", "ppoll", "ppoll_time64", "prctl", "pread64",
+	"preadv", "preadv2", "prlimit64", "process_mrelease", "pselect6", "pselect6_time64",
+	"pwrite64", "pwritev", "pwritev2",
+	"read", "readahead", "readlink", "readlinkat", "readv", "recv", "recvfrom", "recvmmsg",
+	"recvmmsg_time64", "recvmsg", "remap_file_pages", "removexattr", "rename", "renameat",
+	"renameat2", "restart_syscall", "rmdir", "rseq",
+	"rt_sigaction", "rt_sigpending", "rt_sigprocmask", "rt_sigqueueinfo", "rt_sigreturn",
+	"rt_sigsuspend", "rt_sigtimedwait", "rt_sigtimedwait_time64", "rt_tgsigqueueinfo",
+	"sched_get_priority_max", "sched_get_priority_min", "sched_getaffinity", "sched_getattr",
+	"sched_getparam", "sched_getscheduler", "sched_rr_get_interval", "sched_rr_get_interval_time64",
+	"sched_setaffinity", "sched_setattr", "sched_setparam", "sched_setscheduler", "sched_yield",
+	"seccomp", "select", "semctl", "semget", "semop", "semtimedop", "semtimedop_time64",
+	"send", "sendfile", "sendfile64", "sendmmsg", "sendmsg", "sendto",
+	"set_robust_list", "set_thread_area", "set_tid_address", "setfsgid", "setfsgid32",
+	"setfsuid", "setfsuid32", "setgid", "setgid32", "setgroups", "setgroups32", "setitimer",
+	"setpgid", "setpriority", "setregid", "setregid32", "setresgid", "setresgid32",
+	"setresuid", "setresuid32", "setreuid", "setreuid32", "setrlimit", "setsid", "setsockopt",
+	"setuid", "setuid32", "setxattr", "shmat", "shmctl", "shmdt", "shmget", "shutdown",
+	"sigaltstack", "signalfd", "signalfd4", "sigprocmask", "sigreturn", "socketcall",
+	"socketpair", "splice", "stat", "stat64", "statfs", "statfs64", "statx", "symlink",
+	"symlinkat", "sync", "sync_file_range", "syncfs", "sysinfo", "tee", "tgkill", "time",
+	"timer_create", "timer_delete", "timer_getoverrun", "timer_gettime", "timer_gettime64",
+	"timer_settime", "timer_settime64", "timerfd_create", "timerfd_gettime", "timerfd_gettime64",
+	"timerfd_settime", "timerfd_settime64", "times", "tkill", "truncate", "truncate64",
+	"ugetrlimit", "umask", "uname", "unlink", "unlinkat", "utime", "utimensat",
+	"utimensat_time64", "utimes", "vfork", "vmsplice", "wait4", "waitid", "waitpid",
+	"write", "writev",
+	// arch specific
+	"arch_prctl", "modify_ldt", "breakpoint", "cacheflush", "set_tls",
+	"s390_pci_mmio_read", "s390_pci_mmio_write", "s390_runtime_instr", "riscv_flush_icache",
+}
+
+// defaultSeccompProfile returns the builtin default seccomp profile.
+// System calls that are not allowed fail with EPERM (see defaultAction).
+func defaultSeccompProfile() *specs.LinuxSeccomp {
+	return &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: append([]string{}, defaultSeccompSyscalls...), Action: specs.ActAllow},
+			// Only allow the default and the linux32 personality (0x0, 0x8, 0x20000, 0x20008)
+			// and querying the current personality (0xffffffff).
+			{Names: []string{"personality"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 0x0, Op: specs.OpEqualTo}}},
+			{Names: []string{"personality"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 0x8, Op: specs.OpEqualTo}}},
+			{Names: []string{"personality"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 0x20000, Op: specs.OpEqualTo}}},
+			{Names: []string{"personality"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 0x20008, Op: specs.OpEqualTo}}},
+			{Names: []string{"personality"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 0xffffffff, Op: specs.OpEqualTo}}},
+			// Deny the creation of AF_VSOCK (40) sockets.
+			{Names: []string{"socket"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 40, Op: specs.OpNotEqual}}},
+		},
+	}
+}
+
+// configureDefaultSeccomp sets the default seccomp profile if the container spec has none.
+// The profile is loaded from Runtime.SeccompDefaultProfile if set,
+// and the builtin profile is used otherwise.
+func configureDefaultSeccomp(rt *Runtime, c *Container) error {
+	if !rt.SeccompDefault || c.Spec.Linux.Seccomp != nil {
+		return nil
+	}
+	if c.Spec.Annotations[AnnotationSeccompUnconfined] == "true" {
+		c.warnf("SeccompUnconfined", "default seccomp profile is disabled by annotation %s", AnnotationSeccompUnconfined)
+		return nil
+	}
+	if rt.SeccompDefaultProfile == "" {
+		c.Spec.Linux.Seccomp = defaultSeccompProfile()
+		return nil
+	}
+	seccomp, err := loadSeccompProfile(rt.SeccompDefaultProfile)
+	if err != nil {
+		return err
+	}
+	c.Spec.Linux.Seccomp = seccomp
+	return nil
+}
+
+// loadSeccompProfile loads a seccomp profile in the OCI spec format (specs.LinuxSeccomp)
+// from the given file.
+func loadSeccompProfile(profilePath string) (*specs.LinuxSeccomp, error) {
+	// #nosec
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		return nil, err
+	}
+	seccomp := new(specs.LinuxSeccomp)
+	if err := json.Unmarshal(data, seccomp); err != nil {
+		return nil, fmt.Errorf("failed to decode seccomp profile %s: %w", profilePath, err)
+	}
+	return seccomp, nil
+}
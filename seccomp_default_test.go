@@ -0,0 +1,55 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultSeccompProfile(t *testing.T) {
+	profilePath := filepath.Join(t.TempDir(), "seccomp.conf")
+	require.NoError(t, writeSeccompProfile(profilePath, defaultSeccompProfile()))
+
+	data, err := os.ReadFile(profilePath)
+	require.NoError(t, err)
+	lines := strings.Split(string(data), "\n")
+	require.Equal(t, "2", lines[0])
+	require.Equal(t, "allowlist errno 1", lines[1])
+	require.Contains(t, lines, "execve allow")
+	require.Contains(t, lines, "socket allow [0,40,SCMP_CMP_NE,0]")
+	require.NotContains(t, lines, "mount allow")
+}
+
+func TestConfigureDefaultSeccomp(t *testing.T) {
+	newContainer := func() *Container {
+		spec := specki.NewSpec("/tmp/rootfs", "/bin/sh")
+		spec.Annotations = map[string]string{}
+		return &Container{ContainerConfig: &ContainerConfig{Spec: spec}}
+	}
+	r := &Runtime{}
+
+	c := newContainer()
+	require.NoError(t, configureDefaultSeccomp(r, c))
+	require.Nil(t, c.Spec.Linux.Seccomp)
+
+	r.SeccompDefault = true
+	require.NoError(t, configureDefaultSeccomp(r, c))
+	require.NotNil(t, c.Spec.Linux.Seccomp)
+
+	c = newContainer()
+	c.Spec.Annotations[AnnotationSeccompUnconfined] = "true"
+	require.NoError(t, configureDefaultSeccomp(r, c))
+	require.Nil(t, c.Spec.Linux.Seccomp)
+	require.Len(t, c.Warnings, 1)
+
+	profilePath := filepath.Join(t.TempDir(), "seccomp.json")
+	require.NoError(t, os.WriteFile(profilePath, []byte(`{"defaultAction":"SCMP_ACT_ALLOW"}`), 0644))
+	r.SeccompDefaultProfile = profilePath
+	c = newContainer()
+	require.NoError(t, configureDefaultSeccomp(r, c))
+	require.Equal(t, "SCMP_ACT_ALLOW", string(c.Spec.Linux.Seccomp.DefaultAction))
+}
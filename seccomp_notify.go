@@ -0,0 +1,79 @@
+package lxcri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// actNotify forwards the system call to a userspace agent (seccomp user notification).
+// It was added to the runtime-spec after v1.0.2.
+const actNotify = specs.LinuxSeccompAction("SCMP_ACT_NOTIFY")
+
+// The runtime-spec version used by lxcri has no `linux.seccomp.listenerPath`
+// and `linux.seccomp.listenerMetadata`, so they are set through annotations.
+const (
+	// AnnotationSeccompListenerPath is the path of the unix socket of the agent
+	// that handles system calls with the action SCMP_ACT_NOTIFY.
+	AnnotationSeccompListenerPath = "lxcri.seccomp-listener-path"
+
+	// AnnotationSeccompListenerMetadata is an opaque value sent to the agent along
+	// with each notification, e.g to identify the container.
+	AnnotationSeccompListenerMetadata = "lxcri.seccomp-listener-metadata"
+)
+
+// seccompNotifyProxy returns the liblxc seccomp notify proxy address and cookie
+// (`lxc.seccomp.notify.proxy` and `lxc.seccomp.notify.cookie`) for the spec.
+// An empty proxy address is returned if the seccomp profile has no
+// rule with the action SCMP_ACT_NOTIFY.
+func seccompNotifyProxy(spec *specs.Spec) (proxy string, cookie string, err error) {
+	listenerPath := spec.Annotations[AnnotationSeccompListenerPath]
+	cookie = spec.Annotations[AnnotationSeccompListenerMetadata]
+
+	notify := false
+	if spec.Linux != nil && spec.Linux.Seccomp != nil {
+		for _, sc := range spec.Linux.Seccomp.Syscalls {
+			if sc.Action == actNotify {
+				notify = true
+				break
+			}
+		}
+	}
+	if !notify {
+		if listenerPath != "" {
+			return "", "", fmt.Errorf("annotation %s requires a seccomp rule with action %s", AnnotationSeccompListenerPath, actNotify)
+		}
+		return "", "", nil
+	}
+	if listenerPath == "" {
+		return "", "", fmt.Errorf("seccomp action %s requires annotation %s", actNotify, AnnotationSeccompListenerPath)
+	}
+	if !filepath.IsAbs(listenerPath) {
+		return "", "", fmt.Errorf("seccomp listener path %q must be absolute", listenerPath)
+	}
+	if strings.ContainsAny(cookie, "\n") {
+		return "", "", fmt.Errorf("seccomp listener metadata must not contain a newline")
+	}
+	return "unix:" + listenerPath, cookie, nil
+}
+
+// configureSeccompNotify forwards the seccomp notifications of the container
+// to the listener socket through the liblxc seccomp notify proxy.
+// liblxc connects to the listener and sends each notification
+// (struct seccomp_notif_proxy followed by the cookie) and expects
+// the response on the same connection (see lxc.container.conf(5)).
+func configureSeccompNotify(c *Container) error {
+	proxy, cookie, err := seccompNotifyProxy(c.Spec)
+	if err != nil || proxy == "" {
+		return err
+	}
+	if err := c.setConfigItem("lxc.seccomp.notify.proxy", proxy); err != nil {
+		return err
+	}
+	if cookie != "" {
+		return c.setConfigItem("lxc.seccomp.notify.cookie", cookie)
+	}
+	return nil
+}
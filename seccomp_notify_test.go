@@ -0,0 +1,50 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeccompNotifyProxy(t *testing.T) {
+	spec := &specs.Spec{
+		Annotations: map[string]string{},
+		Linux: &specs.Linux{
+			Seccomp: &specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{Names: []string{"reboot"}, Action: specs.ActErrno},
+				},
+			},
+		},
+	}
+
+	proxy, _, err := seccompNotifyProxy(spec)
+	require.NoError(t, err)
+	require.Empty(t, proxy)
+
+	spec.Annotations[AnnotationSeccompListenerPath] = "/run/agent.sock"
+	_, _, err = seccompNotifyProxy(spec)
+	require.Error(t, err)
+
+	spec.Linux.Seccomp.Syscalls = append(spec.Linux.Seccomp.Syscalls,
+		specs.LinuxSyscall{Names: []string{"mknod", "mknodat"}, Action: actNotify})
+	proxy, cookie, err := seccompNotifyProxy(spec)
+	require.NoError(t, err)
+	require.Equal(t, "unix:/run/agent.sock", proxy)
+	require.Empty(t, cookie)
+
+	spec.Annotations[AnnotationSeccompListenerMetadata] = "c1"
+	_, cookie, err = seccompNotifyProxy(spec)
+	require.NoError(t, err)
+	require.Equal(t, "c1", cookie)
+
+	spec.Annotations[AnnotationSeccompListenerPath] = "agent.sock"
+	_, _, err = seccompNotifyProxy(spec)
+	require.Error(t, err)
+
+	delete(spec.Annotations, AnnotationSeccompListenerPath)
+	_, _, err = seccompNotifyProxy(spec)
+	require.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestSeccompArchsDefault(t *testing.T) {
+	seccomp := &specs.LinuxSeccomp{}
+	tests := []struct {
+		host     string
+		sections []string
+	}{
+		{"x86_64", []string{"x86_64", "x86", "x32"}},
+		{"i686", []string{"x86"}},
+		{"i386", []string{"x86"}},
+		{"aarch64", []string{"arm64", "arm"}},
+		{"armv7l", []string{"arm"}},
+		{"ppc64le", []string{"ppc64le"}},
+		{"ppc64", []string{"ppc64", "ppc"}},
+		{"s390x", []string{"s390x", "s390"}},
+		{"mips64", []string{"mips64", "mips", "mips64n32"}},
+		{"mips64el", []string{"mipsel64", "mipsel", "mipsel64n32"}},
+		{"riscv64", []string{"riscv64"}},
+	}
+	for _, tc := range tests {
+		sections, err := seccompArchs(seccomp, tc.host)
+		require.NoError(t, err, tc.host)
+		require.Equal(t, tc.sections, sections, tc.host)
+	}
+
+	_, err := seccompArchs(seccomp, "parisc")
+	require.Error(t, err)
+}
+
+func TestSeccompArchs(t *testing.T) {
+	seccomp := &specs.LinuxSeccomp{
+		Architectures: []specs.Arch{specs.ArchX86_64, specs.ArchX86, specs.ArchX32},
+	}
+	sections, err := seccompArchs(seccomp, "x86_64")
+	require.NoError(t, err)
+	require.Equal(t, []string{"x86_64", "x86", "x32"}, sections)
+
+	// The host architecture does not affect explicitly defined architectures.
+	seccomp.Architectures = []specs.Arch{specs.ArchAARCH64, specs.ArchARM}
+	sections, err = seccompArchs(seccomp, "x86_64")
+	require.NoError(t, err)
+	require.Equal(t, []string{"arm64", "arm"}, sections)
+
+	// Unknown architectures and duplicates are ignored.
+	seccomp.Architectures = []specs.Arch{specs.ArchS390X, specs.ArchPARISC, specs.ArchS390X, specs.Arch("SCMP_ARCH_RISCV64")}
+	sections, err = seccompArchs(seccomp, "s390x")
+	require.NoError(t, err)
+	require.Equal(t, []string{"s390x", "riscv64"}, sections)
+
+	seccomp.Architectures = []specs.Arch{specs.ArchPARISC, specs.ArchPARISC64}
+	_, err = seccompArchs(seccomp, "x86_64")
+	require.Error(t, err)
+}
+
+func TestWriteSeccompProfilePolicyMode(t *testing.T) {
+	eperm := uint(unix.EPERM)
+	enosys := uint(unix.ENOSYS)
+	tests := []struct {
+		seccomp *specs.LinuxSeccomp
+		profile string
+	}{
+		{
+			&specs.LinuxSeccomp{
+				DefaultAction: specs.ActErrno,
+				Architectures: []specs.Arch{specs.ArchX86_64},
+				Syscalls: []specs.LinuxSyscall{
+					{Names: []string{"read", "write"}, Action: specs.ActAllow},
+				},
+			},
+			"2\nallowlist errno 1\n[x86_64]\nread allow\nwrite allow\n",
+		},
+		{
+			&specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Architectures: []specs.Arch{specs.ArchX86_64},
+				Syscalls: []specs.LinuxSyscall{
+					{Names: []string{"mount", "umount2"}, Action: specs.ActErrno, ErrnoRet: &eperm},
+					{Names: []string{"kexec_load"}, Action: specs.ActErrno},
+					{Names: []string{"reboot"}, Action: specs.ActKill},
+					{Names: []string{"bpf"}, Action: specs.ActErrno, ErrnoRet: &enosys},
+				},
+			},
+			"2\ndenylist allow\n[x86_64]\nmount errno 1\numount2 errno 1\nkexec_load errno 1\nreboot kill\nbpf errno 38\n",
+		},
+		{
+			&specs.LinuxSeccomp{
+				DefaultAction: specs.ActLog,
+				Architectures: []specs.Arch{specs.ArchX86_64},
+				Syscalls: []specs.LinuxSyscall{
+					{Names: []string{"ptrace"}, Action: specs.ActTrace},
+					{Names: []string{"kexec_load"}, Action: actKillProcess},
+					{Names: []string{"reboot"}, Action: actKillThread},
+				},
+			},
+			"2\ndenylist allow\n[x86_64]\nptrace errno 38\nkexec_load kill\nreboot kill\n",
+		},
+	}
+	for _, tc := range tests {
+		profilePath := filepath.Join(t.TempDir(), "seccomp.conf")
+		require.NoError(t, writeSeccompProfile(profilePath, tc.seccomp))
+		data, err := os.ReadFile(profilePath)
+		require.NoError(t, err)
+		require.Equal(t, tc.profile, string(data))
+	}
+	require.True(t, hasSeccompAction(tests[2].seccomp, actKillProcess))
+	require.False(t, hasSeccompAction(tests[0].seccomp, actKillProcess))
+}
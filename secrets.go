@@ -0,0 +1,200 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/lxc/lxcri/pkg/specki"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Secret is a file that is made available to the container process,
+// without writing the content to the bundle or to persistent storage.
+// The secret files are written to a tmpfs in the container runtime directory
+// and bind mounted (read-only) into the container. They are overwritten
+// with zeros and removed when the container is deleted.
+type Secret struct {
+	// Target is the absolute path of the secret file within the container.
+	Target string
+	// Data is the content of the secret. It is never persisted.
+	Data []byte `json:"-"`
+	// Source is the path of a file the content is read from, if Data is empty.
+	Source string `json:",omitempty"`
+	// Mode is the file mode of the secret file. The default is 0400.
+	Mode os.FileMode `json:",omitempty"`
+	// UID is the owner (container user ID) of the secret file.
+	UID uint32 `json:",omitempty"`
+	// GID is the group (container group ID) of the secret file.
+	GID uint32 `json:",omitempty"`
+}
+
+func (c *Container) secretsDir() string {
+	return c.RuntimePath("secrets")
+}
+
+func configureSecrets(rt *Runtime, c *Container) error {
+	if len(c.Secrets) == 0 {
+		return nil
+	}
+	dir := c.secretsDir()
+	// The directory must be searchable by the container root user
+	// because liblxc bind mounts the secret files within the container user namespace.
+	if err := os.Mkdir(dir, 0711); err != nil {
+		return err
+	}
+	// #nosec
+	if err := os.Chmod(dir, 0711); err != nil {
+		return err
+	}
+
+	if rt.isPrivileged() {
+		// A private tmpfs ensures that the secrets are only held in memory
+		// and do not propagate to other mount namespaces.
+		if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=0711,size=1m"); err != nil {
+			return fmt.Errorf("failed to mount secrets tmpfs: %w", err)
+		}
+		if err := unix.Mount("", dir, "", unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("failed to make secrets tmpfs private: %w", err)
+		}
+	} else if err := isFilesystem(dir, "tmpfs"); err != nil {
+		// The unprivileged runtime can not mount a tmpfs.
+		return fmt.Errorf("secrets require the runtime root on a tmpfs: %w", err)
+	}
+
+	for i, s := range c.Secrets {
+		if !filepath.IsAbs(s.Target) {
+			return fmt.Errorf("secret target %q is not an absolute path", s.Target)
+		}
+		data := s.Data
+		if len(data) == 0 && s.Source != "" {
+			var err error
+			// #nosec
+			if data, err = os.ReadFile(s.Source); err != nil {
+				return fmt.Errorf("failed to read secret source: %w", err)
+			}
+		}
+		mode := s.Mode
+		if mode == 0 {
+			mode = 0400
+		}
+		filename := filepath.Join(dir, strconv.Itoa(i))
+		if err := writeSecret(filename, data, mode); err != nil {
+			return fmt.Errorf("failed to write secret %s: %w", s.Target, err)
+		}
+		uid := specki.UnmapContainerID(s.UID, c.Spec.Linux.UIDMappings)
+		gid := specki.UnmapContainerID(s.GID, c.Spec.Linux.GIDMappings)
+		owner, group := secretOwner(rt.isPrivileged(), uid, gid)
+		if owner != int(uid) || group != int(gid) {
+			c.warnf("SecretOwnerIgnored", "unprivileged runtime can not change the owner of secret %s to %d:%d", s.Target, s.UID, s.GID)
+		}
+		if err := os.Chown(filename, owner, group); err != nil {
+			return fmt.Errorf("failed to chown secret %s: %w", s.Target, err)
+		}
+		c.Spec.Mounts = append(c.Spec.Mounts, specs.Mount{
+			Source:      filename,
+			Destination: s.Target,
+			Type:        "bind",
+			Options:     []string{"bind", "ro", "nosuid", "nodev", "noexec"},
+		})
+		// The content is not required anymore.
+		c.Secrets[i].Data = nil
+	}
+	return nil
+}
+
+// secretOwner returns the host user and group ID the secret file is chowned to.
+// An unprivileged runtime can only change the group of a file to
+// one of its own groups, so -1 (unchanged) is returned for IDs
+// that are not owned by the runtime user.
+func secretOwner(privileged bool, uid uint32, gid uint32) (int, int) {
+	if privileged {
+		return int(uid), int(gid)
+	}
+	owner, group := -1, -1
+	if int(uid) == os.Geteuid() {
+		owner = int(uid)
+	}
+	if int(gid) == os.Getegid() {
+		group = int(gid)
+	} else if groups, err := os.Getgroups(); err == nil {
+		for _, g := range groups {
+			if g == int(gid) {
+				group = g
+				break
+			}
+		}
+	}
+	return owner, group
+}
+
+func writeSecret(filename string, data []byte, mode os.FileMode) error {
+	// #nosec
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Apply the mode regardless of the umask.
+	return os.Chmod(filename, mode)
+}
+
+// shredSecrets overwrites all secret files in dir with zeros,
+// removes them and unmounts the secrets tmpfs.
+func shredSecrets(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		filename := filepath.Join(dir, e.Name())
+		if err := shredFile(filename); err != nil {
+			return fmt.Errorf("failed to shred secret %s: %w", filename, err)
+		}
+	}
+	// The secrets dir is only a mountpoint if the runtime is privileged.
+	if err := unix.Unmount(dir, unix.MNT_DETACH); err != nil && err != unix.EINVAL && err != unix.EPERM {
+		return fmt.Errorf("failed to unmount secrets tmpfs: %w", err)
+	}
+	return os.Remove(dir)
+}
+
+func shredFile(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	// The file is read-only for the owner.
+	// #nosec
+	if err := os.Chmod(filename, 0600); err != nil {
+		return err
+	}
+	// #nosec
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(make([]byte, info.Size())); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
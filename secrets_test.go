@@ -0,0 +1,56 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShredSecrets(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	dir := filepath.Join(tmpdir, "secrets")
+	require.NoError(t, os.Mkdir(dir, 0711))
+
+	p := filepath.Join(dir, "0")
+	require.NoError(t, writeSecret(p, []byte("password"), 0400))
+	info, err := os.Stat(p)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0400), info.Mode())
+
+	// existing secrets are not overwritten
+	require.Error(t, writeSecret(p, []byte("other"), 0400))
+
+	require.NoError(t, shredSecrets(dir))
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+
+	// no secrets
+	require.NoError(t, shredSecrets(dir))
+}
+
+func TestSecretOwner(t *testing.T) {
+	uid, gid := os.Geteuid(), os.Getegid()
+
+	owner, group := secretOwner(true, 100000, 100000)
+	require.Equal(t, 100000, owner)
+	require.Equal(t, 100000, group)
+
+	// IDs owned by the unprivileged runtime user
+	owner, group = secretOwner(false, uint32(uid), uint32(gid))
+	require.Equal(t, uid, owner)
+	require.Equal(t, gid, group)
+
+	// IDs not owned by the unprivileged runtime user are unchanged
+	owner, group = secretOwner(false, uint32(uid+100000), uint32(gid+100000))
+	require.Equal(t, -1, owner)
+	require.Equal(t, -1, group)
+
+	p := filepath.Join(t.TempDir(), "0")
+	require.NoError(t, writeSecret(p, []byte("password"), 0400))
+	require.NoError(t, os.Chown(p, owner, group))
+}
@@ -0,0 +1,472 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Stats are the resource usage statistics of a container.
+type Stats struct {
+	// Time is the time when the statistics were collected.
+	Time time.Time
+	// MemoryUsage is the total memory usage in bytes (memory.current).
+	MemoryUsage uint64
+	// CPUUsage is the total CPU time consumed (cpu.stat usage_usec).
+	CPUUsage time.Duration
+	// Pids is the number of processes in the container cgroup (pids.current).
+	Pids uint64
+	// CPU are the CPU statistics (cpu.stat).
+	// CPU is nil if the cpu controller is not enabled.
+	CPU *CPUStats `json:",omitempty"`
+	// Memory are the memory statistics (memory.stat).
+	// Memory is nil if the memory controller is not enabled.
+	Memory *MemoryStats `json:",omitempty"`
+	// IO are the block IO statistics per device (io.stat).
+	IO []IOStats `json:",omitempty"`
+	// Networks are the statistics of the network interfaces in the
+	// container network namespace. Networks is empty if the container
+	// is not running or shares the network namespace with the host.
+	Networks []NetworkStats `json:",omitempty"`
+	// Rootfs is the usage of the container root filesystem.
+	// Rootfs is only set if requested, because calculating the usage
+	// of an overlay root filesystem is expensive (see Container.RootfsStats).
+	Rootfs *FilesystemStats `json:",omitempty"`
+}
+
+// CPUStats are the CPU statistics of the container cgroup (cpu.stat).
+type CPUStats struct {
+	// User is the CPU time consumed in user mode (user_usec).
+	User time.Duration
+	// System is the CPU time consumed in kernel mode (system_usec).
+	System time.Duration
+	// Periods is the number of enforcement periods (nr_periods) of the CPU quota.
+	Periods uint64 `json:",omitempty"`
+	// ThrottledPeriods is the number of periods the cgroup was throttled (nr_throttled).
+	ThrottledPeriods uint64 `json:",omitempty"`
+	// Throttled is the total time the cgroup was throttled (throttled_usec).
+	Throttled time.Duration `json:",omitempty"`
+}
+
+// MemoryStats are the memory statistics of the container cgroup.
+type MemoryStats struct {
+	// Limit is the memory limit in bytes (memory.max).
+	// It is math.MaxUint64 if the memory is unlimited.
+	Limit uint64
+	// SwapUsage is the swap usage in bytes (memory.swap.current).
+	SwapUsage uint64
+	// WorkingSet is the memory usage minus the inactive file cache (inactive_file),
+	// which can be reclaimed. It is the usage reported by the kubelet.
+	WorkingSet uint64
+	// Anon is the anonymous memory in bytes e.g heap and stack (anon).
+	Anon uint64
+	// File is the page cache in bytes (file).
+	File uint64
+	// Kernel is the kernel memory e.g stacks and slab (kernel_stack + slab).
+	Kernel uint64
+	// PageFaults is the number of page faults (pgfault).
+	PageFaults uint64
+	// MajorPageFaults is the number of major page faults (pgmajfault).
+	MajorPageFaults uint64
+	// Stat are all counters of memory.stat.
+	Stat map[string]uint64 `json:",omitempty"`
+}
+
+// IOStats are the block IO statistics of a single device (io.stat).
+type IOStats struct {
+	Major        uint64
+	Minor        uint64
+	ReadBytes    uint64
+	WriteBytes   uint64
+	ReadIOs      uint64
+	WriteIOs     uint64
+	DiscardBytes uint64 `json:",omitempty"`
+	DiscardIOs   uint64 `json:",omitempty"`
+}
+
+// Methods used to account the root filesystem usage in FilesystemStats.Method.
+const (
+	// FilesystemUsageUpperdir is the usage of the writable (upper) layer
+	// of an overlay root filesystem.
+	FilesystemUsageUpperdir = "overlay-upperdir"
+	// FilesystemUsageStatfs is the usage of the whole filesystem
+	// that contains the root filesystem (see `man 2 statfs`).
+	FilesystemUsageStatfs = "statfs"
+)
+
+// FilesystemStats is the usage of a filesystem.
+type FilesystemStats struct {
+	// Method is the method used to account the usage.
+	Method string
+	// UsedBytes is the number of bytes used.
+	UsedBytes uint64
+	// Inodes is the number of inodes used.
+	Inodes uint64
+}
+
+// NetworkStats are the statistics of a single network interface.
+type NetworkStats struct {
+	// Interface is the network interface name.
+	Interface string
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDropped uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDropped uint64
+}
+
+// Stats returns the resource usage statistics of the container
+// collected from the container cgroup.
+func (c *Container) Stats() (*Stats, error) {
+	if c.CgroupDir == "" {
+		return nil, fmt.Errorf("container cgroup is undefined")
+	}
+	dir := filepath.Join(cgroupRoot, c.CgroupDir)
+	stats := &Stats{Time: time.Now()}
+
+	var err error
+	stats.MemoryUsage, err = readCgroupUint(filepath.Join(dir, "memory.current"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.Pids, err = readCgroupUint(filepath.Join(dir, "pids.current"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	cpuStat, err := readCgroupKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.CPUUsage = time.Duration(cpuStat["usage_usec"]) * time.Microsecond
+	if cpuStat != nil {
+		stats.CPU = &CPUStats{
+			User:             time.Duration(cpuStat["user_usec"]) * time.Microsecond,
+			System:           time.Duration(cpuStat["system_usec"]) * time.Microsecond,
+			Periods:          cpuStat["nr_periods"],
+			ThrottledPeriods: cpuStat["nr_throttled"],
+			Throttled:        time.Duration(cpuStat["throttled_usec"]) * time.Microsecond,
+		}
+	}
+
+	stats.Memory, err = memoryStats(dir, stats.MemoryUsage)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// #nosec
+	ioStat, err := os.ReadFile(filepath.Join(dir, "io.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if stats.IO, err = parseIOStat(ioStat); err != nil {
+		return nil, err
+	}
+
+	stats.Networks, err = c.networkStats()
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// RootfsStats returns the usage of the container root filesystem.
+// The usage of an overlay root filesystem is calculated by walking
+// the whole upperdir, so RootfsStats should not be called frequently.
+func (c *Container) RootfsStats() (*FilesystemStats, error) {
+	rootfs := c.Spec.Root.Path
+	if !filepath.IsAbs(rootfs) {
+		rootfs = filepath.Join(c.BundlePath, rootfs)
+	}
+	stats, err := rootfsUsage(rootfs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rootfs usage: %w", err)
+	}
+	return stats, nil
+}
+
+// memoryStats returns the memory statistics of the given cgroup directory.
+func memoryStats(dir string, usage uint64) (*MemoryStats, error) {
+	stat, err := readCgroupKeyValues(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+	mem := &MemoryStats{
+		Anon:            stat["anon"],
+		File:            stat["file"],
+		Kernel:          stat["kernel_stack"] + stat["slab"],
+		PageFaults:      stat["pgfault"],
+		MajorPageFaults: stat["pgmajfault"],
+		Stat:            stat,
+	}
+	if inactive := stat["inactive_file"]; inactive < usage {
+		mem.WorkingSet = usage - inactive
+	}
+	mem.Limit, err = readCgroupUint(filepath.Join(dir, "memory.max"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// memory.swap.current does not exist if swap accounting is disabled.
+	mem.SwapUsage, err = readCgroupUint(filepath.Join(dir, "memory.swap.current"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return mem, nil
+}
+
+// parseIOStat parses the cgroup2 io.stat file.
+// Each line contains the device number and the nested keyed counters
+// e.g `8:0 rbytes=90430464 wbytes=299008000 rios=8950 wios=1252 dbytes=0 dios=0`
+func parseIOStat(data []byte) ([]IOStats, error) {
+	var stats []IOStats
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var st IOStats
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &st.Major, &st.Minor); err != nil {
+			return nil, fmt.Errorf("invalid io.stat device %q: %w", fields[0], err)
+		}
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			val, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid io.stat value %q: %w", f, err)
+			}
+			switch kv[0] {
+			case "rbytes":
+				st.ReadBytes = val
+			case "wbytes":
+				st.WriteBytes = val
+			case "rios":
+				st.ReadIOs = val
+			case "wios":
+				st.WriteIOs = val
+			case "dbytes":
+				st.DiscardBytes = val
+			case "dios":
+				st.DiscardIOs = val
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+// rootfsUsage returns the usage of the given container root filesystem.
+// If the rootfs is an overlay mount, the usage of the writable (upper) layer
+// is calculated, which is the usage caused by the container (ephemeral storage).
+// Otherwise the usage of the filesystem that contains the rootfs is returned.
+func rootfsUsage(rootfs string) (*FilesystemStats, error) {
+	// #nosec
+	mountinfo, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	if upperdir := overlayUpperdir(string(mountinfo), rootfs); upperdir != "" {
+		return dirUsage(upperdir)
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(rootfs, &st); err != nil {
+		return nil, err
+	}
+	return &FilesystemStats{
+		Method:    FilesystemUsageStatfs,
+		UsedBytes: (st.Blocks - st.Bfree) * uint64(st.Bsize),
+		Inodes:    st.Files - st.Ffree,
+	}, nil
+}
+
+// overlayUpperdir returns the upperdir of the overlay filesystem mounted
+// at mountpoint, or an empty string if mountpoint is not an overlay mount.
+func overlayUpperdir(mountinfo string, mountpoint string) string {
+	mountpoint = filepath.Clean(mountpoint)
+	var upperdir string
+	for _, line := range strings.Split(mountinfo, "\n") {
+		// e.g `1 0 0:1 / /rootfs rw - overlay overlay rw,lowerdir=/l,upperdir=/u,workdir=/w`
+		vals := strings.SplitN(line, " - ", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		fields := strings.Fields(vals[0])
+		fsFields := strings.Fields(vals[1])
+		if len(fields) < 5 || len(fsFields) < 3 || unescapeMountinfo(fields[4]) != mountpoint {
+			continue
+		}
+		// The last mount at mountpoint is visible.
+		upperdir = ""
+		if fsFields[0] != "overlay" {
+			continue
+		}
+		for _, opt := range strings.Split(fsFields[2], ",") {
+			if strings.HasPrefix(opt, "upperdir=") {
+				upperdir = unescapeMountinfo(strings.TrimPrefix(opt, "upperdir="))
+			}
+		}
+	}
+	return upperdir
+}
+
+// unescapeMountinfo replaces the octal escape sequences (e.g `\040` for a space)
+// the kernel uses for special characters in the mountinfo fields.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// dirUsage calculates the disk usage of the given directory tree (like `du`).
+// Hard links are only accounted once.
+func dirUsage(dir string) (*FilesystemStats, error) {
+	stats := &FilesystemStats{Method: FilesystemUsageUpperdir}
+	inodes := make(map[uint64]struct{})
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may be removed by the container while walking.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if _, exist := inodes[st.Ino]; exist {
+			return nil
+		}
+		inodes[st.Ino] = struct{}{}
+		stats.Inodes++
+		stats.UsedBytes += uint64(st.Blocks) * 512
+		return nil
+	})
+	return stats, err
+}
+
+// networkStats returns the statistics of the network interfaces in the
+// network namespace of the container init process.
+// The statistics are read from /proc/[pid]/net/dev, which reflects the
+// network namespace of the process. This avoids entering the namespace
+// with setns, which affects only the calling thread.
+func (c *Container) networkStats() ([]NetworkStats, error) {
+	if c.Spec.Linux == nil || getNamespace(c.Spec, specs.NetworkNamespace) == nil {
+		return nil, nil
+	}
+	pid := c.linuxContainer.InitPid()
+	if pid < 1 {
+		return nil, nil
+	}
+	// #nosec
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if os.IsNotExist(err) || err == unix.ESRCH {
+		// init process exited
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseNetDev(data)
+}
+
+// parseNetDev parses the network device status information (see `man 5 proc` /proc/net/dev).
+func parseNetDev(data []byte) ([]NetworkStats, error) {
+	var stats []NetworkStats
+	lines := strings.Split(string(data), "\n")
+	// The first two lines are the header.
+	for i := 2; i < len(lines); i++ {
+		vals := strings.SplitN(lines[i], ":", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		fields := strings.Fields(vals[1])
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("invalid network device status %q", lines[i])
+		}
+		var counters [16]uint64
+		for j := range counters {
+			val, err := strconv.ParseUint(fields[j], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network device status %q: %w", lines[i], err)
+			}
+			counters[j] = val
+		}
+		stats = append(stats, NetworkStats{
+			Interface: strings.TrimSpace(vals[0]),
+			RxBytes:   counters[0],
+			RxPackets: counters[1],
+			RxErrors:  counters[2],
+			RxDropped: counters[3],
+			TxBytes:   counters[8],
+			TxPackets: counters[9],
+			TxErrors:  counters[10],
+			TxDropped: counters[11],
+		})
+	}
+	return stats, nil
+}
+
+// readCgroupUint reads a cgroup file that contains a single unsigned integer value.
+// The value "max" is returned as math.MaxUint64.
+func readCgroupUint(filename string) (uint64, error) {
+	// #nosec
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return ^uint64(0), nil
+	}
+	val, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return val, nil
+}
+
+// readCgroupKeyValues reads a flat keyed cgroup file (e.g cpu.stat).
+// Each line contains a key and an unsigned integer value separated by a space.
+func readCgroupKeyValues(filename string) (map[string]uint64, error) {
+	// #nosec
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	vals := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		vals[fields[0]] = val
+	}
+	return vals, nil
+}
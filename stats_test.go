@@ -0,0 +1,129 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCgroupFiles(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	p := filepath.Join(tmpdir, "memory.max")
+	err = os.WriteFile(p, []byte("max\n"), 0640)
+	require.NoError(t, err)
+	val, err := readCgroupUint(p)
+	require.NoError(t, err)
+	require.Equal(t, ^uint64(0), val)
+
+	p = filepath.Join(tmpdir, "memory.current")
+	err = os.WriteFile(p, []byte("4096\n"), 0640)
+	require.NoError(t, err)
+	val, err = readCgroupUint(p)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), val)
+
+	p = filepath.Join(tmpdir, "cpu.stat")
+	err = os.WriteFile(p, []byte("usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n"), 0640)
+	require.NoError(t, err)
+	kv, err := readCgroupKeyValues(p)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{"usage_usec": 1500, "user_usec": 1000, "system_usec": 500}, kv)
+}
+
+func TestParseNetDev(t *testing.T) {
+	data := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1200      12    0    0    0     0          0         0     1200      12    0    0    0     0       0          0
+  eth0: 5242880    4000    1    2    0     0          0         3  1048576    2000    4    5    0     0       0          0
+`
+	stats, err := parseNetDev([]byte(data))
+	require.NoError(t, err)
+	require.Equal(t, []NetworkStats{
+		{Interface: "lo", RxBytes: 1200, RxPackets: 12, TxBytes: 1200, TxPackets: 12},
+		{Interface: "eth0", RxBytes: 5242880, RxPackets: 4000, RxErrors: 1, RxDropped: 2,
+			TxBytes: 1048576, TxPackets: 2000, TxErrors: 4, TxDropped: 5},
+	}, stats)
+
+	_, err = parseNetDev([]byte("h1\nh2\neth0: 1 2 3\n"))
+	require.Error(t, err)
+}
+
+func TestOverlayUpperdir(t *testing.T) {
+	mountinfo := `22 1 0:21 / / rw,relatime - ext4 /dev/sda1 rw
+100 22 0:50 / /var/lib/containers/storage/overlay/abc/merged rw,relatime - overlay overlay rw,lowerdir=/l1:/l2,upperdir=/var/lib/containers/storage/overlay/abc/diff,workdir=/var/lib/containers/storage/overlay/abc/work
+101 22 0:51 / /mnt/rootfs rw,relatime - tmpfs tmpfs rw
+`
+	require.Equal(t, "/var/lib/containers/storage/overlay/abc/diff",
+		overlayUpperdir(mountinfo, "/var/lib/containers/storage/overlay/abc/merged/"))
+	require.Equal(t, "", overlayUpperdir(mountinfo, "/mnt/rootfs"))
+	require.Equal(t, "", overlayUpperdir(mountinfo, "/other"))
+
+	escaped := `102 22 0:52 / /mnt/my\040rootfs rw - overlay overlay rw,lowerdir=/l,upperdir=/u\054v\134w,workdir=/w
+`
+	require.Equal(t, `/u,v\w`, overlayUpperdir(escaped, "/mnt/my rootfs"))
+}
+
+func TestUnescapeMountinfo(t *testing.T) {
+	require.Equal(t, "/mnt/rootfs", unescapeMountinfo("/mnt/rootfs"))
+	require.Equal(t, `/mnt/a b\tc`, unescapeMountinfo(`/mnt/a\040b\134tc`))
+	// incomplete or invalid escape sequences are kept
+	require.Equal(t, `/mnt/a\09`, unescapeMountinfo(`/mnt/a\09`))
+}
+
+func TestDirUsage(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "golang.test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	p := filepath.Join(tmpdir, "data")
+	require.NoError(t, os.WriteFile(p, make([]byte, 8192), 0640))
+	require.NoError(t, os.Link(p, filepath.Join(tmpdir, "link")))
+
+	stats, err := dirUsage(tmpdir)
+	require.NoError(t, err)
+	require.Equal(t, FilesystemUsageUpperdir, stats.Method)
+	// the directory and the hard linked file
+	require.Equal(t, uint64(2), stats.Inodes)
+	require.True(t, stats.UsedBytes >= 8192)
+}
+
+func TestParseIOStat(t *testing.T) {
+	data := []byte("8:0 rbytes=90430464 wbytes=299008000 rios=8950 wios=1252 dbytes=0 dios=0\n253:1 rbytes=4096 wbytes=0 rios=1 wios=0\n")
+	stats, err := parseIOStat(data)
+	require.NoError(t, err)
+	require.Equal(t, []IOStats{
+		{Major: 8, Minor: 0, ReadBytes: 90430464, WriteBytes: 299008000, ReadIOs: 8950, WriteIOs: 1252},
+		{Major: 253, Minor: 1, ReadBytes: 4096, ReadIOs: 1},
+	}, stats)
+
+	stats, err = parseIOStat(nil)
+	require.NoError(t, err)
+	require.Empty(t, stats)
+
+	_, err = parseIOStat([]byte("sda rbytes=1\n"))
+	require.Error(t, err)
+}
+
+func TestMemoryStats(t *testing.T) {
+	dir := t.TempDir()
+	stat := "anon 1000\nfile 2000\nkernel_stack 100\nslab 200\ninactive_file 1500\npgfault 10\npgmajfault 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.stat"), []byte(stat), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.max"), []byte("max\n"), 0640))
+
+	mem, err := memoryStats(dir, 4000)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), mem.Anon)
+	require.Equal(t, uint64(2000), mem.File)
+	require.Equal(t, uint64(300), mem.Kernel)
+	require.Equal(t, uint64(2500), mem.WorkingSet)
+	require.Equal(t, uint64(10), mem.PageFaults)
+	require.Equal(t, uint64(1), mem.MajorPageFaults)
+	require.Equal(t, ^uint64(0), mem.Limit)
+	require.Equal(t, uint64(0), mem.SwapUsage)
+	require.Len(t, mem.Stat, 7)
+}
@@ -0,0 +1,128 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// ipcSysctls are the sysctls (outside of fs.mqueue) isolated by the IPC namespace.
+// See `man 7 ipc_namespaces`.
+var ipcSysctls = map[string]bool{
+	"kernel.msgmax":          true,
+	"kernel.msgmnb":          true,
+	"kernel.msgmni":          true,
+	"kernel.sem":             true,
+	"kernel.shmall":          true,
+	"kernel.shmmax":          true,
+	"kernel.shmmni":          true,
+	"kernel.shm_rmid_forced": true,
+}
+
+// utsSysctls are the sysctls isolated by the UTS namespace.
+var utsSysctls = map[string]bool{
+	"kernel.hostname":   true,
+	"kernel.domainname": true,
+}
+
+// sysctlKeyRe matches a sysctl key in dotted notation.
+// A slash in a name stands for a dot, e.g the interface eth0.100
+// in `net.ipv4.conf.eth0/100.forwarding` (see `man 5 sysctl.d`).
+var sysctlKeyRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_:/-]+)+$`)
+
+// normalizeSysctl returns the sysctl key in dotted notation.
+// A key that uses slashes as separator is converted by swapping
+// slashes and dots, e.g `net/ipv4/conf/eth0.100/forwarding` becomes
+// `net.ipv4.conf.eth0/100.forwarding`. Keys in dotted notation are not changed.
+func normalizeSysctl(key string) string {
+	key = strings.TrimLeft(key, "/")
+	if i := strings.IndexAny(key, "./"); i < 0 || key[i] == '.' {
+		return key
+	}
+	return swapSysctlSeparators(key)
+}
+
+// sysctlPath returns the path in /proc/sys of the given (normalized) sysctl.
+func sysctlPath(key string) string {
+	return filepath.Join("/proc/sys", swapSysctlSeparators(key))
+}
+
+func swapSysctlSeparators(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.':
+			return '/'
+		case '/':
+			return '.'
+		}
+		return r
+	}, key)
+}
+
+// sysctlNamespace returns the type of the namespace that isolates the
+// given (normalized) sysctl. ok is false if the sysctl is not namespaced.
+func sysctlNamespace(key string) (nsType specs.LinuxNamespaceType, ok bool) {
+	switch {
+	case strings.HasPrefix(key, "net."):
+		return specs.NetworkNamespace, true
+	case strings.HasPrefix(key, "fs.mqueue."), ipcSysctls[key]:
+		return specs.IPCNamespace, true
+	case utsSysctls[key]:
+		return specs.UTSNamespace, true
+	}
+	return "", false
+}
+
+// checkSysctl returns an error if the given sysctl would
+// modify the host because it is not isolated by a private namespace.
+func checkSysctl(spec *specs.Spec, key string) error {
+	if !sysctlKeyRe.MatchString(key) {
+		return fmt.Errorf("invalid sysctl key %q", key)
+	}
+	// liblxc writes the sysctl to the path of the key with all dots
+	// replaced by slashes, so it can not set names that contain a dot.
+	if strings.Contains(key, "/") {
+		return fmt.Errorf("sysctl %q is not supported by liblxc: %s contains a name with a dot", key, sysctlPath(key))
+	}
+	nsType, ok := sysctlNamespace(key)
+	if !ok {
+		return fmt.Errorf("sysctl %q is not namespaced and would modify the host", key)
+	}
+	shared, err := isNamespaceSharedWithRuntime(getNamespace(spec, nsType))
+	if err != nil {
+		return fmt.Errorf("sysctl %q: failed to check %s namespace: %w", key, nsType, err)
+	}
+	if shared {
+		return fmt.Errorf("sysctl %q requires a private %s namespace", key, nsType)
+	}
+	return nil
+}
+
+func configureSysctls(c *Container) error {
+	// The keys are sorted, so that the liblxc config is reproducible.
+	keys := make([]string, 0, len(c.Spec.Linux.Sysctl))
+	for key := range c.Spec.Linux.Sysctl {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, specKey := range keys {
+		key := normalizeSysctl(specKey)
+		if err := checkSysctl(c.Spec, key); err != nil {
+			return err
+		}
+		// Network interface specific sysctls may only exist within the container.
+		if _, err := os.Stat(sysctlPath(key)); os.IsNotExist(err) {
+			c.warnf("SysctlUnknown", "sysctl %q does not exist on the host", key)
+		}
+		if err := c.setConfigItem("lxc.sysctl."+key, c.Spec.Linux.Sysctl[specKey]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
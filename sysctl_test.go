@@ -0,0 +1,38 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSysctl(t *testing.T) {
+	spec := &specs.Spec{Linux: &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{
+			{Type: specs.NetworkNamespace},
+			{Type: specs.IPCNamespace},
+		},
+	}}
+
+	require.Equal(t, "net.ipv4.ip_forward", normalizeSysctl("net/ipv4/ip_forward"))
+	require.Equal(t, "net.ipv4.ip_forward", normalizeSysctl("net.ipv4.ip_forward"))
+	require.Equal(t, "net.ipv4.conf.eth0/100.forwarding", normalizeSysctl("net/ipv4/conf/eth0.100/forwarding"))
+	require.Equal(t, "net.ipv4.conf.eth0/100.forwarding", normalizeSysctl("net.ipv4.conf.eth0/100.forwarding"))
+	require.Equal(t, "/proc/sys/net/ipv4/conf/eth0.100/forwarding", sysctlPath("net.ipv4.conf.eth0/100.forwarding"))
+	// liblxc can not set names with a dot
+	require.Error(t, checkSysctl(spec, "net.ipv4.conf.eth0/100.forwarding"))
+
+	require.NoError(t, checkSysctl(spec, "net.ipv4.ip_forward"))
+	require.NoError(t, checkSysctl(spec, "kernel.shmmax"))
+	require.NoError(t, checkSysctl(spec, "fs.mqueue.msg_max"))
+
+	// not namespaced
+	require.Error(t, checkSysctl(spec, "kernel.panic"))
+	require.Error(t, checkSysctl(spec, "vm.swappiness"))
+	// UTS namespace is shared with the host
+	require.Error(t, checkSysctl(spec, "kernel.hostname"))
+	// invalid key
+	require.Error(t, checkSysctl(spec, "net"))
+	require.Error(t, checkSysctl(spec, "net..ipv4"))
+}
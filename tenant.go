@@ -0,0 +1,120 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// tenantsDir is the (hidden) directory within the runtime root
+// that contains the runtime directories of all tenants (users)
+// if Runtime.MultiTenant is enabled.
+const tenantsDir = ".users"
+
+// containersDir returns the directory that contains the
+// runtime directories of the containers managed by the calling user.
+// The containers of different users are isolated from each other
+// if Runtime.MultiTenant is enabled. Container IDs are unique per user then.
+func (rt *Runtime) containersDir() string {
+	if rt.MultiTenant {
+		return filepath.Join(rt.Root, tenantsDir, strconv.Itoa(os.Getuid()))
+	}
+	return rt.Root
+}
+
+// initTenantDir checks the runtime directory of the calling user.
+//
+// The tenants directory must not be writable by other users than its owner (root),
+// otherwise a user could create the tenant directory of another user in advance
+// and lock the user out of the runtime. Therefore the tenant directories
+// must be provisioned by root (see Runtime.AddTenant).
+// A tenant directory is only used if it is owned by the calling user.
+// Only the owner can list or modify the tenant directory, but every user
+// can traverse it, because the mapped root user of a container in a user
+// namespace must reach the container runtime directory (see runtimeDirPermissions).
+// The tenant directory of root is created on demand.
+func (rt *Runtime) initTenantDir() error {
+	uid := os.Getuid()
+	if uid == 0 {
+		return rt.AddTenant(uid)
+	}
+	if err := checkTenantsDir(filepath.Join(rt.Root, tenantsDir)); err != nil {
+		return err
+	}
+	dir := rt.containersDir()
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("tenant dir %s does not exist and must be provisioned by root (e.g with lxcri add-tenant)", dir)
+	}
+	return checkTenantDir(dir, uid)
+}
+
+// AddTenant creates the tenant directory for the user with the given UID
+// in the runtime root (see Runtime.MultiTenant). It requires root privileges,
+// because the tenants directory is only writable by root.
+// AddTenant does nothing if the tenant directory exists already.
+func (rt *Runtime) AddTenant(uid int) error {
+	dir := filepath.Join(rt.Root, tenantsDir)
+	if err := os.Mkdir(dir, 0711); err == nil {
+		// chmod is required because umask is applied to mkdir
+		if err := os.Chmod(dir, 0711); err != nil {
+			return fmt.Errorf("failed to chmod tenants dir: %w", err)
+		}
+	} else if !os.IsExist(err) {
+		return fmt.Errorf("failed to create tenants dir: %w", err)
+	}
+	if err := checkTenantsDir(dir); err != nil {
+		return err
+	}
+
+	dir = filepath.Join(dir, strconv.Itoa(uid))
+	if err := os.Mkdir(dir, 0711); err == nil {
+		if err := unix.Chown(dir, uid, -1); err != nil {
+			return fmt.Errorf("failed to chown tenant dir: %w", err)
+		}
+	} else if !os.IsExist(err) {
+		return fmt.Errorf("failed to create tenant dir: %w", err)
+	}
+	return checkTenantDir(dir, uid)
+}
+
+func checkTenantsDir(dir string) error {
+	var st unix.Stat_t
+	if err := unix.Lstat(dir, &st); err != nil {
+		return fmt.Errorf("failed to stat tenants dir %s: %w", dir, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return fmt.Errorf("tenants dir %s is not a directory", dir)
+	}
+	if st.Uid != 0 {
+		return fmt.Errorf("tenants dir %s is owned by uid %d (expected uid 0)", dir, st.Uid)
+	}
+	// Otherwise any user could create, rename or replace
+	// the tenant directories of other users.
+	if st.Mode&0022 != 0 {
+		return fmt.Errorf("tenants dir %s is writable by group or others", dir)
+	}
+	return nil
+}
+
+func checkTenantDir(dir string, uid int) error {
+	var st unix.Stat_t
+	if err := unix.Lstat(dir, &st); err != nil {
+		return fmt.Errorf("failed to stat tenant dir %s: %w", dir, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return fmt.Errorf("tenant dir %s is not a directory", dir)
+	}
+	// Another user may have created the directory in advance.
+	if int(st.Uid) != uid {
+		return fmt.Errorf("tenant dir %s is owned by uid %d (expected uid %d)", dir, st.Uid, uid)
+	}
+	if st.Mode&0777 != 0711 {
+		if err := unix.Chmod(dir, 0711); err != nil {
+			return fmt.Errorf("failed to chmod tenant dir %s: %w", dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestInitTenantDir(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skipf("This tests only runs as root")
+	}
+	root, err := os.MkdirTemp("", "lxcri-test-tenant")
+	require.NoError(t, err)
+	defer removeAll(t, root)
+
+	rt := Runtime{Root: root, MultiTenant: true}
+	require.NoError(t, rt.initTenantDir())
+
+	dir := filepath.Join(root, tenantsDir, strconv.Itoa(os.Getuid()))
+	require.Equal(t, dir, rt.containersDir())
+
+	info, err := os.Stat(filepath.Join(root, tenantsDir))
+	require.NoError(t, err)
+	require.Equal(t, os.ModeDir|0711, info.Mode())
+
+	info, err = os.Stat(dir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0711), info.Mode().Perm())
+
+	// permissions of an existing tenant dir are restricted
+	require.NoError(t, os.Chmod(dir, 0755))
+	require.NoError(t, rt.initTenantDir())
+	info, err = os.Stat(dir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0711), info.Mode().Perm())
+
+	require.Error(t, checkTenantDir(dir, os.Getuid()+1))
+
+	// the tenant dir of another user is provisioned by root
+	require.NoError(t, rt.AddTenant(1000))
+	var st unix.Stat_t
+	require.NoError(t, unix.Stat(filepath.Join(root, tenantsDir, "1000"), &st))
+	require.Equal(t, uint32(1000), st.Uid)
+	require.NoError(t, checkTenantDir(filepath.Join(root, tenantsDir, "1000"), 1000))
+}
+
+func TestCheckTenantsDir(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skipf("This tests only runs as root")
+	}
+	dir, err := os.MkdirTemp("", "lxcri-test-tenants")
+	require.NoError(t, err)
+	defer removeAll(t, dir)
+
+	require.NoError(t, os.Chmod(dir, 0711))
+	require.NoError(t, checkTenantsDir(dir))
+
+	// other users could create the tenant dirs of other users in advance
+	require.NoError(t, os.Chmod(dir, 0777|os.ModeSticky))
+	require.Error(t, checkTenantsDir(dir))
+	require.NoError(t, os.Chmod(dir, 0731))
+	require.Error(t, checkTenantsDir(dir))
+
+	require.NoError(t, os.Chmod(dir, 0711))
+	require.NoError(t, os.Chown(dir, 1000, -1))
+	require.Error(t, checkTenantsDir(dir))
+}
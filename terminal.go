@@ -0,0 +1,110 @@
+package lxcri
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// TerminalSize is the size of a terminal in characters.
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// ctlFifos are the FIFOs in the container runtime directory the monitor process
+// reads terminal control messages from, if the container has a ConsoleSocket.
+// The messages have the format '<type> <height> <width>\n' used by conmon.
+var ctlFifos = []string{"ctl", "winsz"}
+
+// ctlResize is the control message type to resize the terminal.
+const ctlResize = 1
+
+// createCtlFifos creates the ctlFifos in the container runtime directory.
+func (c *Container) createCtlFifos() error {
+	for _, name := range ctlFifos {
+		if err := unix.Mkfifo(c.RuntimePath(name), 0600); err != nil {
+			return fmt.Errorf("failed to create control FIFO %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// resizeConsole writes a resize message to the winsz FIFO.
+// The monitor resizes the terminal passed to the ConsoleSocket,
+// and liblxc forwards the size to the container console.
+func (c *Container) resizeConsole(size TerminalSize) error {
+	// Opening a FIFO without reader fails with ENXIO instead of blocking.
+	f, err := os.OpenFile(c.RuntimePath("winsz"), os.O_WRONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open terminal control FIFO: %w", err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%d %d %d\n", ctlResize, size.Height, size.Width)
+	return err
+}
+
+// ResizeTerminal sets the size of the terminal of a container process,
+// e.g when the window of an interactive exec session is resized.
+// The terminal is the standard input of the process with the given pid.
+// A pid of zero is the container init process. The terminal of a container
+// with a ConsoleSocket is resized by the monitor process (see ctlFifos).
+// The foreground process group of the terminal receives SIGWINCH.
+func (c *Container) ResizeTerminal(pid int, size TerminalSize) error {
+	if pid == 0 && c.ConsoleSocket != "" {
+		return c.resizeConsole(size)
+	}
+	if pid == 0 {
+		pid = c.linuxContainer.InitPid()
+		if pid < 1 {
+			return fmt.Errorf("%w: init process is not running", ErrInitExited)
+		}
+	} else if c.CgroupDir != "" {
+		pids, err := c.Pids()
+		if err != nil {
+			return err
+		}
+		if !containsInt(pids, pid) {
+			return fmt.Errorf("process %d is not a container process", pid)
+		}
+	}
+	// #nosec
+	f, err := os.OpenFile(fmt.Sprintf("/proc/%d/fd/0", pid), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open terminal of process %d: %w", pid, err)
+	}
+	defer f.Close()
+	return resizeTerminal(int(f.Fd()), size)
+}
+
+// resizeTerminal sets the window size of the terminal fd.
+func resizeTerminal(fd int, size TerminalSize) error {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return fmt.Errorf("not a terminal: %w", err)
+	}
+	ws.Col = size.Width
+	ws.Row = size.Height
+	if err := unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, ws); err != nil {
+		return fmt.Errorf("failed to resize terminal: %w", err)
+	}
+	return nil
+}
+
+// resizeFile sets the window size of the terminal f.
+// Unlike f.Fd() it does not put a non-blocking file into blocking mode.
+func resizeFile(f *os.File, size TerminalSize) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var resizeErr error
+	err = rc.Control(func(fd uintptr) {
+		resizeErr = resizeTerminal(int(fd), size)
+	})
+	if err != nil {
+		return err
+	}
+	return resizeErr
+}
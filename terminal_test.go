@@ -0,0 +1,66 @@
+package lxcri
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/creack/pty"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestResizeTerminal(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	require.NoError(t, err)
+	defer ptmx.Close()
+	defer tty.Close()
+
+	cmd := exec.Command("sleep", "10")
+	cmd.Stdin = tty
+	require.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	require.NoError(t, c.ResizeTerminal(cmd.Process.Pid, TerminalSize{Width: 120, Height: 40}))
+	ws, err := unix.IoctlGetWinsize(int(ptmx.Fd()), unix.TIOCGWINSZ)
+	require.NoError(t, err)
+	require.Equal(t, uint16(120), ws.Col)
+	require.Equal(t, uint16(40), ws.Row)
+
+	require.NoError(t, resizeFile(ptmx, TerminalSize{Width: 80, Height: 24}))
+	ws, err = unix.IoctlGetWinsize(int(tty.Fd()), unix.TIOCGWINSZ)
+	require.NoError(t, err)
+	require.Equal(t, uint16(80), ws.Col)
+	require.Equal(t, uint16(24), ws.Row)
+
+	// stdin of the test process is not necessarily a terminal
+	null := exec.Command("sleep", "10")
+	require.NoError(t, null.Start())
+	defer func() {
+		_ = null.Process.Kill()
+		_ = null.Wait()
+	}()
+	require.Error(t, c.ResizeTerminal(null.Process.Pid, TerminalSize{Width: 80, Height: 24}))
+}
+
+func TestResizeConsole(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{ConsoleSocket: "/run/console.sock"}}
+	c.runtimeDir = t.TempDir()
+
+	// The monitor is not running.
+	require.NoError(t, c.createCtlFifos())
+	require.Error(t, c.ResizeTerminal(0, TerminalSize{Width: 120, Height: 40}))
+
+	f, err := os.OpenFile(c.RuntimePath("winsz"), os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, c.ResizeTerminal(0, TerminalSize{Width: 120, Height: 40}))
+	line, err := bufio.NewReader(f).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "1 40 120\n", line)
+}
@@ -0,0 +1,58 @@
+package lxcri
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/lxc/lxcri/pkg/specki"
+)
+
+// timingsFile is the file in the container runtime directory
+// that records the lifecycle operation durations.
+const timingsFile = "timings.json"
+
+// Timings are the durations of the container lifecycle operations
+// and their phases. They help to attribute slow container starts
+// to a specific phase. Durations of operations that did not (yet)
+// complete successfully are zero.
+type Timings struct {
+	// ConfigGeneration is the time Runtime.Create spent to configure
+	// the container and to generate the liblxc config.
+	ConfigGeneration time.Duration `json:",omitempty"`
+	// MonitorSpawn is the time to spawn the monitor process (lxcri-start).
+	MonitorSpawn time.Duration `json:",omitempty"`
+	// InitReady is the time from the monitor process spawn until
+	// the container init process (lxcri-init) is ready to start the container process.
+	InitReady time.Duration `json:",omitempty"`
+	// Create is the total duration of Runtime.Create.
+	Create time.Duration `json:",omitempty"`
+	// Start is the duration of Runtime.Start.
+	// It includes the time spent waiting for NetworkReadiness.
+	Start time.Duration `json:",omitempty"`
+}
+
+// Timings returns the recorded lifecycle operation durations.
+// ErrNotExist is returned if no durations were recorded,
+// e.g because the container was created by an older runtime.
+func (c *Container) Timings() (*Timings, error) {
+	// #nosec
+	data, err := os.ReadFile(c.RuntimePath(timingsFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := new(Timings)
+	return t, json.Unmarshal(data, t)
+}
+
+// recordTimings writes the lifecycle operation durations.
+// Failures are logged, because timings are informational.
+func (c *Container) recordTimings() {
+	err := specki.EncodeJSONFile(c.RuntimePath(timingsFile), c.timings, os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		c.Log.Warn().Msgf("failed to record timings: %s", err)
+	}
+}
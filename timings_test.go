@@ -0,0 +1,27 @@
+package lxcri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimings(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{}, runtimeDir: t.TempDir()}
+	_, err := c.Timings()
+	require.Equal(t, ErrNotExist, err)
+
+	c.timings = Timings{ConfigGeneration: 5 * time.Millisecond, Create: 200 * time.Millisecond}
+	c.recordTimings()
+	timings, err := c.Timings()
+	require.NoError(t, err)
+	require.Equal(t, c.timings, *timings)
+
+	// the timings are updated by start
+	c.timings.Start = 50 * time.Millisecond
+	c.recordTimings()
+	timings, err = c.Timings()
+	require.NoError(t, err)
+	require.Equal(t, 50*time.Millisecond, timings.Start)
+}
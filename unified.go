@@ -0,0 +1,74 @@
+package lxcri
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unifiedManaged are core cgroup2 interface files that must not be set
+// through specs.LinuxResources.Unified, because they are managed by the runtime.
+var unifiedManaged = map[string]bool{
+	"cgroup.procs":           true,
+	"cgroup.threads":         true,
+	"cgroup.subtree_control": true,
+	"cgroup.type":            true,
+	"cgroup.controllers":     true,
+	"cgroup.events":          true,
+	"cgroup.freeze":          true,
+	"cgroup.kill":            true,
+	"cgroup.stat":            true,
+}
+
+// unifiedCgroupItems validates the unified cgroup2 properties (specs.LinuxResources.Unified)
+// and returns them sorted by key. A key is the name of a cgroup2 interface file
+// in the format `<controller>.<name>` e.g `memory.high`.
+func unifiedCgroupItems(unified map[string]string) ([]cgroupItem, error) {
+	keys := make([]string, 0, len(unified))
+	for key := range unified {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]cgroupItem, 0, len(keys))
+	for _, key := range keys {
+		val := unified[key]
+		parts := strings.SplitN(key, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(key, "/\x00") {
+			return nil, fmt.Errorf("invalid unified cgroup key %q: expected <controller>.<name>", key)
+		}
+		if unifiedManaged[key] {
+			return nil, fmt.Errorf("unified cgroup key %q is managed by the runtime and can not be set", key)
+		}
+		if strings.ContainsAny(val, "\n\x00") {
+			return nil, fmt.Errorf("invalid value for unified cgroup key %q: must be a single line", key)
+		}
+		items = append(items, cgroupItem{key, val})
+	}
+	return items, nil
+}
+
+// configureUnified sets the unified cgroup2 properties for the container cgroup.
+// They are set after all other resource limits, so they take precedence.
+// Unlike other resource limits, a property of an unavailable controller is an error,
+// because the property is set explicitly for cgroup2.
+func configureUnified(c *Container) error {
+	items, err := unifiedCgroupItems(c.Spec.Linux.Resources.Unified)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		// The CPU burst is set by configureCPUBurst.
+		if item.key == cpuMaxBurst {
+			continue
+		}
+		controller := strings.SplitN(item.key, ".", 2)[0]
+		if !c.hasCgroupController(controller) {
+			return fmt.Errorf("failed to set unified cgroup key %q: cgroup controller %q is not available", item.key, controller)
+		}
+		if err := c.setCgroupItem(item.key, item.value); err != nil {
+			return fmt.Errorf("failed to set unified cgroup key %q: %w", item.key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package lxcri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedCgroupItems(t *testing.T) {
+	items, err := unifiedCgroupItems(map[string]string{
+		"memory.high":     "1073741824",
+		"cpu.weight.nice": "-5",
+		"io.max":          "8:0 rbps=1048576",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []cgroupItem{
+		{"cpu.weight.nice", "-5"},
+		{"io.max", "8:0 rbps=1048576"},
+		{"memory.high", "1073741824"},
+	}, items)
+
+	items, err = unifiedCgroupItems(nil)
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	invalid := []map[string]string{
+		{"memory": "1"},
+		{".high": "1"},
+		{"memory.": "1"},
+		{"../memory.high": "1"},
+		{"cgroup.procs": "1"},
+		{"cgroup.subtree_control": "+memory"},
+		{"memory.high": "1\n2"},
+	}
+	for _, unified := range invalid {
+		_, err := unifiedCgroupItems(unified)
+		require.Error(t, err, "%v", unified)
+	}
+}
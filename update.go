@@ -0,0 +1,354 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// cgroupItem is a cgroup2 interface file and the value to write.
+type cgroupItem struct {
+	key   string
+	value string
+}
+
+// Update applies the resource limits to the cgroup of a created, running or paused container.
+// The limits are written to the cgroup2 interface files directly, so that they
+// take effect immediately (e.g for in-place vertical pod scaling).
+// Supported are the CPU (cpu.weight, cpu.max, cpuset.cpus, cpuset.mems),
+// memory (memory.max, memory.low, memory.swap.max), pids (pids.max),
+// block IO (io.weight, io.max) and hugepage (hugetlb.<pagesize>.max) limits
+// and the unified cgroup2 properties.
+// If only the CPU quota or period is set, the other cpu.max value is retained.
+// Other resources are ignored with a warning.
+// NOTE: The container spec is not modified.
+func (rt *Runtime) Update(ctx context.Context, c *Container, res *specs.LinuxResources) error {
+	rt.Log.Info().Str("cid", c.ContainerID).Msg("update container resources")
+	if res == nil {
+		return nil
+	}
+	state, err := c.ContainerState()
+	if err != nil {
+		return errorf("failed to get container state: %w", err)
+	}
+	if state == specs.StateStopped || state == specs.StateCreating {
+		return fmt.Errorf("invalid container state %q", state)
+	}
+
+	if len(res.Devices) > 0 {
+		c.Log.Warn().Msg("device updates are not supported and ignored")
+	}
+	if res.Network != nil {
+		c.Log.Warn().Msg("network resource limits are not supported and ignored")
+	}
+
+	_, err = os.Stat(filepath.Join(cgroupRoot, c.CgroupDir, "io.bfq.weight"))
+	items, err := cgroupResourceItems(res, err == nil)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch item.key {
+		case "cpuset.cpus":
+			// The cpuset is retained when CPUs are allocated exclusively by other containers.
+			err = updateSharedCPUs(c, item.value)
+		case "cpu.max":
+			item.value, err = c.updatedCPUMax(res.CPU, item.value)
+			if err == nil {
+				err = c.writeCgroupFile(item.key, item.value)
+			}
+		default:
+			err = c.writeCgroupFile(item.key, item.value)
+		}
+		if err != nil {
+			return err
+		}
+		c.Log.Debug().Str(item.key, item.value).Msg("updated cgroup")
+	}
+	return nil
+}
+
+// writeCgroupFile writes the value to the cgroup2 interface file of the container cgroup.
+func (c *Container) writeCgroupFile(key string, value string) error {
+	if c.CgroupDir == "" {
+		return fmt.Errorf("container cgroup is not set")
+	}
+	return writeCgroupItem(c.CgroupDir, key, value)
+}
+
+// writeCgroupItem writes the value to the cgroup2 interface file of the cgroup
+// with the given path relative to the cgroup root.
+func writeCgroupItem(cgroupDir string, key string, value string) error {
+	filename := filepath.Join(cgroupRoot, cgroupDir, key)
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		controller := strings.SplitN(key, ".", 2)[0]
+		return fmt.Errorf("failed to set %s=%s: cgroup controller %q is not enabled", key, value, controller)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set %s=%s: %w", key, value, err)
+	}
+	return nil
+}
+
+// cgroupResourceItems converts the resource limits to the cgroup2 interface file values.
+// If bfq is true the block IO weights are set for the BFQ I/O scheduler (see ioCgroupItems).
+func cgroupResourceItems(res *specs.LinuxResources, bfq bool) ([]cgroupItem, error) {
+	var items []cgroupItem
+	if res.CPU != nil {
+		items = append(items, cpuCgroupItems(res.CPU)...)
+	}
+	if res.Memory != nil {
+		mem, err := memoryCgroupItems(res.Memory)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, mem...)
+	}
+	if res.Pids != nil {
+		items = append(items, cgroupItem{"pids.max", pidsLimit(res.Pids.Limit)})
+	}
+	if res.BlockIO != nil {
+		io, err := ioCgroupItems(res.BlockIO, bfq)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, io...)
+	}
+	if len(res.HugepageLimits) > 0 {
+		hugetlb, err := hugetlbCgroupItems(res.HugepageLimits)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, hugetlb...)
+	}
+	// The unified properties are set last, so they take precedence.
+	unified, err := unifiedCgroupItems(res.Unified)
+	if err != nil {
+		return nil, err
+	}
+	return append(items, unified...), nil
+}
+
+// pidsLimit formats the pids limit for pids.max.
+// A limit of zero or below is unlimited.
+func pidsLimit(limit int64) string {
+	if limit > 0 {
+		return strconv.FormatInt(limit, 10)
+	}
+	return "max"
+}
+
+// defaultCPUPeriod is the default cpu.max period in microseconds.
+const defaultCPUPeriod = 100000
+
+func cpuCgroupItems(cpu *specs.LinuxCPU) []cgroupItem {
+	var items []cgroupItem
+	if cpu.Shares != nil && *cpu.Shares > 0 {
+		items = append(items, cgroupItem{"cpu.weight", strconv.FormatUint(cpuSharesToWeight(*cpu.Shares), 10)})
+	}
+	if cpu.Quota != nil || cpu.Period != nil {
+		quota := "max"
+		if cpu.Quota != nil && *cpu.Quota > 0 {
+			quota = strconv.FormatInt(*cpu.Quota, 10)
+		}
+		period := uint64(defaultCPUPeriod)
+		if cpu.Period != nil && *cpu.Period > 0 {
+			period = *cpu.Period
+		}
+		items = append(items, cgroupItem{"cpu.max", quota + " " + strconv.FormatUint(period, 10)})
+	}
+	if cpu.Cpus != "" {
+		items = append(items, cgroupItem{"cpuset.cpus", cpu.Cpus})
+	}
+	if cpu.Mems != "" {
+		items = append(items, cgroupItem{"cpuset.mems", cpu.Mems})
+	}
+	return items
+}
+
+// updatedCPUMax returns the cpu.max value for the update.
+// The quota or the period that is not set in the update
+// is retained from the current cpu.max value of the container cgroup.
+func (c *Container) updatedCPUMax(cpu *specs.LinuxCPU, value string) (string, error) {
+	keepQuota := cpu.Quota == nil
+	keepPeriod := cpu.Period == nil || *cpu.Period == 0
+	if !keepQuota && !keepPeriod {
+		return value, nil
+	}
+	data, err := os.ReadFile(filepath.Join(cgroupRoot, c.CgroupDir, "cpu.max"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read cpu.max: %w", err)
+	}
+	return mergeCPUMax(value, string(data), keepQuota, keepPeriod), nil
+}
+
+// mergeCPUMax replaces the quota and/or period of the cpu.max value
+// with the quota and/or period of the current cpu.max value.
+func mergeCPUMax(value string, current string, keepQuota bool, keepPeriod bool) string {
+	vals := strings.Fields(value)
+	cur := strings.Fields(current)
+	if len(vals) != 2 || len(cur) != 2 {
+		return value
+	}
+	if keepQuota {
+		vals[0] = cur[0]
+	}
+	if keepPeriod {
+		vals[1] = cur[1]
+	}
+	return vals[0] + " " + vals[1]
+}
+
+// cpuSharesToWeight converts the cgroup1 cpu.shares range [2, 262144]
+// to the cgroup2 cpu.weight range [1, 10000].
+func cpuSharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	}
+	if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+func memoryCgroupItems(mem *specs.LinuxMemory) ([]cgroupItem, error) {
+	var items []cgroupItem
+	if mem.Limit != nil {
+		items = append(items, cgroupItem{"memory.max", cgroupLimit(*mem.Limit)})
+	}
+	if mem.Reservation != nil {
+		items = append(items, cgroupItem{"memory.low", cgroupLimit(*mem.Reservation)})
+	}
+	if mem.Swap != nil {
+		// The spec swap limit is the limit for memory and swap (cgroup1 memory.memsw.limit_in_bytes),
+		// whereas cgroup2 memory.swap.max limits the swap usage only.
+		swap := *mem.Swap
+		if swap > 0 {
+			if mem.Limit == nil || *mem.Limit <= 0 {
+				return nil, fmt.Errorf("memory swap limit %d requires a memory limit", swap)
+			}
+			if swap < *mem.Limit {
+				return nil, fmt.Errorf("memory swap limit %d is lower than the memory limit %d", swap, *mem.Limit)
+			}
+			swap -= *mem.Limit
+		}
+		items = append(items, cgroupItem{"memory.swap.max", cgroupLimit(swap)})
+	}
+	return items, nil
+}
+
+// ioCgroupItems returns the block IO weights and throttle limits (io.max).
+// The weights are written to io.weight, which is used by the iocost controller,
+// or to io.bfq.weight if bfq is true. The BFQ I/O scheduler ignores io.weight
+// and uses the cgroup1 blkio weight range [1, 1000], so no conversion is required.
+func ioCgroupItems(blkio *specs.LinuxBlockIO, bfq bool) ([]cgroupItem, error) {
+	var items []cgroupItem
+	weight := func(w uint16) (string, string, error) {
+		if bfq {
+			if w < 10 || w > 1000 {
+				return "", "", fmt.Errorf("invalid blkio weight %d: must be in the range [10, 1000]", w)
+			}
+			return "io.bfq.weight", strconv.FormatUint(uint64(w), 10), nil
+		}
+		ioWeight, err := blkioWeightToIOWeight(w)
+		return "io.weight", strconv.FormatUint(ioWeight, 10), err
+	}
+	if blkio.Weight != nil {
+		key, w, err := weight(*blkio.Weight)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, cgroupItem{key, "default " + w})
+	}
+	for _, dev := range blkio.WeightDevice {
+		if dev.Weight == nil {
+			continue
+		}
+		key, w, err := weight(*dev.Weight)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, cgroupItem{key, fmt.Sprintf("%d:%d %s", dev.Major, dev.Minor, w)})
+	}
+	throttle := []struct {
+		key     string
+		devices []specs.LinuxThrottleDevice
+	}{
+		{"rbps", blkio.ThrottleReadBpsDevice},
+		{"wbps", blkio.ThrottleWriteBpsDevice},
+		{"riops", blkio.ThrottleReadIOPSDevice},
+		{"wiops", blkio.ThrottleWriteIOPSDevice},
+	}
+	for _, t := range throttle {
+		for _, dev := range t.devices {
+			// A rate of zero removes the limit.
+			rate := "max"
+			if dev.Rate > 0 {
+				rate = strconv.FormatUint(dev.Rate, 10)
+			}
+			items = append(items, cgroupItem{"io.max", fmt.Sprintf("%d:%d %s=%s", dev.Major, dev.Minor, t.key, rate)})
+		}
+	}
+	return items, nil
+}
+
+// hugetlbCgroupItems returns the hugetlb.<pagesize>.max limits.
+// The page size is converted to the name used by the kernel, e.g `2MB` or `1GB`.
+func hugetlbCgroupItems(limits []specs.LinuxHugepageLimit) ([]cgroupItem, error) {
+	items := make([]cgroupItem, 0, len(limits))
+	for _, l := range limits {
+		pageSize, err := parseByteSize(l.Pagesize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hugepage limit page size: %w", err)
+		}
+		items = append(items, cgroupItem{"hugetlb." + hugetlbPageSizeName(pageSize) + ".max", strconv.FormatUint(l.Limit, 10)})
+	}
+	return items, nil
+}
+
+// hugetlbPageSizeName formats the page size like the kernel
+// does for the hugetlb cgroup interface files.
+func hugetlbPageSizeName(pageSize uint64) string {
+	switch {
+	case pageSize >= 1<<30:
+		return strconv.FormatUint(pageSize>>30, 10) + "GB"
+	case pageSize >= 1<<20:
+		return strconv.FormatUint(pageSize>>20, 10) + "MB"
+	default:
+		return strconv.FormatUint(pageSize>>10, 10) + "KB"
+	}
+}
+
+// blkioWeightToIOWeight converts the cgroup1 blkio.weight range [10, 1000]
+// to the cgroup2 io.weight range [1, 10000].
+func blkioWeightToIOWeight(weight uint16) (uint64, error) {
+	if weight < 10 || weight > 1000 {
+		return 0, fmt.Errorf("invalid blkio weight %d: must be in the range [10, 1000]", weight)
+	}
+	return 1 + (uint64(weight)-10)*9999/990, nil
+}
+
+// cgroupLimit formats the limit for a cgroup2 interface file.
+// Negative values (-1) are unlimited.
+func cgroupLimit(limit int64) string {
+	if limit < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
@@ -0,0 +1,164 @@
+package lxcri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupResourceItems(t *testing.T) {
+	limit := int64(512 * 1024 * 1024)
+	swap := int64(1024 * 1024 * 1024)
+	quota := int64(50000)
+	shares := uint64(1024)
+	weight := uint16(500)
+	res := &specs.LinuxResources{
+		CPU:    &specs.LinuxCPU{Shares: &shares, Quota: &quota, Cpus: "0-3"},
+		Memory: &specs.LinuxMemory{Limit: &limit, Swap: &swap},
+		Pids:   &specs.LinuxPids{Limit: 0},
+		BlockIO: &specs.LinuxBlockIO{
+			Weight: &weight,
+			ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{
+				{Rate: 1048576},
+			},
+		},
+	}
+	res.BlockIO.ThrottleReadBpsDevice[0].Major = 8
+
+	items, err := cgroupResourceItems(res, false)
+	require.NoError(t, err)
+	require.Equal(t, []cgroupItem{
+		{"cpu.weight", "39"},
+		{"cpu.max", "50000 100000"},
+		{"cpuset.cpus", "0-3"},
+		{"memory.max", "536870912"},
+		{"memory.swap.max", "536870912"},
+		{"pids.max", "max"},
+		{"io.weight", "default 4950"},
+		{"io.max", "8:0 rbps=1048576"},
+	}, items)
+
+	swap = limit - 1
+	_, err = cgroupResourceItems(res, false)
+	require.Error(t, err)
+
+	swap = -1
+	items, err = memoryCgroupItems(res.Memory)
+	require.NoError(t, err)
+	require.Equal(t, cgroupItem{"memory.swap.max", "max"}, items[1])
+
+	weight = 5
+	_, err = cgroupResourceItems(res, false)
+	require.Error(t, err)
+}
+
+func TestIOCgroupItemsBFQ(t *testing.T) {
+	weight := uint16(500)
+	devWeight := uint16(100)
+	blkio := &specs.LinuxBlockIO{
+		Weight:       &weight,
+		WeightDevice: []specs.LinuxWeightDevice{{Weight: &devWeight}},
+	}
+	blkio.WeightDevice[0].Major = 8
+	blkio.WeightDevice[0].Minor = 16
+
+	items, err := ioCgroupItems(blkio, true)
+	require.NoError(t, err)
+	require.Equal(t, []cgroupItem{
+		{"io.bfq.weight", "default 500"},
+		{"io.bfq.weight", "8:16 100"},
+	}, items)
+
+	items, err = ioCgroupItems(blkio, false)
+	require.NoError(t, err)
+	require.Equal(t, []cgroupItem{
+		{"io.weight", "default 4950"},
+		{"io.weight", "8:16 910"},
+	}, items)
+
+	weight = 1001
+	_, err = ioCgroupItems(blkio, true)
+	require.Error(t, err)
+}
+
+func TestHugetlbCgroupItems(t *testing.T) {
+	items, err := hugetlbCgroupItems([]specs.LinuxHugepageLimit{
+		{Pagesize: "2MB", Limit: 1 << 30},
+		{Pagesize: "1GB", Limit: 0},
+		{Pagesize: "64KB", Limit: 65536},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []cgroupItem{
+		{"hugetlb.2MB.max", "1073741824"},
+		{"hugetlb.1GB.max", "0"},
+		{"hugetlb.64KB.max", "65536"},
+	}, items)
+
+	_, err = hugetlbCgroupItems([]specs.LinuxHugepageLimit{{Pagesize: "2XB"}})
+	require.Error(t, err)
+}
+
+func TestPidsLimit(t *testing.T) {
+	require.Equal(t, "max", pidsLimit(0))
+	require.Equal(t, "max", pidsLimit(-1))
+	require.Equal(t, "1024", pidsLimit(1024))
+}
+
+func TestCPUSharesToWeight(t *testing.T) {
+	require.Equal(t, uint64(1), cpuSharesToWeight(2))
+	require.Equal(t, uint64(10000), cpuSharesToWeight(262144))
+	require.Equal(t, uint64(1), cpuSharesToWeight(0))
+}
+
+func TestUpdatedCPUMax(t *testing.T) {
+	root := t.TempDir()
+	prevRoot := cgroupRoot
+	cgroupRoot = root
+	defer func() { cgroupRoot = prevRoot }()
+
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "test"}}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "test"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "test", "cpu.max"), []byte("50000 100000\n"), 0644))
+
+	period := uint64(200000)
+	quota := int64(20000)
+
+	// The quota is retained if only the period is updated.
+	v, err := c.updatedCPUMax(&specs.LinuxCPU{Period: &period}, "max 200000")
+	require.NoError(t, err)
+	require.Equal(t, "50000 200000", v)
+
+	// The period is retained if only the quota is updated.
+	v, err = c.updatedCPUMax(&specs.LinuxCPU{Quota: &quota}, "20000 100000")
+	require.NoError(t, err)
+	require.Equal(t, "20000 100000", v)
+
+	v, err = c.updatedCPUMax(&specs.LinuxCPU{Quota: &quota, Period: &period}, "20000 200000")
+	require.NoError(t, err)
+	require.Equal(t, "20000 200000", v)
+
+	require.Equal(t, "max 200000", mergeCPUMax("max 200000", "invalid", true, false))
+}
+
+func TestWriteCgroupFile(t *testing.T) {
+	root := t.TempDir()
+	prevRoot := cgroupRoot
+	cgroupRoot = root
+	defer func() { cgroupRoot = prevRoot }()
+
+	c := &Container{ContainerConfig: &ContainerConfig{CgroupDir: "test"}}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "test"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "test", "pids.max"), []byte("max\n"), 0644))
+
+	require.NoError(t, c.writeCgroupFile("pids.max", "100"))
+	data, err := os.ReadFile(filepath.Join(root, "test", "pids.max"))
+	require.NoError(t, err)
+	require.Equal(t, "100", string(data)[:3])
+
+	err = c.writeCgroupFile("memory.max", "100")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `cgroup controller "memory" is not enabled`)
+}
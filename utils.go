@@ -2,7 +2,10 @@ package lxcri
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -25,6 +28,10 @@ func fsMagic(fsName string) int64 {
 		return unix.PROC_SUPER_MAGIC
 	case "cgroup2", "cgroup2fs":
 		return unix.CGROUP2_SUPER_MAGIC
+	case "selinuxfs":
+		return unix.SELINUX_MAGIC
+	case "tmpfs":
+		return unix.TMPFS_MAGIC
 	default:
 		return -1
 	}
@@ -59,3 +66,19 @@ func errorf(sfmt string, args ...interface{}) error {
 	prefix := fmt.Sprintf("[%s:%s:%d] ", bin, filepath.Base(file), line)
 	return fmt.Errorf(prefix+sfmt, args...)
 }
+
+// fileDigest returns the sha256 digest of the given file
+// in the form `sha256:<hex encoded digest>`.
+func fileDigest(filename string) (string, error) {
+	// #nosec
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,186 @@
+package lxcri
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lxc/go-lxc"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// Wait waits until the container init process has exited and returns its exit status.
+// It returns immediately if the container is already stopped.
+// The wait is aborted if ctx is done.
+// ErrNotExist is returned if no exit status was recorded, e.g for a restored container.
+// The HookStopped lifecycle hooks are called before the exit status is returned.
+func (rt *Runtime) Wait(ctx context.Context, c *Container) (*ExitStatus, error) {
+	rt.Log.Debug().Str("cid", c.ContainerID).Msg("wait for container to exit")
+	if err := c.waitMonitorExited(ctx); err != nil {
+		return nil, err
+	}
+	c.runOnStopped(ctx)
+	return c.ExitStatus()
+}
+
+// waitMonitorExited waits until the monitor process has exited.
+// The monitor process exits after it has recorded the exit status of the init process.
+// The monitor process is polled, if process file descriptors are not supported.
+func (c *Container) waitMonitorExited(ctx context.Context) error {
+	pidfd, err := c.openMonitor()
+	if err == unix.ESRCH {
+		return nil
+	}
+	if err != nil {
+		c.Log.Debug().Msgf("polling monitor process: %s", err)
+		return c.waitMonitorStopped(ctx)
+	}
+	if err := waitPidfd(ctx, pidfd); err != nil {
+		return err
+	}
+	// Reap the monitor process if this process is its parent.
+	c.isMonitorRunning()
+	return nil
+}
+
+// watchPidfd calls waitPidfd in a goroutine and sends the result to the returned channel.
+func watchPidfd(ctx context.Context, pidfd int) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- waitPidfd(ctx, pidfd)
+	}()
+	return ch
+}
+
+// watchMonitor returns a channel that receives nil when the monitor process has exited,
+// or the context error. It returns nil if process file descriptors are not supported.
+func (c *Container) watchMonitor(ctx context.Context) <-chan error {
+	pidfd, err := c.openMonitor()
+	if err == unix.ESRCH {
+		ch := make(chan error, 1)
+		ch <- nil
+		return ch
+	}
+	if err != nil {
+		c.Log.Debug().Msgf("polling monitor process: %s", err)
+		return nil
+	}
+	return watchPidfd(ctx, pidfd)
+}
+
+// stateWaitInterval is the maximum duration of a single liblxc state wait.
+// liblxc wait timeouts have a resolution of one second.
+const stateWaitInterval = time.Second
+
+// waitInit waits until the liblxc container is RUNNING and done returns true
+// for the state of the container init process.
+// liblxc notifies the state changes through the container command socket,
+// and the monitor process is watched through its process file descriptor,
+// so the container is not polled. An exit of the monitor process is detected
+// after at most stateWaitInterval.
+func (c *Container) waitInit(ctx context.Context, done func(specs.ContainerState) (bool, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	exited := c.watchMonitor(ctx)
+	timer := c.backoff.timer()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if exited == nil && !c.isMonitorRunning() {
+			return fmt.Errorf("monitor already died")
+		}
+		select {
+		case err := <-exited:
+			if err == nil {
+				// Reap the monitor process if this process is its parent.
+				c.isMonitorRunning()
+				return fmt.Errorf("monitor already died")
+			}
+			exited = nil
+			continue
+		default:
+		}
+
+		running, err := c.waitState(ctx, lxc.RUNNING, timer)
+		if err != nil {
+			return err
+		}
+		if !running {
+			c.Log.Debug().Msg("wait for state lxc.RUNNING")
+			continue
+		}
+		initState, err := c.getContainerInitState()
+		if err != nil {
+			return err
+		}
+		ok, err := done(initState)
+		if ok || err != nil {
+			return err
+		}
+		// The liblxc state does not change anymore.
+		if err := timer.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// waitState waits for at most stateWaitInterval until the liblxc container
+// has the given state. The state is polled if the context deadline
+// is closer than stateWaitInterval.
+func (c *Container) waitState(ctx context.Context, state lxc.State, timer *backoffTimer) (bool, error) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < stateWaitInterval {
+		if c.linuxContainer.State() == state {
+			return true, nil
+		}
+		return false, timer.wait(ctx)
+	}
+	return c.linuxContainer.Wait(state, stateWaitInterval), nil
+}
+
+// waitPidfd waits until the process referred to by pidfd has exited,
+// or until ctx is done. The file descriptor is closed.
+func waitPidfd(ctx context.Context, pidfd int) error {
+	// A non-blocking file is registered with the runtime poller,
+	// so the wait can be interrupted by closing the file.
+	if err := unix.SetNonblock(pidfd, true); err != nil {
+		unix.Close(pidfd)
+		return err
+	}
+	f := os.NewFile(uintptr(pidfd), "pidfd")
+	defer f.Close()
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Close()
+		case <-done:
+		}
+	}()
+
+	var exitErr error
+	err = rc.Read(func(fd uintptr) bool {
+		exited, err := pidfdExited(int(fd))
+		if err != nil {
+			exitErr = err
+			return true
+		}
+		// The poller waits until the pidfd is readable if false is returned.
+		return exited
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return exitErr
+}
@@ -0,0 +1,57 @@
+package lxcri
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWaitPidfd(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	pidfd, err := pidfdOpen(cmd.Process.Pid)
+	if err == unix.ENOSYS {
+		t.Skip("pidfd_open is not supported")
+	}
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, waitPidfd(ctx, pidfd))
+
+	pidfd, err = pidfdOpen(cmd.Process.Pid)
+	require.NoError(t, err)
+	require.NoError(t, cmd.Process.Signal(unix.SIGTERM))
+	require.NoError(t, waitPidfd(context.Background(), pidfd))
+	_ = cmd.Wait()
+}
+
+func TestWatchMonitor(t *testing.T) {
+	c := &Container{ContainerConfig: &ContainerConfig{}}
+	// A container without monitor process has exited.
+	require.NoError(t, <-c.watchMonitor(context.Background()))
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+	c.Pid = cmd.Process.Pid
+
+	exited := c.watchMonitor(context.Background())
+	if exited == nil {
+		t.Skip("pidfd_open is not supported")
+	}
+	select {
+	case <-exited:
+		t.Fatal("monitor process exited unexpectedly")
+	case <-time.After(time.Millisecond * 20):
+	}
+	require.NoError(t, cmd.Process.Signal(unix.SIGTERM))
+	require.NoError(t, <-exited)
+	_ = cmd.Wait()
+}